@@ -0,0 +1,223 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+// isAutoindexPage reports whether doc is a server-generated directory
+// listing. Apache mod_autoindex, nginx, lighttpd, and Python's http.server
+// title the page "Index of /path" or "Directory listing for /path"; Go's
+// file server (used for file:// seeds) emits a bare <pre> of links.
+func isAutoindexPage(doc *goquery.Document) bool {
+	for _, selector := range []string{"title", "h1"} {
+		text := strings.ToLower(strings.TrimSpace(doc.Find(selector).First().Text()))
+		if strings.HasPrefix(text, "index of /") || strings.HasPrefix(text, "directory listing for /") {
+			return true
+		}
+	}
+
+	body := doc.Find("body")
+	return doc.Find("title").Length() == 0 &&
+		body.Children().Length() == 1 &&
+		body.Children().First().Is("pre") &&
+		body.Find("pre > a").Length() > 0
+}
+
+// autoindexEntry is a file or subdirectory shown in a directory listing.
+type autoindexEntry struct {
+	url  string
+	name string
+	dir  bool
+
+	// size and modified are what the listing shows, or -1 and the zero time
+	// when it shows nothing.
+	size     int64
+	modified time.Time
+}
+
+var (
+	// autoindexDatePattern finds the modification time in the columns after
+	// an entry: Apache's table (2024-03-01 12:30), Apache's and nginx's
+	// <pre> (01-Mar-2024 12:30), and lighttpd (2024-Mar-01 12:30:45).
+	autoindexDatePattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2} \d{2}:\d{2}(?::\d{2})?|\d{2}-[A-Za-z]{3}-\d{4} \d{2}:\d{2}(?::\d{2})?|\d{4}-[A-Za-z]{3}-\d{2} \d{2}:\d{2}(?::\d{2})?`)
+
+	autoindexDateLayouts = []string{
+		"2006-01-02 15:04", "2006-01-02 15:04:05",
+		"02-Jan-2006 15:04", "02-Jan-2006 15:04:05",
+		"2006-Jan-02 15:04", "2006-Jan-02 15:04:05",
+	}
+
+	// autoindexSizePattern matches a size column: bytes as nginx shows them,
+	// or the abbreviated 1.2K and 3.4M of Apache and lighttpd.
+	autoindexSizePattern = regexp.MustCompile(`(?i)^\d+(?:\.\d+)?[KMGT]?$`)
+)
+
+// autoindexEntries returns the entries of a directory listing. Links that
+// are not entries, such as column sort links and the parent directory, are
+// left out: only files and subdirectories below the listing are kept.
+func (c *Crawler) autoindexEntries(doc *goquery.Document, listingURL string) []autoindexEntry {
+	prefix := listingURL
+	if !strings.HasSuffix(prefix, "/") {
+		prefix = prefix[:strings.LastIndex(prefix, "/")+1]
+	}
+
+	var entries []autoindexEntry
+	seen := make(map[string]struct{})
+	doc.Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		// Column sort links (?C=N;O=D) point back at the listing itself.
+		if href == "" || strings.HasPrefix(href, "?") || strings.HasPrefix(href, "#") {
+			return
+		}
+
+		absolute := c.resolveURL(listingURL, href)
+		if absolute == "" || absolute == listingURL || !strings.HasPrefix(absolute, prefix) {
+			return
+		}
+		if _, exists := seen[absolute]; exists {
+			return
+		}
+		seen[absolute] = struct{}{}
+
+		entry := autoindexEntry{
+			url:  absolute,
+			name: strings.TrimSpace(sel.Text()),
+			dir:  strings.HasSuffix(strings.SplitN(href, "?", 2)[0], "/"),
+			size: -1,
+		}
+		entry.modified, entry.size = parseAutoindexDetails(autoindexDetails(sel))
+		entries = append(entries, entry)
+	})
+	return entries
+}
+
+// autoindexDetails returns the text of the columns shown after an entry's
+// link: the following cells of its table row, or the rest of its line in a
+// <pre> listing.
+func autoindexDetails(link *goquery.Selection) string {
+	if cell := link.Closest("td"); cell.Length() > 0 {
+		var columns []string
+		cell.NextAll().Each(func(_ int, next *goquery.Selection) {
+			columns = append(columns, next.Text())
+		})
+		return strings.Join(columns, " ")
+	}
+
+	var text strings.Builder
+	for node := link.Nodes[0].NextSibling; node != nil && node.Type == html.TextNode; node = node.NextSibling {
+		line, _, ended := strings.Cut(node.Data, "\n")
+		text.WriteString(line)
+		if ended {
+			break
+		}
+	}
+	return text.String()
+}
+
+// parseAutoindexDetails reads the modification time and size from the
+// columns after an entry. Directories show "-" as their size.
+func parseAutoindexDetails(details string) (time.Time, int64) {
+	details = strings.Join(strings.Fields(details), " ")
+
+	var modified time.Time
+	if match := autoindexDatePattern.FindStringIndex(details); match != nil {
+		for _, layout := range autoindexDateLayouts {
+			if parsed, err := time.Parse(layout, details[match[0]:match[1]]); err == nil {
+				modified = parsed
+				break
+			}
+		}
+		details = details[:match[0]] + details[match[1]:]
+	}
+
+	size := int64(-1)
+	for _, field := range strings.Fields(details) {
+		if !autoindexSizePattern.MatchString(field) {
+			continue
+		}
+		if parsed, err := parseByteSize(field); err == nil {
+			size = int64(parsed)
+		}
+		break
+	}
+	return modified, size
+}
+
+// crawlAutoindex records the images in a directory listing and queues its
+// subdirectories, without following any other link on the page. The images
+// of a listing given as a seed, and of the listings below it, are taken
+// whether or not their names contain the keyword. Entries the listing shows
+// as larger than -max-file-size or older than -modified-since are skipped
+// without being downloaded.
+func (c *Crawler) crawlAutoindex(doc *goquery.Document, task CrawlTask, listingURL string) {
+	takeAll := c.underSeedListing(task.Depth, listingURL)
+	pageType := classifyPage(listingURL)
+
+	images, skipped, dirs := 0, 0, 0
+	for _, entry := range c.autoindexEntries(doc, listingURL) {
+		if entry.dir {
+			if c.shouldStopCrawling() || !c.shouldFollowLink(listingURL, entry.url) {
+				continue
+			}
+			if task.Depth+1 > c.config.linkDepthLimit(pageType, classifyPage(entry.url)) {
+				c.recordDeepLink(CrawlTask{URL: entry.url, Depth: task.Depth + 1})
+				continue
+			}
+			dirs++
+			c.enqueueTask(CrawlTask{URL: entry.url, Depth: task.Depth + 1})
+			continue
+		}
+
+		if !isImageURL(entry.url) {
+			continue
+		}
+		if reason := c.autoindexSkipReason(entry); reason != "" {
+			skipped++
+			logVerbose(c.config, "Skipping %s: %s", entry.url, reason)
+			continue
+		}
+		images++
+		if takeAll {
+			c.storeImageURL(entry.url)
+		} else {
+			c.acceptImageURL(entry.url, entry.name)
+		}
+	}
+
+	logVerbose(c.config, "Directory listing with %d image(s), %d skipped, %d subdirectories: %s", images, skipped, dirs, listingURL)
+}
+
+// autoindexSkipReason returns why the size or date a listing shows rules an
+// entry out, or "" to keep it.
+func (c *Crawler) autoindexSkipReason(entry autoindexEntry) string {
+	if limit := c.config.maxFileSizeBytes; limit > 0 && entry.size > int64(limit) {
+		return "listed as " + formatBytes(uint64(entry.size)) + ", over -max-file-size"
+	}
+	if since := c.config.modifiedSince; !since.IsZero() && !entry.modified.IsZero() && entry.modified.Before(since) {
+		return "last modified " + entry.modified.Format("2006-01-02") + ", before -modified-since"
+	}
+	return ""
+}
+
+// underSeedListing reports whether a listing is a seed or lies below a
+// listing that was one, recording seed listings as they are crawled.
+func (c *Crawler) underSeedListing(depth int, listingURL string) bool {
+	c.listingMutex.Lock()
+	defer c.listingMutex.Unlock()
+
+	if depth == 0 {
+		c.seedListings = append(c.seedListings, listingURL)
+		return true
+	}
+	for _, seed := range c.seedListings {
+		if strings.HasPrefix(listingURL, seed) {
+			return true
+		}
+	}
+	return false
+}
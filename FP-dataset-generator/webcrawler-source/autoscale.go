@@ -0,0 +1,136 @@
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	autoscaleInitialWorkers = 2
+	autoscaleInterval       = 2 * time.Second
+
+	// A window with more errors than autoscaleMaxErrorRate, CPU above
+	// autoscaleMaxCPU, or latency beyond autoscaleSlowdown times the
+	// baseline shrinks the pool; a healthy window with queued work grows it.
+	autoscaleMaxErrorRate = 0.20
+	autoscaleMaxCPU       = 0.85
+	autoscaleSlowdown     = 1.5
+	autoscaleGrowErrors   = 0.05
+	autoscaleGrowCPU      = 0.60
+	autoscaleGrowLatency  = 1.2
+)
+
+// autoscaleCeiling is the largest pool -concurrency auto will grow to,
+// within the open file limit.
+func (cfg *Config) autoscaleCeiling() int {
+	ceiling := min(max(16, 4*runtime.NumCPU()), 64)
+	if cfg.maxCrawlWorkers > 0 {
+		ceiling = min(ceiling, cfg.maxCrawlWorkers)
+	}
+	return ceiling
+}
+
+// fetchStats accumulates page fetch outcomes between autoscaler windows.
+type fetchStats struct {
+	fetches      atomic.Int64
+	errors       atomic.Int64
+	latencyNanos atomic.Int64
+}
+
+func (s *fetchStats) record(latency time.Duration, failed bool) {
+	s.fetches.Add(1)
+	s.latencyNanos.Add(int64(latency))
+	if failed {
+		s.errors.Add(1)
+	}
+}
+
+// reset returns the window's totals and starts a new window.
+func (s *fetchStats) reset() (fetches, errors int64, avgLatency time.Duration) {
+	fetches = s.fetches.Swap(0)
+	errors = s.errors.Swap(0)
+	latency := s.latencyNanos.Swap(0)
+	if fetches > 0 {
+		avgLatency = time.Duration(latency / fetches)
+	}
+	return fetches, errors, avgLatency
+}
+
+// workerPool tracks how many crawl workers run and how many should.
+type workerPool struct {
+	mu      sync.Mutex
+	active  int
+	target  int
+	closing bool
+}
+
+// retire reports whether the calling worker should exit because the pool
+// is larger than its target. The last worker never retires, so the pool
+// stays alive until the task channel is closed.
+func (p *workerPool) retire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.active > p.target && p.active > 1 {
+		p.active--
+		return true
+	}
+	return false
+}
+
+// autoscale adjusts the worker pool every autoscaleInterval from observed
+// fetch latency, error rate, and process CPU usage, until done is closed.
+func (c *Crawler) autoscale(done <-chan struct{}) {
+	ticker := time.NewTicker(autoscaleInterval)
+	defer ticker.Stop()
+
+	ceiling := c.config.autoscaleCeiling()
+	var baseline time.Duration
+	cpu := newCPUSampler()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+		}
+
+		fetches, errors, latency := c.fetchStats.reset()
+		usage := cpu.sample()
+		if fetches == 0 {
+			continue
+		}
+
+		errorRate := float64(errors) / float64(fetches)
+		if baseline == 0 || latency < baseline {
+			baseline = latency
+		}
+		slowdown := float64(latency) / float64(baseline)
+
+		c.pool.mu.Lock()
+		target := c.pool.target
+		switch {
+		case errorRate > autoscaleMaxErrorRate || usage > autoscaleMaxCPU || slowdown > autoscaleSlowdown:
+			target = max(target-1, 1)
+		case errorRate < autoscaleGrowErrors && usage < autoscaleGrowCPU && slowdown <= autoscaleGrowLatency && len(c.taskCh) > 0:
+			target = min(target+1, ceiling)
+		}
+
+		if target != c.pool.target {
+			logVerbose(c.config, "Autoscale: %d -> %d workers (latency %s, errors %.0f%%, cpu %.0f%%)",
+				c.pool.target, target, latency.Round(time.Millisecond), errorRate*100, usage*100)
+			c.pool.target = target
+		}
+
+		for !c.pool.closing && c.pool.active < c.pool.target {
+			c.pool.active++
+			c.wg.Add(1)
+			go c.worker()
+		}
+		c.pool.mu.Unlock()
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	_ "embed"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// defaultAdBlocklist lists well-known ad and tracker domains, blocked with
+// -block-ads.
+//
+//go:embed adblock.txt
+var defaultAdBlocklist string
+
+// domainSet holds blocked domains. A domain in the set blocks its
+// subdomains too.
+type domainSet map[string]struct{}
+
+func (s domainSet) add(domains ...string) {
+	for _, domain := range normalizeDomains(domains) {
+		s[domain] = struct{}{}
+	}
+}
+
+// matches reports whether the host of raw is in the set or below a domain
+// that is.
+func (s domainSet) matches(raw string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for host != "" {
+		if _, ok := s[host]; ok {
+			return true
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return false
+}
+
+// parseBlocklist reads the domains of a blocklist, one rule per line, in
+// any of these formats:
+//
+//	ads.example.com              a plain domain
+//	0.0.0.0 ads.example.com      a hosts file entry
+//	||ads.example.com^$third-party  an EasyList domain rule
+//
+// Comments (# and !), EasyList exceptions (@@), element hiding rules, and
+// rules narrower than a whole domain are skipped.
+func parseBlocklist(text string) []string {
+	var domains []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "!") || strings.HasPrefix(line, "[") {
+			continue
+		}
+
+		if rule, ok := strings.CutPrefix(line, "||"); ok {
+			rule, _, _ = strings.Cut(rule, "$")
+			rule = strings.TrimSuffix(rule, "^")
+			if isBlocklistDomain(rule) {
+				domains = append(domains, rule)
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "@@") || strings.Contains(line, "##") || strings.Contains(line, "#@#") {
+			continue
+		}
+
+		line, _, _ = strings.Cut(line, "#")
+		fields := strings.Fields(line)
+		if len(fields) > 1 && net.ParseIP(fields[0]) != nil {
+			fields = fields[1:]
+		} else if len(fields) != 1 {
+			continue
+		}
+		for _, field := range fields {
+			if isBlocklistDomain(field) && field != "localhost" && !strings.HasPrefix(field, "localhost.") {
+				domains = append(domains, field)
+			}
+		}
+	}
+	return domains
+}
+
+// isBlocklistDomain reports whether a blocklist entry is a bare domain name
+// rather than an address, a path, or a pattern.
+func isBlocklistDomain(entry string) bool {
+	if entry == "" || !strings.Contains(entry, ".") || net.ParseIP(entry) != nil {
+		return false
+	}
+	return !strings.ContainsAny(entry, "/*?|^:=,@ ")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// stripParams holds the query parameters given with -strip-params, which
+// canonicalizeImageURL drops on top of redundantImageQueryParams.
+var stripParams map[string]struct{}
+
+// SetStripParams sets the extra query parameters dropped from image URLs
+// before they are compared.
+func SetStripParams(params []string) {
+	stripParams = make(map[string]struct{}, len(params))
+	for _, param := range params {
+		stripParams[strings.ToLower(param)] = struct{}{}
+	}
+}
+
+// isStrippedParam reports whether a query parameter makes no difference to
+// the image an URL serves.
+func isStrippedParam(key string) bool {
+	if _, ok := redundantImageQueryParams[key]; ok {
+		return true
+	}
+	_, ok := stripParams[strings.ToLower(key)]
+	return ok
+}
+
+// learnedParamConfirmations is how many different pairs of URLs must show a
+// parameter changing without the content changing before it is stripped on
+// its host. A single pair can be a coincidence, such as two IDs that both
+// serve a placeholder.
+const learnedParamConfirmations = 2
+
+// paramLearner learns the cache-busting query parameters of each host from
+// the downloads of a run. Two URLs that differ only in their query are
+// saved under the same name, so the second is normally skipped; while a
+// differing parameter is still unknown, the downloader fetches the second
+// anyway and compares the content. Parameters that changed nothing are
+// counted, and the crawler stops telling URLs apart by them once they are
+// confirmed. A parameter that changed the content is not probed again.
+type paramLearner struct {
+	mu          sync.Mutex
+	byFile      map[string]string // stored file to the URL it came from
+	counts      map[string]map[string]int
+	learned     map[string]map[string]struct{}
+	significant map[string]map[string]struct{}
+}
+
+var learnedParams = &paramLearner{
+	byFile:      make(map[string]string),
+	counts:      make(map[string]map[string]int),
+	learned:     make(map[string]map[string]struct{}),
+	significant: make(map[string]map[string]struct{}),
+}
+
+// stored records the URL a file was stored from.
+func (l *paramLearner) stored(file, imageURL string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, exists := l.byFile[file]; !exists {
+		l.byFile[file] = imageURL
+	}
+}
+
+// probe returns the URL file was stored from when imageURL differs from it
+// only in query parameters, one of them not yet learned or found
+// significant, so comparing their content can teach something. It returns
+// "" otherwise.
+func (l *paramLearner) probe(file, imageURL string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	prior := l.byFile[file]
+	if prior == "" || prior == imageURL {
+		return ""
+	}
+	host, params := differingParams(prior, imageURL)
+	for _, param := range params {
+		_, learned := l.learned[host][param]
+		_, significant := l.significant[host][param]
+		if !learned && !significant {
+			return prior
+		}
+	}
+	return ""
+}
+
+// compare records whether two URLs differing in their query served the
+// same content.
+func (l *paramLearner) compare(prior, imageURL string, same bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	host, params := differingParams(prior, imageURL)
+	for _, param := range params {
+		if !same {
+			addHostParam(l.significant, host, param)
+			continue
+		}
+		if l.counts[host] == nil {
+			l.counts[host] = make(map[string]int)
+		}
+		l.counts[host][param]++
+		if l.counts[host][param] == learnedParamConfirmations {
+			addHostParam(l.learned, host, param)
+			logInfo("Learned cache-busting parameter %q for %s", param, host)
+		}
+	}
+}
+
+func addHostParam(byHost map[string]map[string]struct{}, host, param string) {
+	if byHost[host] == nil {
+		byHost[host] = make(map[string]struct{})
+	}
+	byHost[host][param] = struct{}{}
+}
+
+// strip removes the parameters learned for its host from a canonical image
+// URL.
+func (l *paramLearner) strip(canonical string) string {
+	parsed, err := url.Parse(canonical)
+	if err != nil || parsed.RawQuery == "" {
+		return canonical
+	}
+
+	l.mu.Lock()
+	learned := l.learned[strings.ToLower(parsed.Host)]
+	l.mu.Unlock()
+	if len(learned) == 0 {
+		return canonical
+	}
+
+	query := parsed.Query()
+	for param := range learned {
+		query.Del(param)
+	}
+	parsed.RawQuery = query.Encode()
+	return parsed.String()
+}
+
+// probeParams downloads imageURL, which would be saved as the existing
+// file stored from prior, and tells learnedParams whether the content is
+// the same.
+func (d *Downloader) probeParams(prior, imageURL, file string) {
+	probe, err := os.CreateTemp(d.config.OutputDir, file+".*"+partFileSuffix)
+	if err != nil {
+		return
+	}
+	probe.Close()
+	defer os.Remove(probe.Name())
+
+	if _, err := d.fetch(imageURL, probe.Name()); err != nil {
+		logVerbose(d.config, "Could not compare %s with %s: %v", imageURL, prior, err)
+		return
+	}
+	got, err := hashFile(probe.Name())
+	if err != nil {
+		return
+	}
+	existing, err := hashFile(filepath.Join(d.config.OutputDir, file))
+	if err != nil {
+		return
+	}
+	learnedParams.compare(prior, imageURL, got == existing)
+}
+
+// differingParams returns the host of two URLs and the query parameters
+// that differ between them, or no parameters when the URLs differ in more
+// than their query.
+func differingParams(a, b string) (string, []string) {
+	ua, err := url.Parse(a)
+	if err != nil {
+		return "", nil
+	}
+	ub, err := url.Parse(b)
+	if err != nil {
+		return "", nil
+	}
+	host := strings.ToLower(ua.Host)
+	if host != strings.ToLower(ub.Host) || ua.Path != ub.Path {
+		return "", nil
+	}
+
+	qa, qb := ua.Query(), ub.Query()
+	var params []string
+	for key, values := range qa {
+		if !slices.Equal(values, qb[key]) {
+			params = append(params, key)
+		}
+	}
+	for key := range qb {
+		if _, ok := qa[key]; !ok {
+			params = append(params, key)
+		}
+	}
+	sort.Strings(params)
+	return host, params
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// defaultDatasetDir is the output directory of a crawl with several
+// keywords when -output is not given.
+const defaultDatasetDir = "dataset"
+
+// A crawl with several keywords, given as -keyword "dog,cat,horse" or in a
+// -keywords-file, builds a dataset with one class per keyword: each class
+// is crawled in turn into a subdirectory of the output directory named after
+// it, the layout classifier training tools expect.
+
+// hasKeywordClasses reports whether the configuration asks for more than
+// one keyword, before the keywords file is read.
+func hasKeywordClasses(cfg *Config) bool {
+	return cfg.KeywordsFile != "" || strings.Contains(cfg.Keyword, ",")
+}
+
+// parseKeywordClasses returns the keywords of -keyword and -keywords-file,
+// in order and without duplicates. The file holds one keyword per line;
+// blank lines and lines starting with # are skipped.
+func parseKeywordClasses(cfg *Config) ([]string, error) {
+	classes := splitCSV(cfg.Keyword)
+
+	if cfg.KeywordsFile != "" {
+		lines, err := readListFile(cfg.KeywordsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keywords file: %w", err)
+		}
+		classes = append(classes, lines...)
+	}
+
+	seen := make(map[string]struct{}, len(classes))
+	unique := classes[:0]
+	for _, class := range classes {
+		key := strings.ToLower(class)
+		if _, exists := seen[key]; exists {
+			continue
+		}
+		seen[key] = struct{}{}
+		unique = append(unique, class)
+	}
+	return unique, nil
+}
+
+// classDir returns the subdirectory of the output directory a class is
+// crawled into.
+func classDir(cfg *Config, class string) string {
+	dirName := sanitizeFilename(class)
+	if dirName == "" {
+		dirName = class
+	}
+	return filepath.Join(cfg.OutputDir, dirName)
+}
+
+// classFile returns the file of a class named after path, so each class
+// writes its own, e.g. urls_cats.txt for urls.txt.
+func classFile(path, classDir string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "_" + filepath.Base(classDir) + ext
+}
+
+// forEachClass runs fn once per keyword class, with the keyword and output
+// directory of the class, or just once for a crawl of a single keyword.
+func forEachClass(cfg *Config, fn func(cfg *Config) error) error {
+	if cfg.classes == nil {
+		return fn(cfg)
+	}
+
+	for i, class := range cfg.classes {
+		fmt.Printf("\n=== Class %d/%d: %s ===\n\n", i+1, len(cfg.classes), class)
+
+		classCfg := *cfg
+		classCfg.Keyword = class
+		classCfg.OutputDir = classDir(cfg, class)
+		classCfg.KeywordsFile = ""
+		classCfg.classes = nil
+		if cfg.URLListFile != "" {
+			classCfg.URLListFile = classFile(cfg.URLListFile, classCfg.OutputDir)
+		}
+		if cfg.ExportURLs != "" {
+			classCfg.ExportURLs = classFile(cfg.ExportURLs, classCfg.OutputDir)
+		}
+		if err := fn(&classCfg); err != nil {
+			return fmt.Errorf("class %s: %w", class, err)
+		}
+
+		// The downloader detected for the first class serves the rest.
+		cfg.Downloader = classCfg.Downloader
+	}
+
+	fmt.Printf("\n✓ %d class(es) done in %s\n", len(cfg.classes), cfg.OutputDir)
+	return nil
+}
+
+// forEachCrawledClass runs fn once per keyword class with the crawl state
+// load reads for it, or once for a single keyword, for the commands that
+// continue or inspect an earlier crawl. The configuration is validated and
+// printed first. A single keyword may be taken from its crawl state, so
+// that state is loaded before.
+func forEachCrawledClass(cfg *Config, load func(cfg *Config) (*CrawlState, error), fn func(cfg *Config, state *CrawlState) error) error {
+	if !hasKeywordClasses(cfg) {
+		state, err := load(cfg)
+		if err != nil {
+			return err
+		}
+		if err := validateConfig(cfg); err != nil {
+			return configError(err)
+		}
+		printBanner()
+		printConfig(cfg)
+		return fn(cfg, state)
+	}
+
+	if err := validateConfig(cfg); err != nil {
+		return configError(err)
+	}
+	printBanner()
+	printConfig(cfg)
+	return forEachClass(cfg, func(cfg *Config) error {
+		state, err := load(cfg)
+		if err != nil {
+			return err
+		}
+		return fn(cfg, state)
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseKeywordClasses(t *testing.T) {
+	tests := []struct {
+		name    string
+		keyword string
+		file    string
+		want    []string
+	}{
+		{name: "single keyword", keyword: "cats", want: []string{"cats"}},
+		{name: "comma separated", keyword: "cats, dogs ,birds", want: []string{"cats", "dogs", "birds"}},
+		{name: "duplicates ignore case", keyword: "Cats,cats,DOGS,dogs", want: []string{"Cats", "DOGS"}},
+		{name: "keywords file", file: "# animals\ncats\n\n  dogs  \n", want: []string{"cats", "dogs"}},
+		{name: "keyword and file merged", keyword: "cats", file: "CATS\nbirds\n", want: []string{"cats", "birds"}},
+		{name: "nothing given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{Keyword: tt.keyword}
+			if tt.file != "" {
+				cfg.KeywordsFile = filepath.Join(t.TempDir(), "keywords.txt")
+				if err := os.WriteFile(cfg.KeywordsFile, []byte(tt.file), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := parseKeywordClasses(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("parseKeywordClasses() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKeywordClassesMissingFile(t *testing.T) {
+	cfg := &Config{KeywordsFile: filepath.Join(t.TempDir(), "missing.txt")}
+	if _, err := parseKeywordClasses(cfg); err == nil {
+		t.Error("parseKeywordClasses() = nil error, want an error for a missing keywords file")
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	styleUnknown      = "unknown"
+	stylePhoto        = "photo"
+	styleIllustration = "illustration"
+
+	// styleSampleGrid is the maximum number of samples taken along each axis
+	// when classifying an image. Sampling keeps large photos cheap to inspect.
+	styleSampleGrid = 128
+)
+
+// classifyImageStyle guesses whether the image at imagePath is a photograph
+// or a flat-color illustration (clipart, vector art, logos, diagrams).
+//
+// Photographs contain sensor noise and smooth gradients, so even a coarse
+// sample grid yields many distinct colors and few identical neighbours.
+// Illustrations are dominated by large areas of a single flat color and use
+// a small palette. SVG files are always treated as illustrations.
+func classifyImageStyle(imagePath, mimeType string) (string, error) {
+	if mimeType == "image/svg+xml" {
+		return styleIllustration, nil
+	}
+
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return styleUnknown, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width < 2 || height < 2 {
+		return styleUnknown, fmt.Errorf("image too small to classify: %dx%d", width, height)
+	}
+
+	stepX := max(width/styleSampleGrid, 1)
+	stepY := max(height/styleSampleGrid, 1)
+
+	palette := make(map[uint32]struct{}, 1024)
+	samples := 0
+	flatNeighbours := 0
+	comparisons := 0
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		var previous uint32
+		hasPrevious := false
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			// Quantize to 5 bits per channel so JPEG noise on flat areas
+			// does not inflate the palette.
+			color := (r>>11)<<10 | (g>>11)<<5 | (b >> 11)
+			palette[color] = struct{}{}
+			samples++
+
+			if hasPrevious {
+				comparisons++
+				if color == previous {
+					flatNeighbours++
+				}
+			}
+			previous = color
+			hasPrevious = true
+		}
+	}
+
+	if samples == 0 || comparisons == 0 {
+		return styleUnknown, fmt.Errorf("no pixels sampled")
+	}
+
+	paletteRatio := float64(len(palette)) / float64(samples)
+	flatRatio := float64(flatNeighbours) / float64(comparisons)
+
+	if len(palette) <= 64 || (flatRatio >= 0.5 && paletteRatio <= 0.1) {
+		return styleIllustration, nil
+	}
+
+	return stylePhoto, nil
+}
+
+// decodeImageFile opens and decodes an image using the registered decoders.
+func decodeImageFile(imagePath string) (image.Image, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode failed: %w", err)
+	}
+	return img, nil
+}
+
+// wantedImageStyle returns the style required by the configuration, or an
+// empty string when no style filter is active.
+func wantedImageStyle(cfg *Config) string {
+	switch {
+	case cfg.PhotoOnly:
+		return stylePhoto
+	case cfg.IllustrationOnly:
+		return styleIllustration
+	default:
+		return ""
+	}
+}
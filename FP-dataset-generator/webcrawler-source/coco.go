@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// export -format coco packages the downloaded images as a COCO dataset, the
+// JSON annotation tools such as CVAT and Label Studio import: the images
+// with their sizes, licenses, and source URLs, one category per keyword
+// class, and no annotations, or with -coco-whole-image one box covering
+// each image labelled with its class.
+
+type cocoDataset struct {
+	Info        cocoInfo         `json:"info"`
+	Licenses    []cocoLicense    `json:"licenses"`
+	Images      []cocoImage      `json:"images"`
+	Annotations []cocoAnnotation `json:"annotations"`
+	Categories  []cocoCategory   `json:"categories"`
+}
+
+type cocoInfo struct {
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	Year        int    `json:"year"`
+	DateCreated string `json:"date_created"`
+}
+
+type cocoLicense struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url,omitempty"`
+}
+
+type cocoImage struct {
+	ID       int    `json:"id"`
+	FileName string `json:"file_name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	License  int    `json:"license"`
+	COCOURL  string `json:"coco_url"`
+}
+
+type cocoAnnotation struct {
+	ID         int        `json:"id"`
+	ImageID    int        `json:"image_id"`
+	CategoryID int        `json:"category_id"`
+	BBox       [4]float64 `json:"bbox"`
+	Area       float64    `json:"area"`
+	IsCrowd    int        `json:"iscrowd"`
+}
+
+type cocoCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// datasetClass is a keyword class of a dataset: its output directory, and
+// the directory its file names are relative to the dataset from.
+type datasetClass struct {
+	name      string
+	outputDir string
+	prefix    string
+}
+
+// datasetClasses returns the classes of the configuration's dataset: each
+// class of a crawl with several keywords, in its subdirectory, or the one
+// keyword.
+func datasetClasses(cfg *Config) ([]datasetClass, error) {
+	if !hasKeywordClasses(cfg) {
+		if _, err := loadStateForConfig(cfg); err != nil {
+			return nil, err
+		}
+		return []datasetClass{{name: cfg.Keyword, outputDir: cfg.OutputDir}}, nil
+	}
+
+	keywords, err := parseKeywordClasses(cfg)
+	if err != nil {
+		return nil, configError(err)
+	}
+	classes := make([]datasetClass, len(keywords))
+	for i, keyword := range keywords {
+		dir := classDir(cfg, keyword)
+		classes[i] = datasetClass{name: keyword, outputDir: dir, prefix: filepath.Base(dir)}
+	}
+	return classes, nil
+}
+
+// buildCOCODataset collects the downloaded images of each class into a COCO
+// dataset. With wholeImage, each image gets an annotation of its class
+// covering all of it.
+func buildCOCODataset(cfg *Config, wholeImage bool) (*cocoDataset, error) {
+	classes, err := datasetClasses(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dataset := &cocoDataset{
+		Info: cocoInfo{
+			Version:     version,
+			Year:        now.Year(),
+			DateCreated: now.Format("2006/01/02"),
+		},
+		Licenses:    []cocoLicense{},
+		Images:      []cocoImage{},
+		Annotations: []cocoAnnotation{},
+	}
+	licenseIDs := make(map[string]int)
+	var names []string
+
+	for _, class := range classes {
+		state, err := loadState(class.outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", class.name, err)
+		}
+		categoryID := len(dataset.Categories) + 1
+		dataset.Categories = append(dataset.Categories, cocoCategory{ID: categoryID, Name: class.name})
+		names = append(names, class.name)
+
+		entries, indexes := storedEntries(class.outputDir, state)
+		for i, entry := range entries {
+			image := cocoImage{
+				ID:       len(dataset.Images) + 1,
+				FileName: filepath.ToSlash(filepath.Join(class.prefix, entry.Path)),
+				Width:    entry.Width,
+				Height:   entry.Height,
+				COCOURL:  entry.URL,
+			}
+			if attribution := state.Images[indexes[i]].Attribution; attribution != nil && attribution.License != "" {
+				id, known := licenseIDs[attribution.License]
+				if !known {
+					id = len(dataset.Licenses) + 1
+					licenseIDs[attribution.License] = id
+					dataset.Licenses = append(dataset.Licenses, cocoLicense{ID: id, Name: attribution.License, URL: attribution.LicenseURL})
+				}
+				image.License = id
+			}
+			dataset.Images = append(dataset.Images, image)
+
+			if wholeImage && image.Width > 0 && image.Height > 0 {
+				dataset.Annotations = append(dataset.Annotations, cocoAnnotation{
+					ID:         len(dataset.Annotations) + 1,
+					ImageID:    image.ID,
+					CategoryID: categoryID,
+					BBox:       [4]float64{0, 0, float64(image.Width), float64(image.Height)},
+					Area:       float64(image.Width * image.Height),
+				})
+			}
+		}
+	}
+	dataset.Info.Description = "Images of " + strings.Join(names, ", ")
+	return dataset, nil
+}
@@ -0,0 +1,734 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultCommand = "run"
+
+// command is a CLI subcommand. Each command parses its own arguments.
+type command struct {
+	name string
+	run  func(args []string) error
+}
+
+var commands = []command{
+	{name: "run", run: runCommand},
+	{name: "crawl", run: crawlCommand},
+	{name: "download", run: downloadCommand},
+	{name: "resume", run: resumeCommand},
+	{name: "retry-failed", run: retryFailedCommand},
+	{name: "refresh", run: refreshCommand},
+	{name: "check-links", run: checkLinksCommand},
+	{name: "enrich", run: enrichCommand},
+	{name: "export", run: exportCommand},
+	{name: "sample", run: sampleCommand},
+	{name: "stats", run: statsCommand},
+	{name: "serve-preview", run: servePreviewCommand},
+	{name: "sites", run: sitesCommand},
+	{name: "control", run: controlCommand},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
+
+// runCommand crawls and downloads in one go. It is the default command, so
+// invocations without a command name behave as they always have.
+func runCommand(args []string) error {
+	cfg := parseFlags("run", args, nil)
+	if err := validateConfig(cfg); err != nil {
+		return configError(err)
+	}
+
+	printBanner()
+	printConfig(cfg)
+
+	if err := forEachClass(cfg, runKeyword); err != nil {
+		return err
+	}
+	return checkClassConflicts(cfg)
+}
+
+// runKeyword crawls and downloads the images of one keyword.
+func runKeyword(cfg *Config) error {
+	if err := prepareOutput(cfg); err != nil {
+		return err
+	}
+	if !cfg.DryRun {
+		if err := prepareDownloader(cfg); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+
+	state := newCrawlState(cfg)
+	if cfg.DryRun {
+		if err := crawlPhase(cfg, state, nil); err != nil {
+			return err
+		}
+		return writeURLList(cfg, state)
+	}
+	if err := crawlAndDownloadPhase(cfg, state); err != nil {
+		return err
+	}
+
+	fmt.Println("\n✓ Crawling completed successfully!")
+	return nil
+}
+
+// crawlCommand discovers image URLs and records them in the crawl state
+// without downloading anything.
+func crawlCommand(args []string) error {
+	cfg := parseFlags("crawl", args, nil)
+	if err := validateConfig(cfg); err != nil {
+		return configError(err)
+	}
+
+	printBanner()
+	printConfig(cfg)
+
+	return forEachClass(cfg, crawlKeyword)
+}
+
+// crawlKeyword records the image URLs of one keyword in its crawl state.
+func crawlKeyword(cfg *Config) error {
+	if err := prepareOutput(cfg); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	state := newCrawlState(cfg)
+	if err := crawlPhase(cfg, state, nil); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n✓ Crawl state saved to %s\n", statePath(cfg.OutputDir))
+	fmt.Println("  Run the download command with the same output directory to fetch the images.")
+	return nil
+}
+
+// downloadCommand downloads the pending images recorded by an earlier crawl.
+func downloadCommand(args []string) error {
+	cfg := parseFlags("download", args, nil)
+	return forEachCrawledClass(cfg, loadStateForConfig, downloadClass)
+}
+
+// downloadClass downloads the pending images of one keyword.
+func downloadClass(cfg *Config, state *CrawlState) error {
+	requeueRelaxedFilters(cfg, state)
+
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
+
+	if err := prepareDownloader(cfg); err != nil {
+		return err
+	}
+
+	if err := downloadPhase(cfg, state); err != nil {
+		return err
+	}
+
+	fmt.Println("\n✓ Download completed successfully!")
+	return nil
+}
+
+// resumeCommand continues an unfinished crawl from its saved frontier and
+// then downloads every image that is still pending. With -resume-downloads
+// it resumes the downloads only.
+func resumeCommand(args []string) error {
+	var downloadsOnly bool
+	cfg := parseFlags("resume", args, func(fs *flag.FlagSet) {
+		fs.BoolVar(&downloadsOnly, "resume-downloads", false, "Skip the crawl; verify downloaded files and download the rest")
+	})
+	if downloadsOnly {
+		if cfg.DryRun {
+			return configError(fmt.Errorf("-resume-downloads cannot be combined with -dry-run"))
+		}
+		return forEachCrawledClass(cfg, loadDownloadState, resumeDownloads)
+	}
+	return forEachCrawledClass(cfg, loadStateForConfig, resumeClass)
+}
+
+// resumeClass continues the crawl and downloads of one keyword.
+func resumeClass(cfg *Config, state *CrawlState) error {
+	requeueRelaxedFilters(cfg, state)
+
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
+
+	if !cfg.DryRun {
+		if err := prepareDownloader(cfg); err != nil {
+			return err
+		}
+	}
+	fmt.Println()
+
+	if !state.CrawlDone && state.PagesCrawled >= cfg.MaxPages {
+		logWarning("Page budget already used (%d/%d); raise -max-pages to crawl further", state.PagesCrawled, cfg.MaxPages)
+	}
+	if !state.CrawlDone && cfg.MaxImages > 0 && len(state.Images) >= cfg.MaxImages {
+		logWarning("Image budget already reached (%d/%d); raise -max-images to crawl further", len(state.Images), cfg.MaxImages)
+	}
+
+	switch {
+	case state.CrawlDone && cfg.DryRun:
+		logInfo("Crawl already complete")
+		return writeURLList(cfg, state)
+	case state.CrawlDone:
+		logInfo("Crawl already complete, resuming downloads only")
+		if err := downloadPhase(cfg, state); err != nil {
+			return err
+		}
+	case cfg.DryRun:
+		if err := crawlPhase(cfg, state, nil); err != nil {
+			return err
+		}
+		return writeURLList(cfg, state)
+	default:
+		if err := crawlAndDownloadPhase(cfg, state); err != nil {
+			return err
+		}
+	}
+
+	fmt.Println("\n✓ Resume completed successfully!")
+	return nil
+}
+
+// retryFailedCommand re-attempts the downloads listed in the failures file,
+// waiting between rounds with exponential backoff.
+func retryFailedCommand(args []string) error {
+	var (
+		retries = 3
+		backoff = 5 * time.Second
+	)
+	cfg := parseFlags("retry-failed", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&retries, "retries", retries, "Number of retry rounds")
+		fs.DurationVar(&backoff, "backoff", backoff, "Wait before the second round, doubled after each round")
+	})
+	if retries < 1 {
+		return configError(fmt.Errorf("retries must be at least 1"))
+	}
+	if backoff < 0 {
+		return configError(fmt.Errorf("backoff cannot be negative"))
+	}
+
+	return forEachCrawledClass(cfg, loadStateForConfig, func(cfg *Config, state *CrawlState) error {
+		return retryFailedClass(cfg, state, retries, backoff)
+	})
+}
+
+// retryFailedClass re-attempts the failed downloads of one keyword.
+func retryFailedClass(cfg *Config, state *CrawlState, retries int, backoff time.Duration) error {
+	urls, err := loadFailures(cfg.OutputDir)
+	if err != nil {
+		return err
+	}
+	if len(urls) == 0 {
+		logInfo("No failed downloads recorded in %s", failuresPath(cfg.OutputDir))
+		return nil
+	}
+	state.addImages(urls)
+
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
+
+	if err := prepareDownloader(cfg); err != nil {
+		return err
+	}
+
+	for round := 1; round <= retries && len(urls) > 0; round++ {
+		if round > 1 {
+			logInfo("%d download(s) still failing, retrying in %s", len(urls), backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+
+		fmt.Printf("\nRetry round %d/%d: %d URL(s)\n", round, retries, len(urls))
+		downloader := NewDownloader(cfg)
+		downloader.UseVariants(state.variantIndex())
+		if err := downloader.DownloadImages(urls); err != nil {
+			return fmt.Errorf("download failed: %w", err)
+		}
+
+		results := downloader.Results()
+		if err := saveDownloadResults(cfg, state, results); err != nil {
+			return err
+		}
+
+		remaining := urls[:0]
+		for _, imageURL := range urls {
+			if results[imageURL].Result == downloadFailed {
+				remaining = append(remaining, imageURL)
+			}
+		}
+		urls = remaining
+	}
+
+	if len(urls) > 0 {
+		logWarning("%d download(s) still failing; see %s", len(urls), failuresPath(cfg.OutputDir))
+		return nil
+	}
+
+	fmt.Println("\n✓ All failed downloads recovered!")
+	return nil
+}
+
+// refreshCommand re-validates the downloaded images against their sources
+// with conditional requests, replacing changed files and reporting link rot.
+func refreshCommand(args []string) error {
+	cfg := parseFlags("refresh", args, nil)
+	return forEachCrawledClass(cfg, loadStateForConfig, refreshClass)
+}
+
+// refreshClass re-validates the downloaded images of one keyword.
+func refreshClass(cfg *Config, state *CrawlState) error {
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
+
+	downloader := NewDownloader(cfg)
+	results := downloader.refreshImages(state)
+	if len(results) == 0 {
+		logInfo("No downloaded images to refresh")
+		return nil
+	}
+
+	if err := saveState(cfg.OutputDir, state); err != nil {
+		return err
+	}
+	reportPath, err := writeFreshnessReport(cfg.OutputDir, results)
+	if err != nil {
+		return err
+	}
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Result]++
+	}
+
+	fmt.Printf("\n\nRefresh complete:\n")
+	fmt.Printf("  Unchanged: %d\n", counts[freshnessUnchanged])
+	fmt.Printf("  Updated:   %d\n", counts[freshnessUpdated])
+	fmt.Printf("  Gone:      %d (link rot; local copies kept)\n", counts[freshnessGone])
+	fmt.Printf("  Errors:    %d\n", counts[freshnessError])
+	if counts[freshnessSkipped] > 0 {
+		fmt.Printf("  Skipped:   %d (not http/https)\n", counts[freshnessSkipped])
+	}
+	fmt.Printf("  Report:    %s\n", reportPath)
+	return nil
+}
+
+// checkLinksCommand checks that the source URL of every image in the crawl
+// state still answers, records the result in the state, and writes a
+// link-rot report. With -prune, dead URLs that were never downloaded are
+// dropped from the state.
+func checkLinksCommand(args []string) error {
+	var (
+		statuses string
+		prune    bool
+	)
+	cfg := parseFlags("check-links", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&statuses, "status", statuses, "Comma-separated image statuses to check (default: all)")
+		fs.BoolVar(&prune, "prune", prune, "Remove dead URLs that have no downloaded file from the state")
+	})
+	return forEachCrawledClass(cfg, loadStateForConfig, func(cfg *Config, state *CrawlState) error {
+		return checkLinksClass(cfg, state, statuses, prune)
+	})
+}
+
+// checkLinksClass checks the source URLs of one keyword's images.
+func checkLinksClass(cfg *Config, state *CrawlState, statuses string, prune bool) error {
+	wanted := make(map[string]struct{})
+	for _, status := range splitCSV(strings.ToLower(statuses)) {
+		wanted[status] = struct{}{}
+	}
+	var records []*ImageRecord
+	for i := range state.Images {
+		if _, ok := wanted[state.Images[i].Status]; ok || len(wanted) == 0 {
+			records = append(records, &state.Images[i])
+		}
+	}
+	if len(records) == 0 {
+		logInfo("No image URLs to check")
+		return nil
+	}
+
+	results := NewDownloader(cfg).checkLinks(records)
+
+	counts := make(map[string]int)
+	for _, result := range results {
+		counts[result.Result]++
+	}
+
+	pruned := 0
+	if prune {
+		pruned = pruneDeadLinks(state)
+	}
+	if err := saveState(cfg.OutputDir, state); err != nil {
+		return err
+	}
+	reportPath, err := writeLinkReport(cfg.OutputDir, results)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("\n\nLink check complete:\n")
+	fmt.Printf("  Alive:       %d\n", counts[linkAlive])
+	fmt.Printf("  Dead:        %d (404 or 410)\n", counts[linkDead])
+	fmt.Printf("  Unreachable: %d (errors that may be temporary)\n", counts[linkUnreachable])
+	if counts[linkUnchecked] > 0 {
+		fmt.Printf("  Unchecked:   %d (not http/https)\n", counts[linkUnchecked])
+	}
+	if prune {
+		fmt.Printf("  Pruned:      %d dead URL(s) without a downloaded file\n", pruned)
+	}
+	fmt.Printf("  Report:      %s\n", reportPath)
+	return nil
+}
+
+// enrichCommand looks the downloaded images without attribution up on
+// Wikimedia Commons and fills in the author, license, title, and depicted
+// subjects found there, then writes the manifests again.
+func enrichCommand(args []string) error {
+	cfg := parseFlags("enrich", args, nil)
+	return forEachCrawledClass(cfg, loadStateForConfig, enrichClass)
+}
+
+// enrichClass looks up the images of one keyword on Wikimedia Commons.
+func enrichClass(cfg *Config, state *CrawlState) error {
+	var records []*ImageRecord
+	for i := range state.Images {
+		record := &state.Images[i]
+		if record.Status == imageStatusDownloaded && record.File != "" && record.Attribution == nil {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		logInfo("No downloaded images without attribution to look up")
+		return nil
+	}
+
+	logInfo("Looking up %d image(s) on Wikimedia Commons", len(records))
+	found, missing, failed := enrichRecords(cfg, records)
+
+	if err := saveState(cfg.OutputDir, state); err != nil {
+		return err
+	}
+	if err := writeManifest(cfg.OutputDir, state, cfg.Manifest); err != nil {
+		return err
+	}
+
+	fmt.Printf("\n\nEnrichment complete:\n")
+	fmt.Printf("  Found:     %d (on Wikimedia Commons)\n", found)
+	fmt.Printf("  Not found: %d\n", missing)
+	if failed > 0 {
+		fmt.Printf("  Errors:    %d\n", failed)
+	}
+	return nil
+}
+
+// exportFormats are the formats export writes.
+var exportFormats = []string{"txt", "json", "csv", "coco", "yolo"}
+
+// exportCommand writes the image records from the crawl state as a plain URL
+// list, JSON, or CSV, or the downloaded images as a COCO or YOLO dataset.
+func exportCommand(args []string) error {
+	var (
+		format     = "txt"
+		outPath    = "-"
+		statuses   string
+		wholeImage bool
+		valSplit   = 0.2
+		seed       uint64
+	)
+	cfg := parseFlags("export", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", format, "Export format: txt, json, csv, coco, or yolo")
+		fs.StringVar(&outPath, "out", outPath, "File to write (- for stdout), or the directory of a yolo dataset")
+		fs.StringVar(&statuses, "status", statuses, "Comma-separated statuses to include (default: all)")
+		fs.BoolVar(&wholeImage, "coco-whole-image", wholeImage, "With -format coco, annotate each image with a box of its class covering all of it")
+		fs.Float64Var(&valSplit, "val-split", valSplit, "With -format yolo, the share of each class held out for validation")
+		fs.Uint64Var(&seed, "seed", seed, "With -format yolo, the random seed of the train/val split")
+	})
+
+	// Check the format before -out is created, which would truncate it.
+	format = strings.ToLower(format)
+	if !slices.Contains(exportFormats, format) {
+		return fmt.Errorf("unsupported export format %q (use txt, json, csv, coco, or yolo)", format)
+	}
+	if format == "yolo" {
+		exported, err := exportYOLO(cfg, outPath, valSplit, seed)
+		if err != nil {
+			return err
+		}
+		logSuccess("Exported %d image(s) as a YOLO dataset to %s", exported, outPath)
+		return nil
+	}
+	var (
+		records []ImageRecord
+		dataset *cocoDataset
+	)
+	if format == "coco" {
+		var err error
+		if dataset, err = buildCOCODataset(cfg, wholeImage); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if records, err = datasetRecords(cfg, splitCSV(statuses)); err != nil {
+			return err
+		}
+	}
+
+	var out io.Writer = os.Stdout
+	if outPath != "-" && outPath != "" {
+		file, err := os.Create(outPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", outPath, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	exported := len(records)
+	switch format {
+	case "txt":
+		for _, record := range records {
+			if _, err := fmt.Fprintln(out, record.URL); err != nil {
+				return err
+			}
+		}
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(records); err != nil {
+			return err
+		}
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write([]string{"url", "status", "file", "sha256", "error", "author", "license", "source_status", "checked_at", "party", "tags"})
+		for _, record := range records {
+			var author, sourceStatus, checkedAt string
+			license := record.License
+			if record.Attribution != nil {
+				author = record.Attribution.Author
+				if license == "" {
+					license = record.Attribution.License
+				}
+			}
+			if record.CheckedAt != nil {
+				sourceStatus = strconv.Itoa(record.SourceStatus)
+				checkedAt = record.CheckedAt.Format(time.RFC3339)
+			}
+			writer.Write([]string{record.URL, record.Status, record.File, record.SHA256, record.Error, author, license, sourceStatus, checkedAt, record.Party, strings.Join(record.Tags, ";")})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return err
+		}
+	case "coco":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(dataset); err != nil {
+			return err
+		}
+		exported = len(dataset.Images)
+	}
+
+	if out != os.Stdout {
+		logSuccess("Exported %d image(s) to %s", exported, outPath)
+	}
+	return nil
+}
+
+// statsCommand prints a summary of the crawl state.
+func statsCommand(args []string) error {
+	cfg := parseFlags("stats", args, nil)
+	if hasKeywordClasses(cfg) {
+		if err := validateConfig(cfg); err != nil {
+			return configError(err)
+		}
+	}
+	return forEachClass(cfg, printStats)
+}
+
+// printStats prints a summary of the crawl state of one keyword.
+func printStats(cfg *Config) error {
+	state, err := loadStateForConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	counts := state.statusCounts()
+
+	fmt.Printf("Crawl state: %s\n", statePath(cfg.OutputDir))
+	fmt.Printf("  Keyword:         %s\n", state.Keyword)
+	fmt.Printf("  Tool version:    %s\n", state.Version)
+	fmt.Printf("  Started:         %s\n", state.StartedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Updated:         %s\n", state.UpdatedAt.Local().Format("2006-01-02 15:04:05"))
+	fmt.Printf("  Crawl complete:  %t\n", state.CrawlDone)
+	fmt.Printf("  Pages crawled:   %d\n", state.PagesCrawled)
+	fmt.Printf("  Pages seen:      %d\n", len(state.SeenPages))
+	fmt.Printf("  Frontier:        %d\n", len(state.Frontier))
+	fmt.Printf("  Images found:    %d\n", len(state.Images))
+	for _, status := range []string{imageStatusDownloaded, imageStatusPending, imageStatusFailed, imageStatusFiltered, imageStatusDuplicate} {
+		fmt.Printf("    %-14s %d\n", status+":", counts[status])
+	}
+
+	parties := make(map[string]int)
+	tagged := 0
+	for _, record := range state.Images {
+		parties[record.Party]++
+		if len(record.Tags) > 0 {
+			tagged++
+		}
+	}
+	if parties[partyFirst] > 0 || parties[partyThird] > 0 {
+		fmt.Printf("  First-party:     %d\n", parties[partyFirst])
+		fmt.Printf("  Third-party:     %d\n", parties[partyThird])
+	}
+	if tagged > 0 {
+		fmt.Printf("  Tagged:          %d\n", tagged)
+	}
+	return nil
+}
+
+// servePreviewCommand serves a gallery of the output directory, which can
+// be watched while another process crawls into it.
+func servePreviewCommand(args []string) error {
+	addr := defaultPreviewAddr
+	cfg := parseFlags("serve-preview", args, func(fs *flag.FlagSet) {
+		fs.StringVar(&addr, "addr", addr, "Address the preview listens on, e.g. :8000 to share it on the network")
+	})
+	if cfg.OutputDir == "" {
+		return configError(fmt.Errorf("keyword or output directory is required (use -k or -o)"))
+	}
+	return servePreview(cfg.OutputDir, addr)
+}
+
+// sitesCommand lists the builtin sites and the search URL each one seeds.
+func sitesCommand(args []string) error {
+	parseFlags("sites", args, nil)
+
+	fmt.Println("Builtin sites:")
+	for _, site := range siteRegistry {
+		fmt.Printf("  %-12s %s\n", site.Name(), strings.Join(site.Seeds(&Config{}, keywordPlaceholder), " "))
+	}
+	return nil
+}
+
+// controlCommand sends a command to the crawl listening on -control and
+// prints its reply.
+func controlCommand(args []string) error {
+	var flags *flag.FlagSet
+	cfg := parseFlags("control", args, func(fs *flag.FlagSet) { flags = fs })
+	if cfg.Control == "" || flags.NArg() == 0 {
+		return configError(fmt.Errorf("usage: control -control <addr> pause|resume|set-rate <ms>|stop|status"))
+	}
+
+	reply, err := sendControl(cfg.Control, strings.Join(flags.Args(), " "))
+	if err != nil {
+		return err
+	}
+	if message, rejected := strings.CutPrefix(reply, "error: "); rejected {
+		return errors.New(message)
+	}
+	fmt.Println(reply)
+	return nil
+}
+
+// requeueRelaxedFilters queues again the images an earlier run filtered
+// out that pass the filters as configured now, such as a lower -min-width.
+func requeueRelaxedFilters(cfg *Config, state *CrawlState) {
+	if requeued := state.requeueFiltered(cfg); requeued > 0 {
+		logInfo("%d filtered image(s) pass the current filters and will be downloaded again", requeued)
+	}
+}
+
+// loadStateForConfig loads the crawl state from the configured output
+// directory. When no keyword was given it is taken from the state, so
+// commands that operate on an existing crawl only need -output.
+func loadStateForConfig(cfg *Config) (*CrawlState, error) {
+	if cfg.OutputDir == "" {
+		return nil, configError(fmt.Errorf("keyword or output directory is required (use -k or -o)"))
+	}
+
+	state, err := loadState(cfg.OutputDir)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Keyword == "" {
+		cfg.Keyword = state.Keyword
+	}
+	return state, nil
+}
+
+// datasetRecords returns the image records of each class of the dataset
+// whose status is listed, or all of them when no statuses are given. The
+// files of a class are given relative to the dataset's directory.
+func datasetRecords(cfg *Config, statuses []string) ([]ImageRecord, error) {
+	classes, err := datasetClasses(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []ImageRecord
+	for _, class := range classes {
+		state, err := loadState(class.outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", class.name, err)
+		}
+		for _, record := range filterRecords(state.Images, statuses) {
+			if record.File != "" && class.prefix != "" {
+				record.File = filepath.ToSlash(filepath.Join(class.prefix, record.File))
+			}
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// filterRecords keeps the records whose status is listed, or all records when
+// no statuses are given.
+func filterRecords(records []ImageRecord, statuses []string) []ImageRecord {
+	if len(statuses) == 0 {
+		return records
+	}
+
+	wanted := make(map[string]struct{}, len(statuses))
+	for _, status := range statuses {
+		wanted[strings.ToLower(status)] = struct{}{}
+	}
+
+	filtered := make([]ImageRecord, 0, len(records))
+	for _, record := range records {
+		if _, ok := wanted[record.Status]; ok {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+func configError(err error) error {
+	return fmt.Errorf("configuration error: %w", err)
+}
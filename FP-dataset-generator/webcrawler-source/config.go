@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// findConfigFlag scans the raw command-line arguments for -config before the
+// flag set is parsed, so the file can be loaded first and flags applied on
+// top of it.
+func findConfigFlag(args []string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+
+		name := strings.TrimLeft(arg, "-")
+		if name == arg {
+			continue
+		}
+
+		if value, ok := strings.CutPrefix(name, "config="); ok {
+			return strings.TrimSpace(value)
+		}
+
+		if name == "config" && i+1 < len(args) {
+			return strings.TrimSpace(args[i+1])
+		}
+	}
+	return ""
+}
+
+// loadConfigFile reads a YAML or TOML file into cfg. Keys match the long flag
+// names (e.g. max-pages, follow-subdomains). Fields absent from the file keep
+// their current values, and unknown keys are reported as errors so typos do
+// not silently fall back to defaults. The timeout must be a whole number of
+// seconds, matching the -timeout flag, rather than being rounded down.
+func loadConfigFile(path string, cfg *Config) error {
+	if err := decodeFile(path, "config file", cfg); err != nil {
+		return err
+	}
+	if cfg.Timeout < 0 || cfg.Timeout%time.Second != 0 {
+		return fmt.Errorf("timeout in config file %s must be a positive whole number of seconds such as \"45s\", got %s", path, cfg.Timeout)
+	}
+	return nil
+}
+
+// decodeFile reads a YAML or TOML file into v, chosen by the file's
+// extension, rejecting unknown keys. what names the file in errors.
+func decodeFile(path, what string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s %s: %w", what, path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("failed to parse %s %s: %w", what, path, err)
+		}
+	case ".toml":
+		meta, err := toml.Decode(string(data), v)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s %s: %w", what, path, err)
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, len(undecoded))
+			for i, key := range undecoded {
+				keys[i] = key.String()
+			}
+			return fmt.Errorf("unknown key(s) in %s %s: %s", what, path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported %s format %q (use .yaml, .yml, .json, or .toml)", what, filepath.Ext(path))
+	}
+
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigFileTimeout(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "yaml seconds", file: "config.yaml", content: "timeout: 45s\n", want: 45 * time.Second},
+		{name: "yaml minutes", file: "config.yaml", content: "timeout: 2m\n", want: 2 * time.Minute},
+		{name: "toml seconds", file: "config.toml", content: "timeout = \"45s\"\n", want: 45 * time.Second},
+		{name: "no timeout", file: "config.yaml", content: "max-pages: 10\n"},
+		{name: "sub-second", file: "config.yaml", content: "timeout: 500ms\n", wantErr: true},
+		{name: "fractional seconds", file: "config.yaml", content: "timeout: 1500ms\n", wantErr: true},
+		{name: "yaml bare integer", file: "config.yaml", content: "timeout: 30\n", wantErr: true},
+		{name: "toml bare integer", file: "config.toml", content: "timeout = 30\n", wantErr: true},
+		{name: "negative", file: "config.yaml", content: "timeout: -5s\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := &Config{}
+			err := loadConfigFile(path, cfg)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("loadConfigFile() error = %v, want error: %v", err, tt.wantErr)
+			}
+			if err == nil && cfg.Timeout != tt.want {
+				t.Errorf("Timeout = %s, want %s", cfg.Timeout, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The same image found for two keywords lands in two classes of a dataset,
+// labelled both ways, which corrupts supervised training. After the classes
+// of a crawl are downloaded their hash indexes are compared, and the images
+// stored in more than one class are listed in the conflicts file; with
+// -quarantine-conflicts they are also moved out of the classes.
+
+// classConflictsFileName lists the content stored in several classes, one
+// "<sha256>\t<class>/<file>\t<class>/<file>..." line each.
+const classConflictsFileName = "class_conflicts.tsv"
+
+// quarantineDirName is the directory of the output directory conflicting
+// images are moved to, under their class.
+const quarantineDirName = "conflicts"
+
+// classConflict is content stored in more than one class, with the files
+// holding it, relative to the dataset directory.
+type classConflict struct {
+	sum   string
+	files []string
+}
+
+// findClassConflicts returns the content the classes of cfg store more than
+// once across classes, ordered by hash.
+func findClassConflicts(cfg *Config) ([]classConflict, error) {
+	holders := make(map[string][]string)
+	for _, class := range cfg.classes {
+		dir := classDir(cfg, class)
+		index, err := loadHashIndex(dir)
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", class, err)
+		}
+		for sum, file := range index.byHash {
+			if _, err := os.Stat(filepath.Join(dir, file)); err == nil {
+				holders[sum] = append(holders[sum], filepath.Join(filepath.Base(dir), file))
+			}
+		}
+	}
+
+	var conflicts []classConflict
+	for sum, files := range holders {
+		if len(files) > 1 {
+			conflicts = append(conflicts, classConflict{sum: sum, files: files})
+		}
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].sum < conflicts[j].sum })
+	return conflicts, nil
+}
+
+// writeClassConflicts rewrites the conflicts file of outputDir, removing it
+// when there are no conflicts.
+func writeClassConflicts(outputDir string, conflicts []classConflict) error {
+	path := filepath.Join(outputDir, classConflictsFileName)
+	if len(conflicts) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove class conflicts file: %w", err)
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	for _, conflict := range conflicts {
+		fmt.Fprintf(&b, "%s\t%s\n", conflict.sum, strings.Join(conflict.files, "\t"))
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write class conflicts file: %w", err)
+	}
+	return nil
+}
+
+// quarantineConflicts moves every file of the conflicts into the quarantine
+// directory and records its image as filtered in its class, so later runs do
+// not download it again.
+func quarantineConflicts(cfg *Config, conflicts []classConflict) error {
+	byClass := make(map[string]map[string]struct{})
+	for _, conflict := range conflicts {
+		for _, file := range conflict.files {
+			class, name, _ := strings.Cut(filepath.ToSlash(file), "/")
+			if byClass[class] == nil {
+				byClass[class] = make(map[string]struct{})
+			}
+			byClass[class][name] = struct{}{}
+
+			target := filepath.Join(cfg.OutputDir, quarantineDirName, file)
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return fmt.Errorf("failed to create quarantine directory: %w", err)
+			}
+			if err := os.Rename(filepath.Join(cfg.OutputDir, file), target); err != nil {
+				return fmt.Errorf("failed to quarantine %s: %w", file, err)
+			}
+		}
+	}
+
+	for class, files := range byClass {
+		dir := filepath.Join(cfg.OutputDir, class)
+		state, err := loadState(dir)
+		if err != nil {
+			return fmt.Errorf("class %s: %w", class, err)
+		}
+		for i := range state.Images {
+			record := &state.Images[i]
+			if _, conflicting := files[filepath.ToSlash(record.File)]; conflicting && record.Status == imageStatusDownloaded {
+				record.Status, record.FilteredBy = imageStatusFiltered, filterClassConflict
+			}
+		}
+		if err := saveState(dir, state); err != nil {
+			return err
+		}
+		if err := writeManifest(dir, state, cfg.Manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkClassConflicts reports the images the classes of a crawl share, and
+// quarantines them with -quarantine-conflicts.
+func checkClassConflicts(cfg *Config) error {
+	if len(cfg.classes) < 2 || cfg.DryRun {
+		return nil
+	}
+	conflicts, err := findClassConflicts(cfg)
+	if err != nil {
+		return err
+	}
+	if err := writeClassConflicts(cfg.OutputDir, conflicts); err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	path := filepath.Join(cfg.OutputDir, classConflictsFileName)
+	if !cfg.Quarantine {
+		logWarning("%d image(s) were stored in more than one class; see %s, or rerun with -quarantine-conflicts to move them out", len(conflicts), path)
+		return nil
+	}
+	if err := quarantineConflicts(cfg, conflicts); err != nil {
+		return err
+	}
+	logWarning("%d image(s) were stored in more than one class and were moved to %s; see %s", len(conflicts), filepath.Join(cfg.OutputDir, quarantineDirName), path)
+	return nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A crawl run with -control listens for commands on a Unix socket, or on a
+// TCP port of the loopback interface, one per line:
+//
+//	pause            finish in-flight pages, then fetch nothing more
+//	resume           continue a paused crawl
+//	set-rate <ms>    pause <ms> after every page from now on
+//	stop             stop as Ctrl+C does, saving the frontier
+//	status           report progress
+//
+// Each command is answered with a line starting "ok" or "error". The control
+// command sends them, or any tool that writes to a socket, such as socat.
+
+// controlDialTimeout bounds how long the control command waits to connect.
+const controlDialTimeout = 5 * time.Second
+
+// controlAddress returns the network and address -control listens on: a
+// Unix socket for a path, TCP for host:port.
+func controlAddress(addr string) (network, address string) {
+	if strings.ContainsRune(addr, os.PathSeparator) || strings.HasSuffix(addr, ".sock") {
+		return "unix", addr
+	}
+	return "tcp", addr
+}
+
+// validateControlAddress checks that a TCP control address is on the
+// loopback interface, so the crawl cannot be steered from other machines.
+func validateControlAddress(addr string) error {
+	network, address := controlAddress(addr)
+	if network == "unix" {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("control must be a socket path or host:port: %s", addr)
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("control must listen on a loopback address such as 127.0.0.1:7070: %s", addr)
+	}
+	return nil
+}
+
+// crawlControl holds what the control socket changed about a running crawl.
+type crawlControl struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{} // closed on resume
+
+	// rateLimitMs replaces every other rate limit once set-rate was given;
+	// it is -1 until then.
+	rateLimitMs atomic.Int64
+}
+
+func newCrawlControl() *crawlControl {
+	control := &crawlControl{}
+	control.rateLimitMs.Store(-1)
+	return control
+}
+
+// pause stops workers from starting new pages. It reports whether the
+// crawl was running.
+func (ctl *crawlControl) pause() bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if ctl.paused {
+		return false
+	}
+	ctl.paused = true
+	ctl.resumed = make(chan struct{})
+	return true
+}
+
+// resume lets a paused crawl continue. It reports whether it was paused.
+func (ctl *crawlControl) resume() bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if !ctl.paused {
+		return false
+	}
+	ctl.paused = false
+	close(ctl.resumed)
+	return true
+}
+
+func (ctl *crawlControl) isPaused() bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	return ctl.paused
+}
+
+// wait blocks while the crawl is paused, until it is resumed or stop is
+// closed.
+func (ctl *crawlControl) wait(stop <-chan struct{}) {
+	ctl.mu.Lock()
+	paused, resumed := ctl.paused, ctl.resumed
+	ctl.mu.Unlock()
+	if !paused {
+		return
+	}
+	select {
+	case <-resumed:
+	case <-stop:
+	}
+}
+
+// serveControl listens on addr for commands to the crawler until the
+// returned listener is closed.
+func serveControl(addr string, c *Crawler) (io.Closer, error) {
+	network, address := controlAddress(addr)
+	if network == "unix" {
+		// A socket left behind by a crawl that was killed would make Listen
+		// fail; one a running crawl still answers on is kept.
+		if conn, err := net.Dial(network, address); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("control socket %s is in use by another crawl", address)
+		}
+		os.Remove(address)
+	}
+
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open control socket: %w", err)
+	}
+	logInfo("Accepting control commands on %s (pause, resume, set-rate <ms>, stop, status)", addr)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go c.handleControl(conn)
+		}
+	}()
+	return listener, nil
+}
+
+// handleControl answers the commands sent on one connection.
+func (c *Crawler) handleControl(conn net.Conn) {
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		reply, err := c.controlCommand(strings.ToLower(fields[0]), fields[1:])
+		if err != nil {
+			reply = "error: " + err.Error()
+		} else {
+			reply = "ok " + reply
+			logInfo("Control: %s", strings.Join(fields, " "))
+		}
+		if _, err := fmt.Fprintln(conn, strings.TrimSpace(reply)); err != nil {
+			return
+		}
+	}
+}
+
+// controlCommand carries out one control command and returns the reply.
+func (c *Crawler) controlCommand(name string, args []string) (string, error) {
+	switch name {
+	case "pause":
+		if !c.control.pause() {
+			return "already paused", nil
+		}
+		return "paused", nil
+	case "resume":
+		if !c.control.resume() {
+			return "not paused", nil
+		}
+		return "resumed", nil
+	case "set-rate":
+		if len(args) != 1 {
+			return "", errors.New("usage: set-rate <ms>")
+		}
+		ms, err := strconv.Atoi(args[0])
+		if err != nil || ms < 0 {
+			return "", fmt.Errorf("invalid rate %q: must be milliseconds, 0 or more", args[0])
+		}
+		if polite := c.config.politeRateLimit(ms); polite != ms {
+			c.control.rateLimitMs.Store(int64(polite))
+			return fmt.Sprintf("rate %dms, the least this build's policy allows", polite), nil
+		}
+		c.control.rateLimitMs.Store(int64(ms))
+		return fmt.Sprintf("rate %dms", ms), nil
+	case "stop":
+		c.control.resume()
+		c.Stop()
+		return "stopping", nil
+	case "status":
+		state := "running"
+		if c.shouldStopCrawling() {
+			state = "stopping"
+		} else if c.control.isPaused() {
+			state = "paused"
+		}
+		rate := "default"
+		if ms := c.control.rateLimitMs.Load(); ms >= 0 {
+			rate = fmt.Sprintf("%dms", ms)
+		}
+		return fmt.Sprintf("%s pages=%d images=%d rate=%s", state, atomic.LoadInt32(&c.pagesCrawled), c.imageCount(), rate), nil
+	default:
+		return "", fmt.Errorf("unknown command %q (use pause, resume, set-rate <ms>, stop, or status)", name)
+	}
+}
+
+// sendControl sends one command to the control socket of a running crawl
+// and returns its reply.
+func sendControl(addr, command string) (string, error) {
+	network, address := controlAddress(addr)
+	conn, err := net.DialTimeout(network, address, controlDialTimeout)
+	if err != nil {
+		return "", fmt.Errorf("no crawl is listening on %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	if _, err := fmt.Fprintln(conn, command); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("no reply from %s: %w", addr, err)
+	}
+	return strings.TrimSpace(reply), nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Images in formats that dataset tools often cannot read are converted to
+// PNG or JPEG after they are downloaded and before the filters see them:
+// WebP with the decoder built in (-convert-webp), AVIF and HEIC with an
+// external converter (-convert-heif).
+
+// conversionTarget is a format images are converted to.
+type conversionTarget struct {
+	ext    string
+	mime   string
+	encode func(w io.Writer, img image.Image) error
+}
+
+var conversionTargets = map[string]conversionTarget{
+	"png":  {ext: ".png", mime: "image/png", encode: png.Encode},
+	"jpeg": {ext: ".jpg", mime: "image/jpeg", encode: encodeOpaqueJPEG},
+}
+
+// jpegQuality is the quality converted images are encoded as JPEG at; it is
+// high since the source was usually lossy already.
+const jpegQuality = 92
+
+// heifMIMETypes are the HEIF-based types -convert-heif converts.
+var heifMIMETypes = map[string]struct{}{
+	"image/avif": {},
+	"image/heic": {},
+	"image/heif": {},
+}
+
+// heifConverters are the commands tried, in order, to convert AVIF and HEIC
+// images when -image-converter is not set.
+var heifConverters = []string{
+	"magick {in} {out}",
+	"convert {in} {out}",
+	"vips copy {in} {out}",
+	"heif-convert {in} {out}",
+}
+
+// parseTargetFormat normalizes a png or jpeg conversion format, reporting
+// whether it is one.
+func parseTargetFormat(format string) (string, bool) {
+	format = strings.ToLower(strings.TrimSpace(format))
+	if format == "jpg" {
+		format = "jpeg"
+	}
+	_, ok := conversionTargets[format]
+	return format, ok
+}
+
+// conversionFormat returns the format images of mimeType are converted to,
+// or "" when they are kept as they are.
+func (cfg *Config) conversionFormat(mimeType string) string {
+	if mimeType == "image/webp" {
+		return cfg.ConvertWebP
+	}
+	if _, ok := heifMIMETypes[mimeType]; ok {
+		return cfg.ConvertHEIF
+	}
+	return ""
+}
+
+// convertedFileName returns the name an image downloaded as file is stored
+// under, judged by its extension, so an image converted on an earlier run
+// is found under its new name.
+func (cfg *Config) convertedFileName(file string) string {
+	mimeType := extensionMIMETypes[strings.ToLower(filepath.Ext(file))]
+	if isWebPImage(file) {
+		mimeType = "image/webp"
+	}
+	if format := cfg.conversionFormat(mimeType); format != "" {
+		return convertedName(file, format)
+	}
+	return file
+}
+
+// convertedName returns the name an image stored as file is kept under
+// once converted to format. A name that already has an extension of that
+// format keeps it.
+func convertedName(file, format string) string {
+	target := conversionTargets[format]
+	ext := filepath.Ext(file)
+	if extensionMIMETypes[strings.ToLower(ext)] == target.mime {
+		return file
+	}
+	return strings.TrimSuffix(file, ext) + target.ext
+}
+
+// convertImage converts the downloaded image of mimeType at path to format
+// and returns the path of the converted .part file.
+func convertImage(cfg *Config, path, mimeType, format string) (string, error) {
+	converted := strings.TrimSuffix(path, partFileSuffix) + conversionTargets[format].ext + partFileSuffix
+	var err error
+	if mimeType == "image/webp" {
+		err = convertWebP(path, converted, format)
+	} else {
+		err = runConverter(cfg.converter, path, converted, format)
+	}
+	if err != nil {
+		os.Remove(converted)
+		return "", err
+	}
+	return converted, nil
+}
+
+// runConverter runs the external converter on in, writing format to out.
+// Converters pick the format from the output's extension, so they write to
+// a name ending in it, which is then moved to out.
+func runConverter(converter []string, in, out, format string) error {
+	if len(converter) == 0 {
+		return fmt.Errorf("no image converter")
+	}
+	written := out + conversionTargets[format].ext
+	args := make([]string, len(converter)-1)
+	for i, arg := range converter[1:] {
+		args[i] = strings.NewReplacer("{in}", in, "{out}", written).Replace(arg)
+	}
+
+	output, err := exec.Command(converter[0], args...).CombinedOutput()
+	if err != nil {
+		os.Remove(written)
+		if message, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n"); message != "" {
+			return fmt.Errorf("%s failed: %s", converter[0], message)
+		}
+		return fmt.Errorf("%s failed: %w", converter[0], err)
+	}
+	if err := os.Rename(written, out); err != nil {
+		os.Remove(written)
+		return fmt.Errorf("%s wrote no image: %w", converter[0], err)
+	}
+	return nil
+}
+
+// prepareConverter picks the external converter -convert-heif uses: the
+// -image-converter command, or the first of heifConverters installed.
+func prepareConverter(cfg *Config) error {
+	if cfg.ConvertHEIF == "" {
+		return nil
+	}
+	if cfg.ImageConverter != "" {
+		cfg.converter = strings.Fields(cfg.ImageConverter)
+		if !checkCommandExists(cfg.converter[0]) {
+			return fmt.Errorf("image converter %s not found", cfg.converter[0])
+		}
+		fmt.Printf("✓ Using image converter: %s\n", cfg.converter[0])
+		return nil
+	}
+
+	for _, command := range heifConverters {
+		fields := strings.Fields(command)
+		if checkCommandExists(fields[0]) {
+			cfg.converter = fields
+			fmt.Printf("✓ Detected image converter: %s\n", fields[0])
+			return nil
+		}
+	}
+	return fmt.Errorf("no AVIF/HEIC converter found; install ImageMagick, libvips, or libheif, or set -image-converter")
+}
+
+// encodeOpaqueJPEG writes img as a JPEG, over a white background where it
+// is transparent, since JPEG has no alpha channel.
+func encodeOpaqueJPEG(w io.Writer, img image.Image) error {
+	if opaque, ok := img.(interface{ Opaque() bool }); !ok || !opaque.Opaque() {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.White, image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		img = flat
+	}
+	return jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package main
+
+// cpuSampler is a no-op where process CPU time is not available; autoscaling
+// then relies on latency and error rate alone.
+type cpuSampler struct{}
+
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{}
+}
+
+func (s *cpuSampler) sample() float64 {
+	return 0
+}
@@ -0,0 +1,42 @@
+//go:build unix
+
+package main
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// cpuSampler measures the process's CPU usage as a fraction of all cores
+// between successive samples.
+type cpuSampler struct {
+	lastCPU  time.Duration
+	lastWall time.Time
+}
+
+func newCPUSampler() *cpuSampler {
+	return &cpuSampler{lastCPU: processCPUTime(), lastWall: time.Now()}
+}
+
+func (s *cpuSampler) sample() float64 {
+	now := time.Now()
+	cpu := processCPUTime()
+
+	wall := now.Sub(s.lastWall)
+	used := cpu - s.lastCPU
+	s.lastCPU, s.lastWall = cpu, now
+
+	if wall <= 0 {
+		return 0
+	}
+	return float64(used) / (float64(wall) * float64(runtime.NumCPU()))
+}
+
+func processCPUTime() time.Duration {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano())
+}
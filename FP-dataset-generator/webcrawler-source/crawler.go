@@ -1,9 +1,15 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/url"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -35,36 +41,88 @@ var redundantImageQueryParams = map[string]struct{}{
 	"token":    {},
 }
 
+// errRedirectSeen aborts a fetch whose redirect target was already crawled or
+// queued, so the same final page never consumes budget twice.
+var errRedirectSeen = errors.New("redirect target already seen")
+
+// maxRedirects mirrors net/http's default redirect limit.
+const maxRedirects = 10
+
+// minContentHashLength is the minimum normalized text length for a page to
+// take part in duplicate-content detection.
+const minContentHashLength = 200
+
 type Crawler struct {
 	config *Config
 
 	client *http.Client
 
+	// resourceClient fetches what is not a page, such as robots.txt. It
+	// shares the transport of client but records no redirects in the seen
+	// set, so a robots.txt redirected to the homepage does not hide it.
+	resourceClient *http.Client
+
 	taskCh chan CrawlTask
+	nextCh chan CrawlTask // next pages of results listings, taken first
 	wg     sync.WaitGroup
 	taskWG sync.WaitGroup
 
 	seenPages map[string]struct{}
 	seenMutex sync.Mutex
 
+	frontier      []CrawlTask
+	frontierMutex sync.Mutex
+	resumeTasks   []CrawlTask
+	deepLinks     []CrawlTask
+
+	memory *memoryGuard
+	spill  *taskSpill
+
+	pool        workerPool
+	fetchStats  fetchStats
+	diagnostics *crawlDiagnostics
+
+	contentHashes map[[sha256.Size]byte]string
+	contentMutex  sync.Mutex
+
 	robotsCache map[string]*robotstxt.RobotsData
 	robotsMutex sync.RWMutex
 
 	visitedImages map[string]struct{}
 	images        []string
+	imageParties  map[string]string
+	imageTags     map[string][]string
+	imageOrigins  map[string]imageOrigin
+	pageTags      map[string][]string
+	pageLicenses  map[string]pageLicense
 	imagesMutex   sync.Mutex
+	imageStream   chan<- string
+	variants      *variantIndex
+
+	pagesCrawled   int32
+	fetchFailures  int32
+	duplicatePages int32
 
-	pagesCrawled  int32
-	fetchFailures int32
+	sites []SiteProvider
+
+	seedListings []string
+	listingMutex sync.Mutex
 
 	progressBar *progressbar.ProgressBar
+	control     *crawlControl
 	stopCh      chan struct{}
 	stopOnce    sync.Once
+	userStopped atomic.Bool
 }
 
 type CrawlTask struct {
-	URL   string
-	Depth int
+	URL   string `json:"url"`
+	Depth int    `json:"depth"`
+
+	// ResultPage numbers the pages of a results listing reached through
+	// its next-page links, from 2; it is 0 for other pages. Such pages are
+	// crawled ahead of the others.
+	ResultPage int `json:"result_page,omitempty"`
 }
 
 func NewCrawler(cfg *Config) *Crawler {
@@ -73,24 +131,52 @@ func NewCrawler(cfg *Config) *Crawler {
 		queueCapacity = 128
 	}
 
-	return &Crawler{
+	c := &Crawler{
 		config:        cfg,
-		client:        &http.Client{Timeout: cfg.Timeout},
+		client:        &http.Client{Timeout: cfg.Timeout, Transport: newCrawlerTransport(cfg)},
 		taskCh:        make(chan CrawlTask, queueCapacity),
+		nextCh:        make(chan CrawlTask, queueCapacity),
 		seenPages:     make(map[string]struct{}),
+		contentHashes: make(map[[sha256.Size]byte]string),
 		robotsCache:   make(map[string]*robotstxt.RobotsData),
 		visitedImages: make(map[string]struct{}),
+		imageParties:  make(map[string]string),
+		imageTags:     make(map[string][]string),
+		imageOrigins:  make(map[string]imageOrigin),
+		pageTags:      make(map[string][]string),
+		pageLicenses:  make(map[string]pageLicense),
 		images:        make([]string, 0, 256),
+		variants:      newVariantIndex(),
+		control:       newCrawlControl(),
 		stopCh:        make(chan struct{}),
+		diagnostics:   newCrawlDiagnostics(),
+		sites:         crawlSites(cfg),
 	}
+	c.resourceClient = &http.Client{Timeout: cfg.Timeout, Transport: c.client.Transport}
+	c.client.CheckRedirect = c.checkRedirect
+
+	if cfg.maxMemoryBytes > 0 {
+		c.memory = newMemoryGuard(cfg.maxMemoryBytes)
+		c.spill = newTaskSpill(cfg.OutputDir)
+	}
+
+	return c
 }
 
 func (c *Crawler) Start() error {
 	seeds := c.initialSeeds()
-	if len(seeds) == 0 {
+	if len(seeds) == 0 && len(c.resumeTasks) == 0 {
 		return fmt.Errorf("no seed URLs available")
 	}
 
+	// Through a proxy, reachability is the proxy's business.
+	if len(c.resumeTasks) == 0 && !c.config.SkipProbe && c.config.proxies == nil {
+		seeds = c.reachableSeeds(seeds)
+		if len(seeds) == 0 {
+			return fmt.Errorf("none of the seed hosts are reachable (use -skip-probe to crawl anyway)")
+		}
+	}
+
 	c.progressBar = progressbar.NewOptions(
 		c.config.MaxPages,
 		progressbar.OptionSetDescription("Crawling pages"),
@@ -106,22 +192,61 @@ func (c *Crawler) Start() error {
 		}),
 	)
 
-	for i := 0; i < c.config.Concurrency; i++ {
+	workers := c.config.Concurrency
+	if c.config.AutoConcurrency {
+		workers = autoscaleInitialWorkers
+	}
+	c.pool.active, c.pool.target = workers, workers
+	for i := 0; i < workers; i++ {
 		c.wg.Add(1)
 		go c.worker()
 	}
 
-	logVerbose(c.config, "Seeding crawler with %d URL(s)", len(seeds))
-	for _, seed := range seeds {
-		c.enqueueTask(CrawlTask{URL: seed, Depth: 0})
+	c.progressBar.Add(int(atomic.LoadInt32(&c.pagesCrawled)))
+
+	supervisorDone := make(chan struct{})
+	if c.memory != nil {
+		go c.superviseMemory(supervisorDone)
+	}
+	if c.config.AutoConcurrency {
+		go c.autoscale(supervisorDone)
+	}
+
+	if len(c.resumeTasks) > 0 {
+		logVerbose(c.config, "Resuming crawler with %d pending URL(s)", len(c.resumeTasks))
+		for _, task := range c.resumeTasks {
+			c.dispatchTask(task)
+		}
+	} else {
+		logVerbose(c.config, "Seeding crawler with %d URL(s)", len(seeds))
+		for _, seed := range seeds {
+			// Seeds that are images themselves need no page fetch.
+			if isImageURL(seed) {
+				logVerbose(c.config, "Seed is an image: %s", seed)
+				c.storeImageURL(seed)
+				continue
+			}
+			if urlScheme(seed) == "ftp" {
+				c.seedFTPDirectory(seed)
+				continue
+			}
+			c.enqueueTask(CrawlTask{URL: seed, Depth: 0})
+		}
 	}
 
 	go func() {
 		c.taskWG.Wait()
+		// Stop the autoscaler from adding workers before closing, so no
+		// worker is started once the pool may have drained.
+		c.pool.mu.Lock()
+		c.pool.closing = true
+		c.pool.mu.Unlock()
 		close(c.taskCh)
+		close(c.nextCh)
 	}()
 
 	c.wg.Wait()
+	close(supervisorDone)
 
 	if c.progressBar != nil {
 		c.progressBar.Finish()
@@ -131,10 +256,74 @@ func (c *Crawler) Start() error {
 	fmt.Printf("  Pages crawled: %d\n", atomic.LoadInt32(&c.pagesCrawled))
 	fmt.Printf("  Images found:  %d\n", c.imageCount())
 	fmt.Printf("  Fetch failures: %d\n", atomic.LoadInt32(&c.fetchFailures))
+	if duplicates := atomic.LoadInt32(&c.duplicatePages); duplicates > 0 {
+		fmt.Printf("  Duplicate pages: %d (content already seen)\n", duplicates)
+	}
+
+	if c.imageCount() == 0 {
+		c.printZeroYieldDiagnostics()
+	}
 
 	return nil
 }
 
+// Stop asks the crawler to finish in-flight pages and return from Start.
+// Pages not yet crawled are kept in the frontier for a later resume.
+func (c *Crawler) Stop() {
+	c.userStopped.Store(true)
+	c.requestStop()
+}
+
+// Restore primes the crawler with the seen pages, page count, discovered
+// images, and frontier from a previous run so Start continues where that run
+// stopped instead of starting from the seeds again.
+func (c *Crawler) Restore(state *CrawlState) {
+	c.seenMutex.Lock()
+	for _, page := range state.SeenPages {
+		c.seenPages[page] = struct{}{}
+	}
+	c.seenMutex.Unlock()
+
+	for _, imageURL := range state.imageURLs() {
+		c.recordImage(imageURL)
+	}
+
+	atomic.StoreInt32(&c.pagesCrawled, int32(state.PagesCrawled))
+	c.resumeTasks = append([]CrawlTask(nil), state.Frontier...)
+}
+
+// StreamImages makes the crawler send every newly discovered image URL to
+// stream as well as recording it. It must be called before Start, and the
+// caller closes stream after Start returns.
+func (c *Crawler) StreamImages(stream chan<- string) {
+	c.imageStream = stream
+}
+
+// Snapshot copies the crawler's progress into state so it can be saved.
+func (c *Crawler) Snapshot(state *CrawlState) {
+	c.seenMutex.Lock()
+	state.SeenPages = make([]string, 0, len(c.seenPages))
+	for page := range c.seenPages {
+		state.SeenPages = append(state.SeenPages, page)
+	}
+	c.seenMutex.Unlock()
+	sort.Strings(state.SeenPages)
+
+	c.frontierMutex.Lock()
+	state.Frontier = append([]CrawlTask(nil), c.frontier...)
+	c.frontierMutex.Unlock()
+
+	state.PagesCrawled = int(atomic.LoadInt32(&c.pagesCrawled))
+	state.CrawlDone = len(state.Frontier) == 0
+	state.addImages(c.GetImageURLs())
+
+	c.imagesMutex.Lock()
+	state.setParties(c.imageParties)
+	state.setTags(c.imageTags)
+	state.setOrigins(c.imageOrigins)
+	c.imagesMutex.Unlock()
+}
+
 func (c *Crawler) GetImageURLs() []string {
 	c.imagesMutex.Lock()
 	defer c.imagesMutex.Unlock()
@@ -147,18 +336,58 @@ func (c *Crawler) GetImageURLs() []string {
 func (c *Crawler) worker() {
 	defer c.wg.Done()
 
-	for task := range c.taskCh {
+	for {
+		task, ok := c.nextTask()
+		if !ok {
+			return
+		}
 		c.processTask(task)
+		if c.pool.retire() {
+			return
+		}
+	}
+}
+
+// nextTask returns the next task for a worker, preferring the next pages of
+// results listings, and false once both queues are closed and drained.
+func (c *Crawler) nextTask() (CrawlTask, bool) {
+	select {
+	case task, ok := <-c.nextCh:
+		if ok {
+			return task, true
+		}
+	default:
+	}
+
+	select {
+	case task, ok := <-c.nextCh:
+		if ok {
+			return task, true
+		}
+		task, ok = <-c.taskCh
+		return task, ok
+	case task, ok := <-c.taskCh:
+		if ok {
+			return task, true
+		}
+		task, ok = <-c.nextCh
+		return task, ok
 	}
 }
 
 func (c *Crawler) processTask(task CrawlTask) {
 	defer c.taskWG.Done()
 
+	c.control.wait(c.stopCh)
 	if c.shouldStopCrawling() {
+		c.deferTask(task)
 		return
 	}
 
+	if c.memory.underPressure() {
+		c.waitForMemory()
+	}
+
 	attempted, err := c.crawl(task)
 	if err != nil {
 		logVerbose(c.config, "Error crawling %s: %v", task.URL, err)
@@ -168,36 +397,67 @@ func (c *Crawler) processTask(task CrawlTask) {
 		c.incrementPagesCrawled()
 	}
 
-	if c.config.RateLimitMs > 0 {
-		time.Sleep(time.Duration(c.config.RateLimitMs) * time.Millisecond)
+	if rateLimit := c.rateLimitFor(task.URL); rateLimit > 0 {
+		time.Sleep(time.Duration(rateLimit) * time.Millisecond)
 	}
 }
 
 func (c *Crawler) crawl(task CrawlTask) (bool, error) {
 	if !c.config.IgnoreRobots && !c.canCrawl(task.URL) {
 		logVerbose(c.config, "Blocked by robots.txt: %s", task.URL)
+		c.diagnostics.recordRobotsBlock(task.URL)
 		return false, nil
 	}
 
-	req, err := http.NewRequest("GET", task.URL, nil)
+	site := c.siteFor(task.URL)
+	fetchURL := task.URL
+	accept := "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8"
+	if requester, ok := site.(pageRequester); ok {
+		fetchURL = requester.RequestURL(task.URL)
+		accept = requester.Accept()
+	}
+
+	req, err := http.NewRequest("GET", fetchURL, nil)
 	if err != nil {
 		return false, err
 	}
-	req.Header.Set("User-Agent", c.config.UserAgent)
-	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/xml;q=0.9,image/webp,*/*;q=0.8")
-	req.Header.Set("Accept-Language", "en-US,en;q=0.9")
+	req.Header.Set("User-Agent", c.userAgentFor(task.URL))
+	req.Header.Set("Accept", accept)
 	req.Header.Set("Connection", "keep-alive")
 	req.Header.Set("Upgrade-Insecure-Requests", "1")
 
 	attempted := true
 
+	fetchStart := time.Now()
 	resp, err := c.client.Do(req)
+	c.fetchStats.record(time.Since(fetchStart), err != nil && !errors.Is(err, errRedirectSeen) ||
+		err == nil && (resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests))
+	mirrored := false
+	if hostFailing(resp, err) {
+		if mirrorResp := c.fetchFromMirrors(req); mirrorResp != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			resp, err, mirrored = mirrorResp, nil, true
+		}
+	}
 	if err != nil {
+		if errors.Is(err, errRedirectSeen) {
+			logVerbose(c.config, "Skipping %s: redirects to an already seen page", task.URL)
+			return false, nil
+		}
 		c.incrementFetchFailures()
 		return attempted, err
 	}
 	defer resp.Body.Close()
 
+	// Links on a redirected page are relative to where we ended up. Those on
+	// a mirror's page are taken as the primary's, so the crawl stays on it.
+	pageURL := task.URL
+	if !mirrored && resp.Request != nil && resp.Request.URL != nil {
+		pageURL = normalizeURL(resp.Request.URL.String())
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		switch resp.StatusCode {
 		case http.StatusNotFound:
@@ -206,6 +466,7 @@ func (c *Crawler) crawl(task CrawlTask) (bool, error) {
 			return attempted, nil
 		case http.StatusForbidden, http.StatusMethodNotAllowed:
 			logVerbose(c.config, "Skipping %s: status %d", task.URL, resp.StatusCode)
+			c.diagnostics.recordRefused(task.URL, resp.StatusCode)
 			return attempted, nil
 		default:
 			c.incrementFetchFailures()
@@ -213,65 +474,270 @@ func (c *Crawler) crawl(task CrawlTask) (bool, error) {
 		}
 	}
 
-	if !isHTMLContent(resp.Header.Get("Content-Type")) {
+	body := bufio.NewReader(resp.Body)
+	head, _ := body.Peek(sniffLength)
+
+	switch classifyResponse(resp.Header.Get("Content-Type"), head) {
+	case responseImage:
+		logVerbose(c.config, "Page is actually an image: %s", pageURL)
+		if task.Depth == 0 {
+			c.storeImageURL(pageURL)
+		} else {
+			c.acceptImageURL(pageURL, "")
+		}
+		return attempted, nil
+	case responseOther:
+		if c.config.PDFImages && isPDFResponse(resp.Header.Get("Content-Type"), head) {
+			return attempted, c.extractPDFImages(body, pageURL)
+		}
+		if site != nil {
+			err := c.crawlSitePage(site, &sitePage{task: task, url: pageURL, body: body})
+			if !errors.Is(err, errNotSitePage) {
+				return attempted, err
+			}
+		}
+		c.diagnostics.recordContentType(resp.Header.Get("Content-Type"))
 		return attempted, nil
 	}
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	doc, err := goquery.NewDocumentFromReader(body)
 	if err != nil {
 		return attempted, err
 	}
 
-	c.extractImages(doc, task.URL)
+	if original, duplicate := c.markContentSeen(doc, pageURL); duplicate {
+		atomic.AddInt32(&c.duplicatePages, 1)
+		logVerbose(c.config, "Skipping %s: same content as %s", pageURL, original)
+		return attempted, nil
+	}
 
-	if task.Depth < c.config.MaxDepth && !c.shouldStopCrawling() {
-		c.extractAndQueueLinks(doc, task.URL, task.Depth+1)
+	if isAutoindexPage(doc) {
+		c.crawlAutoindex(doc, task, pageURL)
+		return attempted, nil
+	}
+
+	if looksScriptRendered(doc) {
+		logVerbose(c.config, "Page looks rendered by JavaScript: %s", pageURL)
+		c.diagnostics.recordScriptRendered(pageURL)
+	}
+
+	if tags := pageTags(doc); len(tags) > 0 {
+		c.setPageTags(pageURL, tags)
+		defer c.clearPageTags(pageURL)
+	}
+	if licenses := c.licensesOf(doc, pageURL); licenses.license != "" || len(licenses.images) > 0 {
+		c.setPageLicense(pageURL, licenses)
+		defer c.clearPageLicense(pageURL)
+	}
+
+	if site == nil {
+		c.extractImages(doc, pageURL)
+	} else if err := c.crawlSitePage(site, &sitePage{task: task, url: pageURL, doc: doc}); errors.Is(err, errNotSitePage) {
+		c.extractImages(doc, pageURL)
+	} else if err != nil {
+		logVerbose(c.config, "Error extracting images from %s: %v", pageURL, err)
+	}
+
+	if !c.shouldStopCrawling() {
+		c.followPagination(doc, task, pageURL)
+	}
+
+	if task.Depth < c.config.deepestDepth() && !c.shouldStopCrawling() {
+		// Seeds are followed whatever their language.
+		if lang := c.otherLanguage(doc, resp.Header.Get("Content-Language")); lang != "" && task.Depth > 0 {
+			logVerbose(c.config, "Not following links from %s: page is in %q", pageURL, lang)
+		} else {
+			c.extractAndQueueLinks(doc, pageURL, task.Depth+1)
+		}
 	}
 
 	return attempted, nil
 }
 
+// siteFor returns the site pageURL belongs to, or nil for other pages.
+func (c *Crawler) siteFor(pageURL string) SiteProvider {
+	for _, site := range c.sites {
+		if site.Matches(pageURL) {
+			return site
+		}
+	}
+	return nil
+}
+
+// crawlSitePage hands a fetched page to its site and queues the next page of
+// results the site finds, as deep as a results page of its type may go.
+func (c *Crawler) crawlSitePage(site SiteProvider, page *sitePage) error {
+	if err := site.ExtractImages(c, page); err != nil {
+		return err
+	}
+	pageType := classifyPage(page.task.URL)
+	if page.task.Depth >= c.siteDepthLimit(page.task.URL, c.config.linkDepthLimit(pageType, pageType)) || c.shouldStopCrawling() {
+		return nil
+	}
+	if next := site.NextPage(page); next != "" {
+		c.enqueueTask(CrawlTask{URL: next, Depth: page.task.Depth + 1})
+	}
+	return nil
+}
+
+// rateLimitFor returns the pause after crawling pageURL in milliseconds. A
+// rate set over the control socket overrides every other; -identify keeps
+// the pause at least its own limit and the site's robots.txt Crawl-delay.
+// None goes below the deployment policy's minimum.
+func (c *Crawler) rateLimitFor(pageURL string) int {
+	if rateLimit := c.control.rateLimitMs.Load(); rateLimit >= 0 {
+		return c.config.politeRateLimit(int(rateLimit))
+	}
+	rateLimit := max(c.config.RateLimitMs, c.sitePreset(pageURL).RateLimitMs)
+	if limiter, ok := c.siteFor(pageURL).(siteRateLimiter); ok && limiter.RateLimitMs() > 0 {
+		rateLimit = limiter.RateLimitMs()
+	}
+	if c.config.Identify {
+		rateLimit = max(rateLimit, identifyRateLimitMs, int(c.crawlDelayFor(pageURL)/time.Millisecond))
+	}
+	return c.config.politeRateLimit(rateLimit)
+}
+
 func (c *Crawler) extractImages(doc *goquery.Document, baseURL string) {
+	images := c.newPageImages(baseURL)
+	defer images.flush()
+
 	doc.Find("img").Each(func(_ int, sel *goquery.Selection) {
+		metadata := imageMetadata(sel)
 		for _, candidate := range c.collectImageCandidates(sel) {
-			c.tryAddImageURL(baseURL, candidate)
+			images.add(candidate, metadata, sel)
 		}
+		c.recordSrcsetVariants(baseURL, sel)
 	})
 
 	doc.Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
 		if href, exists := sel.Attr("href"); exists {
-			c.tryAddImageURL(baseURL, href)
+			images.add(href, imageMetadata(sel), sel)
 		}
 	})
 
 	doc.Find("picture source").Each(func(_ int, sel *goquery.Selection) {
 		if srcset, exists := sel.Attr("srcset"); exists {
 			if largest := c.extractLargestFromSrcset(srcset); largest != "" {
-				c.tryAddImageURL(baseURL, largest)
+				images.add(largest, imageMetadata(sel.SiblingsFiltered("img")), sel.SiblingsFiltered("img"))
+				c.recordSrcsetVariants(baseURL, sel)
+			}
+		}
+	})
+
+	pageTitle := strings.TrimSpace(doc.Find("title").First().Text())
+
+	// Hero and gallery images are often preloaded, usually at their highest
+	// quality, before the markup that displays them. Preloads carry no text
+	// of their own, so they only match a keyword by their URL.
+	doc.Find("link[rel~='preload'][as='image']").Each(func(_ int, sel *goquery.Selection) {
+		if href, exists := sel.Attr("href"); exists {
+			images.add(href, "", sel)
+		}
+		if srcset, exists := sel.Attr("imagesrcset"); exists {
+			if largest := c.extractLargestFromSrcset(srcset); largest != "" {
+				images.add(largest, "", sel)
+				c.recordSrcsetVariants(baseURL, sel)
+			}
+		}
+	})
+
+	// The og:image is the page's own picture, so it is described by the
+	// page's title. Other share cards are often generic banners and only
+	// match by their URL.
+	doc.Find("meta[property='og:image'], meta[property='og:image:url'], meta[property='og:image:secure_url']").Each(func(_ int, sel *goquery.Selection) {
+		if content, exists := sel.Attr("content"); exists {
+			images.add(content, pageTitle, sel)
+		}
+	})
+	doc.Find("meta[name='twitter:image'], meta[name='twitter:image:src']").Each(func(_ int, sel *goquery.Selection) {
+		if content, exists := sel.Attr("content"); exists {
+			images.add(content, "", sel)
+		}
+	})
+
+	// Many galleries show their hero and tile images only as CSS
+	// backgrounds, set inline or in the page's stylesheets.
+	doc.Find("[style]").Each(func(_ int, sel *goquery.Selection) {
+		for _, candidate := range cssImageURLs(sel.AttrOr("style", "")) {
+			images.add(candidate, imageMetadata(sel), sel)
+		}
+	})
+	// Stylesheets also hold sprites, logos, and icons, so their images only
+	// match a keyword by their URL, not by the page's title.
+	doc.Find("style").Each(func(_ int, sel *goquery.Selection) {
+		for _, candidate := range cssImageURLs(sel.Text()) {
+			images.add(candidate, "", nil)
+		}
+	})
+
+	if c.config.VideoPosters {
+		c.extractVideoPosters(doc.Selection, images, pageTitle)
+	}
+
+	c.extractLazyAttributes(doc.Selection, images)
+	c.extractJSONState(doc, baseURL, images)
+}
+
+// extractLazyAttributes adds the images that elements other than img, such
+// as the divs of a slider, name in the -lazy-attrs attributes, either as a
+// URL or a CSS url().
+func (c *Crawler) extractLazyAttributes(scope *goquery.Selection, images *pageImages) {
+	for _, attr := range c.config.LazyAttrs {
+		selector := "[" + attr + "]"
+		scope.Filter(selector).AddSelection(scope.Find(selector)).Not("img").Each(func(_ int, sel *goquery.Selection) {
+			value := sel.AttrOr(attr, "")
+			candidates := cssImageURLs(value)
+			if len(candidates) == 0 {
+				candidates = []string{value}
 			}
+			for _, candidate := range candidates {
+				images.add(candidate, imageMetadata(sel), sel)
+			}
+		})
+	}
+}
+
+// extractVideoPosters records the still frames media sites publish for their
+// videos, often at full resolution: the poster attribute of video elements
+// and og:video:thumbnail metadata.
+func (c *Crawler) extractVideoPosters(scope *goquery.Selection, images *pageImages, pageTitle string) {
+	scope.Find("video[poster]").Each(func(_ int, sel *goquery.Selection) {
+		poster, _ := sel.Attr("poster")
+		metadata := imageMetadata(sel)
+		if metadata == "" {
+			metadata = pageTitle
 		}
+		images.add(poster, metadata, sel)
 	})
 
-	doc.Find("meta[property='og:image'], meta[property='og:image:url'], meta[property='og:image:secure_url'], meta[name='twitter:image'], meta[name='twitter:image:src']").Each(func(_ int, sel *goquery.Selection) {
+	scope.Find("meta[property='og:video:thumbnail'], meta[name='og:video:thumbnail']").Each(func(_ int, sel *goquery.Selection) {
 		if content, exists := sel.Attr("content"); exists {
-			c.tryAddImageURL(baseURL, content)
+			images.add(content, pageTitle, sel)
 		}
 	})
 }
 
+// lazyLoadAttributes are where lazy-loading scripts keep the URL of an image
+// until it scrolls into view. -lazy-attrs adds site-specific ones.
+var lazyLoadAttributes = []string{
+	"data-src",
+	"data-original",
+	"data-fullsrc",
+	"data-large",
+	"data-lazy",
+	"data-lazy-src",
+	"data-thumbnail",
+	"data-fallback-src",
+	"data-img",
+}
+
+// attributeNamePattern matches the attribute names -lazy-attrs accepts, which
+// are also used in CSS attribute selectors.
+var attributeNamePattern = regexp.MustCompile(`^[a-z_][-a-z0-9_]*$`)
+
 func (c *Crawler) collectImageCandidates(sel *goquery.Selection) []string {
-	attrs := []string{
-		"data-src",
-		"data-original",
-		"data-fullsrc",
-		"data-large",
-		"data-lazy",
-		"data-lazy-src",
-		"data-thumbnail",
-		"data-fallback-src",
-		"data-img",
-		"src",
-	}
+	attrs := append(append(slices.Clone(lazyLoadAttributes), c.config.LazyAttrs...), "src")
 
 	unique := make(map[string]struct{}, len(attrs)*2)
 
@@ -304,14 +770,66 @@ func (c *Crawler) collectImageCandidates(sel *goquery.Selection) []string {
 	return result
 }
 
-func (c *Crawler) tryAddImageURL(baseURL, candidate string) {
+// imageMetadata returns the descriptive text attached to an image element or
+// link: its alt and title attributes, the text and title of the link it is
+// or sits in, and any figure caption.
+func imageMetadata(sel *goquery.Selection) string {
+	var parts []string
+	for _, attr := range []string{"alt", "title", "aria-label"} {
+		if value, exists := sel.Attr(attr); exists {
+			parts = append(parts, value)
+		}
+	}
+	if goquery.NodeName(sel) == "a" {
+		parts = append(parts, sel.Text())
+	} else if link := sel.Closest("a"); link.Length() > 0 {
+		if title, exists := link.Attr("title"); exists {
+			parts = append(parts, title)
+		}
+		parts = append(parts, link.Text())
+	}
+	if caption := sel.Closest("figure").Find("figcaption").First(); caption.Length() > 0 {
+		parts = append(parts, caption.Text())
+	}
+	return strings.Join(strings.Fields(strings.Join(parts, " ")), " ")
+}
+
+// elementCaptions returns the alt text of an image element or of the image a
+// link holds, its title or that of the link around it, and the caption of
+// the figure it sits in.
+func elementCaptions(sel *goquery.Selection) imageCaptions {
+	clean := func(text string) string { return strings.Join(strings.Fields(text), " ") }
+	image := sel
+	if goquery.NodeName(sel) == "a" {
+		image = sel.Find("img").First()
+	}
+	captions := imageCaptions{
+		alt:   clean(image.AttrOr("alt", "")),
+		title: clean(sel.AttrOr("title", "")),
+	}
+	if captions.title == "" {
+		captions.title = clean(sel.Closest("a").AttrOr("title", ""))
+	}
+	if caption := sel.Closest("figure").Find("figcaption").First(); caption.Length() > 0 {
+		captions.figcaption = clean(caption.Text())
+	}
+	return captions
+}
+
+func (c *Crawler) tryAddImageURL(baseURL, candidate, metadata string) {
 	candidate = strings.TrimSpace(candidate)
 	if candidate == "" {
 		return
 	}
 
 	lower := strings.ToLower(candidate)
-	if strings.HasPrefix(lower, "data:") || strings.HasPrefix(lower, "javascript:") {
+	if strings.HasPrefix(lower, "data:") {
+		if c.config.IncludeDataURIs {
+			c.acceptDataURI(baseURL, candidate, metadata)
+		}
+		return
+	}
+	if strings.HasPrefix(lower, "javascript:") {
 		return
 	}
 
@@ -324,17 +842,83 @@ func (c *Crawler) tryAddImageURL(baseURL, candidate string) {
 		return
 	}
 
-	if !containsKeyword(absolute, c.config.Keyword) {
+	party := imageParty(baseURL, absolute)
+	if party == partyThird && c.config.FirstPartyOnly {
+		if c.config.Explain {
+			logVerbose(c.config, "Skipping third-party image on %s: %s", baseURL, absolute)
+		}
 		return
 	}
+	c.noteImageParty(absolute, party)
+	c.noteImageTags(absolute, baseURL)
+	c.noteImageOrigin(absolute, baseURL, metadata)
+	c.noteImageLicense(absolute, baseURL)
+	c.acceptImageURL(absolute, metadata)
+}
+
+// acceptImageURL applies the keyword and URL-level filters to an absolute
+// image URL and records it when it passes. metadata is the image's alt,
+// title, or caption text, used by -keyword-scope metadata. Callers are
+// responsible for establishing that the URL is an image.
+func (c *Crawler) acceptImageURL(absolute, metadata string) {
+	field, text, ok := keywordMatch(c.config.KeywordScope, absolute, metadata, c.config.Keyword)
+	if !ok {
+		c.diagnostics.recordKeywordRejection(absolute)
+		if c.config.Explain {
+			logVerbose(c.config, "No keyword match in %s: %s", c.config.KeywordScope, absolute)
+		}
+		return
+	}
+
+	c.noteImageMatch(absolute, strongestMatch(absolute, metadata, c.config.Keyword))
+	if c.storeImageURL(absolute) && c.config.Explain {
+		logVerbose(c.config, "  matched in %s: %s", field, highlightKeyword(text, c.config.Keyword))
+	}
+}
+
+// storeImageURL records an image that needs no keyword match, such as one the
+// user pointed at directly, after the remaining URL-level filters. It reports
+// whether the image was newly recorded.
+func (c *Crawler) storeImageURL(absolute string) bool {
+	if !c.config.allowsURL(absolute) {
+		if c.config.Explain {
+			logVerbose(c.config, "Excluded by the URL and domain filters: %s", absolute)
+		}
+		return false
+	}
+
+	if !c.allowsLicense(absolute) {
+		if c.config.Explain {
+			logVerbose(c.config, "Not under a -license license: %s", absolute)
+		}
+		return false
+	}
+
+	if c.config.SkipWatermarked && isLikelyWatermarkedURL(absolute) {
+		logVerbose(c.config, "Skipping likely watermarked image: %s", absolute)
+		return false
+	}
 
 	if c.recordImage(absolute) {
 		logVerbose(c.config, "Found image: %s", absolute)
+		return true
 	}
+	return false
 }
 
 func (c *Crawler) extractAndQueueLinks(doc *goquery.Document, baseURL string, depth int) {
-	doc.Find("a[href]").Each(func(_ int, sel *goquery.Selection) {
+	pageType := classifyPage(baseURL)
+	logVerbose(c.config, "Page type %s: %s", pageType, baseURL)
+
+	links := doc.Find("a[href]")
+	if selector, ok := c.siteFor(baseURL).(linkSelector); ok {
+		links = selector.Links(doc)
+	} else if selector := c.sitePreset(baseURL).LinkSelector; selector != "" {
+		if selected := selectLinks(doc, selector); selected.Length() > 0 {
+			links = selected
+		}
+	}
+	links.Each(func(_ int, sel *goquery.Selection) {
 		href, exists := sel.Attr("href")
 		if !exists {
 			return
@@ -346,7 +930,7 @@ func (c *Crawler) extractAndQueueLinks(doc *goquery.Document, baseURL string, de
 		}
 
 		if isImageURL(absolute) {
-			c.tryAddImageURL(baseURL, href)
+			c.tryAddImageURL(baseURL, href, imageMetadata(sel))
 			return
 		}
 
@@ -354,6 +938,11 @@ func (c *Crawler) extractAndQueueLinks(doc *goquery.Document, baseURL string, de
 			return
 		}
 
+		if depth > c.siteDepthLimit(absolute, c.config.linkDepthLimit(pageType, classifyPage(absolute))) {
+			c.recordDeepLink(CrawlTask{URL: absolute, Depth: depth})
+			return
+		}
+
 		c.enqueueTask(CrawlTask{URL: absolute, Depth: depth})
 	})
 }
@@ -363,31 +952,48 @@ func (c *Crawler) recordImage(imageURL string) bool {
 	if canonical == "" {
 		canonical = imageURL
 	}
+	canonical = learnedParams.strip(canonical)
 
 	c.imagesMutex.Lock()
-	defer c.imagesMutex.Unlock()
-
 	if _, exists := c.visitedImages[canonical]; exists {
+		c.imagesMutex.Unlock()
+		return false
+	}
+	if c.imageBudgetSpent() {
+		c.imagesMutex.Unlock()
 		return false
 	}
 
 	c.visitedImages[canonical] = struct{}{}
 	c.images = append(c.images, imageURL)
+	spent := c.imageBudgetSpent()
+	c.imagesMutex.Unlock()
+
+	if spent {
+		logVerbose(c.config, "Found %d image(s), stopping the crawl (-max-images)", c.config.MaxImages)
+		c.requestStop()
+	}
+
+	if c.imageStream != nil {
+		c.imageStream <- imageURL
+	}
 
 	return true
 }
 
-func (c *Crawler) enqueueTask(task CrawlTask) {
-	if c.shouldStopCrawling() {
-		return
-	}
+// imageBudgetSpent reports whether -max-images images were recorded. The
+// caller holds imagesMutex.
+func (c *Crawler) imageBudgetSpent() bool {
+	return c.config.MaxImages > 0 && len(c.images) >= c.config.MaxImages
+}
 
+func (c *Crawler) enqueueTask(task CrawlTask) {
 	normalized := normalizeURL(strings.TrimSpace(task.URL))
 	if normalized == "" {
 		return
 	}
 
-	if task.Depth > c.config.MaxDepth {
+	if task.Depth > c.config.deepestDepth() {
 		return
 	}
 
@@ -396,6 +1002,32 @@ func (c *Crawler) enqueueTask(task CrawlTask) {
 	}
 
 	task.URL = normalized
+	c.dispatchTask(task)
+}
+
+// seedFTPDirectory records the images listed in an FTP directory seed.
+func (c *Crawler) seedFTPDirectory(dirURL string) {
+	entries, err := listFTPDirectory(dirURL)
+	if err != nil {
+		logWarning("Could not list %s: %v", dirURL, err)
+		return
+	}
+
+	for _, entry := range entries {
+		if isImageURL(entry) {
+			c.storeImageURL(entry)
+		}
+	}
+}
+
+// dispatchTask hands a task that is already marked as seen to the workers.
+// Tasks that cannot run because the crawl is stopping are kept in the
+// frontier so a later resume can pick them up.
+func (c *Crawler) dispatchTask(task CrawlTask) {
+	if c.shouldStopCrawling() {
+		c.deferTask(task)
+		return
+	}
 
 	// Increment the outstanding task counter and enqueue without blocking
 	// the calling worker. Sending is done in a separate goroutine so that
@@ -408,10 +1040,27 @@ func (c *Crawler) enqueueTask(task CrawlTask) {
 	select {
 	case <-c.stopCh:
 		c.taskWG.Done()
+		c.deferTask(task)
 		return
 	default:
 	}
 
+	// Under memory pressure the task goes to disk instead of a goroutine;
+	// it keeps its taskWG slot until superviseMemory sends or releases it.
+	if c.memory.underPressure() {
+		err := c.spill.push(task)
+		if err == nil {
+			return
+		}
+		logVerbose(c.config, "Could not spill %s: %v", task.URL, err)
+	}
+
+	c.sendTask(task)
+}
+
+// sendTask delivers a task whose taskWG slot is already held to the workers
+// without blocking the caller.
+func (c *Crawler) sendTask(task CrawlTask) {
 	go func(t CrawlTask) {
 		// Ensure we account for the taskWG in all exit paths. Sending to
 		// the channel may panic if it is closed concurrently; recover and
@@ -419,19 +1068,33 @@ func (c *Crawler) enqueueTask(task CrawlTask) {
 		defer func() {
 			if r := recover(); r != nil {
 				c.taskWG.Done()
+				c.deferTask(t)
 			}
 		}()
 
+		queue := c.taskCh
+		if t.ResultPage > 0 {
+			queue = c.nextCh
+		}
+
 		select {
 		case <-c.stopCh:
 			c.taskWG.Done()
-		case c.taskCh <- t:
+			c.deferTask(t)
+		case queue <- t:
 			// successfully enqueued; the worker that processes the task
 			// will call taskWG.Done() when finished (in processTask).
 		}
 	}(task)
 }
 
+// deferTask records a task that was seen but never crawled.
+func (c *Crawler) deferTask(task CrawlTask) {
+	c.frontierMutex.Lock()
+	c.frontier = append(c.frontier, task)
+	c.frontierMutex.Unlock()
+}
+
 func (c *Crawler) markPageSeen(pageURL string) bool {
 	c.seenMutex.Lock()
 	defer c.seenMutex.Unlock()
@@ -444,12 +1107,63 @@ func (c *Crawler) markPageSeen(pageURL string) bool {
 	return true
 }
 
+// markContentSeen hashes the page's normalized text and reports whether an
+// earlier page had identical content, returning that page's URL. Mirror and
+// print versions of a page differ only in URL, so extracting from them again
+// wastes page budget. Pages with too little text to fingerprint reliably
+// (e.g. JS-rendered shells) are never treated as duplicates.
+func (c *Crawler) markContentSeen(doc *goquery.Document, pageURL string) (string, bool) {
+	text := strings.ToLower(strings.Join(strings.Fields(doc.Find("body").Text()), " "))
+	if len(text) < minContentHashLength {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(text))
+
+	c.contentMutex.Lock()
+	defer c.contentMutex.Unlock()
+
+	if original, exists := c.contentHashes[sum]; exists {
+		return original, true
+	}
+
+	c.contentHashes[sum] = pageURL
+	return "", false
+}
+
+// checkRedirect records every hop of a redirect chain in the seen set. If a
+// hop lands on a page that was already crawled or queued, the fetch is
+// abandoned instead of crawling that page a second time.
+func (c *Crawler) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	target := normalizeURL(req.URL.String())
+	if !c.markPageSeen(target) {
+		return errRedirectSeen
+	}
+
+	logVerbose(c.config, "Redirect: %s -> %s", via[len(via)-1].URL, target)
+	return nil
+}
+
 func (c *Crawler) shouldFollowLink(baseURL, targetURL string) bool {
 	parsed, err := url.Parse(targetURL)
 	if err != nil {
 		return false
 	}
 
+	if !c.config.allowsURL(targetURL) {
+		return false
+	}
+
+	// Saved pages may link to each other; follow those without ever
+	// stepping from a local file out to the web.
+	if parsed.Scheme == "file" {
+		return urlScheme(baseURL) == "file"
+	}
+
 	if parsed.Scheme != "http" && parsed.Scheme != "https" {
 		return false
 	}
@@ -465,6 +1179,70 @@ func (c *Crawler) shouldFollowLink(baseURL, targetURL string) bool {
 	return false
 }
 
+// allowsURL reports whether a link or image URL passes -url-include,
+// -url-exclude, and the domain allowlist and blocklist.
+func (cfg *Config) allowsURL(raw string) bool {
+	if cfg.urlInclude != nil && !cfg.urlInclude.MatchString(raw) {
+		return false
+	}
+	if cfg.urlExclude != nil && cfg.urlExclude.MatchString(raw) {
+		return false
+	}
+	return cfg.allowsHost(raw)
+}
+
+// allowsHost reports whether the host of a URL is in -allow-domains, when
+// given, and not in -block-domains. Images taken from a PDF or inlined in a
+// page are judged by the host of the document.
+func (cfg *Config) allowsHost(raw string) bool {
+	if len(cfg.allowDomains) == 0 && len(cfg.blockDomains) == 0 {
+		return true
+	}
+	raw = documentURL(raw)
+	if urlScheme(raw) == "file" {
+		return true
+	}
+
+	if cfg.blockDomains.matches(raw) {
+		return false
+	}
+	if len(cfg.allowDomains) == 0 {
+		return true
+	}
+	for _, domain := range cfg.allowDomains {
+		if hostMatches(raw, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// documentURL returns the URL of the PDF or page an image taken from one
+// was found in, or imageURL itself for any other image.
+func documentURL(imageURL string) string {
+	if docURL, _, ok := parsePDFImageURL(imageURL); ok {
+		return docURL
+	}
+	if pageURL, _, ok := parseDataURIImageURL(imageURL); ok {
+		return pageURL
+	}
+	return imageURL
+}
+
+// normalizeDomains lowercases domains given as filters and drops a leading
+// "*." or ".", as subdomains always match.
+func normalizeDomains(domains []string) []string {
+	var normalized []string
+	for _, domain := range domains {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		domain = strings.TrimPrefix(strings.TrimPrefix(domain, "*"), ".")
+		if domain != "" && !slices.Contains(normalized, domain) {
+			normalized = append(normalized, domain)
+		}
+	}
+	return normalized
+}
+
 func (c *Crawler) resolveURL(baseURL, ref string) string {
 	ref = strings.TrimSpace(ref)
 	if ref == "" {
@@ -518,6 +1296,14 @@ func (c *Crawler) shouldStopCrawling() bool {
 		return true
 	}
 
+	if c.config.pastDeadline() {
+		c.stopOnce.Do(func() {
+			logVerbose(c.config, "Time budget of %s used, stopping the crawl (-max-duration)", c.config.MaxDuration)
+			close(c.stopCh)
+		})
+		return true
+	}
+
 	return false
 }
 
@@ -563,88 +1349,49 @@ func (c *Crawler) buildDefaultSeeds() []string {
 	seen := make(map[string]struct{}, len(sites))
 
 	for _, site := range sites {
-		seed := c.seedForSite(strings.ToLower(strings.TrimSpace(site)), keyword)
-		if seed == "" {
+		provider := lookupSite(c.config, strings.ToLower(strings.TrimSpace(site)))
+		if provider == nil {
 			continue
 		}
-		if _, exists := seen[seed]; exists {
-			continue
+		for _, seed := range provider.Seeds(c.config, keyword) {
+			if _, exists := seen[seed]; exists {
+				continue
+			}
+			seen[seed] = struct{}{}
+			seeds = append(seeds, seed)
 		}
-		seen[seed] = struct{}{}
-		seeds = append(seeds, seed)
 	}
 
 	return seeds
 }
 
-func (c *Crawler) seedForSite(site, keywordEscaped string) string {
-	switch site {
-	case "wikimedia":
-		return fmt.Sprintf("https://commons.wikimedia.org/w/index.php?search=%s&title=Special:MediaSearch&go=Go&type=image", keywordEscaped)
-	case "pexels":
-		return fmt.Sprintf("https://www.pexels.com/search/%s/", keywordEscaped)
-	case "pixabay":
-		return fmt.Sprintf("https://pixabay.com/images/search/%s/", keywordEscaped)
-	case "freeimages":
-		return fmt.Sprintf("https://www.freeimages.com/search/%s", keywordEscaped)
-	case "unsplash":
-		return fmt.Sprintf("https://unsplash.com/s/photos/%s", keywordEscaped)
-	case "flickr":
-		return fmt.Sprintf("https://www.flickr.com/search/?text=%s&media=photos&license=4,5,6,9,10", keywordEscaped)
-	case "deviantart":
-		return fmt.Sprintf("https://www.deviantart.com/search?q=%s", keywordEscaped)
-	case "pinterest":
-		return fmt.Sprintf("https://www.pinterest.com/search/pins/?q=%s", keywordEscaped)
-	case "imgur":
-		return fmt.Sprintf("https://imgur.com/search?q=%s", keywordEscaped)
-	case "reddit":
-		return fmt.Sprintf("https://www.reddit.com/search/?q=%s&type=link", keywordEscaped)
-	default:
+func (c *Crawler) extractLargestFromSrcset(srcset string) string {
+	candidates := srcsetCandidates(srcset)
+	if len(candidates) == 0 {
 		return ""
 	}
+	return strings.TrimSpace(candidates[0])
 }
 
-func (c *Crawler) extractLargestFromSrcset(srcset string) string {
-	var largestURL string
-	var largestWidth int
-
-	for _, part := range strings.Split(srcset, ",") {
-		part = strings.TrimSpace(part)
-		if part == "" {
-			continue
-		}
-
-		fields := strings.Fields(part)
-		if len(fields) == 0 {
-			continue
-		}
-
-		urlCandidate := fields[0]
-		width := 0
-
-		if len(fields) > 1 {
-			size := strings.TrimSuffix(fields[1], "w")
-			size = strings.TrimSuffix(size, "x")
-			fmt.Sscanf(size, "%d", &width)
-		}
-
-		if width > largestWidth {
-			largestWidth = width
-			largestURL = urlCandidate
-		} else if largestURL == "" {
-			largestURL = urlCandidate
-		}
+func (c *Crawler) canCrawl(pageURL string) bool {
+	parsed, err := url.Parse(pageURL)
+	if err != nil {
+		return false
 	}
 
-	return strings.TrimSpace(largestURL)
-}
+	// robots.txt only governs web servers; local files are always allowed.
+	if parsed.Scheme == "file" {
+		return true
+	}
 
-func (c *Crawler) canCrawl(pageURL string) bool {
-	parsed, err := url.Parse(pageURL)
-	if err != nil || parsed.Host == "" {
+	if parsed.Host == "" {
 		return false
 	}
 
+	if group := c.config.robotsOverrides.lookup(parsed.Hostname()); group != nil {
+		return group.Test(parsed.Path)
+	}
+
 	robotsURL := fmt.Sprintf("%s://%s/robots.txt", parsed.Scheme, parsed.Host)
 	data := c.getRobotsData(robotsURL)
 	if data == nil {
@@ -686,7 +1433,7 @@ func (c *Crawler) fetchRobotsTxt(robotsURL string) *robotstxt.RobotsData {
 	}
 	req.Header.Set("User-Agent", c.config.UserAgent)
 
-	resp, err := c.client.Do(req)
+	resp, err := c.resourceClient.Do(req)
 	if err != nil {
 		return nil
 	}
@@ -721,8 +1468,8 @@ func canonicalizeImageURL(raw string) string {
 
 	query := parsed.Query()
 	stripped := false
-	for key := range redundantImageQueryParams {
-		if _, ok := query[key]; ok {
+	for key := range query {
+		if isStrippedParam(key) {
 			query.Del(key)
 			stripped = true
 		}
@@ -740,10 +1487,55 @@ func canonicalizeImageURL(raw string) string {
 }
 
 func isHTMLContent(contentType string) bool {
-	if contentType == "" {
-		return true
-	}
-
 	contentType = strings.ToLower(contentType)
 	return strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "application/xhtml+xml")
 }
+
+const (
+	responseHTML = iota
+	responseImage
+	responseOther
+)
+
+// sniffLength is the number of leading body bytes http.DetectContentType
+// looks at.
+const sniffLength = 512
+
+// classifyResponse decides how to handle a fetched body from its declared
+// Content-Type and its first bytes. Image magic numbers always win, since
+// servers and CDNs commonly label images as text/html or omit the header.
+// An image header is trusted for content that is not text, so formats the
+// sniffer does not know are found too. A missing or generic header falls
+// back to the sniffed type, and an explicit HTML header is otherwise
+// trusted.
+func classifyResponse(contentType string, head []byte) int {
+	sniffed := sniffBytes(head)
+	if strings.HasPrefix(sniffed, "image/") {
+		if isSupportedImageMIME(sniffed) {
+			return responseImage
+		}
+		return responseOther
+	}
+
+	declared, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(contentType)), ";")
+	if strings.HasPrefix(declared, "image/") && !strings.HasPrefix(sniffed, "text/") {
+		if isSupportedImageMIME(declared) {
+			return responseImage
+		}
+		return responseOther
+	}
+
+	if isHTMLContent(contentType) {
+		return responseHTML
+	}
+
+	lower := strings.ToLower(strings.TrimSpace(contentType))
+	generic := lower == "" ||
+		strings.HasPrefix(lower, "text/plain") ||
+		strings.HasPrefix(lower, "application/octet-stream")
+	if generic && strings.HasPrefix(sniffed, "text/html") {
+		return responseHTML
+	}
+
+	return responseOther
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestCheckRedirect(t *testing.T) {
+	tests := []struct {
+		name    string
+		seen    []string
+		target  string
+		hops    int
+		wantErr error
+		marked  bool
+	}{
+		{name: "unseen target", target: "https://example.com/b", hops: 1, marked: true},
+		{name: "seen target", seen: []string{"https://example.com/b"}, target: "https://example.com/b", hops: 1, wantErr: errRedirectSeen},
+		{name: "fragment dropped before lookup", seen: []string{"https://example.com/b"}, target: "https://example.com/b#top", hops: 1, wantErr: errRedirectSeen},
+		{name: "too many hops", target: "https://example.com/c", hops: maxRedirects},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Crawler{config: &Config{}, seenPages: make(map[string]struct{})}
+			for _, page := range tt.seen {
+				c.markPageSeen(page)
+			}
+			target, _ := url.Parse(tt.target)
+			via := make([]*http.Request, tt.hops)
+			for i := range via {
+				via[i] = &http.Request{URL: &url.URL{Scheme: "https", Host: "example.com", Path: "/a"}}
+			}
+
+			err := c.checkRedirect(&http.Request{URL: target}, via)
+			switch {
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("checkRedirect() = %v, want %v", err, tt.wantErr)
+			case tt.wantErr == nil && tt.hops >= maxRedirects && err == nil:
+				t.Fatal("checkRedirect() = nil, want an error past the redirect limit")
+			case tt.wantErr == nil && tt.hops < maxRedirects && err != nil:
+				t.Fatalf("checkRedirect() = %v, want nil", err)
+			}
+			if tt.marked && c.markPageSeen(normalizeURL(tt.target)) {
+				t.Error("redirect target was not marked as seen")
+			}
+		})
+	}
+}
+
+func TestFetchRobotsTxtLeavesSeenPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/robots.txt" {
+			http.Redirect(w, r, "/", http.StatusMovedPermanently)
+			return
+		}
+		w.Write([]byte("<html><body>home</body></html>"))
+	}))
+	defer server.Close()
+
+	c := NewCrawler(&Config{Timeout: 5 * time.Second})
+	c.getRobotsData(server.URL + "/robots.txt")
+
+	if !c.markPageSeen(normalizeURL(server.URL + "/")) {
+		t.Error("the homepage robots.txt redirects to was marked as seen")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// crawlInfoFileName is the marker written into each output directory so a
+// dataset folder records how it was produced.
+const crawlInfoFileName = ".crawlinfo"
+
+// crawlInfo is the content of the marker file. Config keys match the long
+// flag names, as in a config file.
+type crawlInfo struct {
+	Tool      string    `yaml:"tool"`
+	Version   string    `yaml:"version"`
+	GoVersion string    `yaml:"go-version"`
+	Command   string    `yaml:"command"`
+	CreatedAt time.Time `yaml:"created-at"`
+	UpdatedAt time.Time `yaml:"updated-at"`
+	Config    Config    `yaml:"config"`
+}
+
+// writeCrawlInfo records the tool version and configuration of the current
+// command in the output directory. The creation time of an existing marker
+// is kept; API keys and proxy passwords are left out.
+func writeCrawlInfo(cfg *Config) error {
+	now := time.Now().UTC()
+	info := crawlInfo{
+		Tool:      "webcrawler-ai",
+		Version:   version,
+		GoVersion: runtime.Version(),
+		Command:   cfg.command,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Config:    *cfg,
+	}
+	info.Config.UnsplashKey = ""
+	info.Config.PexelsKey = ""
+	info.Config.PixabayKey = ""
+	info.Config.OpenverseToken = ""
+
+	var proxies []string
+	for _, value := range splitCSV(cfg.Proxy) {
+		if proxyURL, err := parseProxyURL(value); err == nil {
+			value = proxyURL.Redacted()
+		}
+		proxies = append(proxies, value)
+	}
+	info.Config.Proxy = strings.Join(proxies, ",")
+
+	target := filepath.Join(cfg.OutputDir, crawlInfoFileName)
+	if data, err := os.ReadFile(target); err == nil {
+		var previous crawlInfo
+		if yaml.Unmarshal(data, &previous) == nil && !previous.CreatedAt.IsZero() {
+			info.CreatedAt = previous.CreatedAt
+		}
+	}
+
+	data, err := yaml.Marshal(&info)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", crawlInfoFileName, err)
+	}
+	header := "# How this dataset folder was produced, updated on every run.\n"
+	if err := os.WriteFile(target, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", crawlInfoFileName, err)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	// cssURLPattern matches url() references in CSS, quoted or not.
+	cssURLPattern = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)"'\s]*))\s*\)`)
+
+	cssCommentPattern = regexp.MustCompile(`(?s)/\*.*?\*/`)
+)
+
+// cssImageURLs returns the url() references in a style attribute or
+// stylesheet, such as background-image: url(hero.jpg). References that are
+// not images, such as fonts, are left for isImageURL to reject.
+func cssImageURLs(css string) []string {
+	if !strings.Contains(strings.ToLower(css), "url(") {
+		return nil
+	}
+	css = cssCommentPattern.ReplaceAllString(css, "")
+
+	var urls []string
+	for _, match := range cssURLPattern.FindAllStringSubmatch(css, -1) {
+		value := match[1] + match[2] + match[3]
+		if value = strings.TrimSpace(value); value != "" {
+			urls = append(urls, value)
+		}
+	}
+	return urls
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Images inlined in a page as data: URIs have no URL of their own, so
+// -include-data-uris records each one as
+//
+//	data-uri:<entry>:<page url>
+//
+// where the entry, such as 3fa2c1d4e5f60718.png, is the start of the image's
+// SHA-256 and its type. Recording the data itself would put every image in
+// the crawl state and URL lists; the downloader fetches the page again
+// instead, decodes the images it inlines into dataURICacheDir, and takes them
+// from there.
+const (
+	dataURIScheme   = "data-uri"
+	dataURICacheDir = ".data-uris"
+
+	defaultMinDataURISize = "50KB"
+)
+
+// dataURIPattern finds base64 image data URIs in the raw text of a page,
+// whether in attributes, inline styles, or scripts.
+var dataURIPattern = regexp.MustCompile(`(?i)data:image/[a-z0-9.+-]+(?:;[a-z0-9=._-]+)*;base64,[a-z0-9+/]+=*`)
+
+// decodeDataURI decodes a base64 image data URI, returning the image and the
+// file extension of its type.
+func decodeDataURI(raw string) ([]byte, string, bool) {
+	header, payload, found := strings.Cut(strings.TrimSpace(raw), ",")
+	if !found {
+		return nil, "", false
+	}
+	params, ok := strings.CutPrefix(strings.ToLower(header), "data:")
+	if !ok {
+		return nil, "", false
+	}
+	parts := strings.Split(params, ";")
+	if len(parts) < 2 || parts[len(parts)-1] != "base64" {
+		return nil, "", false
+	}
+	ext := dataURIExtension(parts[0])
+	if ext == "" {
+		return nil, "", false
+	}
+
+	payload = strings.Join(strings.Fields(payload), "")
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		if data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "=")); err != nil {
+			return nil, "", false
+		}
+	}
+	return data, ext, true
+}
+
+// dataURIExtension returns the file extension for an inline image's type, or
+// "" for types the crawler does not keep.
+func dataURIExtension(mime string) string {
+	if !isSupportedImageMIME(mime) {
+		return ""
+	}
+	ext := strings.TrimPrefix(mime, "image/")
+	switch ext {
+	case "jpeg", "pjpeg":
+		ext = "jpg"
+	case "svg+xml":
+		ext = "svg"
+	case "x-icon", "vnd.microsoft.icon":
+		ext = "ico"
+	}
+	if !hasImageExtension("." + ext) {
+		return ""
+	}
+	return ext
+}
+
+// dataURIEntry names an inline image by its content and type.
+func dataURIEntry(data []byte, ext string) string {
+	return fmt.Sprintf("%x", sha256.Sum256(data))[:16] + "." + ext
+}
+
+// dataURIImageURL returns the URL recorded for an image inlined in a page.
+func dataURIImageURL(pageURL, entry string) string {
+	return dataURIScheme + ":" + entry + ":" + pageURL
+}
+
+// parseDataURIImageURL splits a data-uri URL into the page's URL and the
+// entry.
+func parseDataURIImageURL(raw string) (pageURL, entry string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, dataURIScheme+":")
+	if !ok {
+		return "", "", false
+	}
+	entry, pageURL, ok = strings.Cut(rest, ":")
+	if !ok || entry == "" || pageURL == "" {
+		return "", "", false
+	}
+	return pageURL, entry, true
+}
+
+// dataURIImageFilename names an inline image after its page and entry, such
+// as gallery_3fa2c1d4e5f60718.png for an image in gallery.html.
+func dataURIImageFilename(pageURL, entry string) string {
+	base := extractFilenameFromURL(pageURL)
+	return sanitizeFilename(strings.TrimSuffix(base, path.Ext(base)) + "_" + entry)
+}
+
+// acceptDataURI records an image inlined in a page when it is at least
+// -min-data-uri-size. With the keyword matched against the URL, it has to
+// appear in the page's URL, as the image has no name of its own.
+func (c *Crawler) acceptDataURI(pageURL, raw, metadata string) {
+	data, ext, ok := decodeDataURI(raw)
+	if !ok {
+		return
+	}
+	if uint64(len(data)) < c.config.minDataURIBytes {
+		logVerbose(c.config, "Skipping inline image of %s on %s", formatBytes(uint64(len(data))), pageURL)
+		return
+	}
+	imageURL := dataURIImageURL(pageURL, dataURIEntry(data, ext))
+	c.noteImageParty(imageURL, partyFirst)
+	c.noteImageTags(imageURL, pageURL)
+	c.noteImageOrigin(imageURL, pageURL, metadata)
+	c.noteImageLicense(imageURL, pageURL)
+	c.acceptImageURL(imageURL, metadata)
+}
+
+// fetchDataURIImage saves the image a data-uri URL names to outputPath,
+// decoding it from its page first if no earlier download did.
+func (d *Downloader) fetchDataURIImage(imageURL, outputPath string) error {
+	pageURL, entry, ok := parseDataURIImageURL(imageURL)
+	if !ok {
+		return fmt.Errorf("invalid %s URL", dataURIScheme)
+	}
+
+	lock := d.dataURIImages.lock(pageURL)
+	defer lock.Unlock()
+
+	return d.dataURIImages.take(pageURL, entry, outputPath, d.extractDataURIsToCache)
+}
+
+// extractDataURIsToCache downloads a page and writes each image it inlines
+// that is large enough into dir.
+func (d *Downloader) extractDataURIsToCache(pageURL, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	pagePath := dir + ".html"
+	defer os.Remove(pagePath)
+	if _, err := d.fetch(pageURL, pagePath); err != nil {
+		return fmt.Errorf("could not download page: %w", err)
+	}
+
+	page, err := os.ReadFile(pagePath)
+	if err != nil {
+		return err
+	}
+	for _, raw := range dataURIPattern.FindAll(page, -1) {
+		data, ext, ok := decodeDataURI(string(raw))
+		if !ok || uint64(len(data)) < d.config.minDataURIBytes {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(dir, dataURIEntry(data, ext)), data, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// hashIndexFileName is the content hash index kept in the output directory.
+// It uses the sha256sum format, so `sha256sum -c` can verify a dataset.
+const hashIndexFileName = "hashes.sha256"
+
+// hashIndex maps SHA-256 content hashes to the file that first stored that
+// content, so the same image served from different URLs or CDNs is kept
+// only once.
+type hashIndex struct {
+	outputDir string
+	mu        sync.Mutex
+	byHash    map[string]string
+}
+
+// loadHashIndex reads the hash index from outputDir. A missing index is not
+// an error; it is created on the first claim.
+func loadHashIndex(outputDir string) (*hashIndex, error) {
+	index := &hashIndex{
+		outputDir: outputDir,
+		byHash:    make(map[string]string),
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, hashIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read hash index: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sum, name, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(sum) != sha256.Size*2 {
+			continue
+		}
+		index.byHash[sum] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hash index: %w", err)
+	}
+
+	return index, nil
+}
+
+// claim registers file as the holder of content sum. If another file that
+// still exists already holds the same content, that file is returned and
+// the index is left unchanged.
+func (h *hashIndex) claim(sum, file string) (string, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if existing, ok := h.byHash[sum]; ok && existing != file {
+		if _, err := os.Stat(filepath.Join(h.outputDir, existing)); err == nil {
+			return existing, true, nil
+		}
+	}
+
+	h.byHash[sum] = file
+
+	out, err := os.OpenFile(filepath.Join(h.outputDir, hashIndexFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to update hash index: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := fmt.Fprintf(out, "%s  %s\n", sum, file); err != nil {
+		return "", false, fmt.Errorf("failed to update hash index: %w", err)
+	}
+	return "", false, nil
+}
+
+// hashFile returns the hex-encoded SHA-256 of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
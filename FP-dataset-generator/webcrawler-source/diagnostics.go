@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// maxDiagnosticSamples bounds how many example URLs are kept per reason.
+const maxDiagnosticSamples = 3
+
+// crawlDiagnostics counts why pages and images were passed over, so a crawl
+// that finds nothing can tell the user what to change.
+type crawlDiagnostics struct {
+	mu sync.Mutex
+
+	robotsBlocked   map[string]int
+	scriptRendered  map[string]int
+	refused         map[string]int
+	contentTypes    map[string]int
+	keywordRejected int
+	keywordSamples  []string
+}
+
+func newCrawlDiagnostics() *crawlDiagnostics {
+	return &crawlDiagnostics{
+		robotsBlocked:  make(map[string]int),
+		scriptRendered: make(map[string]int),
+		refused:        make(map[string]int),
+		contentTypes:   make(map[string]int),
+	}
+}
+
+func (d *crawlDiagnostics) recordRobotsBlock(pageURL string) {
+	d.mu.Lock()
+	d.robotsBlocked[hostOf(pageURL)]++
+	d.mu.Unlock()
+}
+
+func (d *crawlDiagnostics) recordScriptRendered(pageURL string) {
+	d.mu.Lock()
+	d.scriptRendered[hostOf(pageURL)]++
+	d.mu.Unlock()
+}
+
+func (d *crawlDiagnostics) recordRefused(pageURL string, status int) {
+	d.mu.Lock()
+	d.refused[fmt.Sprintf("%s (%d)", hostOf(pageURL), status)]++
+	d.mu.Unlock()
+}
+
+func (d *crawlDiagnostics) recordContentType(contentType string) {
+	if contentType == "" {
+		contentType = "no content type"
+	} else if idx := strings.Index(contentType, ";"); idx != -1 {
+		contentType = strings.TrimSpace(contentType[:idx])
+	}
+
+	d.mu.Lock()
+	d.contentTypes[strings.ToLower(contentType)]++
+	d.mu.Unlock()
+}
+
+func (d *crawlDiagnostics) recordKeywordRejection(imageURL string) {
+	d.mu.Lock()
+	d.keywordRejected++
+	if len(d.keywordSamples) < maxDiagnosticSamples {
+		d.keywordSamples = append(d.keywordSamples, imageURL)
+	}
+	d.mu.Unlock()
+}
+
+// looksScriptRendered reports whether a page appears to build its content in
+// the browser: almost no text or images in the served HTML, but scripts or
+// an empty application root element.
+func looksScriptRendered(doc *goquery.Document) bool {
+	if doc.Find("img").Length() > 0 {
+		return false
+	}
+
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript").Remove()
+	if len(strings.TrimSpace(body.Text())) > 200 {
+		return false
+	}
+
+	appRoot := doc.Find("#root, #app, #__next, #__nuxt, [data-reactroot], app-root").Length() > 0
+	return appRoot || doc.Find("script").Length() >= 3
+}
+
+// hostOf returns the host of rawURL, or rawURL itself when it has none.
+func hostOf(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+// printZeroYieldDiagnostics explains a crawl that found no images.
+func (c *Crawler) printZeroYieldDiagnostics() {
+	d := c.diagnostics
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	fmt.Println("\nNo images were found. Diagnostics:")
+	reported := false
+
+	if total := sumCounts(d.robotsBlocked); total > 0 {
+		reported = true
+		fmt.Printf("  - robots.txt blocked %d page(s): %s\n", total, formatCounts(d.robotsBlocked))
+		fmt.Println("    Use -robots-overrides or -ignore-robots only if you are permitted to crawl these sites.")
+	}
+
+	if total := sumCounts(d.refused); total > 0 {
+		reported = true
+		fmt.Printf("  - %d page(s) refused access: %s\n", total, formatCounts(d.refused))
+		fmt.Println("    The site may block crawlers; try -user-agent or a different site.")
+	}
+
+	if total := sumCounts(d.scriptRendered); total > 0 {
+		reported = true
+		fmt.Printf("  - %d page(s) look rendered by JavaScript: %s\n", total, formatCounts(d.scriptRendered))
+		fmt.Println("    Their images only appear in a browser; try other -sites or -seeds.")
+	}
+
+	if d.keywordRejected > 0 {
+		reported = true
+		fmt.Printf("  - %d image(s) did not match the keyword %q, e.g.:\n", d.keywordRejected, c.config.Keyword)
+		for _, sample := range d.keywordSamples {
+			fmt.Printf("      %s\n", sample)
+		}
+		fmt.Printf("    The keyword is matched in the image %s (-keyword-scope); try a broader keyword or scope.\n", c.config.KeywordScope)
+	}
+
+	if total := sumCounts(d.contentTypes); total > 0 {
+		reported = true
+		fmt.Printf("  - %d response(s) were neither HTML nor images: %s\n", total, formatCounts(d.contentTypes))
+	}
+
+	if failures := atomic.LoadInt32(&c.fetchFailures); failures > 0 {
+		reported = true
+		fmt.Printf("  - %d page fetch(es) failed; run with -v to see the errors\n", failures)
+	}
+
+	if !reported {
+		if atomic.LoadInt32(&c.pagesCrawled) == 0 {
+			fmt.Println("  - No pages were crawled; check the seed URLs and -sites")
+		} else {
+			fmt.Println("  - Pages were crawled but contained no image links; try -max-depth or other seeds")
+		}
+	}
+}
+
+func sumCounts(counts map[string]int) int {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	return total
+}
+
+// formatCounts renders counts as "key (n), ..." ordered by count, largest
+// first, listing at most five keys.
+func formatCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+
+	parts := make([]string, 0, 5)
+	for i, key := range keys {
+		if i == 5 {
+			parts = append(parts, fmt.Sprintf("%d more", len(keys)-i))
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s (%d)", key, counts[key]))
+	}
+	return strings.Join(parts, ", ")
+}
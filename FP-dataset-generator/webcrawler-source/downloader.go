@@ -1,25 +1,148 @@
 package main
 
 import (
+	"encoding/xml"
 	"fmt"
+	"image"
+	"io"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/schollz/progressbar/v3"
 )
 
+// partFileSuffix marks a download that is still in progress.
+const partFileSuffix = ".part"
+
+const (
+	maxDownloadAttempts = 3
+	downloadRetryDelay  = time.Second
+
+	// processBarWidth matches the width of the download progress bar.
+	processBarWidth = 40
+)
+
+type downloadResult int
+
+const (
+	downloadSuccess downloadResult = iota
+	downloadFailed
+	downloadFiltered
+	downloadDuplicate
+)
+
+// status maps a download result to the image status stored in crawl state.
+func (r downloadResult) status() string {
+	switch r {
+	case downloadSuccess:
+		return imageStatusDownloaded
+	case downloadFiltered:
+		return imageStatusFiltered
+	case downloadDuplicate:
+		return imageStatusDuplicate
+	default:
+		return imageStatusFailed
+	}
+}
+
+// downloadOutcome is the result of a single image download, the file name it
+// was saved under, the SHA-256 of its content, and why it failed, if it did.
+type downloadOutcome struct {
+	Result  downloadResult
+	File    string
+	SHA256  string
+	Reason  string
+	Headers map[string]string
+
+	// Filter names the filter that rejected a filtered image, and MIME,
+	// Size, Width, Height, and Sharpness what was measured of it, where
+	// known.
+	Filter        string
+	MIME          string
+	Size          int64
+	Width, Height int
+	Sharpness     float64
+}
+
 type Downloader struct {
 	config      *Config
+	client      *http.Client
 	progressBar *progressbar.ProgressBar
+
+	results      map[string]downloadOutcome
+	resultsMutex sync.Mutex
+
+	hashes     *hashIndex
+	validators *validatorIndex
+	variants   *variantIndex
+	filters    []imageFilter
+	sink       imageSink
+
+	// fetchSlots bounds the images being downloaded and processSlots those
+	// being validated, filtered, and stored, so CPU-bound processing does
+	// not hold download slots and slow downloads do not idle the CPUs.
+	fetchSlots    chan struct{}
+	processSlots  chan struct{}
+	processQueued atomic.Int64
+	processDone   atomic.Int64
+
+	pdfImages     *extractedImages
+	dataURIImages *extractedImages
 }
 
 func NewDownloader(config *Config) *Downloader {
-	return &Downloader{
-		config: config,
+	d := &Downloader{
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout, Transport: newCrawlerTransport(config)},
+		results: make(map[string]downloadOutcome),
+
+		fetchSlots:   make(chan struct{}, config.downloadConcurrency()),
+		processSlots: make(chan struct{}, config.processConcurrency()),
 	}
+
+	if !config.KeepDuplicates {
+		hashes, err := loadHashIndex(config.OutputDir)
+		if err != nil {
+			logWarning("Content deduplication disabled: %v", err)
+		} else {
+			d.hashes = hashes
+		}
+		validators, err := loadValidatorIndex(config.OutputDir)
+		if err != nil {
+			logWarning("ETag deduplication disabled: %v", err)
+		} else {
+			d.validators = validators
+		}
+	}
+	SetStripParams(config.StripParams)
+	SetAllowWebP(config.AllowWebP)
+	SetImageTypes(config.ImageTypes)
+	d.filters = buildFilters(config, d.hashes)
+	d.sink = newImageSink(config)
+	d.pdfImages = newExtractedImages(filepath.Join(config.OutputDir, pdfImageCacheDir))
+	d.dataURIImages = newExtractedImages(filepath.Join(config.OutputDir, dataURICacheDir))
+
+	return d
+}
+
+// Results returns the outcome of every download attempted so far, keyed by
+// image URL.
+func (d *Downloader) Results() map[string]downloadOutcome {
+	d.resultsMutex.Lock()
+	defer d.resultsMutex.Unlock()
+
+	results := make(map[string]downloadOutcome, len(d.results))
+	for imageURL, outcome := range d.results {
+		results[imageURL] = outcome
+	}
+	return results
 }
 
 func (d *Downloader) DownloadImages(imageURLs []string) error {
@@ -27,11 +150,44 @@ func (d *Downloader) DownloadImages(imageURLs []string) error {
 		return fmt.Errorf("no images to download")
 	}
 
-	d.progressBar = progressbar.NewOptions(len(imageURLs),
+	queue := make(chan string, len(imageURLs))
+	for _, imageURL := range imageURLs {
+		queue <- imageURL
+	}
+	close(queue)
+
+	d.progressBar = newDownloadProgressBar(len(imageURLs), true, true)
+	d.showProcessing()
+	d.download(queue)
+	return nil
+}
+
+// DownloadStream downloads image URLs as they arrive on queue until it is
+// closed, so downloads can start while the crawl is still discovering
+// images. The progress bar stays hidden because the crawler owns the
+// terminal while both run; the summary is printed once the queue drains.
+func (d *Downloader) DownloadStream(queue <-chan string) error {
+	d.progressBar = newDownloadProgressBar(-1, false, true)
+	d.showProcessing()
+	d.download(queue)
+	return nil
+}
+
+// newDownloadProgressBar returns the download progress bar. With details it
+// has a row below it for the processing bar, which must be shown before the
+// bar finishes.
+func newDownloadProgressBar(total int, visible, details bool) *progressbar.ProgressBar {
+	detailRows := 0
+	if details {
+		detailRows = 1
+	}
+	return progressbar.NewOptions(total,
 		progressbar.OptionSetDescription("Downloading images"),
 		progressbar.OptionSetWidth(40),
 		progressbar.OptionShowCount(),
 		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetVisibility(visible),
+		progressbar.OptionSetMaxDetailRow(detailRows),
 		progressbar.OptionSetTheme(progressbar.Theme{
 			Saucer:        "=",
 			SaucerHead:    ">",
@@ -40,15 +196,51 @@ func (d *Downloader) DownloadImages(imageURLs []string) error {
 			BarEnd:        "]",
 		}),
 	)
+}
+
+// toProcess counts a downloaded image handed to processing.
+func (d *Downloader) toProcess() {
+	d.processQueued.Add(1)
+}
+
+// processed counts an image that went through processing.
+func (d *Downloader) processed() {
+	d.processDone.Add(1)
+	d.showProcessing()
+}
 
-	semaphore := make(chan struct{}, d.config.Concurrency)
+// showProcessing shows how many of the images downloaded so far are
+// processed in a bar of its own, on the detail row below the download bar.
+func (d *Downloader) showProcessing() {
+	done, total := d.processDone.Load(), d.processQueued.Load()
+	filled := int(done * processBarWidth / max(total, 1))
+	bar := strings.Repeat("=", filled)
+	if filled < processBarWidth {
+		bar += ">" + strings.Repeat(" ", processBarWidth-filled-1)
+	}
+	d.progressBar.AddDetail(fmt.Sprintf("Processing images  %3d%% [%s] (%d/%d)", done*100/max(total, 1), bar, done, total))
+}
+
+// download works through queue, downloading as many images at once as the
+// download concurrency allows and processing as many as the process
+// concurrency allows, and prints a summary once it is closed and drained.
+func (d *Downloader) download(queue <-chan string) {
+	semaphore := make(chan struct{}, cap(d.fetchSlots)+cap(d.processSlots))
 	var wg sync.WaitGroup
 	var successCount int
 	var failCount int
 	var filteredCount int
+	var duplicateCount int
+	var unstartedCount int
 	var mu sync.Mutex
 
-	for _, imageURL := range imageURLs {
+	for imageURL := range queue {
+		// The queue is still drained so the crawl feeding it is not blocked;
+		// images left unstarted stay pending in the crawl state.
+		if d.config.StopDownloads && d.config.pastDeadline() {
+			unstartedCount++
+			continue
+		}
 		wg.Add(1)
 		semaphore <- struct{}{}
 
@@ -56,132 +248,423 @@ func (d *Downloader) DownloadImages(imageURLs []string) error {
 			defer wg.Done()
 			defer func() { <-semaphore }()
 
-			result := d.downloadImage(url)
+			outcome := d.downloadWithVariants(url)
+			result := outcome.Result
+
 			mu.Lock()
-			if result == 0 {
+			switch result {
+			case downloadSuccess:
 				successCount++
-			} else if result == 1 {
+			case downloadFailed:
 				failCount++
-			} else if result == 2 {
+			case downloadFiltered:
 				filteredCount++
+			case downloadDuplicate:
+				duplicateCount++
 			}
 			mu.Unlock()
 
+			d.resultsMutex.Lock()
+			d.results[url] = outcome
+			d.resultsMutex.Unlock()
+
 			d.progressBar.Add(1)
 		}(imageURL)
 	}
 
 	wg.Wait()
 	d.progressBar.Finish()
+	d.pdfImages.remove()
+	d.dataURIImages.remove()
 
 	fmt.Printf("\n\nDownload complete:\n")
 	fmt.Printf("  Successful: %d\n", successCount)
 	fmt.Printf("  Failed:     %d\n", failCount)
-	if d.config.MinWidth > 0 || d.config.MinHeight > 0 {
-		fmt.Printf("  Filtered:   %d (below min resolution)\n", filteredCount)
+	if filteredCount > 0 || d.config.limitsDimensions() || wantedImageStyle(d.config) != "" || d.config.SkipWatermarked {
+		fmt.Printf("  Filtered:   %d (rejected by image filters)\n", filteredCount)
+	}
+	if duplicateCount > 0 {
+		fmt.Printf("  Duplicates: %d (content already downloaded)\n", duplicateCount)
+	}
+	if unstartedCount > 0 {
+		fmt.Printf("  Pending:    %d (not started before -max-duration ran out)\n", unstartedCount)
+	}
+}
+
+// downloadImage fetches one image into a temporary file, runs the filters
+// over it, and hands it to the sink if it passes. outcome is filled in with
+// details about the stored file.
+func (d *Downloader) downloadImage(imageURL string, outcome *downloadOutcome) downloadResult {
+	outcome.File = d.config.convertedFileName(outcome.File)
+	filename := outcome.File
+
+	if d.sink.exists(filename) {
+		if prior := learnedParams.probe(filename, imageURL); prior != "" {
+			d.probeParams(prior, imageURL, filename)
+		}
+		logVerbose(d.config, "File already exists, skipping: %s", filename)
+		return downloadSuccess
+	}
+
+	partPath, size, result := d.fetchImage(imageURL, outcome)
+	if result != downloadSuccess {
+		return result
+	}
+	d.toProcess()
+	return d.processImage(imageURL, partPath, size, outcome)
+}
+
+// fetchImage downloads an image into a .part file, taking one of the
+// download slots while it does, and returns the file's path and size. The
+// mirrors of the image's host are tried in turn while the download fails.
+func (d *Downloader) fetchImage(imageURL string, outcome *downloadOutcome) (string, int64, downloadResult) {
+	d.fetchSlots <- struct{}{}
+	defer func() { <-d.fetchSlots }()
+
+	partPath, size, result := d.fetchFrom(imageURL, outcome)
+	for _, mirror := range d.config.mirrorURLs(imageURL) {
+		if result != downloadFailed {
+			break
+		}
+		logVerbose(d.config, "Trying mirror %s for %s", mirror, imageURL)
+		partPath, size, result = d.fetchFrom(mirror, outcome)
+	}
+	return partPath, size, result
+}
+
+// fetchFrom downloads the image at imageURL into a .part file and returns
+// the file's path and size.
+func (d *Downloader) fetchFrom(imageURL string, outcome *downloadOutcome) (string, int64, downloadResult) {
+	result, reason, head := d.precheckImage(imageURL, outcome)
+	if result != downloadSuccess {
+		logVerbose(d.config, "Skipped %s: %s", imageURL, reason)
+		outcome.Reason = reason
+		return "", 0, result
+	}
+
+	headSize := int64(-1)
+	if head != nil {
+		headSize = head.size
+		outcome.Headers = head.headers
+		if existing, duplicate := d.validators.lookup(imageURL, head.headers, outcome.File); duplicate {
+			reason := "duplicate of " + existing + ", same ETag or Last-Modified"
+			logVerbose(d.config, "Skipped %s: %s", imageURL, reason)
+			outcome.File, outcome.Reason = existing, reason
+			return "", 0, downloadDuplicate
+		}
+	}
+
+	// Download into a .part file and store it once complete and accepted,
+	// so an interrupted download never leaves a truncated image behind that
+	// the existence check above would later accept.
+	partPath := filepath.Join(d.config.OutputDir, outcome.File) + partFileSuffix
+	fileInfo, err := d.fetchVerified(imageURL, partPath, headSize)
+	if err != nil {
+		logVerbose(d.config, "Failed to download %s: %v", imageURL, err)
+		os.Remove(partPath)
+		outcome.Reason = err.Error()
+		return "", 0, downloadFailed
+	}
+	return partPath, fileInfo.Size(), downloadSuccess
+}
+
+// processImage validates a downloaded image, runs the filters over it, and
+// hands it to the sink if it passes, taking one of the process slots while
+// it does.
+func (d *Downloader) processImage(imageURL, partPath string, size int64, outcome *downloadOutcome) downloadResult {
+	d.processSlots <- struct{}{}
+	defer func() { <-d.processSlots }()
+	defer d.processed()
+
+	filename := outcome.File
+	mime, problem := validateImageFile(partPath)
+	if problem != "" {
+		logVerbose(d.config, "Rejected %s: %s", filename, problem)
+		os.Remove(partPath)
+		outcome.Reason = problem
+		return downloadFailed
+	}
+	if format := d.config.conversionFormat(mime); format != "" {
+		converted, err := convertImage(d.config, partPath, mime, format)
+		os.Remove(partPath)
+		if err != nil {
+			logVerbose(d.config, "Rejected %s: %v", filename, err)
+			outcome.Reason = err.Error()
+			return downloadFailed
+		}
+		partPath, mime = converted, conversionTargets[format].mime
+		filename = convertedName(filename, format)
+		outcome.File = filename
+		if info, err := os.Stat(partPath); err == nil {
+			size = info.Size()
+		}
+	}
+	if !extensionMatchesType(filename, mime) {
+		logVerbose(d.config, "Note: %s has a mismatched extension (content is %s)", filename, mime)
+	}
+
+	img := &fetchedImage{url: imageURL, file: filename, path: partPath, mime: mime, size: size}
+	for _, filter := range d.filters {
+		result, reason := filter.check(img, outcome)
+		if result == downloadSuccess {
+			continue
+		}
+		if result == downloadFailed {
+			logVerbose(d.config, "Rejected %s: %s", filename, reason)
+		} else {
+			logVerbose(d.config, "Filtered %s: %s", filename, reason)
+		}
+		if result == downloadFiltered {
+			outcome.Filter, outcome.MIME, outcome.Size = filter.name(), img.mime, img.size
+		}
+		os.Remove(partPath)
+		outcome.Reason = reason
+		return result
+	}
+
+	if err := d.sink.store(partPath, filename); err != nil {
+		logVerbose(d.config, "Failed to save %s: %v", filename, err)
+		os.Remove(partPath)
+		outcome.Reason = "could not save file: " + err.Error()
+		return downloadFailed
 	}
+	learnedParams.stored(filename, imageURL)
+	if err := d.validators.record(imageURL, outcome.Headers, filename); err != nil {
+		logWarning("%v", err)
+	}
+
+	return downloadSuccess
+}
+
+// fetchVerified downloads imageURL to outputPath, retrying when the result is
+// empty or the transfer ended short of the Content-Length its response
+// declared, so a truncated body is never mistaken for a complete image.
+// headSize, the size the pre-download check was told, is only compared when
+// the downloader cannot report on the transfer itself.
+func (d *Downloader) fetchVerified(imageURL, outputPath string, headSize int64) (os.FileInfo, error) {
+	var lastErr error
+	for attempt := 1; attempt <= maxDownloadAttempts; attempt++ {
+		if attempt > 1 {
+			logVerbose(d.config, "Retrying %s (attempt %d/%d): %v", imageURL, attempt, maxDownloadAttempts, lastErr)
+			time.Sleep(time.Duration(attempt-1) * downloadRetryDelay)
+		}
 
+		transfer, err := d.fetch(imageURL, outputPath)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		fileInfo, err := os.Stat(outputPath)
+		if err == nil {
+			err = verifyTransfer(fileInfo.Size(), transfer, headSize)
+		}
+		if err == nil {
+			return fileInfo, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// transferSize is what a downloader reports about the response it saved:
+// the bytes received and the Content-Length the response declared, each -1
+// when unknown.
+type transferSize struct {
+	received int64
+	declared int64
+}
+
+// unknownTransfer is reported by downloaders that cannot tell what they
+// received; their failures show in their exit status alone.
+var unknownTransfer = transferSize{received: -1, declared: -1}
+
+// verifyTransfer checks a saved file of size bytes against the transfer
+// that wrote it. Without a declared length from the transfer, headSize is
+// compared against the file instead, or nothing when that is unknown too.
+func verifyTransfer(size int64, transfer transferSize, headSize int64) error {
+	switch {
+	case size == 0:
+		return fmt.Errorf("empty response")
+	case transfer.declared >= 0 && transfer.received >= 0:
+		if transfer.received != transfer.declared {
+			return fmt.Errorf("received %d of %d declared bytes", transfer.received, transfer.declared)
+		}
+	case headSize >= 0 && size != headSize:
+		return fmt.Errorf("received %d of %d declared bytes", size, headSize)
+	}
 	return nil
 }
 
-func (d *Downloader) downloadImage(imageURL string) int {
-	filename := extractFilenameFromURL(imageURL)
-	outputPath := filepath.Join(d.config.OutputDir, filename)
+// parseCurlTransfer reads the "%{size_download} %header{content-length}"
+// curl writes out after a transfer. curl releases older than 7.84 write the
+// header variable unexpanded, leaving the declared length unknown.
+func parseCurlTransfer(output string) transferSize {
+	transfer := unknownTransfer
+	fields := strings.Fields(output)
+	if len(fields) > 0 {
+		if n, err := strconv.ParseInt(fields[0], 10, 64); err == nil {
+			transfer.received = n
+		}
+	}
+	if len(fields) > 1 {
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil && n > 0 {
+			transfer.declared = n
+		}
+	}
+	return transfer
+}
 
-	if _, err := os.Stat(outputPath); err == nil {
-		logVerbose(d.config, "File already exists, skipping: %s", filename)
-		return 0
+// fetch saves imageURL to outputPath, copying file:// URLs directly and
+// delegating everything else to the configured external downloader, and
+// reports what the transfer received where the downloader can tell. A
+// download that ends short of its Content-Length fails: curl exits with
+// status 18 and wget with status 4.
+func (d *Downloader) fetch(imageURL, outputPath string) (transferSize, error) {
+	switch urlScheme(imageURL) {
+	case "file":
+		return unknownTransfer, copyLocalFile(imageURL, outputPath)
+	case pdfImageScheme:
+		return unknownTransfer, d.fetchPDFImage(imageURL, outputPath)
+	case dataURIScheme:
+		return unknownTransfer, d.fetchDataURIImage(imageURL, outputPath)
 	}
 
+	proxy := d.config.proxies.pick()
+
 	var cmd *exec.Cmd
 
 	switch d.config.Downloader {
 	case "curl":
-		cmd = exec.Command("curl",
+		args := []string{
 			"-s",
 			"-L",
 			"-o", outputPath,
 			"--user-agent", d.config.UserAgent,
 			"--referer", imageURL,
 			"-H", "Accept: image/webp,image/apng,image/*,*/*;q=0.8",
-			"-H", "Accept-Language: en-US,en;q=0.9",
 			"--compressed",
 			"--connect-timeout", "10",
 			"--max-time", fmt.Sprintf("%d", int(d.config.Timeout.Seconds())),
 			"--max-redirs", "10",
-			imageURL,
-		)
+			"-w", "%{size_download} %header{content-length}",
+		}
+		for name, values := range d.config.requestHeaders() {
+			args = append(args, "-H", name+": "+values[0])
+		}
+		if proxy != nil {
+			args = append(args, "--proxy", proxy.String())
+		}
+		args = append(args, d.config.resolve.curlArgs(imageURL)...)
+		cmd = exec.Command("curl", append(args, imageURL)...)
+		var output strings.Builder
+		cmd.Stdout = &output
+		if err := cmd.Run(); err != nil {
+			return unknownTransfer, err
+		}
+		return parseCurlTransfer(output.String()), nil
 	case "wget":
-		cmd = exec.Command("wget",
+		args := []string{
 			"-q",
 			"-O", outputPath,
-			"--user-agent="+d.config.UserAgent,
-			"--referer="+imageURL,
+			"--user-agent=" + d.config.UserAgent,
+			"--referer=" + imageURL,
 			"--header=Accept: image/webp,image/apng,image/*,*/*;q=0.8",
-			"--header=Accept-Language: en-US,en;q=0.9",
 			"--timeout=10",
 			"--tries=3",
 			"--max-redirect=10",
-			imageURL,
-		)
+		}
+		for name, values := range d.config.requestHeaders() {
+			args = append(args, "--header="+name+": "+values[0])
+		}
+		if proxy != nil {
+			args = append(args, "-e", "use_proxy=yes", "-e", "http_proxy="+proxy.String(), "-e", "https_proxy="+proxy.String())
+		}
+		cmd = exec.Command("wget", append(args, imageURL)...)
 	default:
-		return 1
+		return unknownTransfer, fmt.Errorf("unsupported downloader: %s", d.config.Downloader)
 	}
 
-	if err := cmd.Run(); err != nil {
-		os.Remove(outputPath)
-		return 1
+	return unknownTransfer, cmd.Run()
+}
+
+// getImageDimensions reads an image's width and height from its header
+// without decoding the pixels. JPEG, PNG, GIF, BMP, TIFF, and WebP are read
+// natively; SVG dimensions come from the root element's attributes, and
+// AVIF and HEIC dimensions from the image sizes the file declares.
+func getImageDimensions(imagePath, mimeType string) (int, int, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		return 0, 0, err
 	}
+	defer file.Close()
 
-	fileInfo, err := os.Stat(outputPath)
+	var width, height int
+	if mimeType == "image/svg+xml" {
+		width, height, err = svgDimensions(file)
+	} else if _, ok := heifMIMETypes[mimeType]; ok {
+		width, height, err = heifDimensions(file)
+	} else {
+		var config image.Config
+		config, _, err = image.DecodeConfig(file)
+		width, height = config.Width, config.Height
+	}
 	if err != nil {
-		return 1
+		return 0, 0, fmt.Errorf("failed to read dimensions: %w", err)
 	}
 
-	if fileInfo.Size() == 0 {
-		os.Remove(outputPath)
-		return 1
+	if width <= 0 || height <= 0 {
+		return 0, 0, fmt.Errorf("invalid dimensions: %dx%d", width, height)
 	}
 
-	if d.config.MinWidth > 0 || d.config.MinHeight > 0 {
-		width, height, err := getImageDimensions(outputPath)
+	return width, height, nil
+}
+
+// svgDimensions returns the size declared on an SVG's root element, taken
+// from its width and height attributes or, failing that, its viewBox.
+func svgDimensions(r io.Reader) (int, int, error) {
+	decoder := xml.NewDecoder(r)
+	for {
+		token, err := decoder.Token()
 		if err != nil {
-			logVerbose(d.config, "Failed to get dimensions for %s: %v", filename, err)
-			os.Remove(outputPath)
-			return 1
+			return 0, 0, fmt.Errorf("no svg element found")
 		}
-
-		if (d.config.MinWidth > 0 && width < d.config.MinWidth) ||
-			(d.config.MinHeight > 0 && height < d.config.MinHeight) {
-			logVerbose(d.config, "Filtered %s: %dx%d (below minimum)", filename, width, height)
-			os.Remove(outputPath)
-			return 2
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if start.Name.Local != "svg" {
+			return 0, 0, fmt.Errorf("root element is %s, not svg", start.Name.Local)
 		}
-	}
-
-	return 0
-}
-func getImageDimensions(imagePath string) (int, int, error) {
-	cmd := exec.Command("identify", "-ping", "-format", "%w %h", imagePath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return 0, 0, fmt.Errorf("identify failed: %w (output: %s)", err, string(output))
-	}
 
-	outputStr := strings.TrimSpace(string(output))
-	if outputStr == "" {
-		return 0, 0, fmt.Errorf("empty output from identify")
-	}
+		var width, height float64
+		var viewBox string
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "width":
+				width = parseSVGLength(attr.Value)
+			case "height":
+				height = parseSVGLength(attr.Value)
+			case "viewBox":
+				viewBox = attr.Value
+			}
+		}
 
-	var width, height int
-	n, err := fmt.Sscanf(outputStr, "%d %d", &width, &height)
-	if err != nil || n != 2 {
-		return 0, 0, fmt.Errorf("failed to parse dimensions from: %s", outputStr)
+		if (width == 0 || height == 0) && viewBox != "" {
+			var minX, minY float64
+			fmt.Sscan(strings.ReplaceAll(viewBox, ",", " "), &minX, &minY, &width, &height)
+		}
+		return int(width), int(height), nil
 	}
+}
 
-	if width <= 0 || height <= 0 {
-		return 0, 0, fmt.Errorf("invalid dimensions: %dx%d", width, height)
+// parseSVGLength parses a pixel length such as "640" or "640px". Relative
+// units like percentages cannot be resolved and yield 0.
+func parseSVGLength(value string) float64 {
+	value = strings.TrimSuffix(strings.TrimSpace(value), "px")
+	length, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
 	}
-
-	return width, height, nil
+	return length
 }
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyTransfer(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		transfer transferSize
+		headSize int64
+		wantErr  bool
+	}{
+		{name: "complete transfer", size: 1000, transfer: transferSize{1000, 1000}, headSize: -1},
+		{name: "short transfer", size: 400, transfer: transferSize{400, 1000}, headSize: -1, wantErr: true},
+		{name: "empty file", size: 0, transfer: transferSize{0, 0}, headSize: -1, wantErr: true},
+		{name: "transfer wins over a differing head", size: 1200, transfer: transferSize{1200, 1200}, headSize: 1000},
+		{name: "compressed transfer wins over a differing head", size: 5000, transfer: transferSize{800, 800}, headSize: 5000},
+		{name: "head used without a declared length", size: 400, transfer: transferSize{400, -1}, headSize: 1000, wantErr: true},
+		{name: "head matches without a declared length", size: 1000, transfer: unknownTransfer, headSize: 1000},
+		{name: "nothing known", size: 400, transfer: unknownTransfer, headSize: -1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyTransfer(tt.size, tt.transfer, tt.headSize)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyTransfer(%d, %+v, %d) = %v, want error: %v", tt.size, tt.transfer, tt.headSize, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseCurlTransfer(t *testing.T) {
+	tests := []struct {
+		output string
+		want   transferSize
+	}{
+		{output: "5000 5000", want: transferSize{5000, 5000}},
+		{output: "400 1000", want: transferSize{400, 1000}},
+		{output: "5000 ", want: transferSize{5000, -1}},
+		{output: "5000 0", want: transferSize{5000, -1}},
+		{output: "5000 %header{content-length}", want: transferSize{5000, -1}},
+		{output: "", want: unknownTransfer},
+	}
+
+	for _, tt := range tests {
+		if got := parseCurlTransfer(tt.output); got != tt.want {
+			t.Errorf("parseCurlTransfer(%q) = %+v, want %+v", tt.output, got, tt.want)
+		}
+	}
+}
+
+func TestRequestHeadSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		respond func(w http.ResponseWriter)
+		want    int64
+	}{
+		{
+			name:   "content length",
+			method: http.MethodHead,
+			respond: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Length", "12345")
+			},
+			want: 12345,
+		},
+		{
+			name:    "zero content length is unknown",
+			method:  http.MethodHead,
+			respond: func(w http.ResponseWriter) { w.Header().Set("Content-Length", "0") },
+			want:    -1,
+		},
+		{
+			name:   "content range total",
+			method: http.MethodGet,
+			respond: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Range", "bytes 0-0/12345")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("x"))
+			},
+			want: 12345,
+		},
+		{
+			name:   "content range without a total",
+			method: http.MethodGet,
+			respond: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Range", "bytes 0-0/*")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write([]byte("x"))
+			},
+			want: -1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				tt.respond(w)
+			}))
+			defer server.Close()
+
+			d := &Downloader{config: &Config{}, client: server.Client()}
+			head, err := d.requestHead(tt.method, server.URL+"/image.jpg")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if head.size != tt.want {
+				t.Errorf("size = %d, want %d", head.size, tt.want)
+			}
+		})
+	}
+}
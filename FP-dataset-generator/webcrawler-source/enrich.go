@@ -0,0 +1,323 @@
+package main
+
+import (
+	"cmp"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// The enrich command looks up the downloaded images that came from crawled
+// pages, which lack the attribution a provider API gives, on Wikimedia
+// Commons by their SHA-1, which Commons indexes for every file. The author,
+// license, title, and depicted subjects of the files found there fill the
+// gaps in the crawl state and manifests. Openverse offers no lookup by
+// hash; the Commons files it indexes are found this way anyway.
+
+const (
+	commonsAPIURL  = "https://commons.wikimedia.org/w/api.php"
+	wikidataAPIURL = "https://www.wikidata.org/w/api.php"
+
+	// depictsProperty is the "depicts" statement of Commons files.
+	depictsProperty = "P180"
+
+	// wikidataBatchSize is the most entities one request may ask for.
+	wikidataBatchSize = 50
+)
+
+// commonsFile is what Commons records about a file.
+type commonsFile struct {
+	pageID      int
+	title       string
+	attribution Attribution
+}
+
+// commonsLookup queries Commons and Wikidata.
+type commonsLookup struct {
+	client    *http.Client
+	userAgent string
+	language  string
+}
+
+func newCommonsLookup(cfg *Config) *commonsLookup {
+	return &commonsLookup{
+		client:    &http.Client{Timeout: cfg.Timeout, Transport: newCrawlerTransport(cfg)},
+		userAgent: cfg.UserAgent,
+		language:  cmp.Or(cfg.Language, "en"),
+	}
+}
+
+// mediaWikiResponse holds the error MediaWiki APIs report, often with a
+// 200 status.
+type mediaWikiResponse struct {
+	Error *struct {
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+func mediaWikiError(body []byte) string {
+	var response mediaWikiResponse
+	if json.Unmarshal(body, &response) == nil && response.Error != nil {
+		return response.Error.Info
+	}
+	return string(body)
+}
+
+// get queries the MediaWiki API at apiURL and decodes its response into v.
+func (l *commonsLookup) get(apiURL string, query url.Values, v any) error {
+	query.Set("format", "json")
+	query.Set("formatversion", "2")
+	req, err := http.NewRequest(http.MethodGet, apiURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", l.userAgent)
+
+	var body json.RawMessage
+	if err := getProviderJSON(l.client, req, &body, mediaWikiError); err != nil {
+		return err
+	}
+	var failure mediaWikiResponse
+	if json.Unmarshal(body, &failure) == nil && failure.Error != nil {
+		return errors.New(failure.Error.Info)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	return nil
+}
+
+// file returns the Commons file with the given SHA-1, or nil when Commons
+// has none.
+func (l *commonsLookup) file(sum string) (*commonsFile, error) {
+	query := url.Values{}
+	query.Set("action", "query")
+	query.Set("generator", "allimages")
+	query.Set("gaisha1", sum)
+	query.Set("gailimit", "1")
+	query.Set("prop", "imageinfo")
+	query.Set("iiprop", "url|extmetadata")
+	query.Set("iiextmetadatafilter", "Artist|LicenseShortName|LicenseUrl|ObjectName")
+
+	type metadataValue struct {
+		Value string `json:"value"`
+	}
+	var response struct {
+		Query struct {
+			Pages []struct {
+				PageID    int    `json:"pageid"`
+				Title     string `json:"title"`
+				ImageInfo []struct {
+					DescriptionURL string `json:"descriptionurl"`
+					ExtMetadata    struct {
+						Artist           metadataValue `json:"Artist"`
+						LicenseShortName metadataValue `json:"LicenseShortName"`
+						LicenseURL       metadataValue `json:"LicenseUrl"`
+						ObjectName       metadataValue `json:"ObjectName"`
+					} `json:"extmetadata"`
+				} `json:"imageinfo"`
+			} `json:"pages"`
+		} `json:"query"`
+	}
+	if err := l.get(commonsAPIURL, query, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Query.Pages) == 0 || len(response.Query.Pages[0].ImageInfo) == 0 {
+		return nil, nil
+	}
+
+	page := response.Query.Pages[0]
+	name := strings.TrimPrefix(page.Title, "File:")
+	info := page.ImageInfo[0]
+	metadata := info.ExtMetadata
+	author, authorURL := htmlTextAndLink(metadata.Artist.Value)
+	license, _ := htmlTextAndLink(metadata.LicenseShortName.Value)
+	title, _ := htmlTextAndLink(metadata.ObjectName.Value)
+	return &commonsFile{
+		pageID: page.PageID,
+		title:  cmp.Or(title, strings.TrimSuffix(name, path.Ext(name))),
+		attribution: Attribution{
+			Author:     author,
+			AuthorURL:  authorURL,
+			Page:       info.DescriptionURL,
+			License:    license,
+			LicenseURL: metadata.LicenseURL.Value,
+		},
+	}, nil
+}
+
+// depicts returns the names of what the Commons file with the given page ID
+// is stated to depict.
+func (l *commonsLookup) depicts(pageID int) ([]string, error) {
+	entity := fmt.Sprintf("M%d", pageID)
+	query := url.Values{}
+	query.Set("action", "wbgetentities")
+	query.Set("ids", entity)
+	query.Set("props", "claims")
+
+	var response struct {
+		Entities map[string]struct {
+			Statements json.RawMessage `json:"statements"`
+		} `json:"entities"`
+	}
+	if err := l.get(commonsAPIURL, query, &response); err != nil {
+		return nil, err
+	}
+	// Files without statements have an empty list in place of the map.
+	var statements map[string][]struct {
+		Mainsnak struct {
+			Datavalue struct {
+				Value struct {
+					ID string `json:"id"`
+				} `json:"value"`
+			} `json:"datavalue"`
+		} `json:"mainsnak"`
+	}
+	if json.Unmarshal(response.Entities[entity].Statements, &statements) != nil {
+		return nil, nil
+	}
+
+	var items []string
+	for _, statement := range statements[depictsProperty] {
+		if id := statement.Mainsnak.Datavalue.Value.ID; id != "" {
+			items = append(items, id)
+		}
+	}
+	return l.labels(items)
+}
+
+// labels returns the names of Wikidata items in the lookup's language, or
+// in English where they have none in it.
+func (l *commonsLookup) labels(items []string) ([]string, error) {
+	var names []string
+	for start := 0; start < len(items); start += wikidataBatchSize {
+		batch := items[start:min(start+wikidataBatchSize, len(items))]
+		query := url.Values{}
+		query.Set("action", "wbgetentities")
+		query.Set("ids", strings.Join(batch, "|"))
+		query.Set("props", "labels")
+		query.Set("languages", l.language+"|en")
+
+		var response struct {
+			Entities map[string]struct {
+				Labels map[string]struct {
+					Value string `json:"value"`
+				} `json:"labels"`
+			} `json:"entities"`
+		}
+		if err := l.get(wikidataAPIURL, query, &response); err != nil {
+			return names, err
+		}
+		for _, item := range batch {
+			labels := response.Entities[item].Labels
+			if name := cmp.Or(labels[l.language].Value, labels["en"].Value); name != "" {
+				names = mergeTags(names, []string{name})
+			}
+		}
+	}
+	return names, nil
+}
+
+// htmlTextAndLink returns the text of an HTML fragment, as Commons metadata
+// holds, and the target of its first link.
+func htmlTextAndLink(fragment string) (string, string) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(fragment))
+	if err != nil {
+		return strings.TrimSpace(fragment), ""
+	}
+	text := strings.Join(strings.Fields(doc.Text()), " ")
+	href, ok := doc.Find("a[href]").First().Attr("href")
+	if !ok {
+		return text, ""
+	}
+	base, _ := url.Parse(commonsAPIURL)
+	link, err := base.Parse(href)
+	if err != nil {
+		return text, ""
+	}
+	return text, link.String()
+}
+
+// sha1File returns the hex-encoded SHA-1 of the file at path, the hash
+// Commons indexes its files by.
+func sha1File(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha1.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// enrichRecords looks the files of records up on Commons one at a time,
+// pausing -rate-limit between them, and fills in what records lack: the
+// attribution, the license, the title, and the depicted subjects as tags.
+// It returns how many files were found, not found, and could not be looked
+// up, and stops early on Ctrl+C, keeping what was found.
+func enrichRecords(cfg *Config, records []*ImageRecord) (found, missing, failed int) {
+	lookup := newCommonsLookup(cfg)
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	for i, record := range records {
+		if i > 0 {
+			select {
+			case <-interrupts:
+				fmt.Println("\n\nInterrupt received, stopping the lookups")
+				return found, missing, failed
+			case <-time.After(time.Duration(cfg.RateLimitMs) * time.Millisecond):
+			}
+		}
+
+		sum, err := sha1File(filepath.Join(cfg.OutputDir, record.File))
+		if err != nil {
+			logVerbose(cfg, "Could not hash %s: %v", record.File, err)
+			failed++
+			continue
+		}
+		file, err := lookup.file(sum)
+		if err != nil {
+			logVerbose(cfg, "Could not look up %s: %v", record.File, err)
+			failed++
+			continue
+		}
+		if file == nil {
+			logVerbose(cfg, "Not on Commons: %s", record.File)
+			missing++
+			continue
+		}
+
+		found++
+		logVerbose(cfg, "Found %s on Commons: %s", record.File, file.attribution.Page)
+		record.Attribution = &file.attribution
+		record.License = cmp.Or(record.License, attributionLicense(record.Attribution))
+		record.Title = cmp.Or(record.Title, file.title)
+		depicts, err := lookup.depicts(file.pageID)
+		if err != nil {
+			logVerbose(cfg, "Could not look up what %s depicts: %v", record.File, err)
+		}
+		record.Tags = mergeTags(record.Tags, depicts)
+	}
+	return found, missing, failed
+}
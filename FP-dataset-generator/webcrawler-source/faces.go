@@ -0,0 +1,121 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+	"image"
+	"slices"
+
+	pigo "github.com/esimov/pigo/core"
+	"golang.org/x/image/draw"
+)
+
+// -faces runs a small face detector, the pico facefinder cascade through
+// pigo, on each downloaded image, keeping only the images with a face for
+// face datasets, or only those without one for privacy-safe datasets. The
+// cascade is embedded in the binary, so nothing else is needed.
+//
+//go:embed cascades/facefinder
+var faceCascade []byte
+
+const (
+	facesRequire = "require"
+	facesExclude = "exclude"
+
+	// faceDetectSize is the longest side images are scaled down to before
+	// detection, which keeps it fast on large photos.
+	faceDetectSize = 640
+
+	// faceMinQuality is the least detection score taken as a face; lower
+	// scores are mostly textures that look like one.
+	faceMinQuality = 5.0
+)
+
+// faceModes are the values -faces accepts.
+var faceModes = []string{facesRequire, facesExclude}
+
+// faceDetector finds faces with the facefinder cascade. It may look at
+// several images at once.
+type faceDetector struct {
+	cascade *pigo.Pigo
+}
+
+// count returns how many faces are found in img.
+func (d *faceDetector) count(img image.Image) int {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > faceDetectSize {
+		width, height = max(width*faceDetectSize/longest, 1), max(height*faceDetectSize/longest, 1)
+		scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, bounds, draw.Src, nil)
+		img = scaled
+	}
+
+	detections := d.cascade.RunCascade(pigo.CascadeParams{
+		MinSize:     max(min(width, height)/20, 20),
+		MaxSize:     min(width, height),
+		ShiftFactor: 0.1,
+		ScaleFactor: 1.1,
+		ImageParams: pigo.ImageParams{
+			Pixels: pigo.RgbToGrayscale(img),
+			Rows:   height,
+			Cols:   width,
+			Dim:    width,
+		},
+	}, 0)
+
+	faces := 0
+	for _, detection := range d.cascade.ClusterDetections(detections, 0.2) {
+		if detection.Q >= faceMinQuality {
+			faces++
+		}
+	}
+	return faces
+}
+
+// faceFilter keeps the images with a face, or those without one, as -faces
+// asks. Images that cannot be checked, SVGs and those that cannot be
+// decoded, are rejected in either mode: one with a face must not slip into a
+// privacy-safe dataset, nor an unchecked one into a face dataset.
+type faceFilter struct {
+	cfg *Config
+}
+
+func (faceFilter) name() string { return filterFaces }
+
+func (f faceFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	if img.mime == "image/svg+xml" {
+		return downloadFiltered, "could not check for faces"
+	}
+	decoded, err := decodeImageFile(img.path)
+	if err != nil {
+		logVerbose(f.cfg, "Could not look for faces in %s: %v", img.file, err)
+		return downloadFiltered, "could not check for faces"
+	}
+
+	faces := f.cfg.faces.count(decoded)
+	switch {
+	case f.cfg.Faces == facesRequire && faces == 0:
+		return downloadFiltered, "no face found"
+	case f.cfg.Faces == facesExclude && faces > 0:
+		return downloadFiltered, fmt.Sprintf("%d face(s) found", faces)
+	}
+	return downloadSuccess, ""
+}
+
+// validateFaces checks -faces and loads the face detector.
+func validateFaces(cfg *Config) []string {
+	cfg.faces = nil
+	if cfg.Faces == "" {
+		return nil
+	}
+	if !slices.Contains(faceModes, cfg.Faces) {
+		return []string{fmt.Sprintf("faces must be %s or %s", facesRequire, facesExclude)}
+	}
+	cascade, err := pigo.NewPigo().Unpack(faceCascade)
+	if err != nil {
+		return []string{"failed to load the face detector: " + err.Error()}
+	}
+	cfg.faces = &faceDetector{cascade: cascade}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// failuresFileName lists the images whose last download failed, one
+// "<url>\t<reason>" line each, for the retry-failed command. It can be
+// edited by hand to drop URLs that are not worth retrying.
+const failuresFileName = "failures.tsv"
+
+func failuresPath(outputDir string) string {
+	return filepath.Join(outputDir, failuresFileName)
+}
+
+// writeFailures rewrites the failures file from state, removing it when no
+// download has failed.
+func writeFailures(outputDir string, state *CrawlState) error {
+	records := state.failedRecords()
+	if len(records) == 0 {
+		if err := os.Remove(failuresPath(outputDir)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove failures file: %w", err)
+		}
+		return nil
+	}
+
+	var b strings.Builder
+	for _, record := range records {
+		reason := strings.Join(strings.Fields(record.Error), " ")
+		if reason == "" {
+			reason = "unknown error"
+		}
+		fmt.Fprintf(&b, "%s\t%s\n", record.URL, reason)
+	}
+
+	if err := os.WriteFile(failuresPath(outputDir), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write failures file: %w", err)
+	}
+	return nil
+}
+
+// loadFailures returns the URLs listed in the failures file.
+func loadFailures(outputDir string) ([]string, error) {
+	file, err := os.Open(failuresPath(outputDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read failures file: %w", err)
+	}
+	defer file.Close()
+
+	var urls []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		imageURL, _, _ := strings.Cut(scanner.Text(), "\t")
+		if imageURL = strings.TrimSpace(imageURL); imageURL != "" && !strings.HasPrefix(imageURL, "#") {
+			urls = append(urls, imageURL)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read failures file: %w", err)
+	}
+	return urls, nil
+}
+
+// saveDownloadResults records a download batch in state, then saves the
+// state, the failures file, and the attribution of new provider images.
+func saveDownloadResults(cfg *Config, state *CrawlState, results map[string]downloadOutcome) error {
+	state.applyResults(results)
+	state.assignSplits(cfg)
+	if err := saveState(cfg.OutputDir, state); err != nil {
+		return err
+	}
+	if err := writeFailures(cfg.OutputDir, state); err != nil {
+		return err
+	}
+	if err := writeManifest(cfg.OutputDir, state, cfg.Manifest); err != nil {
+		return err
+	}
+	return writeAttributionSidecars(cfg.OutputDir, state, results)
+}
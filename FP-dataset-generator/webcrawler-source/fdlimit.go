@@ -0,0 +1,60 @@
+package main
+
+// Each worker holds files open while it works: a crawl worker its
+// connection and the page it reads, a download the /dev/null and pipes of
+// the curl or wget it spawns and its pidfd, a processing worker the image it
+// reads and the file it stores. Past ulimit -n, opening any of them fails
+// with "too many open files", which surfaces as failed downloads.
+const (
+	filesPerCrawlWorker = 2
+	filesPerDownload    = 5
+	filesPerProcess     = 2
+
+	// filesReserved covers standard streams, state and log files, and idle
+	// keep-alive connections.
+	filesReserved = 32
+)
+
+// filesNeeded estimates the files open at once with the given workers.
+func filesNeeded(crawl, download, process int) int {
+	return filesReserved + crawl*filesPerCrawlWorker + download*filesPerDownload + process*filesPerProcess
+}
+
+// capToFileLimit lowers the crawl, download, and processing concurrency,
+// in proportion, until the files they hold open fit under ulimit -n, and
+// says so. The -concurrency auto ceiling is capped the same way.
+func capToFileLimit(cfg *Config) {
+	limit := openFileLimit()
+	if limit == 0 {
+		return
+	}
+
+	crawl := cfg.Concurrency
+	if cfg.AutoConcurrency {
+		crawl = cfg.autoscaleCeiling()
+	}
+	download, process := cfg.downloadConcurrency(), cfg.processConcurrency()
+	needed := filesNeeded(crawl, download, process)
+	if needed <= limit {
+		return
+	}
+
+	scale := float64(limit-filesReserved) / float64(needed-filesReserved)
+	capped := func(n int) int { return max(1, int(float64(n)*scale)) }
+	newCrawl, newDownload, newProcess := capped(crawl), capped(download), capped(process)
+
+	if cfg.AutoConcurrency {
+		cfg.maxCrawlWorkers = newCrawl
+	} else {
+		cfg.Concurrency = newCrawl
+	}
+	cfg.DownloadWorkers, cfg.ProcessWorkers = newDownload, newProcess
+
+	logWarning("The open file limit (ulimit -n) is %d, too low for %d crawl, %d download, and %d process workers (about %d files).",
+		limit, crawl, download, process, needed)
+	logWarning("Using %d crawl, %d download, and %d process workers instead. Raise the limit with ulimit -n %d to run them all.",
+		newCrawl, newDownload, newProcess, needed)
+	if filesNeeded(newCrawl, newDownload, newProcess) > limit {
+		logWarning("Even one worker of each kind may run out of files; expect \"too many open files\" errors.")
+	}
+}
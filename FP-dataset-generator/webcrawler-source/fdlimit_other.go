@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+// openFileLimit returns 0 where there is no ulimit -n to read; concurrency
+// is then left as configured.
+func openFileLimit() int {
+	return 0
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extensionMIMETypes maps the supported image extensions to the MIME type
+// their content should sniff as.
+var extensionMIMETypes = map[string]string{
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+	".gif":  "image/gif",
+	".bmp":  "image/bmp",
+	".svg":  "image/svg+xml",
+	".ico":  "image/x-icon",
+	".tiff": "image/tiff",
+	".tif":  "image/tiff",
+	".webp": "image/webp",
+	".avif": "image/avif",
+	".heic": "image/heic",
+	".heif": "image/heif",
+}
+
+// sniffFileType returns the MIME type of the file at path based on its
+// leading bytes. It extends http.DetectContentType with the formats the
+// standard sniffer does not know (TIFF, SVG, AVIF, HEIC).
+func sniffFileType(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	return sniffBytes(head[:n]), nil
+}
+
+func sniffBytes(head []byte) string {
+	if bytes.HasPrefix(head, []byte("II*\x00")) || bytes.HasPrefix(head, []byte("MM\x00*")) {
+		return "image/tiff"
+	}
+	if mime := heifBrandType(head); mime != "" {
+		return mime
+	}
+
+	detected := http.DetectContentType(head)
+	if idx := strings.Index(detected, ";"); idx != -1 {
+		detected = detected[:idx]
+	}
+
+	// SVG sniffs as XML or plain text; look for the root element.
+	if detected == "text/xml" || detected == "text/plain" {
+		if bytes.Contains(bytes.ToLower(head), []byte("<svg")) {
+			return "image/svg+xml"
+		}
+	}
+
+	return detected
+}
+
+// validateImageFile checks that a downloaded file really holds an image.
+// CDNs frequently answer with HTML error pages, JSON, or plain text under a
+// 200 status, which would otherwise be kept as images. It returns the
+// sniffed MIME type and an explanation when the content is not acceptable.
+func validateImageFile(path string) (string, string) {
+	detected, err := sniffFileType(path)
+	if err != nil {
+		return "", "could not read file: " + err.Error()
+	}
+
+	// Types added with -image-types that the sniffer does not know are
+	// taken on the word of the file's extension.
+	if detected == "application/octet-stream" && imageMIMETypes != nil {
+		ext := strings.ToLower(filepath.Ext(strings.TrimSuffix(path, partFileSuffix)))
+		if _, known := extensionMIMETypes[ext]; !known && ext != "" && isSupportedImageMIME(imageTypeMIME(ext)) {
+			detected = imageTypeMIME(ext)
+		}
+	}
+
+	if !strings.HasPrefix(detected, "image/") {
+		return detected, "content is " + detected + ", not an image"
+	}
+
+	if !isSupportedImageMIME(detected) {
+		return detected, "unsupported image format " + detected
+	}
+
+	return detected, ""
+}
+
+// extensionMatchesType reports whether path's extension agrees with the
+// sniffed MIME type. Files without a known extension always match.
+func extensionMatchesType(path, mime string) bool {
+	expected, known := extensionMIMETypes[strings.ToLower(filepath.Ext(path))]
+	return !known || expected == mime
+}
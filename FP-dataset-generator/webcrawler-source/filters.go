@@ -0,0 +1,243 @@
+package main
+
+import "fmt"
+
+// fetchedImage is a downloaded image waiting for the filters, before the
+// sink stores it.
+type fetchedImage struct {
+	url  string
+	file string // name the sink stores it under
+	path string // where the download is until then
+	mime string // sniffed content type
+	size int64
+}
+
+// imageFilter decides whether a downloaded image is kept. check returns
+// downloadSuccess to keep it, or the result to record and why. name is what
+// images it filters are recorded as filtered by.
+type imageFilter interface {
+	check(img *fetchedImage, outcome *downloadOutcome) (downloadResult, string)
+	name() string
+}
+
+// Names of the filters, as recorded with the images they filter.
+const (
+	filterTypes      = "types"
+	filterFileSize   = "max-file-size"
+	filterDimensions = "min-size"
+	filterStyle      = "style"
+	filterWatermark  = "watermark"
+	filterSharpness  = "sharpness"
+	filterDuplicate  = "duplicate"
+	filterNSFW       = "nsfw"
+	filterFaces      = "faces"
+
+	// filterClassConflict marks images moved out of their class by
+	// -quarantine-conflicts, as another class stored them too.
+	filterClassConflict = "class-conflict"
+)
+
+// buildFilters returns the filters the configuration enables, cheapest
+// first. Deduplication runs last so only images that are kept claim their
+// content hash.
+func buildFilters(cfg *Config, hashes *hashIndex) []imageFilter {
+	var filters []imageFilter
+	if cfg.allowedMIMETypes != nil {
+		filters = append(filters, typeFilter{cfg: cfg})
+	}
+	if cfg.maxFileSizeBytes > 0 {
+		filters = append(filters, fileSizeFilter{limit: cfg.maxFileSizeBytes})
+	}
+	if cfg.limitsDimensions() {
+		filters = append(filters, dimensionFilter{cfg: cfg})
+	}
+	if wanted := wantedImageStyle(cfg); wanted != "" {
+		filters = append(filters, styleFilter{cfg: cfg, wanted: wanted})
+	}
+	if cfg.SkipWatermarked {
+		filters = append(filters, watermarkFilter{cfg: cfg})
+	}
+	if cfg.MinSharpness > 0 {
+		filters = append(filters, sharpnessFilter{cfg: cfg})
+	}
+	if cfg.faces != nil {
+		filters = append(filters, faceFilter{cfg: cfg})
+	}
+	if cfg.nsfw != nil {
+		filters = append(filters, nsfwFilter{cfg: cfg})
+	}
+	if hashes != nil {
+		filters = append(filters, dedupFilter{hashes: hashes})
+	}
+	return filters
+}
+
+// typeFilter keeps the image types listed in -types.
+type typeFilter struct {
+	cfg *Config
+}
+
+func (typeFilter) name() string { return filterTypes }
+
+func (f typeFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	if !f.cfg.allowsImageType(img.mime) {
+		return downloadFiltered, "type " + img.mime + " not in -types"
+	}
+	return downloadSuccess, ""
+}
+
+// fileSizeFilter rejects images larger than -max-file-size.
+type fileSizeFilter struct {
+	limit uint64
+}
+
+func (fileSizeFilter) name() string { return filterFileSize }
+
+func (f fileSizeFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	if uint64(img.size) > f.limit {
+		return downloadFiltered, formatBytes(uint64(img.size)) + " exceeds -max-file-size"
+	}
+	return downloadSuccess, ""
+}
+
+// dimensionFilter rejects images outside -min-width, -max-width,
+// -min-height, -max-height, -min-aspect, or -max-aspect.
+type dimensionFilter struct {
+	cfg *Config
+}
+
+func (dimensionFilter) name() string { return filterDimensions }
+
+func (f dimensionFilter) check(img *fetchedImage, outcome *downloadOutcome) (downloadResult, string) {
+	width, height, err := getImageDimensions(img.path, img.mime)
+	if err != nil {
+		return downloadFailed, err.Error()
+	}
+	outcome.Width, outcome.Height = width, height
+	if problem := f.cfg.dimensionProblem(width, height); problem != "" {
+		return downloadFiltered, fmt.Sprintf("%dx%d (%s)", width, height, problem)
+	}
+	return downloadSuccess, ""
+}
+
+// limitsDimensions reports whether any size or aspect ratio limit is set.
+func (cfg *Config) limitsDimensions() bool {
+	return cfg.MinWidth > 0 || cfg.MinHeight > 0 || cfg.MaxWidth > 0 || cfg.MaxHeight > 0 ||
+		cfg.MinAspect > 0 || cfg.MaxAspect > 0
+}
+
+// dimensionProblem returns how an image of width x height breaks the size
+// and aspect ratio limits, or "" when it does not.
+func (cfg *Config) dimensionProblem(width, height int) string {
+	switch {
+	case (cfg.MinWidth > 0 && width < cfg.MinWidth) || (cfg.MinHeight > 0 && height < cfg.MinHeight):
+		return "below minimum"
+	case (cfg.MaxWidth > 0 && width > cfg.MaxWidth) || (cfg.MaxHeight > 0 && height > cfg.MaxHeight):
+		return "above maximum"
+	}
+	if height == 0 {
+		return ""
+	}
+	aspect := float64(width) / float64(height)
+	switch {
+	case cfg.MinAspect > 0 && aspect < cfg.MinAspect:
+		return fmt.Sprintf("aspect ratio %.2f below -min-aspect", aspect)
+	case cfg.MaxAspect > 0 && aspect > cfg.MaxAspect:
+		return fmt.Sprintf("aspect ratio %.2f above -max-aspect", aspect)
+	}
+	return ""
+}
+
+// styleFilter keeps only photographs or only illustrations. Images that
+// cannot be classified are kept.
+type styleFilter struct {
+	cfg    *Config
+	wanted string
+}
+
+func (styleFilter) name() string { return filterStyle }
+
+func (f styleFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	style, err := classifyImageStyle(img.path, img.mime)
+	if err != nil {
+		logVerbose(f.cfg, "Could not classify %s, keeping it: %v", img.file, err)
+		return downloadSuccess, ""
+	}
+	if style != f.wanted {
+		return downloadFiltered, fmt.Sprintf("looks like %s, want %s", style, f.wanted)
+	}
+	return downloadSuccess, ""
+}
+
+// watermarkFilter rejects images with a detected watermark. Images that
+// cannot be analysed are kept.
+type watermarkFilter struct {
+	cfg *Config
+}
+
+func (watermarkFilter) name() string { return filterWatermark }
+
+func (f watermarkFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	pattern, err := detectWatermark(img.path)
+	if err != nil {
+		logVerbose(f.cfg, "Could not check %s for watermarks, keeping it: %v", img.file, err)
+		return downloadSuccess, ""
+	}
+	if pattern != "" {
+		return downloadFiltered, "watermark detected (" + pattern + ")"
+	}
+	return downloadSuccess, ""
+}
+
+// dedupFilter rejects images whose content is already stored under another
+// name, pointing the outcome at that file instead.
+type dedupFilter struct {
+	hashes *hashIndex
+}
+
+func (dedupFilter) name() string { return filterDuplicate }
+
+func (f dedupFilter) check(img *fetchedImage, outcome *downloadOutcome) (downloadResult, string) {
+	sum, err := hashFile(img.path)
+	if err != nil {
+		return downloadFailed, "could not hash file: " + err.Error()
+	}
+	outcome.SHA256 = sum
+
+	existing, duplicate, err := f.hashes.claim(sum, img.file)
+	if err != nil {
+		logWarning("%v", err)
+		return downloadSuccess, ""
+	}
+	if duplicate {
+		outcome.File = existing
+		return downloadDuplicate, "duplicate of " + existing
+	}
+	return downloadSuccess, ""
+}
+
+// passesRelaxedFilter reports whether a filtered image would pass the
+// filter that rejected it with the current configuration, judged by what
+// was measured of it then. Images filtered before their measurements were
+// recorded are never judged to pass.
+func passesRelaxedFilter(cfg *Config, record ImageRecord) bool {
+	switch record.FilteredBy {
+	case filterTypes:
+		return record.MIME != "" && cfg.allowsImageType(record.MIME)
+	case filterFileSize:
+		return cfg.maxFileSizeBytes == 0 || (record.Size > 0 && uint64(record.Size) <= cfg.maxFileSizeBytes)
+	case filterDimensions:
+		return record.Width > 0 && record.Height > 0 && cfg.dimensionProblem(record.Width, record.Height) == ""
+	case filterStyle:
+		return wantedImageStyle(cfg) == ""
+	case filterWatermark:
+		return !cfg.SkipWatermarked
+	case filterSharpness:
+		return cfg.MinSharpness == 0 || record.Sharpness >= cfg.MinSharpness
+	case filterNSFW:
+		return cfg.nsfw == nil
+	case filterFaces:
+		return cfg.faces == nil
+	}
+	return false
+}
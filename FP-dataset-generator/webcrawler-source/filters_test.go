@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+func TestDimensionProblem(t *testing.T) {
+	tests := []struct {
+		name          string
+		cfg           Config
+		width, height int
+		want          string
+	}{
+		{name: "no limits", width: 10, height: 10000},
+		{name: "below min width", cfg: Config{MinWidth: 100}, width: 99, height: 500, want: "below minimum"},
+		{name: "at min width", cfg: Config{MinWidth: 100}, width: 100, height: 500},
+		{name: "above max height", cfg: Config{MaxHeight: 1000}, width: 500, height: 1001, want: "above maximum"},
+		{name: "at max height", cfg: Config{MaxHeight: 1000}, width: 500, height: 1000},
+		{name: "below min aspect", cfg: Config{MinAspect: 1}, width: 300, height: 400, want: "aspect ratio 0.75 below -min-aspect"},
+		{name: "above max aspect", cfg: Config{MaxAspect: 2}, width: 900, height: 300, want: "aspect ratio 3.00 above -max-aspect"},
+		{name: "within aspect range", cfg: Config{MinAspect: 1, MaxAspect: 2}, width: 1600, height: 900},
+		{name: "size checked before aspect", cfg: Config{MinWidth: 500, MaxAspect: 2}, width: 400, height: 100, want: "below minimum"},
+		{name: "zero height skips aspect", cfg: Config{MinAspect: 1}, width: 100, height: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.dimensionProblem(tt.width, tt.height); got != tt.want {
+				t.Errorf("dimensionProblem(%d, %d) = %q, want %q", tt.width, tt.height, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPassesRelaxedFilter(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfg    Config
+		record ImageRecord
+		want   bool
+	}{
+		{name: "type now allowed", cfg: Config{allowedMIMETypes: map[string]struct{}{"image/png": {}}}, record: ImageRecord{FilteredBy: filterTypes, MIME: "image/png"}, want: true},
+		{name: "type still excluded", cfg: Config{allowedMIMETypes: map[string]struct{}{"image/png": {}}}, record: ImageRecord{FilteredBy: filterTypes, MIME: "image/gif"}},
+		{name: "type unknown", record: ImageRecord{FilteredBy: filterTypes}},
+		{name: "size limit lifted", record: ImageRecord{FilteredBy: filterFileSize, Size: 5 << 20}, want: true},
+		{name: "size within raised limit", cfg: Config{maxFileSizeBytes: 10 << 20}, record: ImageRecord{FilteredBy: filterFileSize, Size: 5 << 20}, want: true},
+		{name: "size still above limit", cfg: Config{maxFileSizeBytes: 1 << 20}, record: ImageRecord{FilteredBy: filterFileSize, Size: 5 << 20}},
+		{name: "size unknown", cfg: Config{maxFileSizeBytes: 1 << 20}, record: ImageRecord{FilteredBy: filterFileSize}},
+		{name: "dimensions now pass", cfg: Config{MinWidth: 200}, record: ImageRecord{FilteredBy: filterDimensions, Width: 300, Height: 300}, want: true},
+		{name: "dimensions still fail", cfg: Config{MinWidth: 400}, record: ImageRecord{FilteredBy: filterDimensions, Width: 300, Height: 300}},
+		{name: "dimensions unknown", record: ImageRecord{FilteredBy: filterDimensions}},
+		{name: "sharpness now passes", cfg: Config{MinSharpness: 50}, record: ImageRecord{FilteredBy: filterSharpness, Sharpness: 60}, want: true},
+		{name: "sharpness still fails", cfg: Config{MinSharpness: 100}, record: ImageRecord{FilteredBy: filterSharpness, Sharpness: 60}},
+		{name: "watermark check off", record: ImageRecord{FilteredBy: filterWatermark}, want: true},
+		{name: "watermark check on", cfg: Config{SkipWatermarked: true}, record: ImageRecord{FilteredBy: filterWatermark}},
+		{name: "face check off", record: ImageRecord{FilteredBy: filterFaces}, want: true},
+		{name: "face check on", cfg: Config{faces: &faceDetector{}}, record: ImageRecord{FilteredBy: filterFaces}},
+		{name: "filter not relaxable", record: ImageRecord{FilteredBy: "unknown"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := passesRelaxedFilter(&tt.cfg, tt.record); got != tt.want {
+				t.Errorf("passesRelaxedFilter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
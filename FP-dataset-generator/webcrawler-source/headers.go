@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"strings"
+)
+
+// defaultAcceptLanguage is the Accept-Language sent when neither
+// -accept-language nor -language is given.
+const defaultAcceptLanguage = "en-US,en;q=0.9"
+
+// legacyClientHints are the client hints named without the Sec-CH- prefix.
+var legacyClientHints = map[string]struct{}{
+	"Device-Memory":  {},
+	"Downlink":       {},
+	"Dpr":            {},
+	"Ect":            {},
+	"Rtt":            {},
+	"Save-Data":      {},
+	"Viewport-Width": {},
+	"Width":          {},
+}
+
+// acceptLanguage returns the Accept-Language sent with every request: the
+// -accept-language value, or the -language being crawled preferred over
+// English.
+func (cfg *Config) acceptLanguage() string {
+	switch {
+	case cfg.AcceptLanguage != "":
+		return cfg.AcceptLanguage
+	case cfg.Language == "" || cfg.Language == "en":
+		return defaultAcceptLanguage
+	default:
+		return cfg.Language + ",en;q=0.5"
+	}
+}
+
+// parseClientHints reads -client-hints entries of the form Name=value into
+// headers. Names are client hint headers, such as Sec-CH-UA-Platform or
+// Viewport-Width.
+func parseClientHints(entries []string) (http.Header, error) {
+	headers := http.Header{}
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name = textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+		if !ok || name == "" || value == "" {
+			return nil, fmt.Errorf("client-hints entries must be Name=value, got %q", entry)
+		}
+		if _, legacy := legacyClientHints[name]; !legacy && !strings.HasPrefix(name, "Sec-Ch-") {
+			return nil, fmt.Errorf("client-hints: %s is not a client hint header", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("client-hints: %s value must be one line", name)
+		}
+		headers.Set(name, value)
+	}
+	return headers, nil
+}
+
+// requestHeaders returns the headers besides the User-Agent sent with every
+// request, whichever client makes it: Accept-Language, the From address,
+// and the client hints.
+func (cfg *Config) requestHeaders() http.Header {
+	headers := cfg.clientHints.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	headers.Set("Accept-Language", cfg.acceptLanguage())
+	if cfg.From != "" {
+		headers.Set("From", cfg.From)
+	}
+	return headers
+}
+
+// headerTransport adds the request headers to every request that does not
+// set them itself.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var missing []string
+	for name := range t.headers {
+		if req.Header.Get(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the request it is given.
+	req = req.Clone(req.Context())
+	for _, name := range missing {
+		req.Header[name] = t.headers[name]
+	}
+	return t.base.RoundTrip(req)
+}
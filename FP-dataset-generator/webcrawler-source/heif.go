@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// AVIF and HEIC images are HEIF files: ISO media boxes, starting with an
+// ftyp box whose brands tell which codec the images use.
+
+var (
+	avifBrands = []string{"avif", "avis"}
+	heicBrands = []string{"heic", "heix", "heim", "heis", "hevc", "hevx"}
+	heifBrands = []string{"mif1", "msf1"}
+)
+
+// heifBrandType returns the MIME type the ftyp box at the start of head
+// declares, or "" when head is not a HEIF file. The major brand is tried
+// before the compatible ones.
+func heifBrandType(head []byte) string {
+	if len(head) < 16 || string(head[4:8]) != "ftyp" {
+		return ""
+	}
+	end := min(int(binary.BigEndian.Uint32(head)), len(head))
+	brands := []string{string(head[8:12])}
+	for i := 16; i+4 <= end; i += 4 {
+		brands = append(brands, string(head[i:i+4]))
+	}
+
+	for _, group := range []struct {
+		brands []string
+		mime   string
+	}{
+		{avifBrands, "image/avif"},
+		{heicBrands, "image/heic"},
+		{heifBrands, "image/heif"},
+	} {
+		for _, brand := range brands {
+			if slices.Contains(group.brands, brand) {
+				return group.mime
+			}
+		}
+	}
+	return ""
+}
+
+// heifScanLength is how much of a HEIF file is searched for image sizes;
+// the boxes describing the images come before the image data.
+const heifScanLength = 64 * 1024
+
+// heifDimensions returns the size of the largest image a HEIF file
+// declares in its ispe boxes. Photos stored as a grid of tiles declare the
+// tiles' size as well as the whole image's.
+func heifDimensions(r io.Reader) (int, int, error) {
+	head, err := io.ReadAll(io.LimitReader(r, heifScanLength))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var width, height int
+	for rest := head; ; {
+		i := bytes.Index(rest, []byte("ispe"))
+		// ispe is followed by a version and flags, then width and height.
+		if i < 0 || i+16 > len(rest) {
+			break
+		}
+		w := int(binary.BigEndian.Uint32(rest[i+8:]))
+		h := int(binary.BigEndian.Uint32(rest[i+12:]))
+		if w*h > width*height {
+			width, height = w, h
+		}
+		rest = rest[i+4:]
+	}
+	if width == 0 {
+		return 0, 0, fmt.Errorf("no image size found")
+	}
+	return width, height, nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Crawls run for an institution often have to say who is behind them: a
+// From header with a contact address (-from), a page about the crawler
+// linked from the User-Agent (-contact-url), and, with -identify, traffic
+// light enough that no site has reason to complain.
+
+// defaultContactURL is the placeholder page the default User-Agent links to.
+const defaultContactURL = "https://example.com/bot"
+
+// identifyRateLimitMs is the least pause between pages in -identify mode.
+const identifyRateLimitMs = 3000
+
+// validateFrom checks the -from address is a bare email address.
+func validateFrom(from string) error {
+	address, err := mail.ParseAddress(from)
+	if err != nil || address.Name != "" || address.Address != from {
+		return fmt.Errorf("from must be an email address, got %q", from)
+	}
+	return nil
+}
+
+// validateContactURL checks the -contact-url is an absolute http(s) URL.
+func validateContactURL(contactURL string) error {
+	parsed, err := url.Parse(contactURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("contact-url must be an http or https URL, got %q", contactURL)
+	}
+	return nil
+}
+
+// identifiedUserAgent returns userAgent linking to contactURL: the default
+// User-Agent's placeholder page is replaced, and any other gets the URL
+// appended the same way. A User-Agent already naming the URL is kept.
+func identifiedUserAgent(userAgent, contactURL string) string {
+	if contactURL == "" || strings.Contains(userAgent, contactURL) {
+		return userAgent
+	}
+	if userAgent == defaultUserAgent {
+		return strings.Replace(userAgent, "+"+defaultContactURL, "+"+contactURL, 1)
+	}
+	return userAgent + " (+" + contactURL + ")"
+}
+
+// applyIdentify turns on -identify: one page at a time, one download at a
+// time, and at least identifyRateLimitMs between pages.
+func applyIdentify(cfg *Config) {
+	cfg.Concurrency = 1
+	cfg.AutoConcurrency = false
+	cfg.DownloadWorkers = 1
+	cfg.RateLimitMs = max(cfg.RateLimitMs, identifyRateLimitMs)
+}
+
+// crawlDelayFor returns the Crawl-delay the robots.txt of pageURL's site asks
+// of the crawler, which -identify honours.
+func (c *Crawler) crawlDelayFor(pageURL string) time.Duration {
+	parsed, err := url.Parse(pageURL)
+	if err != nil || parsed.Host == "" || parsed.Scheme == "file" {
+		return 0
+	}
+	if c.config.IgnoreRobots || c.config.robotsOverrides.lookup(parsed.Hostname()) != nil {
+		return 0
+	}
+
+	data := c.getRobotsData(fmt.Sprintf("%s://%s/robots.txt", parsed.Scheme, parsed.Host))
+	if data == nil {
+		return 0
+	}
+	group := data.FindGroup(c.config.UserAgent)
+	if group == nil {
+		return 0
+	}
+	return group.CrawlDelay
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Gallery sites built on Next.js and similar frameworks embed the data of a
+// page as JSON for the browser to render: a __NEXT_DATA__ script, or an
+// assignment such as window.__INITIAL_STATE__ = {...}. It often holds the
+// whole result set, full-size URLs included, when the markup holds only a
+// few placeholders. JSON paths pick the image URLs out of it.
+
+// jsonStateAssignment matches the start of a state assignment in a script.
+// The JSON value that follows is read with a decoder, which stops at its end.
+var jsonStateAssignment = regexp.MustCompile(`(?:window|self|globalThis)\.__[A-Za-z0-9_]+__\s*=\s*`)
+
+// jsonMetadataKeys are the fields of an object whose text describes the
+// image URLs found in it, tried in order.
+var jsonMetadataKeys = []string{"alt", "alt_description", "altText", "description", "title", "caption"}
+
+// parseJSONPath parses a JSON path such as $.props.pageProps.photos[*].src
+// into its steps. A step is an object key or array index, * for any one
+// of them, or ** for any depth, written .. as in $..urls.full.
+func parseJSONPath(path string) ([]string, error) {
+	rest := strings.TrimPrefix(strings.TrimSpace(path), "$")
+	if rest != "" && !strings.HasPrefix(rest, ".") && !strings.HasPrefix(rest, "[") {
+		rest = "." + rest
+	}
+	var steps []string
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			steps = append(steps, "**")
+			rest = rest[2:]
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("unclosed [ in %q", path)
+			}
+			step := strings.Trim(rest[1:end], `'"`)
+			if step == "" {
+				return nil, fmt.Errorf("empty [] in %q", path)
+			}
+			steps = append(steps, step)
+			rest = rest[end+1:]
+			continue
+		default:
+			return nil, fmt.Errorf("expected . or [ in %q", path)
+		}
+
+		end := strings.IndexAny(rest, ".[")
+		if end < 0 {
+			end = len(rest)
+		}
+		if end == 0 {
+			if strings.HasPrefix(rest, "[") {
+				continue
+			}
+			return nil, fmt.Errorf("empty step in %q", path)
+		}
+		steps = append(steps, rest[:end])
+		rest = rest[end:]
+	}
+	if len(steps) == 0 || steps[len(steps)-1] == "**" {
+		return nil, fmt.Errorf("%q selects no values", path)
+	}
+	return steps, nil
+}
+
+// parseJSONPaths parses each of paths, naming the ones that are invalid.
+func parseJSONPaths(paths []string) ([][]string, []string) {
+	var parsed [][]string
+	var problems []string
+	for _, path := range paths {
+		steps, err := parseJSONPath(path)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		parsed = append(parsed, steps)
+	}
+	return parsed, problems
+}
+
+// jsonMatch is a string a JSON path selected and the text describing it.
+type jsonMatch struct {
+	value    string
+	metadata string
+}
+
+// matchJSONPath returns the strings in value that steps select. owners are
+// the objects enclosing value, innermost last.
+func matchJSONPath(value any, steps []string, owners []map[string]any, matches []jsonMatch) []jsonMatch {
+	if len(steps) == 0 {
+		if s, ok := value.(string); ok {
+			matches = append(matches, jsonMatch{value: s, metadata: jsonMetadata(owners)})
+		}
+		return matches
+	}
+
+	step := steps[0]
+	if step == "**" {
+		// ** matches no steps, or one more with ** still to go.
+		matches = matchJSONPath(value, steps[1:], owners, matches)
+		eachJSONChild(value, owners, func(child any, owners []map[string]any) {
+			matches = matchJSONPath(child, steps, owners, matches)
+		})
+		return matches
+	}
+	if step == "*" {
+		eachJSONChild(value, owners, func(child any, owners []map[string]any) {
+			matches = matchJSONPath(child, steps[1:], owners, matches)
+		})
+		return matches
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		if child, ok := v[step]; ok {
+			matches = matchJSONPath(child, steps[1:], append(owners, v), matches)
+		}
+	case []any:
+		if i, err := strconv.Atoi(step); err == nil && i >= 0 && i < len(v) {
+			matches = matchJSONPath(v[i], steps[1:], owners, matches)
+		}
+	}
+	return matches
+}
+
+// eachJSONChild calls visit with each member of an object, in the order of
+// their keys, or each element of an array.
+func eachJSONChild(value any, owners []map[string]any, visit func(child any, owners []map[string]any)) {
+	switch v := value.(type) {
+	case map[string]any:
+		owners = append(owners, v)
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			visit(v[key], owners)
+		}
+	case []any:
+		for _, child := range v {
+			visit(child, owners)
+		}
+	}
+}
+
+// jsonMetadata returns the first describing text of the innermost object
+// that has one.
+func jsonMetadata(owners []map[string]any) string {
+	for i := len(owners) - 1; i >= 0; i-- {
+		for _, key := range jsonMetadataKeys {
+			if text, ok := owners[i][key].(string); ok && strings.TrimSpace(text) != "" {
+				return strings.TrimSpace(text)
+			}
+		}
+	}
+	return ""
+}
+
+// pageJSONStates returns the JSON data embedded in a page's scripts.
+// Assignments that are JavaScript rather than JSON are passed over.
+func pageJSONStates(doc *goquery.Document) []any {
+	var states []any
+	doc.Find("script").Each(func(_ int, sel *goquery.Selection) {
+		text := sel.Text()
+		if strings.EqualFold(strings.TrimSpace(sel.AttrOr("type", "")), "application/json") {
+			var state any
+			if json.Unmarshal([]byte(text), &state) == nil {
+				states = append(states, state)
+			}
+			return
+		}
+		for _, loc := range jsonStateAssignment.FindAllStringIndex(text, -1) {
+			var state any
+			if json.NewDecoder(strings.NewReader(text[loc[1]:])).Decode(&state) == nil {
+				states = append(states, state)
+			}
+		}
+	})
+	return states
+}
+
+// extractJSONState adds the images the -json-paths rules and the JSON paths
+// of the page's site preset select in the page's embedded JSON.
+func (c *Crawler) extractJSONState(doc *goquery.Document, baseURL string, images *pageImages) {
+	paths := c.config.jsonPaths
+	if preset := c.sitePreset(baseURL).JSONPaths; len(preset) > 0 {
+		// The presets were checked by validateSitePresets.
+		parsed, _ := parseJSONPaths(preset)
+		paths = append(append([][]string(nil), paths...), parsed...)
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	found := 0
+	for _, state := range pageJSONStates(doc) {
+		for _, steps := range paths {
+			for _, match := range matchJSONPath(state, steps, nil, nil) {
+				images.add(match.value, match.metadata, nil)
+				found++
+			}
+		}
+	}
+	if found > 0 {
+		logVerbose(c.config, "Found %d image URL(s) in the embedded JSON of %s", found, baseURL)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// languageStopwords holds frequent short words that tell the languages
+// written in Latin script apart in a page's text.
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "for", "with", "that", "this", "are", "was", "you"},
+	"es": {"el", "los", "las", "del", "que", "por", "con", "una", "para", "es", "como", "y"},
+	"fr": {"le", "les", "des", "et", "est", "une", "pour", "dans", "du", "sur", "au", "avec"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "eine", "auf", "für"},
+	"it": {"il", "di", "che", "della", "per", "sono", "gli", "non", "alla", "nel", "delle", "anche"},
+	"pt": {"que", "não", "uma", "com", "os", "do", "da", "em", "dos", "por", "para", "são"},
+	"nl": {"het", "een", "van", "en", "dat", "op", "niet", "met", "voor", "zijn", "ook", "maar"},
+}
+
+// minLanguageStopwords is how many stopwords a page's text needs before its
+// language is guessed from them.
+const minLanguageStopwords = 10
+
+// languageScripts maps writing systems to the language a page mostly
+// written in them is taken to be in. Japanese mixes kana with Han, so any
+// kana makes Han text Japanese rather than Chinese.
+var languageScripts = []struct {
+	table    *unicode.RangeTable
+	language string
+}{
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Arabic, "ar"},
+	{unicode.Greek, "el"},
+	{unicode.Hebrew, "he"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+}
+
+// normalizeLanguage reduces a language tag such as en-US to its primary
+// subtag, lowercased.
+func normalizeLanguage(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag, _, _ = strings.Cut(tag, ",")
+	tag, _, _ = strings.Cut(tag, "-")
+	tag, _, _ = strings.Cut(tag, "_")
+	return strings.TrimSpace(tag)
+}
+
+// detectPageLanguage returns the language of a page: the one it declares in
+// its lang attribute, a Content-Language meta tag, or contentLanguage from
+// the response header, or else the one its text reads as. It returns "" when
+// neither tells.
+func detectPageLanguage(doc *goquery.Document, contentLanguage string) string {
+	if lang, ok := doc.Find("html").Attr("lang"); ok && normalizeLanguage(lang) != "" {
+		return normalizeLanguage(lang)
+	}
+	if lang, ok := doc.Find("html").Attr("xml:lang"); ok && normalizeLanguage(lang) != "" {
+		return normalizeLanguage(lang)
+	}
+	var declared string
+	doc.Find("meta[http-equiv]").EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		if equiv, _ := sel.Attr("http-equiv"); strings.EqualFold(equiv, "content-language") {
+			content, _ := sel.Attr("content")
+			declared = normalizeLanguage(content)
+			return false
+		}
+		return true
+	})
+	if declared != "" {
+		return declared
+	}
+	if lang := normalizeLanguage(contentLanguage); lang != "" {
+		return lang
+	}
+
+	body := doc.Find("body").Clone()
+	body.Find("script, style, noscript").Remove()
+	return textLanguage(body.Text())
+}
+
+// textLanguage guesses the language of text from the script most of its
+// letters are in, or from its stopwords when that is Latin.
+func textLanguage(text string) string {
+	letters := 0
+	scripts := make(map[string]int)
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, script := range languageScripts {
+			if unicode.Is(script.table, r) {
+				scripts[script.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+	if scripts["zh"] > 0 && scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+	for language, count := range scripts {
+		if count*2 > letters {
+			return language
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool { return !unicode.IsLetter(r) }) {
+		for language, stopwords := range languageStopwords {
+			for _, stopword := range stopwords {
+				if word == stopword {
+					counts[language]++
+					break
+				}
+			}
+		}
+	}
+
+	best, bestCount, runnerUp := "", 0, 0
+	for language, count := range counts {
+		switch {
+		case count > bestCount:
+			best, bestCount, runnerUp = language, count, bestCount
+		case count > runnerUp:
+			runnerUp = count
+		}
+	}
+	if bestCount < minLanguageStopwords || bestCount == runnerUp {
+		return ""
+	}
+	return best
+}
+
+// otherLanguage returns the language of a page when -language is set and
+// the page is known to be in a different one, or "" otherwise.
+func (c *Crawler) otherLanguage(doc *goquery.Document, contentLanguage string) string {
+	if c.config.Language == "" {
+		return ""
+	}
+	if lang := detectPageLanguage(doc, contentLanguage); lang != "" && lang != c.config.Language {
+		return lang
+	}
+	return ""
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Datasets meant to be shared need images their authors allow to be
+// redistributed. Pages state a license in several ways: Creative Commons
+// links, rel=license, schema.org license fields in JSON-LD or microdata, and
+// the license templates of Wikimedia Commons. Each image gets the license
+// closest to it: one given for it in its figure or its schema.org
+// ImageObject, else the page's. Provider images get the license their API
+// gives. -license keeps only the images under the listed licenses.
+
+// licenseCodes are the licenses recognized, as -license names them.
+var licenseCodes = []string{"cc0", "pdm", "cc-by", "cc-by-sa", "cc-by-nd", "cc-by-nc", "cc-by-nc-sa", "cc-by-nc-nd"}
+
+// licenseSelectors find the elements that state a license: rel=license
+// links, links to a Creative Commons license or dedication, schema.org
+// microdata, and the short names of Wikimedia Commons license templates.
+var licenseSelectors = []string{
+	`a[rel~="license"]`,
+	`link[rel~="license"]`,
+	`a[href*="creativecommons.org/licenses/"]`,
+	`a[href*="creativecommons.org/publicdomain/"]`,
+	`[itemprop="license"]`,
+	`.licensetpl_short`,
+}
+
+// licenseFromURL returns the license a Creative Commons deed or legal code
+// URL names, such as https://creativecommons.org/licenses/by-sa/4.0/, or "".
+func licenseFromURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || !strings.HasSuffix(strings.ToLower(u.Hostname()), "creativecommons.org") {
+		return ""
+	}
+	parts := strings.Split(strings.Trim(strings.ToLower(u.Path), "/"), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	switch {
+	case parts[0] == "licenses":
+		if code := "cc-" + parts[1]; slices.Contains(licenseCodes, code) {
+			return code
+		}
+	case parts[0] == "publicdomain" && parts[1] == "zero":
+		return "cc0"
+	case parts[0] == "publicdomain" && parts[1] == "mark":
+		return "pdm"
+	}
+	return ""
+}
+
+// licenseFromName returns the license a name such as "CC BY-SA 4.0",
+// "Creative Commons Attribution 2.0", or "Public domain" stands for, or "".
+func licenseFromName(name string) string {
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	words := strings.FieldsFunc(name, func(r rune) bool { return r == ' ' || r == '-' || r == '_' })
+	has := func(word string) bool { return slices.Contains(words, word) }
+
+	switch {
+	case has("cc0") || strings.Contains(name, "cc zero"):
+		return "cc0"
+	case strings.Contains(name, "public domain"):
+		return "pdm"
+	case !has("cc") && !strings.Contains(name, "creative commons"):
+		return ""
+	}
+
+	code := ""
+	switch {
+	case has("by"), has("attribution"):
+		code = "cc-by"
+	default:
+		return ""
+	}
+	if has("nc") || has("noncommercial") {
+		code += "-nc"
+	}
+	switch {
+	case has("sa") || strings.Contains(name, "sharealike") || strings.Contains(name, "share alike"):
+		code += "-sa"
+	case has("nd") || strings.Contains(name, "noderivatives") || strings.Contains(name, "no derivatives"):
+		code += "-nd"
+	}
+	return code
+}
+
+// licenseOf returns the license a URL or name stands for, or "".
+func licenseOf(value string) string {
+	if license := licenseFromURL(value); license != "" {
+		return license
+	}
+	return licenseFromName(value)
+}
+
+// attributionLicense returns the license of an image a provider credited.
+func attributionLicense(attribution *Attribution) string {
+	if attribution == nil {
+		return ""
+	}
+	if license := licenseFromURL(attribution.LicenseURL); license != "" {
+		return license
+	}
+	return licenseFromName(attribution.License)
+}
+
+// imageScopeSelector matches the elements whose license is that of the image
+// in them rather than the page's.
+const imageScopeSelector = `figure, [itemtype*="ImageObject"]`
+
+// firstLicense returns the license named by the first of elements naming one.
+func firstLicense(elements *goquery.Selection) string {
+	license := ""
+	elements.EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		for _, value := range []string{sel.AttrOr("href", ""), sel.AttrOr("content", ""), sel.Text()} {
+			if license = licenseOf(value); license != "" {
+				return false
+			}
+		}
+		return true
+	})
+	return license
+}
+
+// elementLicense returns the license stated for an image element itself,
+// within the figure or schema.org ImageObject it sits in, or "".
+func elementLicense(sel *goquery.Selection) string {
+	scope := sel.Closest(imageScopeSelector)
+	if scope.Length() == 0 {
+		return ""
+	}
+	return firstLicense(scope.Find(strings.Join(licenseSelectors, ", ")))
+}
+
+// pageLicense is the license a page states for itself and those its JSON-LD
+// gives particular images, by URL.
+type pageLicense struct {
+	license string
+	images  map[string]string
+}
+
+// licensesOf reads the licenses a page states.
+func (c *Crawler) licensesOf(doc *goquery.Document, pageURL string) pageLicense {
+	licenses := pageLicense{images: make(map[string]string)}
+	doc.Find(`script[type="application/ld+json"]`).Each(func(_ int, sel *goquery.Selection) {
+		var value any
+		if json.Unmarshal([]byte(sel.Text()), &value) == nil {
+			c.jsonLDLicenses(value, pageURL, &licenses)
+		}
+	})
+	if licenses.license == "" {
+		licenses.license = firstLicense(doc.Find(strings.Join(licenseSelectors, ", ")).FilterFunction(func(_ int, sel *goquery.Selection) bool {
+			return sel.Closest(imageScopeSelector).Length() == 0
+		}))
+	}
+	return licenses
+}
+
+// jsonLDLicenses records the license fields of the schema.org objects in a
+// JSON-LD value: those of objects with a contentUrl for that image, the
+// first of the others for the page.
+func (c *Crawler) jsonLDLicenses(value any, pageURL string, licenses *pageLicense) {
+	switch v := value.(type) {
+	case []any:
+		for _, item := range v {
+			c.jsonLDLicenses(item, pageURL, licenses)
+		}
+	case map[string]any:
+		if license := jsonLDLicense(v["license"]); license != "" {
+			if content, ok := v["contentUrl"].(string); ok {
+				if absolute := c.resolveURL(pageURL, content); absolute != "" {
+					licenses.images[absolute] = license
+				}
+			} else if licenses.license == "" {
+				licenses.license = license
+			}
+		}
+		for key, child := range v {
+			if key != "license" {
+				c.jsonLDLicenses(child, pageURL, licenses)
+			}
+		}
+	}
+}
+
+// jsonLDLicense returns the license a schema.org license field names: a URL
+// or name, an object with one, or a list of them.
+func jsonLDLicense(value any) string {
+	switch v := value.(type) {
+	case string:
+		return licenseOf(v)
+	case map[string]any:
+		for _, key := range []string{"url", "@id", "name"} {
+			if s, ok := v[key].(string); ok {
+				if license := licenseOf(s); license != "" {
+					return license
+				}
+			}
+		}
+	case []any:
+		for _, item := range v {
+			if license := jsonLDLicense(item); license != "" {
+				return license
+			}
+		}
+	}
+	return ""
+}
+
+// setPageLicense remembers the licenses of a page while its images are
+// extracted; clearPageLicense forgets them again.
+func (c *Crawler) setPageLicense(pageURL string, licenses pageLicense) {
+	c.imagesMutex.Lock()
+	c.pageLicenses[pageURL] = licenses
+	c.imagesMutex.Unlock()
+}
+
+func (c *Crawler) clearPageLicense(pageURL string) {
+	c.imagesMutex.Lock()
+	delete(c.pageLicenses, pageURL)
+	c.imagesMutex.Unlock()
+}
+
+// noteImageLicense gives an image found on pageURL the license the page
+// states for it, unless the image already has one.
+func (c *Crawler) noteImageLicense(imageURL, pageURL string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	licenses := c.pageLicenses[pageURL]
+	license := licenses.images[imageURL]
+	if license == "" {
+		license = licenses.license
+	}
+	c.setImageLicense(imageURL, license)
+}
+
+// noteElementLicense gives an image the license stated for the element it
+// was found in. It comes first, so it wins over that of the page.
+func (c *Crawler) noteElementLicense(imageURL, license string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	c.setImageLicense(imageURL, license)
+}
+
+// setImageLicense records the license of an image that has none yet. The
+// caller holds imagesMutex.
+func (c *Crawler) setImageLicense(imageURL, license string) {
+	if license == "" {
+		return
+	}
+	if origin := c.imageOrigins[imageURL]; origin.license == "" {
+		origin.license = license
+		c.imageOrigins[imageURL] = origin
+	}
+}
+
+// allowsLicense reports whether an image's license is one of -license, when
+// given.
+func (c *Crawler) allowsLicense(imageURL string) bool {
+	if len(c.config.License) == 0 {
+		return true
+	}
+	c.imagesMutex.Lock()
+	license := c.imageOrigins[imageURL].license
+	c.imagesMutex.Unlock()
+	return slices.Contains(c.config.License, license)
+}
+
+// licensedProviderImages returns the provider results whose license is one
+// of -license, when given.
+func licensedProviderImages(cfg *Config, images []providerImage) []providerImage {
+	if len(cfg.License) == 0 {
+		return images
+	}
+	return slices.DeleteFunc(images, func(image providerImage) bool {
+		if slices.Contains(cfg.License, attributionLicense(&image.Attribution)) {
+			return false
+		}
+		logVerbose(cfg, "Skipping %s: license %q not in -license", image.URL, image.Attribution.License)
+		return true
+	})
+}
+
+// validateLicenses checks the licenses given to -license.
+func validateLicenses(licenses []string) error {
+	for _, license := range licenses {
+		if !slices.Contains(licenseCodes, license) {
+			return fmt.Errorf("license must be one of: %s, got %q", strings.Join(licenseCodes, ", "), license)
+		}
+	}
+	return nil
+}
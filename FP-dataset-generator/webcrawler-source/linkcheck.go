@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// linkReportFileName is the per-URL report written by check-links.
+const linkReportFileName = "link-rot.tsv"
+
+const (
+	linkAlive       = "alive"
+	linkDead        = "dead"
+	linkUnreachable = "unreachable"
+	linkUnchecked   = "unchecked"
+)
+
+// linkResult is what checking one source URL found.
+type linkResult struct {
+	URL    string
+	Result string
+	Detail string
+}
+
+// checkLinks verifies that the source URLs of records still answer, and
+// annotates each record with the status seen and when.
+func (d *Downloader) checkLinks(records []*ImageRecord) []linkResult {
+	results := make([]linkResult, len(records))
+	semaphore := make(chan struct{}, d.config.downloadConcurrency())
+	var wg sync.WaitGroup
+
+	d.progressBar = newDownloadProgressBar(len(records), true, false)
+	for i, record := range records {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[i] = d.checkLink(record)
+			d.progressBar.Add(1)
+		}()
+	}
+	wg.Wait()
+	d.progressBar.Finish()
+
+	return results
+}
+
+// checkLink sends a HEAD request, or a ranged GET where HEAD is refused, for
+// one record. Only 404 and 410 count as dead; other errors may be temporary
+// and are reported as unreachable.
+func (d *Downloader) checkLink(record *ImageRecord) linkResult {
+	result := linkResult{URL: record.URL}
+
+	scheme := urlScheme(record.URL)
+	if scheme != "http" && scheme != "https" {
+		result.Result, result.Detail = linkUnchecked, scheme+" URLs are not checked"
+		return result
+	}
+
+	head, err := d.headImage(record.URL)
+	now := time.Now().UTC()
+	record.CheckedAt = &now
+	if err != nil {
+		record.SourceStatus = 0
+		record.SourceError = err.Error()
+		result.Result, result.Detail = linkUnreachable, err.Error()
+		return result
+	}
+
+	record.SourceStatus = head.status
+	record.SourceError = ""
+	result.Detail = fmt.Sprintf("%d %s", head.status, http.StatusText(head.status))
+	switch {
+	case head.status == http.StatusNotFound || head.status == http.StatusGone:
+		result.Result = linkDead
+	case head.status < 400:
+		result.Result = linkAlive
+	default:
+		result.Result = linkUnreachable
+	}
+	return result
+}
+
+// pruneDeadLinks removes the records whose source is dead and that have no
+// downloaded file. Downloaded images stay in the dataset, annotated as dead.
+func pruneDeadLinks(state *CrawlState) int {
+	kept := state.Images[:0]
+	pruned := 0
+	for _, record := range state.Images {
+		dead := record.SourceStatus == http.StatusNotFound || record.SourceStatus == http.StatusGone
+		if dead && record.Status != imageStatusDownloaded {
+			pruned++
+			continue
+		}
+		kept = append(kept, record)
+	}
+	state.Images = kept
+	return pruned
+}
+
+// writeLinkReport saves the check results as "<url>\t<result>\t<detail>"
+// lines, sorted by result and URL.
+func writeLinkReport(outputDir string, results []linkResult) (string, error) {
+	sorted := append([]linkResult(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Result != sorted[j].Result {
+			return sorted[i].Result < sorted[j].Result
+		}
+		return sorted[i].URL < sorted[j].URL
+	})
+
+	var b strings.Builder
+	b.WriteString("url\tresult\tdetail\n")
+	for _, result := range sorted {
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", result.URL, result.Result, strings.Join(strings.Fields(result.Detail), " "))
+	}
+
+	path := filepath.Join(outputDir, linkReportFileName)
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write link report: %w", err)
+	}
+	return path, nil
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
 	"runtime"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,90 +23,318 @@ const (
 	defaultTimeoutSec  = 30
 	defaultMaxPages    = 50
 	defaultMaxDepth    = 3
+	defaultResultPages = 10
 	defaultConcurrency = 5
 )
 
+// builtinSites lists the names of the registered sites in order; see
+// RegisterSite.
 var (
-	builtinSites = []string{
-		"wikimedia",
-		"pexels",
-		"pixabay",
-		"freeimages",
-		"unsplash",
-		"flickr",
-		"deviantart",
-		"pinterest",
-		"imgur",
-		"reddit",
-	}
-	builtinSiteSet = func() map[string]struct{} {
-		m := make(map[string]struct{}, len(builtinSites))
-		for _, site := range builtinSites {
-			m[site] = struct{}{}
-		}
-		return m
-	}()
+	builtinSites   []string
+	builtinSiteSet = make(map[string]struct{})
 )
 
 type Config struct {
-	Keyword          string
-	OutputDir        string
-	MaxPages         int
-	MaxDepth         int
-	Concurrency      int
-	Timeout          time.Duration
-	UserAgent        string
-	RateLimitMs      int
-	Downloader       string
-	SeedURLs         []string
-	DefaultSites     []string
-	FollowSubdomains bool
-	IgnoreRobots     bool
-	MinWidth         int
-	MinHeight        int
-	SkipThumbnails   bool
-	Verbose          bool
-
-	invalidSites []string
+	Keyword          string        `yaml:"keyword" toml:"keyword"`
+	KeywordsFile     string        `yaml:"keywords-file" toml:"keywords-file"`
+	KeywordScope     string        `yaml:"keyword-scope" toml:"keyword-scope"`
+	Language         string        `yaml:"language" toml:"language"`
+	OutputDir        string        `yaml:"output" toml:"output"`
+	MaxPages         int           `yaml:"max-pages" toml:"max-pages"`
+	MaxImages        int           `yaml:"max-images" toml:"max-images"`
+	MinImages        int           `yaml:"min-images" toml:"min-images"`
+	MaxImagesPerPage int           `yaml:"max-images-per-page" toml:"max-images-per-page"`
+	MaxDuration      time.Duration `yaml:"max-duration" toml:"max-duration"`
+	StopDownloads    bool          `yaml:"max-duration-downloads" toml:"max-duration-downloads"`
+	MaxDepth         int           `yaml:"max-depth" toml:"max-depth"`
+	TypeDepth        []string      `yaml:"type-depth" toml:"type-depth"`
+	MaxResultPages   int           `yaml:"max-result-pages" toml:"max-result-pages"`
+	Concurrency      int           `yaml:"concurrency" toml:"concurrency"`
+	AutoConcurrency  bool          `yaml:"auto-concurrency" toml:"auto-concurrency"`
+	DownloadWorkers  int           `yaml:"download-concurrency" toml:"download-concurrency"`
+	ProcessWorkers   int           `yaml:"process-concurrency" toml:"process-concurrency"`
+	MaxMemory        string        `yaml:"max-memory" toml:"max-memory"`
+	Timeout          time.Duration `yaml:"timeout" toml:"timeout"`
+	UserAgent        string        `yaml:"user-agent" toml:"user-agent"`
+	From             string        `yaml:"from" toml:"from"`
+	ContactURL       string        `yaml:"contact-url" toml:"contact-url"`
+	Identify         bool          `yaml:"identify" toml:"identify"`
+	AcceptLanguage   string        `yaml:"accept-language" toml:"accept-language"`
+	ClientHints      []string      `yaml:"client-hints" toml:"client-hints"`
+	Proxy            string        `yaml:"proxy" toml:"proxy"`
+	ProxyFile        string        `yaml:"proxy-file" toml:"proxy-file"`
+	RotateProxies    bool          `yaml:"rotate-proxies" toml:"rotate-proxies"`
+	Resolve          []string      `yaml:"resolve" toml:"resolve"`
+	RateLimitMs      int           `yaml:"rate-limit" toml:"rate-limit"`
+	Control          string        `yaml:"control" toml:"control"`
+	Downloader       string        `yaml:"downloader" toml:"downloader"`
+	SeedURLs         []string      `yaml:"seeds" toml:"seeds"`
+	InputURLs        string        `yaml:"input-urls" toml:"input-urls"`
+	WatchDir         string        `yaml:"watch-dir" toml:"watch-dir"`
+	DefaultSites     []string      `yaml:"sites" toml:"sites"`
+	Subreddits       []string      `yaml:"subreddits" toml:"subreddits"`
+	FollowSubdomains bool          `yaml:"follow-subdomains" toml:"follow-subdomains"`
+	FirstPartyOnly   bool          `yaml:"first-party-only" toml:"first-party-only"`
+	License          []string      `yaml:"license" toml:"license"`
+	URLInclude       string        `yaml:"url-include" toml:"url-include"`
+	URLExclude       string        `yaml:"url-exclude" toml:"url-exclude"`
+	AllowDomains     []string      `yaml:"allow-domains" toml:"allow-domains"`
+	BlockDomains     []string      `yaml:"block-domains" toml:"block-domains"`
+	BlockDomainsFile string        `yaml:"block-domains-file" toml:"block-domains-file"`
+	BlockAds         bool          `yaml:"block-ads" toml:"block-ads"`
+	IgnoreRobots     bool          `yaml:"ignore-robots" toml:"ignore-robots"`
+	RobotsOverrides  string        `yaml:"robots-overrides" toml:"robots-overrides"`
+	SkipProbe        bool          `yaml:"skip-probe" toml:"skip-probe"`
+	MinWidth         int           `yaml:"min-width" toml:"min-width"`
+	MinHeight        int           `yaml:"min-height" toml:"min-height"`
+	MaxWidth         int           `yaml:"max-width" toml:"max-width"`
+	MaxHeight        int           `yaml:"max-height" toml:"max-height"`
+	MinAspect        float64       `yaml:"min-aspect" toml:"min-aspect"`
+	MaxAspect        float64       `yaml:"max-aspect" toml:"max-aspect"`
+	MaxFileSize      string        `yaml:"max-file-size" toml:"max-file-size"`
+	ModifiedSince    string        `yaml:"modified-since" toml:"modified-since"`
+	AllowedTypes     []string      `yaml:"types" toml:"types"`
+	ImageTypes       []string      `yaml:"image-types" toml:"image-types"`
+	AllowWebP        bool          `yaml:"allow-webp" toml:"allow-webp"`
+	ConvertWebP      string        `yaml:"convert-webp" toml:"convert-webp"`
+	ConvertHEIF      string        `yaml:"convert-heif" toml:"convert-heif"`
+	ImageConverter   string        `yaml:"image-converter" toml:"image-converter"`
+	SkipThumbnails   bool          `yaml:"skip-thumbnails" toml:"skip-thumbnails"`
+	StripParams      []string      `yaml:"strip-params" toml:"strip-params"`
+	LazyAttrs        []string      `yaml:"lazy-attrs" toml:"lazy-attrs"`
+	VideoPosters     bool          `yaml:"video-posters" toml:"video-posters"`
+	JSONPaths        []string      `yaml:"json-paths" toml:"json-paths"`
+	PDFImages        bool          `yaml:"pdf-images" toml:"pdf-images"`
+	IncludeDataURIs  bool          `yaml:"include-data-uris" toml:"include-data-uris"`
+	MinDataURISize   string        `yaml:"min-data-uri-size" toml:"min-data-uri-size"`
+	PhotoOnly        bool          `yaml:"photo-only" toml:"photo-only"`
+	IllustrationOnly bool          `yaml:"illustration-only" toml:"illustration-only"`
+	SkipWatermarked  bool          `yaml:"skip-watermarked" toml:"skip-watermarked"`
+	MinSharpness     float64       `yaml:"min-sharpness" toml:"min-sharpness"`
+	Faces            string        `yaml:"faces" toml:"faces"`
+	NSFWModel        string        `yaml:"nsfw-model" toml:"nsfw-model"`
+	NSFWThreshold    float64       `yaml:"nsfw-threshold" toml:"nsfw-threshold"`
+	NSFWAction       string        `yaml:"nsfw-action" toml:"nsfw-action"`
+	ONNXRuntime      string        `yaml:"onnx-runtime" toml:"onnx-runtime"`
+	KeepDuplicates   bool          `yaml:"keep-duplicates" toml:"keep-duplicates"`
+	Quarantine       bool          `yaml:"quarantine-conflicts" toml:"quarantine-conflicts"`
+	DryRun           bool          `yaml:"dry-run" toml:"dry-run"`
+	URLListFile      string        `yaml:"url-list" toml:"url-list"`
+	ExportURLs       string        `yaml:"export-urls" toml:"export-urls"`
+	Manifest         []string      `yaml:"manifest" toml:"manifest"`
+	Split            string        `yaml:"split" toml:"split"`
+	SplitSeed        uint64        `yaml:"split-seed" toml:"split-seed"`
+	Verbose          bool          `yaml:"verbose" toml:"verbose"`
+	Explain          bool          `yaml:"explain" toml:"explain"`
+
+	// Sites defined in the config file that -sites can name.
+	CustomSites []SiteDefinition `yaml:"custom-sites" toml:"custom-sites"`
+
+	// File of presets replacing the builtin ones for the sites it lists.
+	SiteConfig string `yaml:"site-config" toml:"site-config"`
+
+	// Hosts tried in place of a failing host, as host=mirror|mirror.
+	Mirrors []string `yaml:"mirrors" toml:"mirrors"`
+
+	// Image search API used instead of crawling, and its credentials.
+	Provider           string `yaml:"provider" toml:"provider"`
+	UnsplashKey        string `yaml:"unsplash-key" toml:"unsplash-key"`
+	PexelsKey          string `yaml:"pexels-key" toml:"pexels-key"`
+	PixabayKey         string `yaml:"pixabay-key" toml:"pixabay-key"`
+	PixabayImageType   string `yaml:"pixabay-image-type" toml:"pixabay-image-type"`
+	PixabayOrientation string `yaml:"pixabay-orientation" toml:"pixabay-orientation"`
+	OpenverseToken     string `yaml:"openverse-token" toml:"openverse-token"`
+
+	command          string
+	classes          []string
+	invalidSites     []string
+	maxMemoryBytes   uint64
+	maxFileSizeBytes uint64
+	minDataURIBytes  uint64
+	modifiedSince    time.Time
+	deadline         time.Time
+	urlInclude       *regexp.Regexp
+	urlExclude       *regexp.Regexp
+	allowDomains     []string
+	blockDomains     domainSet
+	robotsOverrides  robotsOverrides
+	jsonPaths        [][]string
+	maxCrawlWorkers  int
+	policy           crawlPolicy
+	nsfw             nsfwClassifier
+	faces            *faceDetector
+	converter        []string
+	sitePresets      map[string]SitePreset
+	mirrors          hostMirrors
+	allowedMIMETypes map[string]struct{}
+	typeDepths       map[string]int
+	proxies          *proxyPool
+	resolve          resolveOverrides
+	clientHints      http.Header
+	splitShares      []int
+}
+
+// concurrencyFlag accepts either a worker count or "auto" for -concurrency.
+type concurrencyFlag struct {
+	cfg *Config
+}
+
+func (f concurrencyFlag) String() string {
+	if f.cfg == nil {
+		return ""
+	}
+	if f.cfg.AutoConcurrency {
+		return "auto"
+	}
+	return strconv.Itoa(f.cfg.Concurrency)
+}
+
+func (f concurrencyFlag) Set(value string) error {
+	if strings.EqualFold(strings.TrimSpace(value), "auto") {
+		f.cfg.AutoConcurrency = true
+		return nil
+	}
+
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return fmt.Errorf("must be a number or auto")
+	}
+	f.cfg.Concurrency = n
+	f.cfg.AutoConcurrency = false
+	return nil
+}
+
+// downloadConcurrency returns the number of parallel downloads, which
+// defaults to the crawl concurrency.
+func (cfg *Config) downloadConcurrency() int {
+	if cfg.DownloadWorkers > 0 {
+		return cfg.DownloadWorkers
+	}
+	return cfg.Concurrency
+}
+
+// processConcurrency returns the number of downloaded images validated,
+// filtered, and stored at once, which defaults to the number of CPUs.
+func (cfg *Config) processConcurrency() int {
+	if cfg.ProcessWorkers > 0 {
+		return cfg.ProcessWorkers
+	}
+	return runtime.NumCPU()
+}
+
+// pastDeadline reports whether the -max-duration budget has run out.
+func (cfg *Config) pastDeadline() bool {
+	return !cfg.deadline.IsZero() && time.Now().After(cfg.deadline)
+}
+
+// allowsImageType reports whether images of the given MIME type pass the
+// -types filter. Every type is allowed when the filter is not set.
+func (cfg *Config) allowsImageType(mimeType string) bool {
+	if len(cfg.allowedMIMETypes) == 0 {
+		return true
+	}
+	if format := cfg.conversionFormat(mimeType); format != "" {
+		// Converted images are kept as the type they are stored as.
+		mimeType = conversionTargets[format].mime
+	}
+	_, ok := cfg.allowedMIMETypes[mimeType]
+	return ok
 }
 
 func main() {
-	cfg := parseFlags()
-	if err := validateConfig(cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Configuration error: %v\n", err)
-		os.Exit(1)
+	name, args := defaultCommand, os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
 	}
 
-	printBanner()
-	printConfig(cfg)
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
 
-	if err := run(cfg); err != nil {
+	if err := cmd.run(args); err != nil {
 		fmt.Fprintf(os.Stderr, "\nError: %v\n", err)
 		os.Exit(1)
 	}
-
-	fmt.Println("\n✓ Crawling completed successfully!")
 }
 
-func parseFlags() *Config {
+// parseFlags parses the shared crawler flags for the named command. Commands
+// with options of their own register them through extra.
+func parseFlags(name string, args []string, extra func(fs *flag.FlagSet)) *Config {
 	cfg := &Config{
-		MaxPages:     defaultMaxPages,
-		MaxDepth:     defaultMaxDepth,
-		Concurrency:  defaultConcurrency,
-		UserAgent:    defaultUserAgent,
-		RateLimitMs:  defaultRateLimitMs,
-		Downloader:   "auto",
-		DefaultSites: defaultSites(),
+		MaxPages:       defaultMaxPages,
+		MaxDepth:       defaultMaxDepth,
+		MaxResultPages: defaultResultPages,
+		Concurrency:    defaultConcurrency,
+		UserAgent:      defaultUserAgent,
+		RateLimitMs:    defaultRateLimitMs,
+		NSFWThreshold:  defaultNSFWThreshold,
+		NSFWAction:     nsfwQuarantine,
+		Downloader:     "auto",
+		KeywordScope:   keywordScopeURL,
+		DefaultSites:   defaultSites(),
+		command:        name,
 	}
 
 	var (
 		timeoutSeconds = defaultTimeoutSec
 		seedList       string
 		siteList       string
+		typeList       string
+		imageTypeList  string
+		resolveList    string
+		clientHintList string
+		typeDepthList  string
+		subredditList  string
+		stripParamList string
+		lazyAttrList   string
+		allowedDomains string
+		blockedDomains string
+		jsonPathList   string
+		manifestList   string
+		licenseList    string
+		mirrorList     string
+		configPath     = findConfigFlag(args)
 		showVersion    bool
 	)
 
-	fs := flag.NewFlagSet(filepath.Base(os.Args[0]), flag.ContinueOnError)
+	// Values from the config file become the flag defaults, so any flag given
+	// explicitly on the command line overrides the file.
+	fileSites := false
+	if configPath != "" {
+		cfg.DefaultSites = nil
+		if err := loadConfigFile(configPath, cfg); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(2)
+		}
+		if cfg.Timeout > 0 {
+			timeoutSeconds = int(cfg.Timeout / time.Second)
+		}
+		seedList = strings.Join(cfg.SeedURLs, ",")
+		typeList = strings.Join(cfg.AllowedTypes, ",")
+		imageTypeList = strings.Join(cfg.ImageTypes, ",")
+		resolveList = strings.Join(cfg.Resolve, ",")
+		clientHintList = strings.Join(cfg.ClientHints, ",")
+		typeDepthList = strings.Join(cfg.TypeDepth, ",")
+		subredditList = strings.Join(cfg.Subreddits, ",")
+		stripParamList = strings.Join(cfg.StripParams, ",")
+		lazyAttrList = strings.Join(cfg.LazyAttrs, ",")
+		allowedDomains = strings.Join(cfg.AllowDomains, ",")
+		blockedDomains = strings.Join(cfg.BlockDomains, ",")
+		jsonPathList = strings.Join(cfg.JSONPaths, ",")
+		manifestList = strings.Join(cfg.Manifest, ",")
+		licenseList = strings.Join(cfg.License, ",")
+		mirrorList = strings.Join(cfg.Mirrors, ",")
+		if len(cfg.DefaultSites) > 0 {
+			fileSites = true
+		} else {
+			cfg.DefaultSites = defaultSites()
+		}
+	}
+
+	fs := flag.NewFlagSet(filepath.Base(os.Args[0])+" "+name, flag.ContinueOnError)
 	fs.SetOutput(os.Stderr)
 	fs.Usage = func() {
 		printUsage()
@@ -110,27 +344,54 @@ func parseFlags() *Config {
 
 	fs.StringVar(&cfg.Keyword, "keyword", cfg.Keyword, "Keyword to search for in image filenames (required)")
 	fs.StringVar(&cfg.Keyword, "k", cfg.Keyword, "Keyword to search for (shorthand)")
+	fs.StringVar(&cfg.KeywordsFile, "keywords-file", cfg.KeywordsFile, "File of keywords, one per line, each crawled as a class of its own")
+	fs.StringVar(&cfg.KeywordScope, "keyword-scope", cfg.KeywordScope, "Where the keyword must appear: filename, path, url, metadata, text, or any")
 
 	fs.StringVar(&cfg.OutputDir, "output", cfg.OutputDir, "Output directory (default: ./<keyword>)")
 	fs.StringVar(&cfg.OutputDir, "o", cfg.OutputDir, "Output directory (shorthand)")
 
 	fs.IntVar(&cfg.MaxPages, "max-pages", cfg.MaxPages, "Maximum number of pages to crawl")
 	fs.IntVar(&cfg.MaxPages, "p", cfg.MaxPages, "Maximum pages (shorthand)")
+	fs.IntVar(&cfg.MaxImages, "max-images", cfg.MaxImages, "Stop crawling once this many image URLs are found (0 for no limit)")
+	fs.DurationVar(&cfg.MaxDuration, "max-duration", cfg.MaxDuration, "Stop crawling after this much wall-clock time, e.g. 30m")
+	fs.BoolVar(&cfg.StopDownloads, "max-duration-downloads", cfg.StopDownloads, "Stop downloading too when -max-duration runs out")
+	fs.IntVar(&cfg.MaxImagesPerPage, "max-images-per-page", cfg.MaxImagesPerPage, "Keep at most this many of the best scoring images from each page (0 for no limit)")
+	fs.IntVar(&cfg.MinImages, "min-images", cfg.MinImages, "Keep raising -max-pages and -max-depth until this many image URLs are found")
 
 	fs.IntVar(&cfg.MaxDepth, "max-depth", cfg.MaxDepth, "Maximum crawl depth")
 	fs.IntVar(&cfg.MaxDepth, "d", cfg.MaxDepth, "Maximum depth (shorthand)")
+	fs.StringVar(&typeDepthList, "type-depth", typeDepthList, "Comma-separated per-page-type depth limits, e.g. detail=4,search=2")
+	fs.IntVar(&cfg.MaxResultPages, "max-result-pages", cfg.MaxResultPages, "Follow the next-page links of a results listing up to this many pages (0 for no limit)")
+
+	fs.Var(concurrencyFlag{cfg}, "concurrency", "Number of concurrent workers, or auto to scale with observed load")
+	fs.Var(concurrencyFlag{cfg}, "c", "Concurrency (shorthand)")
+
+	fs.IntVar(&cfg.DownloadWorkers, "download-concurrency", cfg.DownloadWorkers, "Number of concurrent downloads (default: same as -concurrency)")
+	fs.IntVar(&cfg.DownloadWorkers, "dc", cfg.DownloadWorkers, "Download concurrency (shorthand)")
+	fs.IntVar(&cfg.ProcessWorkers, "process-concurrency", cfg.ProcessWorkers, "Number of downloaded images validated, filtered, and stored at once (default: number of CPUs)")
+	fs.IntVar(&cfg.ProcessWorkers, "pc", cfg.ProcessWorkers, "Process concurrency (shorthand)")
 
-	fs.IntVar(&cfg.Concurrency, "concurrency", cfg.Concurrency, "Number of concurrent workers")
-	fs.IntVar(&cfg.Concurrency, "c", cfg.Concurrency, "Concurrency (shorthand)")
+	fs.StringVar(&cfg.MaxMemory, "max-memory", cfg.MaxMemory, "Soft memory limit, e.g. 2GB; spills the crawl frontier to disk near it")
 
 	fs.IntVar(&timeoutSeconds, "timeout", timeoutSeconds, "Request timeout in seconds")
 	fs.IntVar(&timeoutSeconds, "t", timeoutSeconds, "Timeout (shorthand)")
 
 	fs.StringVar(&cfg.UserAgent, "user-agent", cfg.UserAgent, "User agent string")
 	fs.StringVar(&cfg.UserAgent, "ua", cfg.UserAgent, "User agent (shorthand)")
+	fs.StringVar(&cfg.From, "from", cfg.From, "Contact email address sent in the From header")
+	fs.StringVar(&cfg.ContactURL, "contact-url", cfg.ContactURL, "URL of a page about the crawler, linked from the User-Agent")
+	fs.StringVar(&cfg.AcceptLanguage, "accept-language", cfg.AcceptLanguage, "Accept-Language header sent with every request (default: en-US, or the -language)")
+	fs.StringVar(&clientHintList, "client-hints", clientHintList, "Comma-separated Name=value client hint headers, e.g. Sec-CH-UA-Platform=\"Windows\"")
+	fs.BoolVar(&cfg.Identify, "identify", cfg.Identify, "Identify the crawler and keep its traffic low: one request at a time, a 3s rate limit, and robots.txt Crawl-delay")
+
+	fs.StringVar(&cfg.Proxy, "proxy", cfg.Proxy, "Proxy URL (http, https, or socks5); comma-separate several to rotate")
+	fs.StringVar(&cfg.ProxyFile, "proxy-file", cfg.ProxyFile, "File with one proxy URL per line")
+	fs.BoolVar(&cfg.RotateProxies, "rotate-proxies", cfg.RotateProxies, "Use the proxies round-robin, one per request")
+	fs.StringVar(&resolveList, "resolve", resolveList, "Comma-separated host:address (or host:port:address) DNS overrides")
 
 	fs.IntVar(&cfg.RateLimitMs, "rate-limit", cfg.RateLimitMs, "Rate limit between requests in milliseconds")
 	fs.IntVar(&cfg.RateLimitMs, "r", cfg.RateLimitMs, "Rate limit (shorthand)")
+	fs.StringVar(&cfg.Control, "control", cfg.Control, "Unix socket path or loopback host:port accepting pause, resume, set-rate, stop, and status while crawling")
 
 	fs.StringVar(&cfg.Downloader, "downloader", cfg.Downloader, "Downloader to use: curl, wget, or auto")
 
@@ -138,20 +399,85 @@ func parseFlags() *Config {
 	fs.StringVar(&seedList, "s", seedList, "Seed URLs (shorthand)")
 
 	fs.StringVar(&siteList, "sites", siteList, sitesHelp)
+	fs.StringVar(&cfg.SiteConfig, "site-config", cfg.SiteConfig, "YAML or TOML file of site presets replacing the builtin ones")
+	fs.StringVar(&mirrorList, "mirrors", mirrorList, "Comma-separated host=mirror|mirror hosts tried when a host rate-limits or fails")
+	fs.StringVar(&subredditList, "subreddits", subredditList, "Comma-separated subreddits the reddit site searches (default: all of Reddit)")
+	fs.StringVar(&cfg.InputURLs, "input-urls", cfg.InputURLs, "File of image URLs to download, one per line or as JSON (replaces crawling unless -seeds is given)")
+	fs.StringVar(&cfg.WatchDir, "watch-dir", cfg.WatchDir, "Crawl each HTML page saved into this directory until interrupted (replaces crawling)")
+	fs.StringVar(&cfg.Provider, "provider", cfg.Provider, "Search an image API instead of crawling: "+strings.Join(providerNames, ", "))
+	fs.StringVar(&cfg.UnsplashKey, "unsplash-key", cfg.UnsplashKey, "Unsplash API access key (default: $UNSPLASH_ACCESS_KEY)")
+	fs.StringVar(&cfg.PexelsKey, "pexels-key", cfg.PexelsKey, "Pexels API key (default: $PEXELS_API_KEY)")
+	fs.StringVar(&cfg.PixabayKey, "pixabay-key", cfg.PixabayKey, "Pixabay API key (default: $PIXABAY_API_KEY)")
+	fs.StringVar(&cfg.PixabayImageType, "pixabay-image-type", cfg.PixabayImageType, "Pixabay image type: "+strings.Join(pixabayImageTypes, ", "))
+	fs.StringVar(&cfg.PixabayOrientation, "pixabay-orientation", cfg.PixabayOrientation, "Pixabay orientation: "+strings.Join(pixabayOrientations, ", "))
+	fs.StringVar(&cfg.OpenverseToken, "openverse-token", cfg.OpenverseToken, "Openverse API token, optional (default: $OPENVERSE_TOKEN)")
 
 	fs.BoolVar(&cfg.FollowSubdomains, "follow-subdomains", cfg.FollowSubdomains, "Follow links to subdomains")
+	fs.BoolVar(&cfg.FirstPartyOnly, "first-party-only", cfg.FirstPartyOnly, "Only keep images served from the same registrable domain as their page")
+	fs.StringVar(&licenseList, "license", licenseList, "Comma-separated licenses to keep images under, e.g. cc0,cc-by")
+	fs.StringVar(&cfg.URLInclude, "url-include", cfg.URLInclude, "Only follow links and keep images whose URL matches this regular expression")
+	fs.StringVar(&cfg.URLExclude, "url-exclude", cfg.URLExclude, "Skip links and images whose URL matches this regular expression")
+	fs.StringVar(&allowedDomains, "allow-domains", allowedDomains, "Comma-separated domains, with their subdomains, the crawl never leaves")
+	fs.StringVar(&blockedDomains, "block-domains", blockedDomains, "Comma-separated domains, with their subdomains, never crawled or downloaded from")
+	fs.StringVar(&cfg.BlockDomainsFile, "block-domains-file", cfg.BlockDomainsFile, "Blocklist of domains: plain, hosts-file, or EasyList format")
+	fs.BoolVar(&cfg.BlockAds, "block-ads", cfg.BlockAds, "Block the builtin list of ad and tracker domains")
+	fs.StringVar(&cfg.Language, "language", cfg.Language, "Only follow links from pages in this language (e.g. en)")
 	fs.BoolVar(&cfg.IgnoreRobots, "ignore-robots", cfg.IgnoreRobots, "Ignore robots.txt restrictions")
+	fs.StringVar(&cfg.RobotsOverrides, "robots-overrides", cfg.RobotsOverrides, "File of per-domain Allow and Disallow rules that replace those sites' robots.txt")
+	fs.BoolVar(&cfg.SkipProbe, "skip-probe", cfg.SkipProbe, "Skip the seed host reachability probe")
 
 	fs.IntVar(&cfg.MinWidth, "min-width", cfg.MinWidth, "Minimum image width in pixels (0 = no limit)")
 	fs.IntVar(&cfg.MinHeight, "min-height", cfg.MinHeight, "Minimum image height in pixels (0 = no limit)")
+	fs.IntVar(&cfg.MaxWidth, "max-width", cfg.MaxWidth, "Maximum image width in pixels (0 = no limit)")
+	fs.IntVar(&cfg.MaxHeight, "max-height", cfg.MaxHeight, "Maximum image height in pixels (0 = no limit)")
+	fs.Float64Var(&cfg.MinAspect, "min-aspect", cfg.MinAspect, "Minimum width to height ratio, e.g. 0.5 (0 = no limit)")
+	fs.Float64Var(&cfg.MaxAspect, "max-aspect", cfg.MaxAspect, "Maximum width to height ratio, e.g. 2.5 (0 = no limit)")
+	fs.StringVar(&cfg.MaxFileSize, "max-file-size", cfg.MaxFileSize, "Skip images larger than this size, e.g. 10MB")
+	fs.StringVar(&cfg.ModifiedSince, "modified-since", cfg.ModifiedSince, "Skip directory listing entries last modified before this date (YYYY-MM-DD)")
+	fs.StringVar(&typeList, "types", typeList, "Comma-separated image types to keep, e.g. jpg,png")
+	fs.StringVar(&imageTypeList, "image-types", imageTypeList, "Comma-separated image types recognized in URLs and responses, replacing the builtin list, e.g. jpg,png,webp")
+	fs.BoolVar(&cfg.AllowWebP, "allow-webp", cfg.AllowWebP, "Keep WebP images instead of skipping them")
+	fs.StringVar(&cfg.ConvertWebP, "convert-webp", cfg.ConvertWebP, "Convert downloaded WebP images to png or jpeg (implies -allow-webp)")
+	fs.StringVar(&cfg.ConvertHEIF, "convert-heif", cfg.ConvertHEIF, "Convert downloaded AVIF and HEIC images to png or jpeg with an external converter")
+	fs.StringVar(&cfg.ImageConverter, "image-converter", cfg.ImageConverter, "Command converting images for -convert-heif, with {in} and {out} for the paths")
 
 	fs.BoolVar(&cfg.SkipThumbnails, "skip-thumbnails", cfg.SkipThumbnails, "Skip images likely to be thumbnails")
+	fs.StringVar(&stripParamList, "strip-params", stripParamList, "Comma-separated query parameters that do not change the image, dropped when comparing image URLs")
+	fs.StringVar(&lazyAttrList, "lazy-attrs", lazyAttrList, "Comma-separated attributes besides data-src and the like that hold lazy-loaded image URLs, e.g. data-bg")
+	fs.BoolVar(&cfg.VideoPosters, "video-posters", cfg.VideoPosters, "Also collect video poster frames and og:video:thumbnail images")
+	fs.StringVar(&jsonPathList, "json-paths", jsonPathList, "Comma-separated JSON paths, e.g. $..urls.full, selecting image URLs in the JSON state pages embed")
+	fs.BoolVar(&cfg.PDFImages, "pdf-images", cfg.PDFImages, "Extract the images embedded in PDFs the crawl reaches")
+	fs.BoolVar(&cfg.IncludeDataURIs, "include-data-uris", cfg.IncludeDataURIs, "Save large images inlined in pages as data: URIs")
+	fs.StringVar(&cfg.MinDataURISize, "min-data-uri-size", cfg.MinDataURISize, "Smallest inline image -include-data-uris saves (default: "+defaultMinDataURISize+")")
+	fs.BoolVar(&cfg.PhotoOnly, "photo-only", cfg.PhotoOnly, "Keep only photographs, rejecting flat-color illustrations")
+	fs.BoolVar(&cfg.IllustrationOnly, "illustration-only", cfg.IllustrationOnly, "Keep only illustrations, rejecting photographs")
+	fs.BoolVar(&cfg.SkipWatermarked, "skip-watermarked", cfg.SkipWatermarked, "Skip images that look watermarked (stock previews)")
+	fs.Float64Var(&cfg.MinSharpness, "min-sharpness", cfg.MinSharpness, "Skip images less sharp than this variance of the Laplacian, e.g. 100 (0 = no limit)")
+	fs.StringVar(&cfg.Faces, "faces", cfg.Faces, "Keep only images with a face (require) or without one (exclude)")
+	fs.StringVar(&cfg.NSFWModel, "nsfw-model", cfg.NSFWModel, "ONNX model that flags NSFW images after download")
+	fs.Float64Var(&cfg.NSFWThreshold, "nsfw-threshold", cfg.NSFWThreshold, "NSFW score from which -nsfw-model flags an image")
+	fs.StringVar(&cfg.NSFWAction, "nsfw-action", cfg.NSFWAction, "What to do with flagged images: quarantine or delete")
+	fs.StringVar(&cfg.ONNXRuntime, "onnx-runtime", cfg.ONNXRuntime, "Path of the onnxruntime library -nsfw-model runs on")
+	fs.BoolVar(&cfg.KeepDuplicates, "keep-duplicates", cfg.KeepDuplicates, "Keep images whose content was already downloaded from another URL")
+	fs.BoolVar(&cfg.Quarantine, "quarantine-conflicts", cfg.Quarantine, "With several keywords, move images stored in more than one class to <output>/conflicts")
+	fs.BoolVar(&cfg.DryRun, "dry-run", cfg.DryRun, "Crawl and list matching image URLs without downloading")
+	fs.StringVar(&cfg.URLListFile, "url-list", cfg.URLListFile, "File for the dry-run URL list (default: <output>/image_urls.txt)")
+	fs.StringVar(&cfg.ExportURLs, "export-urls", cfg.ExportURLs, "Write the discovered image URLs to this file after crawling, as JSON if it ends in .json")
+	fs.StringVar(&manifestList, "manifest", manifestList, "Comma-separated manifest formats to write to the output directory: jsonl, csv")
+	fs.StringVar(&cfg.Split, "split", cfg.Split, "Assign downloaded images to train/val/test splits by percentage, e.g. 80/10/10")
+	fs.Uint64Var(&cfg.SplitSeed, "split-seed", cfg.SplitSeed, "Seed of the -split assignment; the same seed gives the same splits")
 	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "Enable verbose output")
 	fs.BoolVar(&cfg.Verbose, "v", cfg.Verbose, "Verbose (shorthand)")
+	fs.BoolVar(&cfg.Explain, "explain", cfg.Explain, "With -verbose, show where each image matched the keyword and which were rejected")
 
+	fs.StringVar(&configPath, "config", configPath, "Load options from a YAML or TOML config file")
 	fs.BoolVar(&showVersion, "version", showVersion, "Show version information and exit")
 
-	if err := fs.Parse(os.Args[1:]); err != nil {
+	if extra != nil {
+		extra(fs)
+	}
+
+	if err := fs.Parse(args); err != nil {
 		if err == flag.ErrHelp {
 			os.Exit(0)
 		}
@@ -166,14 +492,56 @@ func parseFlags() *Config {
 	}
 
 	cfg.Keyword = strings.TrimSpace(cfg.Keyword)
+	cfg.KeywordScope = strings.TrimSpace(strings.ToLower(cfg.KeywordScope))
+	cfg.Language = normalizeLanguage(cfg.Language)
 	cfg.OutputDir = strings.TrimSpace(cfg.OutputDir)
 	cfg.Downloader = strings.TrimSpace(strings.ToLower(cfg.Downloader))
 	cfg.UserAgent = strings.TrimSpace(cfg.UserAgent)
+	cfg.From = strings.TrimSpace(cfg.From)
+	cfg.ContactURL = strings.TrimSpace(cfg.ContactURL)
+	cfg.AcceptLanguage = strings.TrimSpace(cfg.AcceptLanguage)
+	cfg.Provider = strings.TrimSpace(strings.ToLower(cfg.Provider))
+	if cfg.UnsplashKey == "" {
+		cfg.UnsplashKey = os.Getenv("UNSPLASH_ACCESS_KEY")
+	}
+	if cfg.PexelsKey == "" {
+		cfg.PexelsKey = os.Getenv("PEXELS_API_KEY")
+	}
+	if cfg.PixabayKey == "" {
+		cfg.PixabayKey = os.Getenv("PIXABAY_API_KEY")
+	}
+	if cfg.OpenverseToken == "" {
+		cfg.OpenverseToken = os.Getenv("OPENVERSE_TOKEN")
+	}
+	cfg.PixabayImageType = strings.TrimSpace(strings.ToLower(cfg.PixabayImageType))
+	cfg.PixabayOrientation = strings.TrimSpace(strings.ToLower(cfg.PixabayOrientation))
 
 	cfg.Timeout = time.Duration(timeoutSeconds) * time.Second
 	cfg.SeedURLs = splitCSV(seedList)
+	cfg.AllowedTypes = splitCSV(strings.ToLower(typeList))
+	cfg.ImageTypes = splitCSV(strings.ToLower(imageTypeList))
+	cfg.Resolve = splitCSV(resolveList)
+	cfg.ClientHints = splitCSV(clientHintList)
+	cfg.TypeDepth = splitCSV(typeDepthList)
+	cfg.Subreddits = splitCSV(subredditList)
+	cfg.StripParams = splitCSV(stripParamList)
+	cfg.LazyAttrs = splitCSV(strings.ToLower(lazyAttrList))
+	cfg.AllowDomains = splitCSV(allowedDomains)
+	cfg.BlockDomains = splitCSV(blockedDomains)
+	cfg.JSONPaths = splitCSV(jsonPathList)
+	cfg.Manifest = splitCSV(strings.ToLower(manifestList))
+	cfg.License = splitCSV(strings.ToLower(licenseList))
+	cfg.Mirrors = splitCSV(mirrorList)
+	for i, subreddit := range cfg.Subreddits {
+		cfg.Subreddits[i] = strings.TrimPrefix(strings.TrimPrefix(subreddit, "/"), "r/")
+	}
+	for i, seed := range cfg.SeedURLs {
+		cfg.SeedURLs[i] = toSeedURL(seed)
+	}
 
-	if cfg.OutputDir == "" && cfg.Keyword != "" {
+	if cfg.OutputDir == "" && hasKeywordClasses(cfg) {
+		cfg.OutputDir = filepath.Join(".", defaultDatasetDir)
+	} else if cfg.OutputDir == "" && cfg.Keyword != "" {
 		dirName := sanitizeFilename(cfg.Keyword)
 		if dirName == "" {
 			dirName = cfg.Keyword
@@ -182,7 +550,9 @@ func parseFlags() *Config {
 	}
 
 	if siteList != "" {
-		cfg.DefaultSites, cfg.invalidSites = parseSiteList(siteList)
+		cfg.DefaultSites, cfg.invalidSites = parseSiteList(siteList, cfg.CustomSites)
+	} else if fileSites {
+		cfg.DefaultSites, cfg.invalidSites = parseSiteList(strings.Join(cfg.DefaultSites, ","), cfg.CustomSites)
 	} else {
 		cfg.DefaultSites = defaultSites()
 		cfg.invalidSites = nil
@@ -222,13 +592,39 @@ func splitCSV(value string) []string {
 	return result
 }
 
-func parseSiteList(value string) (valid []string, invalid []string) {
+// readListFile reads a file with one entry per line. Blank lines and lines
+// starting with # are skipped.
+func readListFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			entries = append(entries, line)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+func parseSiteList(value string, custom []SiteDefinition) (valid []string, invalid []string) {
 	for _, entry := range splitCSV(value) {
 		normalized := strings.ToLower(entry)
 		if _, ok := builtinSiteSet[normalized]; ok {
 			valid = append(valid, normalized)
 			continue
 		}
+		if slices.ContainsFunc(custom, func(site SiteDefinition) bool {
+			return strings.ToLower(strings.TrimSpace(site.Name)) == normalized
+		}) {
+			valid = append(valid, normalized)
+			continue
+		}
 		invalid = append(invalid, entry)
 	}
 	return valid, invalid
@@ -237,10 +633,28 @@ func parseSiteList(value string) (valid []string, invalid []string) {
 func validateConfig(cfg *Config) error {
 	var problems []string
 
-	if cfg.Keyword == "" {
+	cfg.classes = nil
+	if hasKeywordClasses(cfg) {
+		classes, err := parseKeywordClasses(cfg)
+		switch {
+		case err != nil:
+			problems = append(problems, err.Error())
+		case len(classes) == 0:
+			problems = append(problems, "no keywords given in -keyword or -keywords-file")
+		default:
+			cfg.classes = classes
+		}
+	} else if cfg.Keyword == "" {
 		problems = append(problems, "keyword is required (use -keyword or -k)")
 	}
 
+	if !slices.Contains(keywordScopes, cfg.KeywordScope) {
+		problems = append(problems, "keyword-scope must be one of: "+strings.Join(keywordScopes, ", "))
+	}
+	if cfg.Language != "" && (len(cfg.Language) < 2 || len(cfg.Language) > 3 || strings.Trim(cfg.Language, "abcdefghijklmnopqrstuvwxyz") != "") {
+		problems = append(problems, fmt.Sprintf("language must be a language code such as en or de: %s", cfg.Language))
+	}
+
 	if cfg.OutputDir == "" {
 		problems = append(problems, "output directory could not be determined")
 	}
@@ -249,14 +663,62 @@ func validateConfig(cfg *Config) error {
 		problems = append(problems, "max-pages must be at least 1")
 	}
 
+	if cfg.MaxImages < 0 {
+		problems = append(problems, "max-images cannot be negative")
+	}
+	if cfg.MaxResultPages < 0 {
+		problems = append(problems, "max-result-pages cannot be negative")
+	}
+	if cfg.MinImages < 0 {
+		problems = append(problems, "min-images cannot be negative")
+	}
+	if cfg.MaxImagesPerPage < 0 {
+		problems = append(problems, "max-images-per-page cannot be negative")
+	}
+	cfg.deadline = time.Time{}
+	if cfg.MaxDuration < 0 {
+		problems = append(problems, "max-duration cannot be negative")
+	} else if cfg.MaxDuration > 0 {
+		cfg.deadline = time.Now().Add(cfg.MaxDuration)
+	}
+	if cfg.MaxImages > 0 && cfg.MinImages > cfg.MaxImages {
+		problems = append(problems, "min-images cannot be more than max-images")
+	}
+
 	if cfg.MaxDepth < 1 {
 		problems = append(problems, "max-depth must be at least 1")
 	}
 
+	cfg.typeDepths = nil
+	if depths, err := parseTypeDepths(cfg.TypeDepth); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		cfg.typeDepths = depths
+	}
+
 	if cfg.Concurrency < 1 {
 		problems = append(problems, "concurrency must be at least 1")
 	}
 
+	if cfg.DownloadWorkers < 0 {
+		problems = append(problems, "download-concurrency cannot be negative")
+	}
+	if cfg.ProcessWorkers < 0 {
+		problems = append(problems, "process-concurrency cannot be negative")
+	}
+
+	if cfg.MaxMemory != "" {
+		limit, err := parseByteSize(cfg.MaxMemory)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("max-memory: %v", err))
+		case limit < 64<<20:
+			problems = append(problems, "max-memory must be at least 64MB")
+		default:
+			cfg.maxMemoryBytes = limit
+		}
+	}
+
 	if cfg.Timeout <= 0 {
 		problems = append(problems, "timeout must be greater than 0 seconds")
 	}
@@ -265,6 +727,38 @@ func validateConfig(cfg *Config) error {
 		problems = append(problems, "rate-limit cannot be negative")
 	}
 
+	if cfg.From != "" {
+		if err := validateFrom(cfg.From); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if cfg.ContactURL != "" {
+		if err := validateContactURL(cfg.ContactURL); err != nil {
+			problems = append(problems, err.Error())
+		}
+		cfg.UserAgent = identifiedUserAgent(cfg.UserAgent, cfg.ContactURL)
+	}
+	if strings.ContainsAny(cfg.AcceptLanguage, "\r\n") {
+		problems = append(problems, "accept-language must be one line")
+	}
+	cfg.clientHints = nil
+	if hints, err := parseClientHints(cfg.ClientHints); err != nil {
+		problems = append(problems, err.Error())
+	} else if len(hints) > 0 {
+		cfg.clientHints = hints
+	}
+	if cfg.Identify {
+		if cfg.From == "" && cfg.ContactURL == "" {
+			problems = append(problems, "identify requires -from or -contact-url")
+		}
+		applyIdentify(cfg)
+	}
+	if cfg.Control != "" {
+		if err := validateControlAddress(cfg.Control); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
 	if cfg.MinWidth < 0 {
 		problems = append(problems, "min-width cannot be negative")
 	}
@@ -273,6 +767,165 @@ func validateConfig(cfg *Config) error {
 		problems = append(problems, "min-height cannot be negative")
 	}
 
+	if cfg.MaxWidth < 0 || cfg.MaxHeight < 0 {
+		problems = append(problems, "max-width and max-height cannot be negative")
+	}
+	if (cfg.MaxWidth > 0 && cfg.MaxWidth < cfg.MinWidth) || (cfg.MaxHeight > 0 && cfg.MaxHeight < cfg.MinHeight) {
+		problems = append(problems, "max-width and max-height cannot be below min-width and min-height")
+	}
+
+	if cfg.MinAspect < 0 || cfg.MaxAspect < 0 {
+		problems = append(problems, "min-aspect and max-aspect cannot be negative")
+	}
+	if cfg.MaxAspect > 0 && cfg.MaxAspect < cfg.MinAspect {
+		problems = append(problems, "max-aspect cannot be below min-aspect")
+	}
+
+	if cfg.MinSharpness < 0 {
+		problems = append(problems, "min-sharpness cannot be negative")
+	}
+
+	if cfg.MaxFileSize != "" {
+		limit, err := parseByteSize(cfg.MaxFileSize)
+		switch {
+		case err != nil:
+			problems = append(problems, fmt.Sprintf("max-file-size: %v", err))
+		case limit == 0:
+			problems = append(problems, "max-file-size must be greater than 0")
+		default:
+			cfg.maxFileSizeBytes = limit
+		}
+	}
+
+	cfg.urlInclude, cfg.urlExclude = nil, nil
+	if cfg.URLInclude != "" {
+		pattern, err := regexp.Compile(cfg.URLInclude)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("url-include: %v", err))
+		}
+		cfg.urlInclude = pattern
+	}
+	if cfg.URLExclude != "" {
+		pattern, err := regexp.Compile(cfg.URLExclude)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("url-exclude: %v", err))
+		}
+		cfg.urlExclude = pattern
+	}
+
+	cfg.allowDomains = normalizeDomains(cfg.AllowDomains)
+	cfg.blockDomains = make(domainSet)
+	cfg.blockDomains.add(cfg.BlockDomains...)
+	if cfg.BlockDomainsFile != "" {
+		data, err := os.ReadFile(cfg.BlockDomainsFile)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("block-domains-file: %v", err))
+		}
+		cfg.blockDomains.add(parseBlocklist(string(data))...)
+	}
+	if cfg.BlockAds {
+		cfg.blockDomains.add(parseBlocklist(defaultAdBlocklist)...)
+	}
+
+	cfg.robotsOverrides = nil
+	if cfg.RobotsOverrides != "" {
+		data, err := os.ReadFile(cfg.RobotsOverrides)
+		if err == nil {
+			cfg.robotsOverrides, err = parseRobotsOverrides(string(data))
+		}
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("robots-overrides: %v", err))
+		}
+	}
+
+	cfg.modifiedSince = time.Time{}
+	if cfg.ModifiedSince != "" {
+		since, err := time.Parse("2006-01-02", cfg.ModifiedSince)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("modified-since must be a date such as 2024-01-31: %s", cfg.ModifiedSince))
+		} else {
+			cfg.modifiedSince = since
+		}
+	}
+
+	cfg.minDataURIBytes = 0
+	if cfg.IncludeDataURIs {
+		size := cfg.MinDataURISize
+		if size == "" {
+			size = defaultMinDataURISize
+		}
+		limit, err := parseByteSize(size)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("min-data-uri-size: %v", err))
+		} else {
+			cfg.minDataURIBytes = limit
+		}
+	}
+
+	for i, imageType := range cfg.ImageTypes {
+		cfg.ImageTypes[i] = strings.TrimPrefix(imageType, ".")
+		if !imageTypePattern.MatchString(cfg.ImageTypes[i]) {
+			problems = append(problems, fmt.Sprintf("invalid image type in -image-types: %q", imageType))
+		}
+	}
+	if len(cfg.ImageTypes) > 0 {
+		// WebP is kept when -image-types lists it, like any other type.
+		cfg.AllowWebP = slices.Contains(cfg.ImageTypes, "webp")
+	}
+
+	if cfg.ConvertWebP != "" {
+		format, ok := parseTargetFormat(cfg.ConvertWebP)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("convert-webp must be png or jpeg, got %q", cfg.ConvertWebP))
+		}
+		if len(cfg.ImageTypes) > 0 && !cfg.AllowWebP {
+			problems = append(problems, "convert-webp needs webp in -image-types")
+		}
+		cfg.ConvertWebP, cfg.AllowWebP = format, true
+	}
+	if cfg.ConvertHEIF != "" {
+		format, ok := parseTargetFormat(cfg.ConvertHEIF)
+		if !ok {
+			problems = append(problems, fmt.Sprintf("convert-heif must be png or jpeg, got %q", cfg.ConvertHEIF))
+		}
+		cfg.ConvertHEIF = format
+	}
+	if cfg.ImageConverter != "" && (!strings.Contains(cfg.ImageConverter, "{in}") || !strings.Contains(cfg.ImageConverter, "{out}")) {
+		problems = append(problems, "image-converter must contain {in} and {out}")
+	}
+
+	cfg.allowedMIMETypes = nil
+	for _, imageType := range cfg.AllowedTypes {
+		mimeType, ok := extensionMIMETypes["."+strings.TrimPrefix(imageType, ".")]
+		if !ok && slices.Contains(cfg.ImageTypes, strings.TrimPrefix(imageType, ".")) {
+			mimeType, ok = imageTypeMIME("."+strings.TrimPrefix(imageType, ".")), true
+		}
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown image type in -types: %s", imageType))
+			continue
+		}
+		if mimeType == "image/webp" && !cfg.AllowWebP {
+			problems = append(problems, "-types webp needs -allow-webp")
+			continue
+		}
+		if format := cfg.conversionFormat(mimeType); format != "" {
+			problems = append(problems, fmt.Sprintf("-types %s keeps nothing when those images are converted to %s", imageType, format))
+			continue
+		}
+		if cfg.allowedMIMETypes == nil {
+			cfg.allowedMIMETypes = make(map[string]struct{})
+		}
+		cfg.allowedMIMETypes[mimeType] = struct{}{}
+	}
+
+	if cfg.PhotoOnly && cfg.IllustrationOnly {
+		problems = append(problems, "photo-only and illustration-only cannot be used together")
+	}
+	cfg.NSFWAction = strings.ToLower(strings.TrimSpace(cfg.NSFWAction))
+	problems = append(problems, validateNSFW(cfg)...)
+	cfg.Faces = strings.ToLower(strings.TrimSpace(cfg.Faces))
+	problems = append(problems, validateFaces(cfg)...)
+
 	validDownloaders := map[string]struct{}{
 		"auto": {},
 		"curl": {},
@@ -282,9 +935,71 @@ func validateConfig(cfg *Config) error {
 		problems = append(problems, "downloader must be one of: auto, curl, wget")
 	}
 
+	cfg.proxies = nil
+	if proxies, err := loadProxies(cfg); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		cfg.proxies = proxies
+		if proxies.socks() && cfg.Downloader == "wget" {
+			problems = append(problems, "wget cannot use SOCKS proxies; use -downloader curl")
+		}
+	}
+
+	cfg.resolve = nil
+	if overrides, err := parseResolveOverrides(cfg.Resolve); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		cfg.resolve = overrides
+		if overrides != nil && cfg.Downloader == "wget" {
+			problems = append(problems, "wget does not support -resolve; use -downloader curl")
+		}
+	}
+
+	if cfg.Provider != "" && !slices.Contains(providerNames, cfg.Provider) {
+		problems = append(problems, "provider must be one of: "+strings.Join(providerNames, ", "))
+	}
+	if cfg.Provider == "unsplash" && cfg.UnsplashKey == "" {
+		problems = append(problems, "the unsplash provider needs an access key (use -unsplash-key or set UNSPLASH_ACCESS_KEY)")
+	}
+	if cfg.Provider == "pexels" && cfg.PexelsKey == "" {
+		problems = append(problems, "the pexels provider needs an API key (use -pexels-key or set PEXELS_API_KEY)")
+	}
+	if cfg.Provider == "pixabay" && cfg.PixabayKey == "" {
+		problems = append(problems, "the pixabay provider needs an API key (use -pixabay-key or set PIXABAY_API_KEY)")
+	}
+	if cfg.PixabayImageType != "" && !slices.Contains(pixabayImageTypes, cfg.PixabayImageType) {
+		problems = append(problems, "pixabay-image-type must be one of: "+strings.Join(pixabayImageTypes, ", "))
+	}
+	if cfg.PixabayOrientation != "" && !slices.Contains(pixabayOrientations, cfg.PixabayOrientation) {
+		problems = append(problems, "pixabay-orientation must be one of: "+strings.Join(pixabayOrientations, ", "))
+	}
+
 	for _, seed := range cfg.SeedURLs {
-		if !strings.HasPrefix(seed, "http://") && !strings.HasPrefix(seed, "https://") {
-			problems = append(problems, fmt.Sprintf("invalid seed URL (must start with http:// or https://): %s", seed))
+		if !hasSeedScheme(seed) {
+			problems = append(problems, fmt.Sprintf("invalid seed URL (must be an existing path or start with http://, https://, file://, or ftp://): %s", seed))
+		}
+	}
+
+	problems = append(problems, validateCustomSites(cfg)...)
+
+	presets, err := loadSitePresets(cfg.SiteConfig)
+	if err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = append(problems, validateSitePresets(presets)...)
+	}
+	cfg.sitePresets = presets
+	problems = append(problems, collectMirrors(cfg)...)
+
+	jsonPaths, pathProblems := parseJSONPaths(cfg.JSONPaths)
+	for _, problem := range pathProblems {
+		problems = append(problems, "invalid -json-paths: "+problem)
+	}
+	cfg.jsonPaths = jsonPaths
+
+	for _, attr := range cfg.LazyAttrs {
+		if !attributeNamePattern.MatchString(attr) {
+			problems = append(problems, fmt.Sprintf("invalid attribute name in -lazy-attrs: %q", attr))
 		}
 	}
 
@@ -293,18 +1008,45 @@ func validateConfig(cfg *Config) error {
 	}
 
 	for _, site := range cfg.DefaultSites {
-		if _, ok := builtinSiteSet[site]; !ok {
+		if _, ok := builtinSiteSet[site]; !ok && cfg.customSite(site) == nil {
 			problems = append(problems, fmt.Sprintf("unsupported site in configuration: %s", site))
 		}
 	}
 
+	if cfg.WatchDir != "" {
+		if info, err := os.Stat(cfg.WatchDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Sprintf("watch-dir is not a directory: %s", cfg.WatchDir))
+		}
+	}
+
 	if len(cfg.SeedURLs) == 0 && len(cfg.DefaultSites) == 0 {
 		problems = append(problems, "no seed URLs or default sites provided")
 	}
 
+	if err := validateManifestFormats(cfg.Manifest); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateLicenses(cfg.License); err != nil {
+		problems = append(problems, err.Error())
+	}
+	cfg.splitShares = nil
+	if cfg.Split != "" {
+		if shares, err := parseSplit(cfg.Split); err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			cfg.splitShares = shares
+		}
+	}
+	if policy, err := loadPolicy(); err != nil {
+		problems = append(problems, err.Error())
+	} else {
+		problems = append(problems, applyPolicy(cfg, policy)...)
+	}
+
 	if len(problems) > 0 {
 		return fmt.Errorf(strings.Join(problems, "; "))
 	}
+	capToFileLimit(cfg)
 	return nil
 }
 
@@ -313,45 +1055,322 @@ func printUsage() {
 
 Usage:
   %[1]s -keyword <keyword> [options]
+  %[1]s <command> [options]
+
+Commands:
+  run                       Crawl and download in one go (default)
+  crawl                     Crawl only and save discovered image URLs to the crawl state
+  download                  Download pending images recorded in the crawl state
+  resume                    Continue an interrupted crawl, then download pending images;
+                            with -resume-downloads, skip the crawl, verify the files
+                            already downloaded against their checksums, and download
+                            the rest (from <output>/image_urls.txt without a state)
+  retry-failed              Re-attempt the downloads listed in <output>/failures.tsv
+  refresh                   Re-check downloaded images, update changed ones, and
+                            report dead source URLs in <output>/freshness.tsv
+  check-links               Check that every source URL is still alive, record the
+                            status in the crawl state, and write <output>/link-rot.tsv
+  enrich                    Look the downloaded images without attribution up on
+                            Wikimedia Commons by their SHA-1 and fill in the author,
+                            license, title, and depicted subjects found there;
+                            writes the -manifest files again
+  export                    Write the discovered images as txt, json, or csv, or
+                            the downloaded ones as a COCO dataset (-format coco;
+                            -coco-whole-image adds a box per image of its class)
+                            or a YOLO dataset directory (-format yolo -out <dir>,
+                            split by -val-split, default 0.2, or by -split when
+                            the crawl used it, with empty label stubs and a
+                            data.yaml naming the keywords)
+  sample                    Write a random sample of the downloaded images as a
+                            manifest (-n, -seed, -out), stratified by host, label,
+                            or resolution-bucket (-stratify-by; default: label),
+                            and copy it into a directory with -copy-to
+  stats                     Show progress recorded in the crawl state
+  serve-preview             Serve a gallery of the downloaded images, newest first,
+                            reloading itself while a crawl into the output
+                            directory runs (-addr, default: 127.0.0.1:8000)
+  sites                     List the builtin sites and their search URLs
+  control <command>         Send pause, resume, set-rate <ms>, stop, or status to
+                            the crawl listening on -control
 
 Required Flags:
-  -keyword, -k <string>     Keyword to search for in image filenames
+  -keyword, -k <string>     Keyword to search for in image filenames; several
+                            comma-separated keywords are crawled as classes
+                            into <output>/<keyword> (default output: ./dataset)
 
 Optional Flags:
+  -keywords-file <path>     File of keywords, one per line, each crawled as a
+                            class like comma-separated -keyword values
+  -keyword-scope <scope>    Where the keyword must appear: filename, path, url,
+                            metadata (filename or alt/title/caption), text
+                            (alt/title/caption only), or any (url or
+                            alt/title/caption) (default: url)
   -output, -o <string>      Output directory (default: ./<keyword>)
   -max-pages, -p <int>      Maximum number of pages to crawl (default: %[2]d)
+  -max-images <int>         Stop crawling as soon as this many image URLs are
+                            found (default: no limit)
+  -max-duration <duration>  Stop crawling after this much time, e.g. 30m or 2h,
+                            keeping what was found; the frontier is saved for
+                            the resume command
+  -max-duration-downloads   Stop downloading too when -max-duration runs out,
+                            leaving the rest pending
+  -max-images-per-page <int>
+                            Keep at most this many images from each page,
+                            preferring linked full-size, described, and large
+                            images over thumbnails and icons (default: no limit)
+  -min-images <int>         Keep crawling deeper and longer, doubling -max-pages
+                            and adding a level of depth up to 4 times (and at
+                            most 2000 pages), until this many image URLs are
+                            found; reports the images found on each site
   -max-depth, -d <int>      Maximum crawl depth (default: %[3]d)
-  -concurrency, -c <int>    Number of concurrent workers (default: %[4]d)
+  -type-depth <list>        Depth limits per page type (search, gallery, detail,
+                            other), e.g. detail=4,search=2; by default detail
+                            pages linked from search results or galleries are
+                            followed one level past -max-depth
+  -max-result-pages <int>   Follow next-page links (rel=next, "Next", ?page=N)
+                            ahead of other links and without going deeper, up
+                            to this many pages of a listing (default: %[9]d;
+                            0 for no limit)
+  -concurrency, -c <int|auto>
+                            Number of concurrent crawl workers (default: %[4]d); auto
+                            starts small and scales with latency, errors, and CPU
+  -download-concurrency, -dc <int>
+                            Number of concurrent downloads (default: same as -c)
+  -process-concurrency, -pc <int>
+                            Number of downloaded images validated, filtered,
+                            hashed, and stored at once, apart from the
+                            downloads (default: number of CPUs)
+  -max-memory <size>        Soft memory limit (e.g. 2GB); new pages spill to disk near it
   -timeout, -t <int>        Request timeout in seconds (default: %[5]d)
   -rate-limit, -r <int>     Rate limit between requests in ms (default: %[6]d)
+  -control <addr>           Accept commands while crawling on a Unix socket path
+                            or a loopback host:port; send them with the control
+                            command
   -user-agent, -ua <string> User agent string
+  -from <email>             Contact address sent in the From header of every request
+  -contact-url <url>        Page about the crawler, linked from the User-Agent in
+                            place of the default's placeholder
+  -identify                 Run as an identified, low-traffic crawler: requires
+                            -from or -contact-url, crawls and downloads one at a
+                            time, waits at least 3s between pages, and honours
+                            robots.txt Crawl-delay
+  -accept-language <value>  Accept-Language header, for sites whose results vary
+                            by locale (default: en-US,en;q=0.9, or the -language
+                            preferred over English)
+  -client-hints <list>      Comma-separated Name=value client hint headers sent
+                            with every request, e.g.
+                            Sec-CH-UA-Platform="Windows",Viewport-Width=1280
+  -proxy <url>              Proxy for crawling and downloads (http://, https://,
+                            socks5://); comma-separated for several
+  -proxy-file <path>        File with one proxy URL per line
+  -rotate-proxies           Rotate through the proxies round-robin per request
+  -resolve <list>           Pin hosts to addresses, curl-style: host:address or
+                            host:port:address, comma-separated
   -downloader <string>      Downloader: curl, wget, or auto (default: auto)
-  -seeds, -s <string>       Comma-separated seed URLs to start crawling
-  -sites <string>           Comma-separated default sites to use (available: %[7]s)
+  -seeds, -s <string>       Comma-separated seed URLs to start crawling (http, https,
+                            ftp, file:// or local paths to saved pages)
+  -sites <string>           Comma-separated default sites to use (available: %[7]s,
+                            and any custom-sites from the config file)
+  -site-config <path>       YAML or TOML file of presets (rate-limit, max-depth,
+                            user-agent, image-selector, link-selector) keyed by
+                            site, replacing the builtin presets of those sites
+  -mirrors <list>           Comma-separated host=mirror|mirror entries; pages and
+                            images are fetched from a host's mirrors, in order,
+                            when it answers 429 or 5xx or cannot be reached
+  -subreddits <list>        Comma-separated subreddits the reddit site searches
+                            (default: all of Reddit)
+  -input-urls <path>        File of image URLs to download, one per line or a JSON
+                            list as -export-urls writes; replaces crawling unless
+                            -seeds is also given
+  -watch-dir <dir>          Keep watching a directory and crawl each HTML page
+                            saved into it, for pages the crawler cannot reach;
+                            replaces crawling, stop with Ctrl+C
+  -provider <name>          Query an image API instead of crawling HTML: %[8]s;
+                            each results page counts against -max-pages
+  -unsplash-key <key>       Unsplash API access key (default: $UNSPLASH_ACCESS_KEY)
+  -pexels-key <key>         Pexels API key (default: $PEXELS_API_KEY)
+  -pixabay-key <key>        Pixabay API key (default: $PIXABAY_API_KEY); -min-width
+                            and -min-height are applied in the search
+  -pixabay-image-type <t>   all, photo, illustration, or vector (default: follows
+                            -photo-only/-illustration-only, else all)
+  -pixabay-orientation <o>  all, horizontal, or vertical (default: all)
+  -openverse-token <t>      Openverse API token for higher rate limits; not
+                            required (default: $OPENVERSE_TOKEN)
   -min-width <int>          Minimum image width in pixels (default: 0)
   -min-height <int>         Minimum image height in pixels (default: 0)
+  -max-width <int>          Maximum image width in pixels (default: 0, no limit)
+  -max-height <int>         Maximum image height in pixels (default: 0, no limit)
+  -min-aspect <ratio>       Minimum width to height ratio, e.g. 0.5 to skip tall
+                            banners (default: 0, no limit)
+  -max-aspect <ratio>       Maximum width to height ratio, e.g. 2.5 to skip
+                            panoramas and wide banners (default: 0, no limit)
+  -max-file-size <size>     Skip images larger than this (e.g. 10MB); entries of
+                            directory listings are skipped by their listed size
+  -modified-since <date>    Skip directory listing entries last modified before
+                            this date (YYYY-MM-DD)
+  -types <list>             Comma-separated image types to keep (e.g. jpg,png)
+  -image-types <list>       Image types recognized in URLs and response headers and
+                            downloaded, replacing the builtin list, e.g. jpg,png,webp;
+                            types the builtin list lacks, such as jxl, are added
+                            (unlike -types, other images are never downloaded)
+  -allow-webp               Keep WebP images instead of skipping them (default: false)
+  -convert-webp <format>    Convert downloaded WebP images to png or jpeg, for
+                            tools that cannot read WebP (implies -allow-webp)
+  -convert-heif <format>    Convert downloaded AVIF and HEIC images to png or jpeg
+                            with ImageMagick, libvips, or libheif, whichever is
+                            installed (default: kept as downloaded)
+  -image-converter <cmd>    Converter for -convert-heif, with {in} and {out} for
+                            the paths, e.g. "heif-convert -q 90 {in} {out}"
   -skip-thumbnails          Skip images likely to be thumbnails (default: false)
+  -strip-params <list>      Comma-separated query parameters, such as cache
+                            busters, dropped when comparing image URLs; more are
+                            learned per host from downloads with equal content
+  -lazy-attrs <list>        Comma-separated attributes that hold lazy-loaded
+                            image URLs on this site, such as
+                            data-flickity-lazyload or data-bg, besides data-src,
+                            data-original, data-lazy, and the like
+  -video-posters            Also collect the poster frames of videos and
+                            og:video:thumbnail images (default: false)
+  -json-paths <list>        Comma-separated JSON paths selecting image URLs in
+                            the JSON pages embed for their scripts, such as
+                            __NEXT_DATA__ (e.g. $.props.photos[*].src or
+                            $..urls.full); builtin sites have their own
+  -pdf-images               Extract the images embedded in PDFs the crawl
+                            reaches instead of skipping them (default: false)
+  -include-data-uris        Save images inlined in pages as data: URIs when
+                            they are at least -min-data-uri-size (default: false)
+  -min-data-uri-size <size> Smallest inline image to save (default: 50KB)
+  -photo-only               Keep only photographs, rejecting clipart/illustrations
+  -illustration-only        Keep only illustrations, rejecting photographs
+  -skip-watermarked         Skip stock previews and images with detected watermarks
+  -min-sharpness <score>    Skip blurry images: those whose variance of the
+                            Laplacian, measured at up to 1024 pixels, is below
+                            this; around 100 rejects most blur (default: 0)
+  -faces <mode>             require: keep only images with a face, for face
+                            datasets; exclude: keep only images without one, for
+                            privacy-safe datasets. Images that cannot be checked,
+                            such as SVGs, are rejected in both modes
+  -nsfw-model <path>        Run this ONNX NSFW classifier on each downloaded image
+                            and move those it flags to <output>/nsfw; needs a
+                            build with -tags onnx and the onnxruntime library
+  -nsfw-threshold <score>   NSFW score from 0 to 1 from which an image is flagged
+                            (default: %.1[10]f)
+  -nsfw-action <action>     quarantine flagged images in <output>/nsfw, or delete
+                            them (default: quarantine)
+  -onnx-runtime <path>      onnxruntime library to load (default: libonnxruntime
+                            on the library path)
+  -keep-duplicates          Keep identical images downloaded from different URLs
+  -quarantine-conflicts     With several keywords, move images stored in more than
+                            one class to <output>/conflicts/<class>; without it
+                            they are only listed in <output>/class_conflicts.tsv
   -follow-subdomains        Follow links to subdomains (default: false)
+  -first-party-only         Only keep images served from the same registrable
+                            domain (eTLD+1) as the page they are on, dropping
+                            ads, trackers, and embeds; note that some sites
+                            serve their own images from a CDN domain
+  -license <list>           Only keep images under these licenses: cc0, pdm,
+                            cc-by, cc-by-sa, cc-by-nd, cc-by-nc, cc-by-nc-sa,
+                            cc-by-nc-nd; read from Creative Commons and
+                            rel=license links, schema.org license fields, and
+                            Wikimedia Commons templates, or a provider's API.
+                            Images with no license found are dropped
+  -url-include <regex>      Only follow links and keep images whose URL matches,
+                            e.g. '/gallery/|cdn\.example\.com'; seeds are exempt
+  -url-exclude <regex>      Skip links and images whose URL matches, e.g.
+                            '/(avatars|sprites)/'
+  -allow-domains <list>     Comma-separated domains the crawl never leaves, even
+                            with -follow-subdomains; subdomains are included
+  -block-domains <list>     Comma-separated domains never crawled or downloaded
+                            from, such as ad and tracker CDNs
+  -block-domains-file <path>
+                            Blocklist of domains, one per line: plain domains,
+                            a hosts file (0.0.0.0 ads.example.com), or EasyList
+                            domain rules (||ads.example.com^)
+  -block-ads                Block a builtin list of ad and tracker domains (default: false)
+  -language <code>          Only follow links from pages in this language, such
+                            as en, as declared by the page or read from its
+                            text; pages of unknown language and seeds are
+                            followed, and images are taken from every page
   -ignore-robots            Ignore robots.txt restrictions (default: false)
+  -robots-overrides <path>  File of [domain] sections with Allow and Disallow rules
+                            that replace the robots.txt of those domains and their
+                            subdomains, for sites you own or may crawl
+  -skip-probe               Skip the DNS/TCP/TLS probe of seed hosts at startup
+  -dry-run                  Crawl and list matching image URLs, skip downloading
+  -url-list <path>          Where -dry-run saves the URL list (default: <output>/image_urls.txt)
+  -export-urls <path>       Write the discovered image URLs to this file after
+                            crawling: one per line for wget -i or aria2c -i, or
+                            with their tags, variants, and attribution if it
+                            ends in .json; -input-urls reads both back
+  -manifest <list>          Write manifest.jsonl and/or manifest.csv (jsonl, csv)
+                            to the output directory after downloading, listing
+                            each image's path, URL, page, caption and its alt,
+                            title, and figcaption apart, license, keyword match,
+                            relevance score (0-1), dimensions, size, SHA-256,
+                            status, and split
+  -split <shares>           Assign downloaded images to train/val(/test) splits by
+                            percentage, e.g. 80/10/10, recorded in the state and
+                            manifest and used by export -format yolo; an image's
+                            split follows from its content, so it stays put as
+                            the dataset grows
+  -split-seed <int>         Seed of the -split assignment (default: 0)
   -verbose, -v              Enable verbose output (default: false)
+  -explain                  With -verbose, highlight where each image matched the
+                            keyword and log the images that did not match
+  -config <path>            Load options from a YAML or TOML file (flags override it)
   -version                  Show version information
 
 Examples:
   %[1]s -k dog
   %[1]s -k cat -o ./cats -p 100
   %[1]s -k nature -s "https://example.com,https://photos.example.com"
+  %[1]s -k fossil -s ./saved_pages/,ftp://archive.example.org/images/
   %[1]s -k landscape -c 10 -downloader curl -v
+  %[1]s -config crawl.yaml -p 200
+  %[1]s crawl -k bird -p 300 && %[1]s download -k bird
+  %[1]s export -k bird -format csv -out birds.csv
+  %[1]s export -k dog,cat -format coco -out dataset/annotations.json
+  %[1]s export -k dog,cat -format yolo -out yolo -val-split 0.1
+  %[1]s sample -k dog,cat -n 200 -stratify-by host -copy-to pilot -out pilot.csv
+  %[1]s retry-failed -k bird -retries 5 -backoff 30s
+  %[1]s resume -k bird -resume-downloads
+  %[1]s check-links -k bird -prune
+  %[1]s -k mountain -provider unsplash -unsplash-key <key> -p 5
 
 Notes:
-  - WebP images are automatically excluded
-  - robots.txt is respected unless -ignore-robots is specified
+  - WebP images are excluded unless -allow-webp or -convert-webp is given
+  - Image type and size are checked with a HEAD request before downloading,
+    so oversized or non-image responses are skipped without fetching them
+  - Downloads are deduplicated by SHA-256; hashes are listed in
+    <output>/hashes.sha256 (verify with: sha256sum -c hashes.sha256)
+  - Images whose ETag, or Last-Modified and name, and size match a stored image
+    are not downloaded again, even from another URL or CDN host
+  - robots.txt is respected unless -ignore-robots is specified; -robots-overrides
+    replaces it for chosen sites only
+  - A build may carry a deployment policy, shown as Policy in the configuration:
+    a minimum rate limit, a maximum number of workers, or binding robots.txt,
+    which no flag, config file, or control command can loosen
   - Progress bars show crawling and download progress
-
-`, filepath.Base(os.Args[0]), defaultMaxPages, defaultMaxDepth, defaultConcurrency, defaultTimeoutSec, defaultRateLimitMs, strings.Join(builtinSites, ","))
+  - The run and resume commands download images while the crawl is still
+    in progress; the crawl command only records them
+  - Crawl progress is saved to <output>/.crawlstate.json; press Ctrl+C once
+    to stop gracefully and continue later with the resume command
+  - The download and resume commands fetch again the images an earlier run
+    filtered out when they pass the filters given now, e.g. a lower -min-width
+  - <output>/.crawlinfo records the tool version, configuration, and times
+    of the runs that produced the folder (API keys are left out)
+  - Config file keys match the long flag names (e.g. max-pages: 100);
+    timeout takes a duration string such as "45s"
+  - More sites can be defined in the config file under custom-sites, each
+    with a name, a search-url containing {keyword}, and optionally an
+    image-selector, link-selector (CSS), and rate-limit in ms; name them
+    in -sites to crawl them
+
+`, filepath.Base(os.Args[0]), defaultMaxPages, defaultMaxDepth, defaultConcurrency, defaultTimeoutSec, defaultRateLimitMs, strings.Join(builtinSites, ","), strings.Join(providerNames, ", "), defaultResultPages, defaultNSFWThreshold)
 }
 
 func printBanner() {
-	fmt.Println(`
+	fmt.Print(`
                                               ████
                                              ░░███
   ██████  ████████   ██████   █████ ███ █████ ░███  █████ ████
@@ -363,34 +1382,122 @@ func printBanner() {
                                                      ███ ░███
                                                     ░░██████
                                                      ░░░░░░
+
 `)
 }
 
 func printConfig(cfg *Config) {
 	fmt.Println("Configuration:")
-	fmt.Printf("  Keyword:           %s\n", cfg.Keyword)
+	if cfg.classes != nil {
+		fmt.Printf("  Classes:           %s (matched in %s)\n", strings.Join(cfg.classes, ", "), cfg.KeywordScope)
+		if cfg.Quarantine {
+			fmt.Printf("  Class Conflicts:   quarantined in %s\n", filepath.Join(cfg.OutputDir, quarantineDirName))
+		}
+	} else {
+		fmt.Printf("  Keyword:           %s (matched in %s)\n", cfg.Keyword, cfg.KeywordScope)
+	}
 	fmt.Printf("  Output Directory:  %s\n", cfg.OutputDir)
 	fmt.Printf("  Max Pages:         %d\n", cfg.MaxPages)
+	if cfg.MaxImages > 0 {
+		fmt.Printf("  Max Images:        %d\n", cfg.MaxImages)
+	}
+	if cfg.MinImages > 0 {
+		fmt.Printf("  Min Images:        %d\n", cfg.MinImages)
+	}
+	if cfg.MaxImagesPerPage > 0 {
+		fmt.Printf("  Images per Page:   %d at most\n", cfg.MaxImagesPerPage)
+	}
+	if cfg.MaxDuration > 0 {
+		scope := "crawling"
+		if cfg.StopDownloads {
+			scope = "crawling and downloading"
+		}
+		fmt.Printf("  Max Duration:      %s of %s\n", cfg.MaxDuration, scope)
+	}
 	fmt.Printf("  Max Depth:         %d\n", cfg.MaxDepth)
-	fmt.Printf("  Concurrency:       %d\n", cfg.Concurrency)
+	if len(cfg.typeDepths) > 0 {
+		fmt.Printf("  Depth by Type:     %s\n", strings.Join(cfg.TypeDepth, ", "))
+	}
+	fmt.Printf("  Max Result Pages:  %d\n", cfg.MaxResultPages)
+	if cfg.AutoConcurrency {
+		fmt.Printf("  Concurrency:       auto crawl (up to %d), %d download, %d process\n", cfg.autoscaleCeiling(), cfg.downloadConcurrency(), cfg.processConcurrency())
+	} else {
+		fmt.Printf("  Concurrency:       %d crawl, %d download, %d process\n", cfg.Concurrency, cfg.downloadConcurrency(), cfg.processConcurrency())
+	}
 	fmt.Printf("  Timeout:           %s\n", cfg.Timeout)
+	if cfg.maxMemoryBytes > 0 {
+		fmt.Printf("  Memory Limit:      %s (soft)\n", formatBytes(cfg.maxMemoryBytes))
+	}
 	fmt.Printf("  Rate Limit:        %dms\n", cfg.RateLimitMs)
+	if cfg.From != "" || cfg.ContactURL != "" {
+		fmt.Printf("  User Agent:        %s\n", cfg.UserAgent)
+	}
+	if cfg.From != "" {
+		fmt.Printf("  From:              %s\n", cfg.From)
+	}
+	fmt.Printf("  Accept-Language:   %s\n", cfg.acceptLanguage())
+	if len(cfg.clientHints) > 0 {
+		fmt.Printf("  Client Hints:      %s\n", strings.Join(cfg.ClientHints, ", "))
+	}
+	if cfg.Identify {
+		fmt.Printf("  Identify:          yes (low traffic, honours Crawl-delay)\n")
+	}
+	if cfg.Control != "" {
+		fmt.Printf("  Control:           %s\n", cfg.Control)
+	}
 	fmt.Printf("  Downloader:        %s\n", cfg.Downloader)
+	if len(cfg.resolve) > 0 {
+		fmt.Printf("  DNS Overrides:     %s\n", strings.Join(cfg.Resolve, ", "))
+	}
+	if cfg.proxies != nil {
+		mode := "first"
+		if cfg.proxies.rotate {
+			mode = "round-robin"
+		}
+		fmt.Printf("  Proxies:           %d (%s)\n", len(cfg.proxies.proxies), mode)
+	}
 
 	if cfg.MinWidth > 0 || cfg.MinHeight > 0 {
 		fmt.Printf("  Min Resolution:    %dx%d\n", cfg.MinWidth, cfg.MinHeight)
 	} else {
 		fmt.Printf("  Min Resolution:    No limit\n")
 	}
+	if cfg.MaxWidth > 0 || cfg.MaxHeight > 0 {
+		fmt.Printf("  Max Resolution:    %dx%d\n", cfg.MaxWidth, cfg.MaxHeight)
+	}
+	switch {
+	case cfg.MinAspect > 0 && cfg.MaxAspect > 0:
+		fmt.Printf("  Aspect Ratio:      %.2f to %.2f\n", cfg.MinAspect, cfg.MaxAspect)
+	case cfg.MinAspect > 0:
+		fmt.Printf("  Aspect Ratio:      at least %.2f\n", cfg.MinAspect)
+	case cfg.MaxAspect > 0:
+		fmt.Printf("  Aspect Ratio:      at most %.2f\n", cfg.MaxAspect)
+	}
 
-	if len(cfg.SeedURLs) > 0 {
+	if cfg.InputURLs != "" {
+		fmt.Printf("  URL List:          %s\n", cfg.InputURLs)
+	}
+	if cfg.ExportURLs != "" {
+		fmt.Printf("  Export URLs:       %s\n", cfg.ExportURLs)
+	}
+	if len(cfg.Manifest) > 0 {
+		fmt.Printf("  Manifest:          %s\n", strings.Join(cfg.Manifest, ", "))
+	}
+	if cfg.splitShares != nil {
+		fmt.Printf("  Split:             %s %s (seed %d)\n", strings.Join(splitNames[:len(cfg.splitShares)], "/"), cfg.Split, cfg.SplitSeed)
+	}
+	if cfg.WatchDir != "" {
+		fmt.Printf("  Source:            pages saved into %s\n", cfg.WatchDir)
+	} else if cfg.Provider != "" {
+		fmt.Printf("  Source:            %s API (up to %d results pages)\n", cfg.Provider, cfg.MaxPages)
+	} else if len(cfg.SeedURLs) > 0 {
 		fmt.Printf("  Seed URLs:         %d provided\n", len(cfg.SeedURLs))
 		if cfg.Verbose {
 			for i, url := range cfg.SeedURLs {
 				fmt.Printf("    %d. %s\n", i+1, url)
 			}
 		}
-	} else {
+	} else if cfg.InputURLs == "" {
 		switch {
 		case len(cfg.DefaultSites) == 0:
 			fmt.Println("  Seed URLs:         None (crawler will not start)")
@@ -399,11 +1506,99 @@ func printConfig(cfg *Config) {
 		default:
 			fmt.Printf("  Seed URLs:         None (using sites: %s)\n", strings.Join(cfg.DefaultSites, ", "))
 		}
+		if len(cfg.Subreddits) > 0 && slices.Contains(cfg.DefaultSites, "reddit") {
+			fmt.Printf("  Subreddits:        %s\n", strings.Join(cfg.Subreddits, ", "))
+		}
 	}
 
+	if cfg.maxFileSizeBytes > 0 {
+		fmt.Printf("  Max File Size:     %s\n", formatBytes(cfg.maxFileSizeBytes))
+	}
+	if !cfg.modifiedSince.IsZero() {
+		fmt.Printf("  Modified Since:    %s\n", cfg.modifiedSince.Format("2006-01-02"))
+	}
+	if cfg.IncludeDataURIs {
+		fmt.Printf("  Data URIs:         %s and larger\n", formatBytes(cfg.minDataURIBytes))
+	}
+	if len(cfg.ImageTypes) > 0 {
+		fmt.Printf("  Image Formats:     %s\n", strings.Join(cfg.ImageTypes, ", "))
+	}
+	if len(cfg.AllowedTypes) > 0 {
+		fmt.Printf("  Image Types:       %s\n", strings.Join(cfg.AllowedTypes, ", "))
+	}
+	switch {
+	case cfg.ConvertWebP != "":
+		fmt.Printf("  WebP:              converted to %s\n", cfg.ConvertWebP)
+	case cfg.AllowWebP:
+		fmt.Println("  WebP:              kept")
+	}
+	if cfg.ConvertHEIF != "" {
+		fmt.Printf("  AVIF/HEIC:         converted to %s\n", cfg.ConvertHEIF)
+	}
 	fmt.Printf("  Skip Thumbnails:   %t\n", cfg.SkipThumbnails)
+	if cfg.VideoPosters {
+		fmt.Printf("  Video Posters:     %t\n", cfg.VideoPosters)
+	}
+	if cfg.PDFImages {
+		fmt.Printf("  PDF Images:        %t\n", cfg.PDFImages)
+	}
+	if len(cfg.JSONPaths) > 0 {
+		fmt.Printf("  JSON Paths:        %s\n", strings.Join(cfg.JSONPaths, ", "))
+	}
+	if style := wantedImageStyle(cfg); style != "" {
+		fmt.Printf("  Image Style:       %s only\n", style)
+	}
+	fmt.Printf("  Skip Watermarked:  %t\n", cfg.SkipWatermarked)
+	if cfg.MinSharpness > 0 {
+		fmt.Printf("  Min Sharpness:     %.1f\n", cfg.MinSharpness)
+	}
+	if cfg.faces != nil {
+		fmt.Printf("  Faces:             %s\n", cfg.Faces)
+	}
+	if cfg.nsfw != nil {
+		fmt.Printf("  NSFW Filter:       %s, %s from %.2f\n", cfg.NSFWModel, cfg.NSFWAction, cfg.NSFWThreshold)
+	}
+	if cfg.SiteConfig != "" {
+		fmt.Printf("  Site Config:       %s\n", cfg.SiteConfig)
+	}
+	if len(cfg.mirrors) > 0 {
+		fmt.Printf("  Mirrors:           %d host(s)\n", len(cfg.mirrors))
+	}
 	fmt.Printf("  Follow Subdomains: %t\n", cfg.FollowSubdomains)
+	if cfg.FirstPartyOnly {
+		fmt.Printf("  First-party Only:  %t\n", cfg.FirstPartyOnly)
+	}
+	if len(cfg.License) > 0 {
+		fmt.Printf("  License:           %s\n", strings.Join(cfg.License, ", "))
+	}
+	if cfg.URLInclude != "" {
+		fmt.Printf("  URL Include:       %s\n", cfg.URLInclude)
+	}
+	if cfg.URLExclude != "" {
+		fmt.Printf("  URL Exclude:       %s\n", cfg.URLExclude)
+	}
+	if cfg.Language != "" {
+		fmt.Printf("  Language:          %s\n", cfg.Language)
+	}
+	if len(cfg.allowDomains) > 0 {
+		fmt.Printf("  Allowed Domains:   %s\n", strings.Join(cfg.allowDomains, ", "))
+	}
+	if len(cfg.blockDomains) > 0 {
+		fmt.Printf("  Blocked Domains:   %d\n", len(cfg.blockDomains))
+	}
 	fmt.Printf("  Ignore Robots:     %t\n", cfg.IgnoreRobots)
+	if cfg.policy.active() {
+		fmt.Printf("  Policy:            %s\n", cfg.policy)
+	}
+	if len(cfg.robotsOverrides) > 0 && !cfg.IgnoreRobots {
+		fmt.Printf("  Robots Overrides:  %d domain(s) from %s\n", len(cfg.robotsOverrides), cfg.RobotsOverrides)
+	}
+	if cfg.SkipProbe {
+		fmt.Printf("  Host Probe:        skipped\n")
+	}
+	if cfg.DryRun {
+		fmt.Printf("  Dry Run:           true (URL list: %s)\n", urlListPath(cfg))
+	}
 	fmt.Printf("  Verbose:           %t\n", cfg.Verbose)
 	fmt.Println()
 }
@@ -413,12 +1608,22 @@ func printVersion() {
 	fmt.Printf("Go version: %s\n", runtime.Version())
 }
 
-func run(cfg *Config) error {
+// prepareOutput creates the output directory and records the run in its
+// marker file.
+func prepareOutput(cfg *Config) error {
 	if err := os.MkdirAll(cfg.OutputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output directory %s: %w", cfg.OutputDir, err)
 	}
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
 	fmt.Printf("✓ Created output directory: %s\n", cfg.OutputDir)
+	return nil
+}
 
+// prepareDownloader resolves the downloader binary and checks the tools the
+// configured filters depend on.
+func prepareDownloader(cfg *Config) error {
 	if cfg.Downloader == "auto" {
 		detected, err := detectDownloader()
 		if err != nil {
@@ -433,30 +1638,121 @@ func run(cfg *Config) error {
 		fmt.Printf("✓ Using downloader: %s\n", cfg.Downloader)
 	}
 
-	if (cfg.MinWidth > 0 || cfg.MinHeight > 0) && !checkCommandExists("identify") {
-		return fmt.Errorf("minimum dimension filters require ImageMagick 'identify' command; please install ImageMagick")
+	return prepareConverter(cfg)
+}
+
+// urlListPath returns where the dry-run URL list is written.
+func urlListPath(cfg *Config) string {
+	if cfg.URLListFile != "" {
+		return cfg.URLListFile
 	}
+	return filepath.Join(cfg.OutputDir, "image_urls.txt")
+}
 
-	SetSkipThumbnails(cfg.SkipThumbnails)
+// writeURLList prints the discovered image URLs and saves them one per line,
+// a format curl, wget -i, and aria2c -i all accept.
+func writeURLList(cfg *Config, state *CrawlState) error {
+	urls := state.imageURLs()
 
 	fmt.Println()
+	for _, imageURL := range urls {
+		fmt.Println(imageURL)
+	}
+
+	content := strings.Join(urls, "\n")
+	if content != "" {
+		content += "\n"
+	}
+
+	target := urlListPath(cfg)
+	if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write URL list %s: %w", target, err)
+	}
 
-	crawler := NewCrawler(cfg)
-	if err := crawler.Start(); err != nil {
-		return fmt.Errorf("crawling failed: %w", err)
+	fmt.Printf("\n✓ Dry run: %d image URL(s) saved to %s (nothing downloaded)\n", len(urls), target)
+	return nil
+}
+
+// crawlAndDownloadPhase crawls and downloads concurrently: images already
+// pending in state and every image the crawler discovers are streamed to the
+// downloader as they are found, instead of waiting for the crawl to finish.
+func crawlAndDownloadPhase(cfg *Config, state *CrawlState) error {
+	downloader := NewDownloader(cfg)
+	downloader.UseVariants(state.variantIndex())
+	stream := make(chan string, cfg.downloadConcurrency()*4)
+
+	downloadDone := make(chan error, 1)
+	go func() {
+		downloadDone <- downloader.DownloadStream(stream)
+	}()
+
+	var feeders sync.WaitGroup
+	if pending := state.pendingURLs(); len(pending) > 0 {
+		feeders.Add(1)
+		go func() {
+			defer feeders.Done()
+			for _, imageURL := range pending {
+				stream <- imageURL
+			}
+		}()
 	}
 
-	imageURLs := crawler.GetImageURLs()
-	if len(imageURLs) == 0 {
+	crawlErr := crawlPhase(cfg, state, stream)
+	feeders.Wait()
+	close(stream)
+
+	if crawlErr == nil && len(state.Images) > 0 {
+		fmt.Println("\nWaiting for remaining downloads to finish...")
+	}
+	downloadErr := <-downloadDone
+
+	if err := saveDownloadResults(cfg, state, downloader.Results()); err != nil {
+		return err
+	}
+
+	if crawlErr != nil {
+		return crawlErr
+	}
+	if downloadErr != nil {
+		return fmt.Errorf("download failed: %w", downloadErr)
+	}
+	if len(state.Images) == 0 {
 		fmt.Println("\nNo images found matching criteria")
-		return nil
+	}
+	return nil
+}
+
+// downloadPhase downloads every pending or previously failed image in state
+// and records the outcomes.
+func downloadPhase(cfg *Config, state *CrawlState) error {
+	pending := state.pendingURLs()
+	if len(pending) == 0 {
+		if len(state.Images) == 0 {
+			fmt.Println("\nNo images found matching criteria")
+		} else {
+			fmt.Println("\nNo pending images to download")
+		}
+		if cfg.splitShares != nil {
+			state.assignSplits(cfg)
+			if err := saveState(cfg.OutputDir, state); err != nil {
+				return err
+			}
+		}
+		return writeManifest(cfg.OutputDir, state, cfg.Manifest)
 	}
 
 	fmt.Println()
 
 	downloader := NewDownloader(cfg)
-	if err := downloader.DownloadImages(imageURLs); err != nil {
-		return fmt.Errorf("download failed: %w", err)
+	downloader.UseVariants(state.variantIndex())
+	downloadErr := downloader.DownloadImages(pending)
+
+	if err := saveDownloadResults(cfg, state, downloader.Results()); err != nil {
+		return err
+	}
+
+	if downloadErr != nil {
+		return fmt.Errorf("download failed: %w", downloadErr)
 	}
 
 	return nil
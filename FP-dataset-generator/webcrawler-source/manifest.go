@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// The manifest lists every image of a run in one file that training
+// pipelines can load directly, one row each: where it is stored, where it
+// came from, what was said about it, its size and hash, and whether it was
+// downloaded. -manifest picks the formats, manifest.jsonl and manifest.csv,
+// which are rewritten after every download phase.
+
+// manifestFormats are the formats -manifest accepts.
+var manifestFormats = []string{"jsonl", "csv"}
+
+// manifestEntry is one image of the manifest.
+type manifestEntry struct {
+	Path       string  `json:"path,omitempty"`
+	URL        string  `json:"url"`
+	Page       string  `json:"page_url,omitempty"`
+	Caption    string  `json:"caption,omitempty"`
+	Alt        string  `json:"alt,omitempty"`
+	Title      string  `json:"title,omitempty"`
+	Figcaption string  `json:"figcaption,omitempty"`
+	License    string  `json:"license,omitempty"`
+	Label      string  `json:"label,omitempty"`
+	Match      string  `json:"match,omitempty"`
+	Score      float64 `json:"score"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Size       int64   `json:"size,omitempty"`
+	SHA256     string  `json:"sha256,omitempty"`
+	Status     string  `json:"status"`
+	Split      string  `json:"split,omitempty"`
+	Error      string  `json:"error,omitempty"`
+}
+
+var manifestColumns = []string{"path", "url", "page_url", "caption", "alt", "title", "figcaption", "license", "label", "match", "score", "width", "height", "size", "sha256", "status", "split", "error"}
+
+func manifestPath(outputDir, format string) string {
+	return filepath.Join(outputDir, "manifest."+format)
+}
+
+// imageOrigin is the first page an image was found on and what that page
+// said about it.
+type imageOrigin struct {
+	page     string
+	caption  string
+	captions imageCaptions
+	license  string
+	match    string
+}
+
+// imageCaptions are the texts that describe an image element separately,
+// for datasets that pair images with captions.
+type imageCaptions struct {
+	alt        string
+	title      string
+	figcaption string
+}
+
+// noteImageOrigin remembers the first page an image was found on, and its
+// alt, title, or caption text there. A later page fills in a caption the
+// first did not give.
+func (c *Crawler) noteImageOrigin(imageURL, pageURL, caption string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	origin := c.imageOrigins[imageURL]
+	if origin.page == "" {
+		origin.page = pageURL
+	}
+	if origin.caption == "" {
+		origin.caption = caption
+	}
+	c.imageOrigins[imageURL] = origin
+}
+
+// noteImageCaptions remembers the alt, title, and figure caption of an
+// image, keeping the first of each that a page gave.
+func (c *Crawler) noteImageCaptions(imageURL string, captions imageCaptions) {
+	if captions == (imageCaptions{}) {
+		return
+	}
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	origin := c.imageOrigins[imageURL]
+	origin.captions.alt = cmp.Or(origin.captions.alt, captions.alt)
+	origin.captions.title = cmp.Or(origin.captions.title, captions.title)
+	origin.captions.figcaption = cmp.Or(origin.captions.figcaption, captions.figcaption)
+	c.imageOrigins[imageURL] = origin
+}
+
+// noteImageMatch remembers where the keyword matched an image, keeping the
+// strongest match of the pages it was found on.
+func (c *Crawler) noteImageMatch(imageURL, match string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	origin := c.imageOrigins[imageURL]
+	if strongerMatch(match, origin.match) {
+		origin.match = match
+		c.imageOrigins[imageURL] = origin
+	}
+}
+
+// setOrigins records on each image that has none yet the page it was found
+// on, its captions and license, and the strongest keyword match yet.
+func (s *CrawlState) setOrigins(origins map[string]imageOrigin) {
+	for i := range s.Images {
+		origin := origins[s.Images[i].URL]
+		if s.Images[i].Page == "" {
+			s.Images[i].Page = origin.page
+		}
+		if s.Images[i].Caption == "" {
+			s.Images[i].Caption = origin.caption
+		}
+		s.Images[i].Alt = cmp.Or(s.Images[i].Alt, origin.captions.alt)
+		s.Images[i].Title = cmp.Or(s.Images[i].Title, origin.captions.title)
+		s.Images[i].Figcaption = cmp.Or(s.Images[i].Figcaption, origin.captions.figcaption)
+		s.Images[i].License = cmp.Or(s.Images[i].License, origin.license)
+		if strongerMatch(origin.match, s.Images[i].Match) {
+			s.Images[i].Match = origin.match
+		}
+	}
+}
+
+// manifestEntries returns the manifest rows of the images in state. The
+// dimensions and size of downloaded images are read from their files.
+func manifestEntries(outputDir string, state *CrawlState) []manifestEntry {
+	entries := make([]manifestEntry, len(state.Images))
+	for i, record := range state.Images {
+		entry := manifestEntry{
+			URL:        record.URL,
+			Page:       record.Page,
+			Caption:    record.Caption,
+			Alt:        record.Alt,
+			Title:      record.Title,
+			Figcaption: record.Figcaption,
+			License:    record.License,
+			Label:      state.Keyword,
+			Match:      record.Match,
+			Score:      relevanceScore(record),
+			Width:      record.Width,
+			Height:     record.Height,
+			Size:       record.Size,
+			SHA256:     record.SHA256,
+			Status:     record.Status,
+			Split:      record.Split,
+			Error:      record.Error,
+		}
+		if record.Attribution != nil {
+			// Provider licenses that are not Creative Commons ones, such
+			// as the Unsplash License, are listed by name.
+			entry.Page = cmp.Or(entry.Page, record.Attribution.Page)
+			entry.License = cmp.Or(entry.License, record.Attribution.License)
+		}
+		if record.Status == imageStatusDownloaded && record.File != "" {
+			entry.Path = filepath.ToSlash(record.File)
+			path := filepath.Join(outputDir, record.File)
+			if info, err := os.Stat(path); err == nil {
+				entry.Size = info.Size()
+			}
+			if mimeType, err := sniffFileType(path); err == nil {
+				entry.Width, entry.Height, _ = getImageDimensions(path, mimeType)
+			}
+		}
+		entries[i] = entry
+	}
+	return entries
+}
+
+// storedEntries returns the manifest rows of the images in state stored
+// in the output directory, each file once though several URLs served it,
+// with the index of its record in state.
+func storedEntries(outputDir string, state *CrawlState) ([]manifestEntry, []int) {
+	var (
+		entries []manifestEntry
+		indexes []int
+	)
+	seen := make(map[string]struct{})
+	for i, entry := range manifestEntries(outputDir, state) {
+		if entry.Status != imageStatusDownloaded || entry.Path == "" {
+			continue
+		}
+		if _, dup := seen[entry.Path]; dup {
+			continue
+		}
+		seen[entry.Path] = struct{}{}
+		entries = append(entries, entry)
+		indexes = append(indexes, i)
+	}
+	return entries, indexes
+}
+
+// writeManifest rewrites the manifest of state in each of the formats.
+func writeManifest(outputDir string, state *CrawlState, formats []string) error {
+	if len(formats) == 0 {
+		return nil
+	}
+	entries := manifestEntries(outputDir, state)
+
+	for _, format := range formats {
+		var buf bytes.Buffer
+		if err := encodeManifest(&buf, format, entries); err != nil {
+			return err
+		}
+		if err := os.WriteFile(manifestPath(outputDir, format), buf.Bytes(), 0644); err != nil {
+			return fmt.Errorf("failed to write manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// encodeManifest writes entries to w as jsonl or csv.
+func encodeManifest(w io.Writer, format string, entries []manifestEntry) error {
+	switch format {
+	case "jsonl":
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return fmt.Errorf("failed to encode manifest: %w", err)
+			}
+		}
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write(manifestColumns)
+		for _, entry := range entries {
+			writer.Write([]string{
+				entry.Path, entry.URL, entry.Page, entry.Caption, entry.Alt, entry.Title, entry.Figcaption, entry.License, entry.Label,
+				entry.Match, strconv.FormatFloat(entry.Score, 'f', 2, 64),
+				manifestNumber(int64(entry.Width)), manifestNumber(int64(entry.Height)), manifestNumber(entry.Size),
+				entry.SHA256, entry.Status, entry.Split, entry.Error,
+			})
+		}
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("failed to encode manifest: %w", err)
+		}
+	}
+	return nil
+}
+
+// manifestNumber formats a CSV number, leaving unknown ones empty.
+func manifestNumber(n int64) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+// validateManifestFormats checks each -manifest format is one of
+// manifestFormats.
+func validateManifestFormats(formats []string) error {
+	for _, format := range formats {
+		if !slices.Contains(manifestFormats, format) {
+			return fmt.Errorf("manifest format must be %s, got %q", strings.Join(manifestFormats, " or "), format)
+		}
+	}
+	return nil
+}
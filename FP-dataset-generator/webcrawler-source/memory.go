@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// spillFileName holds frontier tasks moved out of memory under pressure.
+	spillFileName = ".frontier-spill.jsonl"
+
+	memoryCheckInterval = 500 * time.Millisecond
+
+	// Pressure starts at memoryHighWater of the limit and only clears again
+	// below memoryLowWater, so the crawler does not flap around the limit.
+	memoryHighWater = 0.85
+	memoryLowWater  = 0.70
+
+	// memoryWaitAttempts bounds how long a worker holds off fetching while
+	// memory is tight, so memory that cannot be reclaimed (the seen set
+	// itself) slows the crawl down without stalling it.
+	memoryWaitAttempts = 20
+	memoryWaitStep     = 250 * time.Millisecond
+)
+
+// memoryGuard samples heap usage against a soft limit and reports when the
+// crawler should apply backpressure.
+type memoryGuard struct {
+	limit    uint64
+	pressure atomic.Bool
+	heap     atomic.Uint64
+}
+
+// newMemoryGuard also hands the limit to the Go runtime, which makes the
+// garbage collector work harder as the heap approaches it.
+func newMemoryGuard(limit uint64) *memoryGuard {
+	debug.SetMemoryLimit(int64(limit))
+	return &memoryGuard{limit: limit}
+}
+
+// sample reads the current heap size and updates the pressure flag. It
+// reports whether pressure was relieved by this sample.
+func (g *memoryGuard) sample() (relieved bool) {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	g.heap.Store(stats.HeapAlloc)
+
+	usage := float64(stats.HeapAlloc) / float64(g.limit)
+	switch {
+	case usage >= memoryHighWater:
+		if !g.pressure.Swap(true) {
+			logWarning("Memory usage %s of %s limit, spilling new pages to disk", formatBytes(stats.HeapAlloc), formatBytes(g.limit))
+		}
+		runtime.GC()
+	case usage < memoryLowWater:
+		return g.pressure.Swap(false)
+	}
+	return false
+}
+
+func (g *memoryGuard) underPressure() bool {
+	return g != nil && g.pressure.Load()
+}
+
+// taskSpill is an append-only file of frontier tasks with a read cursor.
+// Tasks are pushed while memory is tight and popped back in batches once
+// there is room again.
+type taskSpill struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	readOffset int64
+	pending    int
+}
+
+func newTaskSpill(outputDir string) *taskSpill {
+	return &taskSpill{path: filepath.Join(outputDir, spillFileName)}
+}
+
+func (s *taskSpill) push(task CrawlTask) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		file, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open frontier spill file: %w", err)
+		}
+		s.file = file
+		s.readOffset = 0
+	}
+
+	line, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+	if _, err := s.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write frontier spill file: %w", err)
+	}
+	s.pending++
+	return nil
+}
+
+// pop returns up to n spilled tasks in the order they were pushed.
+func (s *taskSpill) pop(n int) []CrawlTask {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending == 0 || s.file == nil {
+		return nil
+	}
+
+	if _, err := s.file.Seek(s.readOffset, io.SeekStart); err != nil {
+		return nil
+	}
+
+	reader := bufio.NewReader(s.file)
+	tasks := make([]CrawlTask, 0, n)
+	for len(tasks) < n {
+		line, err := reader.ReadBytes('\n')
+		if len(line) == 0 || err != nil && err != io.EOF {
+			break
+		}
+		s.readOffset += int64(len(line))
+		s.pending--
+
+		var task CrawlTask
+		if json.Unmarshal(line, &task) == nil {
+			tasks = append(tasks, task)
+		}
+	}
+
+	if s.pending <= 0 {
+		s.pending = 0
+		s.file.Truncate(0)
+		s.readOffset = 0
+	}
+
+	return tasks
+}
+
+func (s *taskSpill) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending
+}
+
+// close removes the spill file; anything left in it has already been moved
+// to the frontier.
+func (s *taskSpill) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+		os.Remove(s.path)
+	}
+}
+
+// superviseMemory samples memory usage until the crawl ends, moving spilled
+// tasks back into the queue whenever pressure clears or the workers run out
+// of queued work. Spilled tasks keep their taskWG slot, so when the crawl
+// stops they are released here and kept in the frontier.
+func (c *Crawler) superviseMemory(done <-chan struct{}) {
+	ticker := time.NewTicker(memoryCheckInterval)
+	defer ticker.Stop()
+	defer c.spill.close()
+
+	for {
+		select {
+		case <-c.stopCh:
+			c.releaseSpill()
+			return
+		case <-done:
+			c.releaseSpill()
+			return
+		case <-ticker.C:
+		}
+
+		relieved := c.memory.sample()
+		if c.spill.len() == 0 {
+			continue
+		}
+		if relieved || !c.memory.underPressure() || len(c.taskCh) == 0 {
+			for _, task := range c.spill.pop(cap(c.taskCh)) {
+				c.sendTask(task)
+			}
+		}
+	}
+}
+
+// releaseSpill moves every spilled task to the frontier.
+func (c *Crawler) releaseSpill() {
+	for {
+		tasks := c.spill.pop(1024)
+		if len(tasks) == 0 {
+			return
+		}
+		for _, task := range tasks {
+			c.deferTask(task)
+			c.taskWG.Done()
+		}
+	}
+}
+
+// waitForMemory holds a worker back briefly while memory is tight, giving
+// the garbage collector a chance before another page is parsed.
+func (c *Crawler) waitForMemory() {
+	for i := 0; i < memoryWaitAttempts && c.memory.underPressure(); i++ {
+		select {
+		case <-c.stopCh:
+			return
+		case <-time.After(memoryWaitStep):
+		}
+	}
+}
+
+// formatBytes renders a byte count with a binary unit suffix.
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for value := n / unit; value >= unit; value /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
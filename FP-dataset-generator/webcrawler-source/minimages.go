@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// A crawl with -min-images that ends short of its target is continued with
+// a larger budget: each round doubles -max-pages and crawls one level
+// deeper, starting from the pages left in the frontier and the links the
+// last round passed over for being too deep. minImagesMaxRounds and
+// minImagesMaxPages cap how far a crawl grows.
+const (
+	minImagesMaxRounds = 4
+	minImagesMaxPages  = 2000
+)
+
+// recordDeepLink remembers a link left out for its depth, which a later
+// round of a -min-images crawl may follow.
+func (c *Crawler) recordDeepLink(task CrawlTask) {
+	if c.config.MinImages == 0 {
+		return
+	}
+	c.frontierMutex.Lock()
+	c.deepLinks = append(c.deepLinks, task)
+	c.frontierMutex.Unlock()
+}
+
+// stoppedByUser reports whether Stop was called, by Ctrl+C or the control
+// socket, rather than the crawl running out of budget.
+func (c *Crawler) stoppedByUser() bool {
+	return c.userStopped.Load()
+}
+
+// expandCrawl raises the budget of cfg for another round of a -min-images
+// crawl and adds the links the last round left out for their depth to the
+// frontier. It reports false when the caps are reached or nothing is left to
+// crawl.
+func expandCrawl(cfg *Config, state *CrawlState, crawler *Crawler, round int) bool {
+	if round >= minImagesMaxRounds || cfg.MaxPages >= minImagesMaxPages {
+		logInfo("Found %d of %d image(s); the -min-images budget cap is reached", len(state.Images), cfg.MinImages)
+		return false
+	}
+
+	seen := make(map[string]struct{}, len(state.SeenPages))
+	for _, page := range state.SeenPages {
+		seen[page] = struct{}{}
+	}
+	for _, task := range crawler.deepLinks {
+		if _, exists := seen[task.URL]; exists {
+			continue
+		}
+		seen[task.URL] = struct{}{}
+		state.SeenPages = append(state.SeenPages, task.URL)
+		state.Frontier = append(state.Frontier, task)
+	}
+	if len(state.Frontier) == 0 {
+		logInfo("Found %d of %d image(s); no pages are left to crawl", len(state.Images), cfg.MinImages)
+		return false
+	}
+
+	cfg.MaxPages = min(cfg.MaxPages*2, minImagesMaxPages)
+	cfg.MaxDepth++
+	state.CrawlDone = false
+	logInfo("Found %d of %d image(s); crawling on with -max-pages %d and -max-depth %d", len(state.Images), cfg.MinImages, cfg.MaxPages, cfg.MaxDepth)
+	return true
+}
+
+// printImageSources lists how many of the images were found on each site:
+// the builtin or custom site an image's host belongs to, or else the host.
+func printImageSources(cfg *Config, imageURLs []string) {
+	sites := crawlSites(cfg)
+	counts := make(map[string]int)
+	for _, imageURL := range imageURLs {
+		imageURL = documentURL(imageURL)
+		source := ""
+		for _, site := range sites {
+			if site.Matches(imageURL) {
+				source = site.Name()
+				break
+			}
+		}
+		if source == "" {
+			if u, err := url.Parse(imageURL); err == nil && u.Hostname() != "" {
+				source = strings.ToLower(u.Hostname())
+			} else {
+				source = "other"
+			}
+		}
+		counts[source]++
+	}
+
+	sources := make([]string, 0, len(counts))
+	for source := range counts {
+		sources = append(sources, source)
+	}
+	sort.Slice(sources, func(i, j int) bool {
+		if counts[sources[i]] != counts[sources[j]] {
+			return counts[sources[i]] > counts[sources[j]]
+		}
+		return sources[i] < sources[j]
+	})
+
+	fmt.Println("\nImages by site:")
+	for _, source := range sources {
+		fmt.Printf("  %-24s %d\n", source, counts[source])
+	}
+}
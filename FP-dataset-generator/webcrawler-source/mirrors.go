@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Long crawls of a source outlive the patience of its host: it starts
+// answering 429 or 5xx, or stops answering. A host can be given mirrors,
+// hosts serving the same paths, which are tried in order when it does. They
+// are set per builtin site in the site presets, per custom site, or for any
+// host with -mirrors.
+
+// hostMirrors lists the mirrors of hosts, by host.
+type hostMirrors map[string][]string
+
+// parseMirrors reads -mirrors entries such as
+// upload.example.org=mirror1.example.net|mirror2.example.net.
+func parseMirrors(entries []string) (hostMirrors, []string) {
+	mirrors := make(hostMirrors)
+	var problems []string
+	for _, entry := range entries {
+		host, list, ok := strings.Cut(entry, "=")
+		if !ok {
+			problems = append(problems, fmt.Sprintf("mirrors entry %q must be host=mirror|mirror", entry))
+			continue
+		}
+		problems = append(problems, mirrors.add("mirrors", host, strings.Split(list, "|"))...)
+	}
+	return mirrors, problems
+}
+
+// add gives host the mirrors, after those it has, returning the problems
+// with them. source names where they were given in the problems.
+func (m hostMirrors) add(source, host string, mirrors []string) []string {
+	var problems []string
+	host = strings.ToLower(strings.TrimSpace(host))
+	if !validHost(host) {
+		problems = append(problems, fmt.Sprintf("%s: invalid host %q", source, host))
+	}
+	for _, mirror := range mirrors {
+		mirror = strings.ToLower(strings.TrimSpace(mirror))
+		switch {
+		case !validHost(mirror):
+			problems = append(problems, fmt.Sprintf("%s: invalid mirror %q of %s", source, mirror, host))
+		case mirror == host:
+			problems = append(problems, fmt.Sprintf("%s: %s cannot mirror itself", source, host))
+		default:
+			m[host] = append(m[host], mirror)
+		}
+	}
+	return problems
+}
+
+// validHost reports whether host is a host name or address, with an
+// optional port, and nothing else.
+func validHost(host string) bool {
+	u, err := url.Parse("//" + host)
+	return err == nil && host != "" && u.Host == host && u.Path == "" && u.User == nil
+}
+
+// collectMirrors gathers the mirrors of the site presets, the custom
+// sites, and -mirrors into cfg.mirrors.
+func collectMirrors(cfg *Config) []string {
+	mirrors, problems := parseMirrors(cfg.Mirrors)
+	for name, preset := range cfg.sitePresets {
+		for host, list := range preset.Mirrors {
+			problems = append(problems, mirrors.add(fmt.Sprintf("site config for %q", name), host, list)...)
+		}
+	}
+	for _, site := range cfg.CustomSites {
+		for host, list := range site.Mirrors {
+			problems = append(problems, mirrors.add(fmt.Sprintf("custom site %q", site.Name), host, list)...)
+		}
+	}
+	cfg.mirrors = nil
+	if len(mirrors) > 0 {
+		cfg.mirrors = mirrors
+	}
+	return problems
+}
+
+// mirrorURLs returns rawURL on each mirror of its host, in order.
+func (cfg *Config) mirrorURLs(rawURL string) []string {
+	if cfg.mirrors == nil {
+		return nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return nil
+	}
+	hosts := cfg.mirrors[strings.ToLower(u.Host)]
+	if hosts == nil {
+		hosts = cfg.mirrors[strings.ToLower(u.Hostname())]
+	}
+
+	urls := make([]string, len(hosts))
+	for i, host := range hosts {
+		mirrored := *u
+		mirrored.Host = host
+		urls[i] = mirrored.String()
+	}
+	return urls
+}
+
+// hostFailing reports whether a response, or the error in its place, shows
+// the host rate-limiting or failing, so a mirror is worth trying.
+func hostFailing(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, errRedirectSeen)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// fetchFromMirrors retries a page request whose host is failing on each of
+// its mirrors robots.txt allows, returning the first response that does
+// not fail, or nil when none does.
+func (c *Crawler) fetchFromMirrors(req *http.Request) *http.Response {
+	for _, mirror := range c.config.mirrorURLs(req.URL.String()) {
+		if !c.config.IgnoreRobots && !c.canCrawl(mirror) {
+			continue
+		}
+		mirrorURL, err := url.Parse(mirror)
+		if err != nil {
+			continue
+		}
+		mirrorReq := req.Clone(req.Context())
+		mirrorReq.URL, mirrorReq.Host = mirrorURL, ""
+
+		logVerbose(c.config, "Trying mirror %s for %s", mirror, req.URL)
+		resp, err := c.client.Do(mirrorReq)
+		if !hostFailing(resp, err) {
+			return resp
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+	}
+	return nil
+}
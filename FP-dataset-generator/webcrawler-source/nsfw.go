@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"golang.org/x/image/draw"
+)
+
+// -nsfw-model runs a local NSFW classifier, an ONNX model, on each
+// downloaded image, and moves the images it flags to <output>/nsfw, or
+// deletes them with -nsfw-action delete, so datasets for classrooms and
+// research stay clean. Running ONNX models takes the onnxruntime library,
+// so the classifier is only built with the onnx tag:
+//
+//	go build -tags onnx
+//
+// The model takes one RGB image at its input size, with values from 0 to 1,
+// shaped 1x3xHxW or 1xHxWx3. It outputs either one NSFW score, two scores,
+// safe and NSFW, or the five classes of the widely used GantMan model:
+// drawings, hentai, neutral, porn, and sexy.
+
+const (
+	defaultNSFWThreshold = 0.8
+	nsfwQuarantine       = "quarantine"
+	nsfwDelete           = "delete"
+
+	// nsfwDirName is the directory of the output directory flagged images
+	// are moved to.
+	nsfwDirName = "nsfw"
+
+	// nsfwDefaultSize is the input size of models that leave it open.
+	nsfwDefaultSize = 224
+)
+
+// nsfwActions are the values -nsfw-action accepts.
+var nsfwActions = []string{nsfwQuarantine, nsfwDelete}
+
+// nsfwClassifier scores how likely an image is to be NSFW, from 0 to 1.
+type nsfwClassifier interface {
+	score(img image.Image) (float64, error)
+}
+
+// nsfwTensor scales img to width x height and lays its RGB values out from
+// 0 to 1, by channel first or by pixel.
+func nsfwTensor(img image.Image, width, height int, channelsFirst bool) []float32 {
+	scaled := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	plane := width * height
+	data := make([]float32, 3*plane)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			offset := scaled.PixOffset(x, y)
+			pixel := y*width + x
+			for c := 0; c < 3; c++ {
+				value := float32(scaled.Pix[offset+c]) / 255
+				if channelsFirst {
+					data[c*plane+pixel] = value
+				} else {
+					data[pixel*3+c] = value
+				}
+			}
+		}
+	}
+	return data
+}
+
+// nsfwProbability turns the outputs of a model into the probability that its
+// image is NSFW. Outputs that are not probabilities are taken as logits.
+func nsfwProbability(outputs []float32) (float64, error) {
+	scores := make([]float64, len(outputs))
+	sum := 0.0
+	probabilities := true
+	for i, output := range outputs {
+		scores[i] = float64(output)
+		sum += scores[i]
+		probabilities = probabilities && scores[i] >= 0 && scores[i] <= 1
+	}
+
+	switch len(scores) {
+	case 1:
+		if !probabilities {
+			return 1 / (1 + math.Exp(-scores[0])), nil
+		}
+		return scores[0], nil
+	case 2, 5:
+		if !probabilities || math.Abs(sum-1) > 0.01 {
+			scores = softmax(scores)
+		}
+		if len(scores) == 2 {
+			return scores[1], nil
+		}
+		// Of drawings, hentai, neutral, porn, and sexy.
+		return scores[1] + scores[3] + scores[4], nil
+	}
+	return 0, fmt.Errorf("model gives %d outputs, want 1, 2, or 5", len(scores))
+}
+
+func softmax(logits []float64) []float64 {
+	highest := slices.Max(logits)
+	probabilities := make([]float64, len(logits))
+	sum := 0.0
+	for i, logit := range logits {
+		probabilities[i] = math.Exp(logit - highest)
+		sum += probabilities[i]
+	}
+	for i := range probabilities {
+		probabilities[i] /= sum
+	}
+	return probabilities
+}
+
+// nsfwFilter rejects the images the -nsfw-model classifier flags, moving
+// them to the nsfw directory first unless -nsfw-action is delete. Images
+// that cannot be classified are kept.
+type nsfwFilter struct {
+	cfg *Config
+}
+
+func (nsfwFilter) name() string { return filterNSFW }
+
+func (f nsfwFilter) check(img *fetchedImage, _ *downloadOutcome) (downloadResult, string) {
+	if img.mime == "image/svg+xml" {
+		return downloadSuccess, ""
+	}
+	decoded, err := decodeImageFile(img.path)
+	if err != nil {
+		logVerbose(f.cfg, "Could not check %s for NSFW content, keeping it: %v", img.file, err)
+		return downloadSuccess, ""
+	}
+	score, err := f.cfg.nsfw.score(decoded)
+	if err != nil {
+		logVerbose(f.cfg, "Could not check %s for NSFW content, keeping it: %v", img.file, err)
+		return downloadSuccess, ""
+	}
+	if score < f.cfg.NSFWThreshold {
+		return downloadSuccess, ""
+	}
+
+	reason := fmt.Sprintf("NSFW score %.2f", score)
+	if f.cfg.NSFWAction == nsfwQuarantine {
+		target := filepath.Join(f.cfg.OutputDir, nsfwDirName, img.file)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			logWarning("Failed to create %s: %v", filepath.Dir(target), err)
+		} else if err := os.Rename(img.path, target); err != nil {
+			logWarning("Failed to move %s to %s: %v", img.file, target, err)
+		} else {
+			reason += ", moved to " + filepath.Join(nsfwDirName, img.file)
+		}
+	}
+	return downloadFiltered, reason
+}
+
+// validateNSFW checks the -nsfw-* settings and loads the model.
+func validateNSFW(cfg *Config) []string {
+	cfg.nsfw = nil
+	if cfg.NSFWModel == "" {
+		return nil
+	}
+
+	var problems []string
+	if cfg.NSFWThreshold <= 0 || cfg.NSFWThreshold > 1 {
+		problems = append(problems, "nsfw-threshold must be above 0 and at most 1")
+	}
+	if !slices.Contains(nsfwActions, cfg.NSFWAction) {
+		problems = append(problems, fmt.Sprintf("nsfw-action must be %s or %s", nsfwQuarantine, nsfwDelete))
+	}
+	classifier, err := loadNSFWModel(cfg.NSFWModel, cfg.ONNXRuntime)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	cfg.nsfw = classifier
+	return problems
+}
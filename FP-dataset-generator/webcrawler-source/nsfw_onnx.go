@@ -0,0 +1,109 @@
+//go:build onnx
+
+package main
+
+import (
+	"fmt"
+	"image"
+	"runtime"
+
+	ort "github.com/yalue/onnxruntime_go"
+)
+
+// onnxNSFWClassifier runs an NSFW model with onnxruntime. Sessions may run
+// on several images at once.
+type onnxNSFWClassifier struct {
+	session       *ort.DynamicAdvancedSession
+	width, height int
+	channelsFirst bool
+}
+
+// onnxRuntimeLibrary is the usual name of the onnxruntime library, found on
+// the library path when -onnx-runtime is not given.
+func onnxRuntimeLibrary() string {
+	switch runtime.GOOS {
+	case "windows":
+		return "onnxruntime.dll"
+	case "darwin":
+		return "libonnxruntime.dylib"
+	default:
+		return "libonnxruntime.so"
+	}
+}
+
+// loadNSFWModel loads the ONNX model at modelPath with the onnxruntime
+// library at library, or under its usual name when library is "".
+func loadNSFWModel(modelPath, library string) (nsfwClassifier, error) {
+	if !ort.IsInitialized() {
+		if library == "" {
+			library = onnxRuntimeLibrary()
+		}
+		ort.SetSharedLibraryPath(library)
+		if err := ort.InitializeEnvironment(); err != nil {
+			return nil, fmt.Errorf("failed to load onnxruntime from %s (set -onnx-runtime): %w", library, err)
+		}
+	}
+
+	inputs, outputs, err := ort.GetInputOutputInfo(modelPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read NSFW model %s: %w", modelPath, err)
+	}
+	if len(inputs) != 1 || len(outputs) == 0 {
+		return nil, fmt.Errorf("NSFW model %s must take one image input", modelPath)
+	}
+	input := inputs[0]
+	dims := input.Dimensions
+	if input.DataType != ort.TensorElementDataTypeFloat || len(dims) != 4 {
+		return nil, fmt.Errorf("NSFW model %s must take a 4-dimensional float image, got %v", modelPath, dims)
+	}
+
+	classifier := &onnxNSFWClassifier{}
+	switch {
+	case dims[1] == 3:
+		classifier.channelsFirst = true
+		classifier.height, classifier.width = modelSize(dims[2]), modelSize(dims[3])
+	case dims[3] == 3:
+		classifier.height, classifier.width = modelSize(dims[1]), modelSize(dims[2])
+	default:
+		return nil, fmt.Errorf("NSFW model %s must take 3 color channels, got %v", modelPath, dims)
+	}
+
+	classifier.session, err = ort.NewDynamicAdvancedSession(modelPath, []string{input.Name}, []string{outputs[0].Name}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load NSFW model %s: %w", modelPath, err)
+	}
+	return classifier, nil
+}
+
+// modelSize returns a dimension of a model's input, or the default size
+// where the model leaves it open.
+func modelSize(dim int64) int {
+	if dim <= 0 {
+		return nsfwDefaultSize
+	}
+	return int(dim)
+}
+
+func (c *onnxNSFWClassifier) score(img image.Image) (float64, error) {
+	shape := ort.NewShape(1, int64(c.height), int64(c.width), 3)
+	if c.channelsFirst {
+		shape = ort.NewShape(1, 3, int64(c.height), int64(c.width))
+	}
+	input, err := ort.NewTensor(shape, nsfwTensor(img, c.width, c.height, c.channelsFirst))
+	if err != nil {
+		return 0, err
+	}
+	defer input.Destroy()
+
+	outputs := []ort.Value{nil}
+	if err := c.session.Run([]ort.Value{input}, outputs); err != nil {
+		return 0, err
+	}
+	defer outputs[0].Destroy()
+
+	tensor, ok := outputs[0].(*ort.Tensor[float32])
+	if !ok {
+		return 0, fmt.Errorf("model output is not float scores")
+	}
+	return nsfwProbability(tensor.GetData())
+}
@@ -0,0 +1,11 @@
+//go:build !onnx
+
+package main
+
+import "errors"
+
+// loadNSFWModel fails in builds without the onnx tag, which cannot run ONNX
+// models.
+func loadNSFWModel(_, _ string) (nsfwClassifier, error) {
+	return nil, errors.New("nsfw-model needs a build with ONNX support (go build -tags onnx)")
+}
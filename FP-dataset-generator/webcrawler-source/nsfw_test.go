@@ -0,0 +1,60 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSoftmax(t *testing.T) {
+	tests := []struct {
+		logits []float64
+		want   []float64
+	}{
+		{logits: []float64{0, 0}, want: []float64{0.5, 0.5}},
+		{logits: []float64{0, math.Log(3)}, want: []float64{0.25, 0.75}},
+		{logits: []float64{1000, 1000 + math.Log(3)}, want: []float64{0.25, 0.75}},
+	}
+
+	for _, tt := range tests {
+		got := softmax(tt.logits)
+		for i := range tt.want {
+			if math.Abs(got[i]-tt.want[i]) > 1e-9 {
+				t.Errorf("softmax(%v) = %v, want %v", tt.logits, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestNSFWProbability(t *testing.T) {
+	tests := []struct {
+		name    string
+		outputs []float32
+		want    float64
+		wantErr bool
+	}{
+		{name: "single probability", outputs: []float32{0.8}, want: 0.8},
+		{name: "single zero probability", outputs: []float32{0}, want: 0},
+		{name: "single negative logit", outputs: []float32{-2}, want: 1 / (1 + math.Exp(2))},
+		{name: "single large logit", outputs: []float32{2}, want: 1 / (1 + math.Exp(-2))},
+		{name: "two probabilities", outputs: []float32{0.3, 0.7}, want: 0.7},
+		{name: "two logits", outputs: []float32{0, float32(math.Log(3))}, want: 0.75},
+		{name: "two scores not summing to one", outputs: []float32{0.6, 0.6}, want: 0.5},
+		{name: "five probabilities", outputs: []float32{0.1, 0.2, 0.3, 0.25, 0.15}, want: 0.6},
+		{name: "five equal logits", outputs: []float32{4, 4, 4, 4, 4}, want: 0.6},
+		{name: "unsupported output count", outputs: []float32{0.2, 0.3, 0.5}, wantErr: true},
+		{name: "no outputs", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nsfwProbability(tt.outputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("nsfwProbability(%v) error = %v, want error: %v", tt.outputs, err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-6 {
+				t.Errorf("nsfwProbability(%v) = %v, want %v", tt.outputs, got, tt.want)
+			}
+		})
+	}
+}
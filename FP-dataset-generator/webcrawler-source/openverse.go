@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	openverseSearchURL = "https://api.openverse.org/v1/images/"
+	// Anonymous requests may ask for at most 20 results per page.
+	openversePerPage = 20
+)
+
+// openverseProvider searches openly licensed images through the Openverse
+// API. It works without credentials; a token raises the rate limits.
+type openverseProvider struct {
+	client    *http.Client
+	token     string
+	userAgent string
+}
+
+type openverseSearchResponse struct {
+	PageCount int `json:"page_count"`
+	Results   []struct {
+		URL               string `json:"url"`
+		ForeignLandingURL string `json:"foreign_landing_url"`
+		Creator           string `json:"creator"`
+		CreatorURL        string `json:"creator_url"`
+		License           string `json:"license"`
+		LicenseVersion    string `json:"license_version"`
+		LicenseURL        string `json:"license_url"`
+		Tags              []struct {
+			Name string `json:"name"`
+		} `json:"tags"`
+	} `json:"results"`
+}
+
+func (p *openverseProvider) searchPage(keyword string, page int) ([]providerImage, bool, error) {
+	query := url.Values{}
+	query.Set("q", keyword)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("page_size", strconv.Itoa(openversePerPage))
+
+	req, err := http.NewRequest(http.MethodGet, openverseSearchURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	if p.token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.token)
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	var response openverseSearchResponse
+	if err := getProviderJSON(p.client, req, &response, openverseError); err != nil {
+		return nil, false, err
+	}
+
+	images := make([]providerImage, 0, len(response.Results))
+	for _, result := range response.Results {
+		if result.URL == "" {
+			continue
+		}
+		var tags []string
+		for _, tag := range result.Tags {
+			if name := strings.TrimSpace(tag.Name); name != "" {
+				tags = mergeTags(tags, []string{name})
+			}
+		}
+		images = append(images, providerImage{
+			URL: result.URL,
+			Attribution: Attribution{
+				Author:     result.Creator,
+				AuthorURL:  result.CreatorURL,
+				Page:       result.ForeignLandingURL,
+				License:    openverseLicenseName(result.License, result.LicenseVersion),
+				LicenseURL: result.LicenseURL,
+			},
+			Tags: tags,
+		})
+	}
+	return images, page < response.PageCount, nil
+}
+
+// openverseLicenseName turns an Openverse license code and version, such as
+// "by-sa" and "4.0", into its common name, "CC BY-SA 4.0".
+func openverseLicenseName(code, licenseVersion string) string {
+	var name string
+	switch code {
+	case "":
+		return ""
+	case "cc0":
+		name = "CC0"
+	case "pdm":
+		name = "Public Domain Mark"
+	case "sampling+", "nc-sampling+":
+		name = "CC " + strings.ToUpper(strings.TrimSuffix(code, "+")) + "+"
+	default:
+		name = "CC " + strings.ToUpper(code)
+	}
+	if licenseVersion != "" {
+		name += " " + licenseVersion
+	}
+	return name
+}
+
+// openverseError extracts the message from an Openverse error response,
+// which looks like {"detail": "..."}.
+func openverseError(body []byte) string {
+	var response struct {
+		Detail string `json:"detail"`
+	}
+	if json.Unmarshal(body, &response) == nil && response.Detail != "" {
+		return response.Detail
+	}
+	return string(body)
+}
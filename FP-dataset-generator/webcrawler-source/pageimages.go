@@ -0,0 +1,137 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// junkImagePattern matches the URLs of page furniture that aggregator pages
+// repeat by the hundred: icons, logos, avatars, ads, and tracking pixels.
+var junkImagePattern = regexp.MustCompile(`(?i)(^|[/_.-])(icons?|logos?|sprites?|avatars?|badges?|emoji|banners?|ads?|spacer|pixel|blank|placeholder)([/_.-]|\d|$)`)
+
+// pageImages gathers the images an extraction finds on one page. Without
+// -max-images-per-page each is passed on as it is found; with it they are
+// held until flush, which passes on the best scoring ones.
+type pageImages struct {
+	c       *Crawler
+	baseURL string
+	found   []pageImage
+	byURL   map[string]int // index in found
+}
+
+type pageImage struct {
+	candidate string
+	metadata  string
+	score     int
+}
+
+func (c *Crawler) newPageImages(baseURL string) *pageImages {
+	return &pageImages{c: c, baseURL: baseURL, byURL: make(map[string]int)}
+}
+
+// add offers an image candidate found in or for sel, which may be nil.
+func (p *pageImages) add(candidate, metadata string, sel *goquery.Selection) {
+	p.noteElement(candidate, sel)
+	limit := p.c.config.MaxImagesPerPage
+	if limit == 0 {
+		p.c.tryAddImageURL(p.baseURL, candidate, metadata)
+		return
+	}
+
+	candidate = strings.TrimSpace(candidate)
+	key := candidate
+	if !strings.HasPrefix(strings.ToLower(candidate), "data:") {
+		key = p.c.resolveURL(p.baseURL, candidate)
+		if key == "" || !isImageURL(key) {
+			return
+		}
+		// Candidates the keyword rules out would only take a place a
+		// matching image could have.
+		if _, _, ok := keywordMatch(p.c.config.KeywordScope, key, metadata, p.c.config.Keyword); !ok {
+			p.c.tryAddImageURL(p.baseURL, candidate, metadata)
+			return
+		}
+	}
+
+	score := scorePageImage(key, metadata, sel)
+	if i, exists := p.byURL[key]; exists {
+		if score > p.found[i].score {
+			p.found[i] = pageImage{candidate, metadata, score}
+		}
+		return
+	}
+	p.byURL[key] = len(p.found)
+	p.found = append(p.found, pageImage{candidate, metadata, score})
+}
+
+// noteElement records the captions and license of the element a candidate
+// was found in. Those of meta and link elements describe the page, not the
+// image.
+func (p *pageImages) noteElement(candidate string, sel *goquery.Selection) {
+	if sel == nil || sel.Length() == 0 {
+		return
+	}
+	switch goquery.NodeName(sel) {
+	case "meta", "link", "style":
+		return
+	}
+	if absolute := p.c.resolveURL(p.baseURL, strings.TrimSpace(candidate)); absolute != "" && isImageURL(absolute) {
+		p.c.noteImageCaptions(absolute, elementCaptions(sel))
+		p.c.noteElementLicense(absolute, elementLicense(sel))
+	}
+}
+
+// flush passes on the images held back, the best scoring first, up to
+// -max-images-per-page.
+func (p *pageImages) flush() {
+	kept := p.found
+	if limit := p.c.config.MaxImagesPerPage; limit > 0 && len(kept) > limit {
+		sort.SliceStable(kept, func(i, j int) bool { return kept[i].score > kept[j].score })
+		logVerbose(p.c.config, "Keeping %d of %d images on %s (-max-images-per-page)", limit, len(kept), p.baseURL)
+		kept = kept[:limit]
+	}
+	for _, image := range kept {
+		p.c.tryAddImageURL(p.baseURL, image.candidate, image.metadata)
+	}
+	p.found, p.byURL = nil, make(map[string]int)
+}
+
+// scorePageImage rates how likely an image on a page is to be content rather
+// than page furniture: links to full-size images, hero images, described
+// images, and large ones score higher; thumbnails, small images, and icons
+// lower.
+func scorePageImage(imageURL, metadata string, sel *goquery.Selection) int {
+	score := 0
+	if metadata != "" {
+		score += 2
+	}
+	if isThumbnailImage(imageURL) {
+		score -= 3
+	}
+	if junkImagePattern.MatchString(imageURL) {
+		score -= 5
+	}
+	if sel == nil {
+		return score
+	}
+
+	switch goquery.NodeName(sel) {
+	case "a":
+		score += 3
+	case "meta", "link", "video":
+		score += 2
+	}
+	width, _ := strconv.Atoi(strings.TrimSuffix(sel.AttrOr("width", ""), "px"))
+	height, _ := strconv.Atoi(strings.TrimSuffix(sel.AttrOr("height", ""), "px"))
+	switch {
+	case width >= 300 && height >= 300:
+		score += 3
+	case width > 0 && width < 100, height > 0 && height < 100:
+		score -= 4
+	}
+	return score
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Page types distinguish pages by what they link to, so the depth limit can
+// differ between them: a search results page is mostly links to detail
+// pages, which carry the full-size image.
+const (
+	pageTypeSearch  = "search"
+	pageTypeGallery = "gallery"
+	pageTypeDetail  = "detail"
+	pageTypeOther   = "other"
+)
+
+var pageTypes = []string{pageTypeSearch, pageTypeGallery, pageTypeDetail, pageTypeOther}
+
+// siteAdapter holds the URL patterns that tell the page types of a builtin
+// site apart. Patterns are matched against the URL path and query; gallery
+// patterns are tried before detail patterns.
+type siteAdapter struct {
+	name    string
+	domain  string
+	search  *regexp.Regexp
+	gallery *regexp.Regexp
+	detail  *regexp.Regexp
+}
+
+var siteAdapters = []siteAdapter{
+	{
+		name:    "wikimedia",
+		domain:  "wikimedia.org",
+		search:  regexp.MustCompile(`Special:(Media)?Search|[?&]search=`),
+		gallery: regexp.MustCompile(`^/wiki/Category:`),
+		detail:  regexp.MustCompile(`^/wiki/File:`),
+	},
+	{
+		name:    "pexels",
+		domain:  "pexels.com",
+		search:  regexp.MustCompile(`^/search/`),
+		gallery: regexp.MustCompile(`^/collections/|^/@`),
+		detail:  regexp.MustCompile(`^/photo/`),
+	},
+	{
+		name:    "pixabay",
+		domain:  "pixabay.com",
+		search:  regexp.MustCompile(`^/(images|photos|illustrations|vectors)/search/`),
+		gallery: regexp.MustCompile(`^/users/`),
+		detail:  regexp.MustCompile(`^/(photos|illustrations|vectors)/[^/]+-\d+/?$`),
+	},
+	{
+		name:    "freeimages",
+		domain:  "freeimages.com",
+		search:  regexp.MustCompile(`^/search/`),
+		gallery: regexp.MustCompile(`^/photographer/`),
+		detail:  regexp.MustCompile(`^/photo/`),
+	},
+	{
+		name:    "unsplash",
+		domain:  "unsplash.com",
+		search:  regexp.MustCompile(`^/s/`),
+		gallery: regexp.MustCompile(`^/collections/|^/@`),
+		detail:  regexp.MustCompile(`^/photos/`),
+	},
+	{
+		name:    "flickr",
+		domain:  "flickr.com",
+		search:  regexp.MustCompile(`^/search/`),
+		gallery: regexp.MustCompile(`^/photos/[^/]+/(albums|galleries|sets)|^/groups/`),
+		detail:  regexp.MustCompile(`^/photos/[^/]+/\d+`),
+	},
+	{
+		name:    "deviantart",
+		domain:  "deviantart.com",
+		search:  regexp.MustCompile(`^/search`),
+		gallery: regexp.MustCompile(`/gallery`),
+		detail:  regexp.MustCompile(`/art/`),
+	},
+	{
+		name:    "pinterest",
+		domain:  "pinterest.com",
+		search:  regexp.MustCompile(`^/search/`),
+		gallery: regexp.MustCompile(`^/[^/]+/[^/]+/$`),
+		detail:  regexp.MustCompile(`^/pin/`),
+	},
+	{
+		name:    "imgur",
+		domain:  "imgur.com",
+		search:  regexp.MustCompile(`^/search`),
+		gallery: regexp.MustCompile(`^/(a|t)/`),
+		detail:  regexp.MustCompile(`^/gallery/`),
+	},
+	{
+		name:    "reddit",
+		domain:  "reddit.com",
+		search:  regexp.MustCompile(`/search`),
+		gallery: regexp.MustCompile(`^/r/[^/]+/?$`),
+		detail:  regexp.MustCompile(`/comments/`),
+	},
+}
+
+// searchQueryKeys are query parameters that mark a generic search page.
+var searchQueryKeys = []string{"q", "query", "search", "s", "text", "keyword"}
+
+// classifyPage returns the page type of rawURL, using the patterns of the
+// builtin site it belongs to or, for other sites, treating URLs with a
+// search path or query parameter as search pages.
+func classifyPage(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return pageTypeOther
+	}
+
+	host := strings.ToLower(u.Hostname())
+	target := u.Path
+	if u.RawQuery != "" {
+		target += "?" + u.RawQuery
+	}
+
+	for _, adapter := range siteAdapters {
+		if host != adapter.domain && !strings.HasSuffix(host, "."+adapter.domain) {
+			continue
+		}
+		switch {
+		case adapter.search.MatchString(target):
+			return pageTypeSearch
+		case adapter.gallery.MatchString(target):
+			return pageTypeGallery
+		case adapter.detail.MatchString(target):
+			return pageTypeDetail
+		default:
+			return pageTypeOther
+		}
+	}
+
+	if strings.Contains(strings.ToLower(u.Path), "/search") {
+		return pageTypeSearch
+	}
+	query := u.Query()
+	for _, key := range searchQueryKeys {
+		if query.Get(key) != "" {
+			return pageTypeSearch
+		}
+	}
+	return pageTypeOther
+}
+
+// parseTypeDepths parses -type-depth entries such as "detail=4".
+func parseTypeDepths(entries []string) (map[string]int, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	depths := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		name, value, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok || !slices.Contains(pageTypes, name) {
+			return nil, fmt.Errorf("invalid -type-depth entry %q (use type=depth with type one of: %s)", entry, strings.Join(pageTypes, ", "))
+		}
+		depth, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid depth in -type-depth entry %q", entry)
+		}
+		depths[name] = depth
+	}
+	return depths, nil
+}
+
+// linkDepthLimit returns the deepest level at which a page of type linkType,
+// linked from a page of type fromType, is crawled. Unless set with
+// -type-depth, detail pages linked from search results or galleries may go
+// one level past -max-depth, so the results on the last level are still
+// opened.
+func (cfg *Config) linkDepthLimit(fromType, linkType string) int {
+	if depth, ok := cfg.typeDepths[linkType]; ok {
+		return depth
+	}
+	if linkType == pageTypeDetail && (fromType == pageTypeSearch || fromType == pageTypeGallery) {
+		return cfg.MaxDepth + 1
+	}
+	return cfg.MaxDepth
+}
+
+// deepestDepth returns the deepest level any page may be crawled at.
+func (cfg *Config) deepestDepth() int {
+	deepest := cfg.MaxDepth + 1
+	for _, depth := range cfg.typeDepths {
+		deepest = max(deepest, depth)
+	}
+	return deepest
+}
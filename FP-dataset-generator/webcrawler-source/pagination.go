@@ -0,0 +1,184 @@
+package main
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Search results and galleries continue over numbered pages. Their next
+// pages are queued ahead of other links, at the depth of the page that
+// links to them, so a results listing is read through to -max-result-pages
+// before the crawl wanders off into the pages it links to.
+
+// nextPageTexts are the link texts, lowercased and without arrows, of
+// "next page" links in the languages the crawler meets most.
+var nextPageTexts = map[string]struct{}{
+	"next":          {},
+	"next page":     {},
+	"more results":  {},
+	"older posts":   {},
+	"older entries": {},
+	"siguiente":     {},
+	"suivant":       {},
+	"page suivante": {},
+	"weiter":        {},
+	"nächste":       {},
+	"nächste seite": {},
+	"avanti":        {},
+	"successiva":    {},
+	"próxima":       {},
+	"volgende":      {},
+}
+
+// pageNumberKeys are the query parameters that number the pages of a
+// listing, as in ?page=2.
+var pageNumberKeys = []string{"page", "p", "pg", "paged", "pagenum", "page_num"}
+
+// pageNumberPath matches a page number in the path, as in /blog/page/2/.
+var pageNumberPath = regexp.MustCompile(`/page/(\d+)/?$`)
+
+// nextPageLinks returns the absolute URLs a page gives for its next page:
+// rel=next links, "next" links and buttons, and links to the same URL with
+// the page number one higher.
+func (c *Crawler) nextPageLinks(doc *goquery.Document, pageURL string) []string {
+	current, err := url.Parse(pageURL)
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	seen := make(map[string]struct{})
+	doc.Find("link[rel][href], a[href]").Each(func(_ int, sel *goquery.Selection) {
+		href, _ := sel.Attr("href")
+		absolute := c.resolveURL(pageURL, href)
+		if absolute == "" || absolute == pageURL {
+			return
+		}
+		if _, exists := seen[absolute]; exists {
+			return
+		}
+		if !isNextPageLink(sel) {
+			target, err := url.Parse(absolute)
+			if err != nil || !isNextPageURL(current, target) {
+				return
+			}
+		}
+		seen[absolute] = struct{}{}
+		links = append(links, absolute)
+	})
+	return links
+}
+
+// isNextPageLink reports whether a link is marked as leading to the next
+// page by its rel, text, label, or class.
+func isNextPageLink(sel *goquery.Selection) bool {
+	for _, rel := range strings.Fields(strings.ToLower(sel.AttrOr("rel", ""))) {
+		if rel == "next" {
+			return true
+		}
+	}
+	if goquery.NodeName(sel) != "a" {
+		return false
+	}
+
+	for _, text := range []string{sel.Text(), sel.AttrOr("aria-label", ""), sel.AttrOr("title", "")} {
+		text = strings.Trim(strings.ToLower(strings.Join(strings.Fields(text), " ")), " »›>→.")
+		if _, ok := nextPageTexts[text]; ok {
+			return true
+		}
+	}
+
+	// A bare arrow or a link classed "next" counts inside pagination only.
+	classes := strings.Fields(strings.ToLower(sel.AttrOr("class", "")))
+	arrow := strings.TrimSpace(sel.Text())
+	if (slices.Contains(classes, "next") || arrow == "»" || arrow == "›" || arrow == "→") &&
+		sel.Closest("[class*='pagination'], [class*='pager'], nav").Length() > 0 {
+		return true
+	}
+	return false
+}
+
+// isNextPageURL reports whether target is current with its page number,
+// in the query or the path, one higher. A URL without one is page 1.
+func isNextPageURL(current, target *url.URL) bool {
+	if !strings.EqualFold(current.Host, target.Host) {
+		return false
+	}
+
+	currentQuery, targetQuery := current.Query(), target.Query()
+	for _, key := range pageNumberKeys {
+		next, err := strconv.Atoi(targetQuery.Get(key))
+		if err != nil || current.Path != target.Path {
+			continue
+		}
+		page := 1
+		if value := currentQuery.Get(key); value != "" {
+			if page, err = strconv.Atoi(value); err != nil {
+				continue
+			}
+		}
+		currentQuery.Del(key)
+		targetQuery.Del(key)
+		return next == page+1 && currentQuery.Encode() == targetQuery.Encode()
+	}
+
+	match := pageNumberPath.FindStringSubmatch(target.Path)
+	if match == nil || current.RawQuery != target.RawQuery {
+		return false
+	}
+	next, _ := strconv.Atoi(match[1])
+	base := strings.TrimSuffix(target.Path[:len(target.Path)-len(match[0])], "/")
+	if currentMatch := pageNumberPath.FindStringSubmatch(current.Path); currentMatch != nil {
+		page, _ := strconv.Atoi(currentMatch[1])
+		return next == page+1 && base == strings.TrimSuffix(current.Path[:len(current.Path)-len(currentMatch[0])], "/")
+	}
+	return next == 2 && base == strings.TrimSuffix(current.Path, "/")
+}
+
+// pageNumber returns the page number in a URL's query or path, or 1 when it
+// has none.
+func pageNumber(raw string) int {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return 1
+	}
+	query := u.Query()
+	for _, key := range pageNumberKeys {
+		if page, err := strconv.Atoi(query.Get(key)); err == nil && page > 0 {
+			return page
+		}
+	}
+	if match := pageNumberPath.FindStringSubmatch(u.Path); match != nil {
+		if page, err := strconv.Atoi(match[1]); err == nil && page > 0 {
+			return page
+		}
+	}
+	return 1
+}
+
+// followPagination queues the next pages of a results page ahead of its
+// other links, up to -max-result-pages pages in all. A results page reached
+// through an ordinary link is numbered by its URL.
+func (c *Crawler) followPagination(doc *goquery.Document, task CrawlTask, pageURL string) {
+	resultPage := task.ResultPage
+	if resultPage == 0 {
+		resultPage = pageNumber(pageURL)
+	}
+	resultPage++
+	for _, next := range c.nextPageLinks(doc, pageURL) {
+		if c.config.MaxResultPages > 0 && resultPage > c.config.MaxResultPages {
+			logVerbose(c.config, "Not following %s: results page %d is past -max-result-pages", next, resultPage)
+			return
+		}
+		if !c.shouldFollowLink(pageURL, next) {
+			continue
+		}
+		logVerbose(c.config, "Following results page %d: %s", resultPage, next)
+		c.enqueueTask(CrawlTask{URL: next, Depth: task.Depth, ResultPage: resultPage})
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// An image found on a page is first-party when it is served from the same
+// registrable domain (eTLD+1) as the page, such as cdn.example.co.uk for a
+// page on www.example.co.uk, and third-party otherwise: ad networks,
+// trackers, and embeds from other sites.
+const (
+	partyFirst = "first-party"
+	partyThird = "third-party"
+)
+
+// registrableDomain returns the eTLD+1 of a URL's host, or the host itself
+// for IP addresses and hosts without a public suffix, such as localhost.
+func registrableDomain(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "" || net.ParseIP(host) != nil {
+		return host
+	}
+	if domain, err := publicsuffix.EffectiveTLDPlusOne(host); err == nil {
+		return domain
+	}
+	return host
+}
+
+// imageParty tells whether an image found on pageURL is first-party or
+// third-party. Images taken from a PDF or inlined in a page are judged by
+// the document they came from.
+func imageParty(pageURL, imageURL string) string {
+	page, image := registrableDomain(pageURL), registrableDomain(documentURL(imageURL))
+	if page == "" || image == "" || page == image {
+		return partyFirst
+	}
+	return partyThird
+}
+
+// noteImageParty remembers whether an image is first-party or third-party.
+// An image found as first-party on any page stays first-party.
+func (c *Crawler) noteImageParty(imageURL, party string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	if c.imageParties[imageURL] != partyFirst {
+		c.imageParties[imageURL] = party
+	}
+}
+
+// setParties records on each image that has none yet whether it was
+// first-party or third-party.
+func (s *CrawlState) setParties(parties map[string]string) {
+	for i := range s.Images {
+		if s.Images[i].Party == "" {
+			s.Images[i].Party = parties[s.Images[i].URL]
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// Images embedded in a PDF have no URL of their own, so -pdf-images records
+// each one as
+//
+//	pdf-image:<entry>:<pdf url>
+//
+// where the entry, such as p3-12.jpg, names the page, the PDF object, and
+// the image type. The downloader fetches each PDF once, extracts all of its
+// images into pdfImageCacheDir, and takes them from there.
+const (
+	pdfImageScheme   = "pdf-image"
+	pdfImageCacheDir = ".pdf-images"
+
+	// maxPDFBytes caps the size of a PDF read while crawling.
+	maxPDFBytes = 100 << 20
+)
+
+func init() {
+	// pdfcpu would otherwise create a configuration directory in the
+	// user's home on first use.
+	api.DisableConfigDir()
+}
+
+// isPDFResponse reports whether a fetched body is a PDF, by its declared
+// Content-Type or its magic number.
+func isPDFResponse(contentType string, head []byte) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "application/pdf") ||
+		bytes.HasPrefix(head, []byte("%PDF-"))
+}
+
+// pdfImageURL returns the URL recorded for an image embedded in a PDF.
+func pdfImageURL(pdfURL, entry string) string {
+	return pdfImageScheme + ":" + entry + ":" + pdfURL
+}
+
+// parsePDFImageURL splits a pdf-image URL into the PDF's URL and the entry.
+func parsePDFImageURL(raw string) (pdfURL, entry string, ok bool) {
+	rest, ok := strings.CutPrefix(raw, pdfImageScheme+":")
+	if !ok {
+		return "", "", false
+	}
+	entry, pdfURL, ok = strings.Cut(rest, ":")
+	if !ok || entry == "" || pdfURL == "" {
+		return "", "", false
+	}
+	return pdfURL, entry, true
+}
+
+// pdfImageFilename names an extracted image after its PDF and entry, such as
+// report_p3-12.jpg for an image in report.pdf.
+func pdfImageFilename(pdfURL, entry string) string {
+	base := extractFilenameFromURL(pdfURL)
+	return sanitizeFilename(strings.TrimSuffix(base, path.Ext(base)) + "_" + entry)
+}
+
+// pdfImageEntry names an image of a PDF by the page it was first found on,
+// its object number, and its type.
+func pdfImageEntry(img model.Image) string {
+	return fmt.Sprintf("p%d-%d.%s", img.PageNr, img.ObjNr, img.FileType)
+}
+
+// walkPDFImages calls visit once for every raster image in a PDF, skipping
+// thumbnails and masks.
+func walkPDFImages(rs io.ReadSeeker, visit func(entry string, img model.Image) error) error {
+	seen := make(map[int]struct{})
+	return api.ExtractImages(rs, nil, func(img model.Image, _ bool, _ int) error {
+		if img.Thumb || img.IsImgMask {
+			return nil
+		}
+		if _, exists := seen[img.ObjNr]; exists {
+			return nil
+		}
+		seen[img.ObjNr] = struct{}{}
+		return visit(pdfImageEntry(img), img)
+	}, nil)
+}
+
+// extractPDFImages records the images embedded in a PDF the crawl reached.
+// With the keyword matched against the URL, it has to appear in the PDF's
+// URL, as the images have no names of their own.
+func (c *Crawler) extractPDFImages(body io.Reader, pdfURL string) error {
+	data, err := io.ReadAll(io.LimitReader(body, maxPDFBytes+1))
+	if err != nil {
+		return err
+	}
+	if len(data) > maxPDFBytes {
+		logVerbose(c.config, "Skipping PDF larger than %s: %s", formatBytes(maxPDFBytes), pdfURL)
+		return nil
+	}
+
+	found := 0
+	err = walkPDFImages(bytes.NewReader(data), func(entry string, _ model.Image) error {
+		found++
+		c.acceptImageURL(pdfImageURL(pdfURL, entry), "")
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("could not read PDF: %w", err)
+	}
+	logVerbose(c.config, "PDF with %d image(s): %s", found, pdfURL)
+	return nil
+}
+
+// extractedImages holds the images a download run extracted from the
+// documents it fetched, such as PDFs, until each is taken by its download.
+type extractedImages struct {
+	dir string
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+func newExtractedImages(dir string) *extractedImages {
+	return &extractedImages{
+		dir:   dir,
+		locks: make(map[string]*sync.Mutex),
+	}
+}
+
+// lock serializes the downloads of images from the same document, so the
+// document is fetched and extracted only once.
+func (p *extractedImages) lock(documentURL string) *sync.Mutex {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	lock, exists := p.locks[documentURL]
+	if !exists {
+		lock = &sync.Mutex{}
+		p.locks[documentURL] = lock
+	}
+	lock.Lock()
+	return lock
+}
+
+// remove deletes the images no download took.
+func (p *extractedImages) remove() {
+	os.RemoveAll(p.dir)
+}
+
+// fetchPDFImage saves the image a pdf-image URL names to outputPath,
+// extracting it from the PDF first if no earlier download did.
+func (d *Downloader) fetchPDFImage(imageURL, outputPath string) error {
+	pdfURL, entry, ok := parsePDFImageURL(imageURL)
+	if !ok {
+		return fmt.Errorf("invalid %s URL", pdfImageScheme)
+	}
+
+	lock := d.pdfImages.lock(pdfURL)
+	defer lock.Unlock()
+
+	return d.pdfImages.take(pdfURL, entry, outputPath, d.extractPDFToCache)
+}
+
+// take moves the image entry extracted from a document to outputPath,
+// calling extract to fill the document's directory if no earlier download
+// did.
+func (p *extractedImages) take(documentURL, entry, outputPath string, extract func(documentURL, dir string) error) error {
+	dir := filepath.Join(p.dir, fmt.Sprintf("%x", sha256.Sum256([]byte(documentURL)))[:16])
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := extract(documentURL, dir); err != nil {
+			os.RemoveAll(dir)
+			return err
+		}
+	}
+
+	if err := os.Rename(filepath.Join(dir, entry), outputPath); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("image %s not found in %s", entry, documentURL)
+		}
+		return err
+	}
+	return nil
+}
+
+// extractPDFToCache downloads a PDF and writes each of its images into dir.
+func (d *Downloader) extractPDFToCache(pdfURL, dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	pdfPath := dir + ".pdf"
+	defer os.Remove(pdfPath)
+	if _, err := d.fetch(pdfURL, pdfPath); err != nil {
+		return fmt.Errorf("could not download PDF: %w", err)
+	}
+
+	file, err := os.Open(pdfPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	head := make([]byte, sniffLength)
+	n, _ := io.ReadFull(file, head)
+	if !isPDFResponse("", head[:n]) {
+		return fmt.Errorf("%s is %s, not a PDF", pdfURL, http.DetectContentType(head[:n]))
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	err = walkPDFImages(file, func(entry string, img model.Image) error {
+		out, err := os.Create(filepath.Join(dir, entry))
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, img); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
+	if err != nil {
+		return fmt.Errorf("could not extract images from PDF: %w", err)
+	}
+	return nil
+}
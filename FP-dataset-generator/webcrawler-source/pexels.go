@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	pexelsSearchURL = "https://api.pexels.com/v1/search"
+	pexelsPerPage   = 80
+	pexelsLicense   = "Pexels License (https://www.pexels.com/license/)"
+)
+
+// pexelsProvider searches photos through the Pexels API, which needs an API
+// key.
+type pexelsProvider struct {
+	client    *http.Client
+	key       string
+	userAgent string
+}
+
+type pexelsSearchResponse struct {
+	NextPage string `json:"next_page"`
+	Photos   []struct {
+		URL             string `json:"url"`
+		Photographer    string `json:"photographer"`
+		PhotographerURL string `json:"photographer_url"`
+		Src             struct {
+			Original string `json:"original"`
+		} `json:"src"`
+	} `json:"photos"`
+}
+
+func (p *pexelsProvider) searchPage(keyword string, page int) ([]providerImage, bool, error) {
+	query := url.Values{}
+	query.Set("query", keyword)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(pexelsPerPage))
+
+	req, err := http.NewRequest(http.MethodGet, pexelsSearchURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Authorization", p.key)
+	req.Header.Set("User-Agent", p.userAgent)
+
+	var response pexelsSearchResponse
+	if err := getProviderJSON(p.client, req, &response, pexelsError); err != nil {
+		return nil, false, err
+	}
+
+	images := make([]providerImage, 0, len(response.Photos))
+	for _, photo := range response.Photos {
+		if photo.Src.Original == "" {
+			continue
+		}
+		images = append(images, providerImage{
+			URL: photo.Src.Original,
+			Attribution: Attribution{
+				Author:    photo.Photographer,
+				AuthorURL: photo.PhotographerURL,
+				Page:      photo.URL,
+				License:   pexelsLicense,
+			},
+		})
+	}
+	return images, response.NextPage != "", nil
+}
+
+// pexelsError extracts the message from a Pexels error response, which looks
+// like {"error": "..."} or {"code": "...", "message": "..."}.
+func pexelsError(body []byte) string {
+	var response struct {
+		Error   string `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(body, &response) == nil {
+		if response.Error != "" {
+			return response.Error
+		}
+		if response.Message != "" {
+			return response.Message
+		}
+	}
+	return string(body)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+)
+
+// A dataset is built by a pipeline composed from the configuration:
+//
+//	sources  discover image URLs and record them in the crawl state
+//	         (the HTML crawler, an image search API, a list of URLs)
+//	filters  decide for each downloaded image whether it is kept
+//	         (type, file size, dimensions, style, watermarks, duplicates)
+//	sink     stores the images that pass every filter
+//
+// The keyword is matched while crawling rather than as a filter, since it
+// needs the page context around each image.
+
+// imageSource discovers image URLs.
+type imageSource interface {
+	name() string
+
+	// discover records the image URLs it finds in state and, when stream is
+	// not nil, also sends each newly found URL to it. It leaves
+	// state.CrawlDone false when it stopped with work left to resume.
+	discover(cfg *Config, state *CrawlState, stream chan<- string) error
+}
+
+// imageSink stores the images that pass the filters.
+type imageSink interface {
+	// exists reports whether an image is already stored under file.
+	exists(file string) bool
+
+	// store moves the completed download at path into the sink as file.
+	store(path, file string) error
+}
+
+// pipelineSources returns the sources the configuration asks for. An image
+// search API or a URL list replace the crawler, unless seed URLs are given
+// as well. A watched directory replaces every other source.
+func pipelineSources(cfg *Config) []imageSource {
+	if cfg.WatchDir != "" {
+		return []imageSource{watchDirSource{dir: cfg.WatchDir}}
+	}
+
+	var sources []imageSource
+	if cfg.InputURLs != "" {
+		sources = append(sources, urlListSource{path: cfg.InputURLs})
+	}
+	if cfg.Provider != "" {
+		sources = append(sources, providerSource{})
+	} else if cfg.InputURLs == "" || len(cfg.SeedURLs) > 0 {
+		sources = append(sources, crawlerSource{})
+	}
+	return sources
+}
+
+// newImageSink returns where downloaded images are stored.
+func newImageSink(cfg *Config) imageSink {
+	return localDirSink{dir: cfg.OutputDir}
+}
+
+// crawlPhase runs the configured sources in turn, saving the state after
+// each one. When stream is not nil, newly discovered image URLs are also
+// sent to it.
+func crawlPhase(cfg *Config, state *CrawlState, stream chan<- string) error {
+	state.CrawlDone = true
+	for _, source := range pipelineSources(cfg) {
+		logVerbose(cfg, "Running source: %s", source.name())
+		err := source.discover(cfg, state, stream)
+		if saveErr := saveState(cfg.OutputDir, state); saveErr != nil {
+			return saveErr
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if !state.CrawlDone && len(state.Frontier) > 0 {
+		logInfo("%d page(s) left in the frontier; run the resume command to continue crawling", len(state.Frontier))
+	}
+
+	if cfg.ExportURLs != "" {
+		if err := writeImageURLList(cfg.ExportURLs, state); err != nil {
+			return err
+		}
+		logSuccess("Exported %d image URL(s) to %s", len(state.Images), cfg.ExportURLs)
+	}
+	return nil
+}
+
+// crawlerSource crawls HTML pages from the seeds or builtin sites,
+// continuing from state when it holds an unfinished crawl. The first Ctrl+C
+// stops the crawl gracefully so the frontier is saved; a second one aborts.
+type crawlerSource struct{}
+
+func (crawlerSource) name() string { return "crawler" }
+
+func (crawlerSource) discover(cfg *Config, state *CrawlState, stream chan<- string) error {
+	SetSkipThumbnails(cfg.SkipThumbnails)
+	SetStripParams(cfg.StripParams)
+	SetAllowWebP(cfg.AllowWebP)
+	SetImageTypes(cfg.ImageTypes)
+
+	if cfg.MinImages == 0 {
+		_, err := runCrawler(cfg, state, stream)
+		return err
+	}
+
+	roundCfg := *cfg
+	for round := 1; ; round++ {
+		crawler, err := runCrawler(&roundCfg, state, stream)
+		if err != nil {
+			return err
+		}
+		if len(state.Images) >= cfg.MinImages || crawler.stoppedByUser() || cfg.pastDeadline() || !expandCrawl(&roundCfg, state, crawler, round) {
+			break
+		}
+	}
+	printImageSources(cfg, state.imageURLs())
+	return nil
+}
+
+// runCrawler runs one crawl, continuing from state when it holds an
+// unfinished crawl, and copies its progress into state.
+func runCrawler(cfg *Config, state *CrawlState, stream chan<- string) (*Crawler, error) {
+	crawler := NewCrawler(cfg)
+	if len(state.Frontier) > 0 {
+		crawler.Restore(state)
+	}
+	if stream != nil {
+		crawler.StreamImages(stream)
+	}
+	crawler.TrackVariants(state.variantIndex())
+
+	if cfg.Control != "" {
+		listener, err := serveControl(cfg.Control, crawler)
+		if err != nil {
+			return nil, err
+		}
+		defer listener.Close()
+	}
+
+	interrupts := make(chan os.Signal, 2)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-interrupts:
+		case <-done:
+			return
+		}
+		fmt.Println("\n\nInterrupt received, finishing in-flight pages (press Ctrl+C again to abort)...")
+		crawler.Stop()
+		select {
+		case <-interrupts:
+			os.Exit(130)
+		case <-done:
+		}
+	}()
+
+	crawlErr := crawler.Start()
+	crawler.Snapshot(state)
+
+	if crawlErr != nil {
+		return nil, fmt.Errorf("crawling failed: %w", crawlErr)
+	}
+	return crawler, nil
+}
+
+// urlListSource reads image URLs from a file: one per line, or a JSON list
+// such as -export-urls writes.
+type urlListSource struct {
+	path string
+}
+
+func (urlListSource) name() string { return "url list" }
+
+func (s urlListSource) discover(cfg *Config, state *CrawlState, stream chan<- string) error {
+	entries, err := readURLList(s.path)
+	if err != nil {
+		return err
+	}
+
+	added := state.addListedImages(entries)
+	if stream != nil {
+		for _, imageURL := range added {
+			stream <- imageURL
+		}
+	}
+
+	logSuccess("Read %d new image URL(s) from %s", len(added), s.path)
+	return nil
+}
+
+// localDirSink stores images as files in the output directory.
+type localDirSink struct {
+	dir string
+}
+
+func (s localDirSink) exists(file string) bool {
+	_, err := os.Stat(filepath.Join(s.dir, file))
+	return err == nil
+}
+
+func (s localDirSink) store(path, file string) error {
+	return os.Rename(path, filepath.Join(s.dir, file))
+}
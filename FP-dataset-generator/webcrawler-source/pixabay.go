@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	pixabaySearchURL = "https://pixabay.com/api/"
+	pixabayPerPage   = 200
+	pixabayLicense   = "Pixabay Content License (https://pixabay.com/service/license-summary/)"
+)
+
+var (
+	pixabayImageTypes   = []string{"all", "photo", "illustration", "vector"}
+	pixabayOrientations = []string{"all", "horizontal", "vertical"}
+)
+
+// pixabayProvider searches images through the Pixabay API, which needs an
+// API key. -min-width and -min-height are passed on so the API only returns
+// images that are large enough.
+type pixabayProvider struct {
+	client      *http.Client
+	key         string
+	userAgent   string
+	imageType   string
+	orientation string
+	minWidth    int
+	minHeight   int
+}
+
+type pixabaySearchResponse struct {
+	TotalHits int `json:"totalHits"`
+	Hits      []struct {
+		PageURL       string `json:"pageURL"`
+		LargeImageURL string `json:"largeImageURL"`
+		User          string `json:"user"`
+		UserID        int    `json:"user_id"`
+		Tags          string `json:"tags"`
+	} `json:"hits"`
+}
+
+func (p *pixabayProvider) searchPage(keyword string, page int) ([]providerImage, bool, error) {
+	query := url.Values{}
+	query.Set("key", p.key)
+	query.Set("q", keyword)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(pixabayPerPage))
+	query.Set("image_type", p.imageType)
+	if p.orientation != "" {
+		query.Set("orientation", p.orientation)
+	}
+	if p.minWidth > 0 {
+		query.Set("min_width", strconv.Itoa(p.minWidth))
+	}
+	if p.minHeight > 0 {
+		query.Set("min_height", strconv.Itoa(p.minHeight))
+	}
+
+	req, err := http.NewRequest(http.MethodGet, pixabaySearchURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", p.userAgent)
+
+	// Pixabay reports errors as plain text such as "[ERROR 400] Invalid API key".
+	var response pixabaySearchResponse
+	if err := getProviderJSON(p.client, req, &response, func(body []byte) string { return string(body) }); err != nil {
+		return nil, false, err
+	}
+
+	images := make([]providerImage, 0, len(response.Hits))
+	for _, hit := range response.Hits {
+		if hit.LargeImageURL == "" {
+			continue
+		}
+		images = append(images, providerImage{
+			URL: hit.LargeImageURL,
+			Attribution: Attribution{
+				Author:    hit.User,
+				AuthorURL: fmt.Sprintf("https://pixabay.com/users/%s-%d/", url.PathEscape(hit.User), hit.UserID),
+				Page:      hit.PageURL,
+				License:   pixabayLicense,
+			},
+			Tags: splitCSV(hit.Tags),
+		})
+	}
+	return images, page*pixabayPerPage < response.TotalHits, nil
+}
+
+// pixabayImageType returns the image type to search for. Unless set with
+// -pixabay-image-type it follows -photo-only and -illustration-only.
+func pixabayImageType(cfg *Config) string {
+	switch {
+	case cfg.PixabayImageType != "":
+		return cfg.PixabayImageType
+	case cfg.PhotoOnly:
+		return "photo"
+	case cfg.IllustrationOnly:
+		return "illustration"
+	default:
+		return "all"
+	}
+}
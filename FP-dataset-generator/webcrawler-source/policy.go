@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// A deployment policy sets politeness limits that no flag, config file, site
+// definition, or control command can loosen, for builds run as a shared
+// service. Its values are set when building, either directly:
+//
+//	go build -ldflags "-X main.policyMinRateLimit=2000 -X main.policyRespectRobots=true"
+//
+// or by naming a policy file, YAML or TOML with the keys of crawlPolicy,
+// which must then exist:
+//
+//	go build -ldflags "-X main.policyFile=/etc/webcrawler-ai/policy.yaml"
+//
+// Where both set a limit, the stricter one applies.
+var (
+	policyFile           string
+	policyMinRateLimit   string
+	policyMaxConcurrency string
+	policyRespectRobots  string
+)
+
+// crawlPolicy is the deployment policy.
+type crawlPolicy struct {
+	// MinRateLimitMs is the least pause between the pages of a site.
+	MinRateLimitMs int `yaml:"min-rate-limit" toml:"min-rate-limit"`
+
+	// MaxConcurrency caps the crawl and download workers each.
+	MaxConcurrency int `yaml:"max-concurrency" toml:"max-concurrency"`
+
+	// RespectRobots makes robots.txt binding: -ignore-robots and
+	// -robots-overrides are refused.
+	RespectRobots bool `yaml:"respect-robots" toml:"respect-robots"`
+}
+
+// active reports whether the policy sets any limit.
+func (p crawlPolicy) active() bool {
+	return p.MinRateLimitMs > 0 || p.MaxConcurrency > 0 || p.RespectRobots
+}
+
+func (p crawlPolicy) String() string {
+	var limits []string
+	if p.MinRateLimitMs > 0 {
+		limits = append(limits, fmt.Sprintf("rate limit at least %dms", p.MinRateLimitMs))
+	}
+	if p.MaxConcurrency > 0 {
+		limits = append(limits, fmt.Sprintf("at most %d workers", p.MaxConcurrency))
+	}
+	if p.RespectRobots {
+		limits = append(limits, "robots.txt binding")
+	}
+	return strings.Join(limits, ", ")
+}
+
+// loadPolicy returns the policy the build sets.
+func loadPolicy() (crawlPolicy, error) {
+	var policy crawlPolicy
+	var err error
+	if policyMinRateLimit != "" {
+		if policy.MinRateLimitMs, err = strconv.Atoi(policyMinRateLimit); err != nil || policy.MinRateLimitMs < 0 {
+			return policy, fmt.Errorf("built-in policy: invalid minimum rate limit %q", policyMinRateLimit)
+		}
+	}
+	if policyMaxConcurrency != "" {
+		if policy.MaxConcurrency, err = strconv.Atoi(policyMaxConcurrency); err != nil || policy.MaxConcurrency < 0 {
+			return policy, fmt.Errorf("built-in policy: invalid maximum concurrency %q", policyMaxConcurrency)
+		}
+	}
+	if policyRespectRobots != "" {
+		if policy.RespectRobots, err = strconv.ParseBool(policyRespectRobots); err != nil {
+			return policy, fmt.Errorf("built-in policy: invalid respect-robots %q", policyRespectRobots)
+		}
+	}
+	if policyFile == "" {
+		return policy, nil
+	}
+
+	var file crawlPolicy
+	if err := decodeFile(policyFile, "policy file", &file); err != nil {
+		return policy, err
+	}
+	if file.MinRateLimitMs < 0 || file.MaxConcurrency < 0 {
+		return policy, fmt.Errorf("policy file %s: limits cannot be negative", policyFile)
+	}
+	policy.MinRateLimitMs = max(policy.MinRateLimitMs, file.MinRateLimitMs)
+	if file.MaxConcurrency > 0 && (policy.MaxConcurrency == 0 || file.MaxConcurrency < policy.MaxConcurrency) {
+		policy.MaxConcurrency = file.MaxConcurrency
+	}
+	policy.RespectRobots = policy.RespectRobots || file.RespectRobots
+	return policy, nil
+}
+
+// applyPolicy holds cfg to the deployment policy. Settings it tightens are
+// reported; those that break robots.txt are refused.
+func applyPolicy(cfg *Config, policy crawlPolicy) []string {
+	cfg.policy = policy
+	if !policy.active() {
+		return nil
+	}
+
+	var problems []string
+	if policy.RespectRobots {
+		if cfg.IgnoreRobots {
+			problems = append(problems, "ignore-robots is not allowed by this build's policy")
+		}
+		if cfg.RobotsOverrides != "" {
+			problems = append(problems, "robots-overrides is not allowed by this build's policy")
+		}
+	}
+	if cfg.RateLimitMs < policy.MinRateLimitMs {
+		logWarning("Raising -rate-limit from %dms to %dms, the least this build's policy allows", cfg.RateLimitMs, policy.MinRateLimitMs)
+		cfg.RateLimitMs = policy.MinRateLimitMs
+	}
+	if limit := policy.MaxConcurrency; limit > 0 {
+		if cfg.AutoConcurrency {
+			if cfg.maxCrawlWorkers == 0 || cfg.maxCrawlWorkers > limit {
+				cfg.maxCrawlWorkers = limit
+			}
+		} else if cfg.Concurrency > limit {
+			logWarning("Lowering -concurrency from %d to %d, the most this build's policy allows", cfg.Concurrency, limit)
+			cfg.Concurrency = limit
+		}
+		if cfg.downloadConcurrency() > limit {
+			cfg.DownloadWorkers = limit
+		}
+	}
+	return problems
+}
+
+// politeRateLimit returns ms raised to the policy's minimum rate limit.
+func (cfg *Config) politeRateLimit(ms int) int {
+	return max(ms, cfg.policy.MinRateLimitMs)
+}
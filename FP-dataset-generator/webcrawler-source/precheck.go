@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// manifestHeaders are the response headers kept for each downloaded image,
+// enough for later freshness checks and conditional re-downloads.
+var manifestHeaders = []string{"Content-Type", "Content-Length", "Last-Modified", "ETag", "Cache-Control"}
+
+// responseHead is what a pre-download request learned about an image
+// without transferring its body. Empty fields mean the server did not say.
+type responseHead struct {
+	status      int
+	contentType string
+	size        int64
+	headers     map[string]string
+}
+
+// headImage asks the server for an image's type and size. It tries HEAD
+// first and falls back to a one-byte ranged GET for servers that reject
+// HEAD.
+func (d *Downloader) headImage(imageURL string) (*responseHead, error) {
+	head, err := d.requestHead(http.MethodHead, imageURL)
+	if err == nil && head.status != http.StatusMethodNotAllowed && head.status != http.StatusNotImplemented &&
+		head.status != http.StatusForbidden {
+		return head, nil
+	}
+	return d.requestHead(http.MethodGet, imageURL)
+}
+
+func (d *Downloader) requestHead(method, imageURL string) (*responseHead, error) {
+	req, err := http.NewRequest(method, imageURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", d.config.UserAgent)
+	req.Header.Set("Referer", imageURL)
+	req.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
+	if method == http.MethodGet {
+		req.Header.Set("Range", "bytes=0-0")
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	head := &responseHead{status: resp.StatusCode, size: -1}
+	if mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type")); err == nil {
+		head.contentType = strings.ToLower(mediaType)
+	}
+
+	head.headers = make(map[string]string, len(manifestHeaders))
+	for _, name := range manifestHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			head.headers[name] = value
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusPartialContent:
+		// Content-Range: bytes 0-0/12345
+		if _, total, ok := strings.Cut(resp.Header.Get("Content-Range"), "/"); ok {
+			if size, err := strconv.ParseInt(total, 10, 64); err == nil {
+				head.size = size
+			}
+		}
+	case resp.ContentLength > 0:
+		// A HEAD response, or a GET whose server ignored the range and would
+		// have sent the whole body. Some servers answer HEAD with a zero
+		// length, which says nothing about the image.
+		head.size = resp.ContentLength
+	}
+
+	// A ranged response describes one byte; record the full size instead.
+	delete(head.headers, "Content-Length")
+	if head.size > 0 {
+		head.headers["Content-Length"] = strconv.FormatInt(head.size, 10)
+	}
+
+	return head, nil
+}
+
+// precheckImage decides from the response headers alone whether an image is
+// worth downloading. It returns downloadSuccess to go ahead, or the result
+// to record along with the reason the image was skipped. An inconclusive
+// check never blocks a download. The response head is returned too when
+// the server answered successfully, or nil. What it learned of a filtered
+// image is noted in outcome.
+func (d *Downloader) precheckImage(imageURL string, outcome *downloadOutcome) (downloadResult, string, *responseHead) {
+	scheme := urlScheme(imageURL)
+	if scheme != "http" && scheme != "https" {
+		return downloadSuccess, "", nil
+	}
+
+	head, err := d.headImage(imageURL)
+	if err != nil {
+		logVerbose(d.config, "Pre-download check failed for %s, downloading anyway: %v", imageURL, err)
+		return downloadSuccess, "", nil
+	}
+
+	if head.status == http.StatusNotFound || head.status == http.StatusGone {
+		return downloadFailed, fmt.Sprintf("server returned %d", head.status), nil
+	}
+
+	switch {
+	case head.contentType == "", head.contentType == "application/octet-stream", head.contentType == "binary/octet-stream":
+		// Unknown type; the content is sniffed after download.
+	case !strings.HasPrefix(head.contentType, "image/"):
+		return downloadFailed, "content is " + head.contentType + ", not an image", nil
+	case !isSupportedImageMIME(head.contentType):
+		return downloadFailed, "unsupported image format " + head.contentType, nil
+	case !d.config.allowsImageType(head.contentType):
+		outcome.Filter, outcome.MIME, outcome.Size = filterTypes, head.contentType, max(head.size, 0)
+		return downloadFiltered, "type " + head.contentType + " not in -types", nil
+	}
+
+	if d.config.maxFileSizeBytes > 0 && head.size > int64(d.config.maxFileSizeBytes) {
+		outcome.Filter, outcome.MIME, outcome.Size = filterFileSize, head.contentType, head.size
+		return downloadFiltered, fmt.Sprintf("%s exceeds -max-file-size %s", formatBytes(uint64(head.size)), formatBytes(d.config.maxFileSizeBytes)), nil
+	}
+
+	if head.status >= 400 {
+		return downloadSuccess, "", nil
+	}
+	return downloadSuccess, "", head
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"html/template"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// The serve-preview command serves a gallery of the images in an output
+// directory, newest first, refreshing itself while a crawl into it is still
+// running, so a poor dataset can be stopped early.
+
+const (
+	defaultPreviewAddr = "127.0.0.1:8000"
+
+	// previewLimit caps the images shown, newest first.
+	previewLimit = 300
+
+	// previewRefreshSeconds is how often the gallery reloads itself.
+	previewRefreshSeconds = 10
+)
+
+// previewImage is an image in the gallery. Path is relative to the output
+// directory, with forward slashes.
+type previewImage struct {
+	Path    string
+	Name    string
+	Class   string
+	modTime time.Time
+}
+
+// previewPage is what the gallery template shows.
+type previewPage struct {
+	Keyword string
+	Refresh int
+	Total   int
+	Images  []previewImage
+
+	// Counts are the image statuses of the crawl state when last saved,
+	// and Updated when that was; nil without a state.
+	Counts  map[string]int
+	Updated string
+}
+
+var previewTemplate = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>{{with .Keyword}}{{.}} - {{end}}dataset preview</title>
+<style>
+body { font-family: sans-serif; margin: 1em; background: #f4f4f4; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(180px, 1fr)); gap: 8px; }
+figure { margin: 0; background: #fff; padding: 4px; }
+img { width: 100%; height: 160px; object-fit: contain; }
+figcaption { font-size: 11px; overflow: hidden; text-overflow: ellipsis; white-space: nowrap; }
+</style>
+</head>
+<body>
+<h1>{{with .Keyword}}{{.}}: {{end}}{{.Total}} image(s)</h1>
+<p>
+{{if gt .Total (len .Images)}}Showing the newest {{len .Images}}. {{end}}
+{{with .Counts}}Crawl state as of {{$.Updated}}: {{index . "downloaded"}} downloaded, {{index . "pending"}} pending, {{index . "failed"}} failed, {{index . "filtered"}} filtered, {{index . "duplicate"}} duplicate.{{end}}
+Reloads every {{.Refresh}}s.
+</p>
+<div class="grid">
+{{range .Images}}<figure><a href="/image/{{.Path}}"><img src="/image/{{.Path}}" loading="lazy" alt="{{.Name}}"></a><figcaption title="{{.Path}}">{{with .Class}}{{.}}/{{end}}{{.Name}}</figcaption></figure>
+{{end}}</div>
+</body>
+</html>
+`))
+
+// previewImages returns the images stored in outputDir, newest first.
+// Hidden files and directories, partial downloads, and the directories
+// rejected images are moved to are left out.
+func previewImages(outputDir string) ([]previewImage, error) {
+	var images []previewImage
+	err := filepath.WalkDir(outputDir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if file == outputDir {
+				return err
+			}
+			return nil
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if file != outputDir && (strings.HasPrefix(name, ".") || name == nsfwDirName || name == quarantineDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || strings.HasSuffix(name, partFileSuffix) || !hasImageExtension(name) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(outputDir, file)
+		if err != nil {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		class := path.Dir(rel)
+		if class == "." {
+			class = ""
+		}
+		images = append(images, previewImage{Path: rel, Name: name, Class: class, modTime: info.ModTime()})
+		return nil
+	})
+	slices.SortFunc(images, func(a, b previewImage) int {
+		return b.modTime.Compare(a.modTime)
+	})
+	return images, err
+}
+
+// previewServer serves the gallery of an output directory and its images.
+type previewServer struct {
+	outputDir string
+	images    http.Handler
+}
+
+func newPreviewServer(outputDir string) *previewServer {
+	return &previewServer{
+		outputDir: outputDir,
+		images:    http.StripPrefix("/image/", http.FileServer(http.Dir(outputDir))),
+	}
+}
+
+func (p *previewServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if imagePath, ok := strings.CutPrefix(r.URL.Path, "/image/"); ok {
+		// Only images are served, not the state or other files beside them.
+		if !hasImageExtension(imagePath) || strings.Contains("/"+imagePath, "/.") {
+			http.NotFound(w, r)
+			return
+		}
+		p.images.ServeHTTP(w, r)
+		return
+	}
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	images, err := previewImages(p.outputDir)
+	if err != nil && len(images) == 0 {
+		http.Error(w, "failed to list images: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	page := previewPage{Refresh: previewRefreshSeconds, Total: len(images), Images: images}
+	if len(images) > previewLimit {
+		page.Images = images[:previewLimit]
+	}
+	if state, err := loadState(p.outputDir); err == nil {
+		page.Keyword = state.Keyword
+		page.Counts = state.statusCounts()
+		page.Updated = state.UpdatedAt.Local().Format("15:04:05")
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := previewTemplate.Execute(w, page); err != nil {
+		logWarning("Failed to write preview: %v", err)
+	}
+}
+
+// previewURL returns the URL the gallery is reached at on this machine.
+func previewURL(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "http://" + addr
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return "http://" + net.JoinHostPort(host, port)
+}
+
+// servePreview serves the gallery of outputDir on addr until interrupted.
+func servePreview(outputDir, addr string) error {
+	if info, err := os.Stat(outputDir); err != nil || !info.IsDir() {
+		return errors.New("output directory does not exist: " + outputDir)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	logInfo("Serving a preview of %s at %s (Ctrl+C to stop)", outputDir, previewURL(listener.Addr().String()))
+	return http.Serve(listener, newPreviewServer(outputDir))
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxProbeTimeout caps the per-host reachability probe, so a long -timeout
+// meant for slow pages does not also delay startup.
+const maxProbeTimeout = 10 * time.Second
+
+// probeSeedHosts resolves and connects to every distinct seed host
+// concurrently, completing a TLS handshake for https. It returns the probe
+// error for each unreachable host, keyed by host:port. Hosts reached through
+// a proxy are not probed, since the proxy decides reachability. Hosts pinned
+// with -resolve are probed at their pinned address.
+func probeSeedHosts(seeds []string, timeout time.Duration, overrides resolveOverrides) map[string]error {
+	if timeout <= 0 || timeout > maxProbeTimeout {
+		timeout = maxProbeTimeout
+	}
+
+	targets := make(map[string]string)
+	for _, seed := range seeds {
+		if address, scheme := probeAddress(seed); address != "" {
+			targets[address] = scheme
+		}
+	}
+
+	var (
+		mu          sync.Mutex
+		wg          sync.WaitGroup
+		unreachable = make(map[string]error)
+	)
+	for address, scheme := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := probeHost(address, scheme, timeout, overrides); err != nil {
+				mu.Lock()
+				unreachable[address] = err
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return unreachable
+}
+
+// probeAddress returns the host:port a seed connects to and its scheme, or
+// an empty address for seeds that need no network or go through a proxy.
+func probeAddress(seed string) (string, string) {
+	u, err := url.Parse(seed)
+	if err != nil || u.Hostname() == "" {
+		return "", ""
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	switch scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	case "ftp":
+		if port == "" {
+			port = "21"
+		}
+	default:
+		return "", ""
+	}
+
+	if scheme == "http" || scheme == "https" {
+		if proxy, err := http.ProxyFromEnvironment(&http.Request{URL: u}); err != nil || proxy != nil {
+			return "", ""
+		}
+	}
+
+	return net.JoinHostPort(u.Hostname(), port), scheme
+}
+
+func probeHost(address, scheme string, timeout time.Duration, overrides resolveOverrides) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	host, port, _ := net.SplitHostPort(address)
+	dialAddress := address
+	if pinned, ok := overrides.lookup(host, port); ok {
+		dialAddress = net.JoinHostPort(pinned, port)
+	} else if net.ParseIP(host) == nil {
+		if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
+			return fmt.Errorf("DNS lookup failed: %w", err)
+		}
+	}
+
+	dialer := &net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", dialAddress)
+	if err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	if scheme == "https" {
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// reachableSeeds probes the seed hosts, reports the unreachable ones, and
+// returns the seeds that can still be crawled.
+func (c *Crawler) reachableSeeds(seeds []string) []string {
+	logVerbose(c.config, "Probing seed hosts...")
+	unreachable := probeSeedHosts(seeds, c.config.Timeout, c.config.resolve)
+	if len(unreachable) == 0 {
+		return seeds
+	}
+
+	addresses := make([]string, 0, len(unreachable))
+	for address := range unreachable {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	for _, address := range addresses {
+		logWarning("Seed host %s is unreachable: %v", address, unreachable[address])
+	}
+
+	kept := seeds[:0:0]
+	for _, seed := range seeds {
+		if address, _ := probeAddress(seed); address != "" {
+			if _, down := unreachable[address]; down {
+				continue
+			}
+		}
+		kept = append(kept, seed)
+	}
+
+	if skipped := len(seeds) - len(kept); skipped > 0 {
+		logWarning("Skipping %d seed(s) on unreachable hosts", skipped)
+	}
+	return kept
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// providerNames are the image search APIs that can be queried instead of
+// crawling HTML with -provider.
+var providerNames = []string{"unsplash", "pexels", "pixabay", "openverse"}
+
+// Attribution credits the author of an image found through a provider API,
+// so datasets built from it can meet the license terms.
+type Attribution struct {
+	Author     string `json:"author,omitempty"`
+	AuthorURL  string `json:"author_url,omitempty"`
+	Page       string `json:"page,omitempty"`
+	License    string `json:"license,omitempty"`
+	LicenseURL string `json:"license_url,omitempty"`
+}
+
+// providerImage is one search result: the URL of the full-resolution file,
+// who to credit for it, and the tags the API gives it, if any.
+type providerImage struct {
+	URL         string
+	Attribution Attribution
+	Tags        []string
+}
+
+// imageProvider searches an image API page by page.
+type imageProvider interface {
+	// searchPage returns the results on the given page, counting from 1, and
+	// whether more pages follow it.
+	searchPage(keyword string, page int) ([]providerImage, bool, error)
+}
+
+// newProvider returns the provider selected with -provider.
+func newProvider(cfg *Config) imageProvider {
+	client := &http.Client{
+		Timeout:   cfg.Timeout,
+		Transport: newCrawlerTransport(cfg),
+	}
+
+	switch cfg.Provider {
+	case "unsplash":
+		return &unsplashProvider{client: client, key: cfg.UnsplashKey, userAgent: cfg.UserAgent}
+	case "pexels":
+		return &pexelsProvider{client: client, key: cfg.PexelsKey, userAgent: cfg.UserAgent}
+	case "pixabay":
+		return &pixabayProvider{
+			client:      client,
+			key:         cfg.PixabayKey,
+			userAgent:   cfg.UserAgent,
+			imageType:   pixabayImageType(cfg),
+			orientation: cfg.PixabayOrientation,
+			minWidth:    cfg.MinWidth,
+			minHeight:   cfg.MinHeight,
+		}
+	case "openverse":
+		return &openverseProvider{client: client, token: cfg.OpenverseToken, userAgent: cfg.UserAgent}
+	default:
+		return nil
+	}
+}
+
+// providerSource searches the image API selected with -provider. Each
+// results page counts against -max-pages, and state records the last page
+// fetched so the resume command picks up after it.
+type providerSource struct{}
+
+func (providerSource) name() string { return "provider" }
+
+func (providerSource) discover(cfg *Config, state *CrawlState, stream chan<- string) error {
+	provider := newProvider(cfg)
+	state.CrawlDone = false
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	logInfo("Searching the %s API for %q", cfg.Provider, cfg.Keyword)
+
+	found := 0
+search:
+	for page := state.PagesCrawled + 1; page <= cfg.MaxPages; page++ {
+		images, more, err := provider.searchPage(cfg.Keyword, page)
+		if err != nil {
+			return fmt.Errorf("%s search failed on page %d: %w", cfg.Provider, page, err)
+		}
+
+		images = licensedProviderImages(cfg, images)
+		if cfg.MaxImages > 0 {
+			images = images[:min(len(images), max(0, cfg.MaxImages-len(state.Images)))]
+		}
+		for _, imageURL := range state.addProviderImages(images) {
+			found++
+			if stream != nil {
+				stream <- imageURL
+			}
+		}
+		state.PagesCrawled = page
+		logVerbose(cfg, "Page %d: %d result(s)", page, len(images))
+
+		if !more {
+			state.CrawlDone = true
+			break
+		}
+		if page == cfg.MaxPages {
+			break
+		}
+		if cfg.pastDeadline() {
+			logInfo("Time budget of %s used, stopping the search (-max-duration)", cfg.MaxDuration)
+			break
+		}
+		if cfg.MaxImages > 0 && len(state.Images) >= cfg.MaxImages {
+			logInfo("Found %d image(s), stopping the search (-max-images)", cfg.MaxImages)
+			break
+		}
+
+		select {
+		case <-interrupts:
+			fmt.Println("\n\nInterrupt received, stopping the search")
+			break search
+		case <-time.After(time.Duration(cfg.RateLimitMs) * time.Millisecond):
+		}
+	}
+
+	logSuccess("Found %d new image(s) on %d page(s) of %s results", found, state.PagesCrawled, cfg.Provider)
+	if !state.CrawlDone {
+		logInfo("More results are available; raise -max-pages and run the resume command to fetch them")
+	}
+	return nil
+}
+
+// getProviderJSON sends req and decodes a successful JSON response into v.
+// Error responses are reported with the message the API returned, which
+// errorMessage extracts from the body.
+func getProviderJSON(client *http.Client, req *http.Request, v any, errorMessage func([]byte) string) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 16<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		message := strings.TrimSpace(errorMessage(body))
+		if message == "" {
+			message = http.StatusText(resp.StatusCode)
+		}
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, message)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("unexpected response: %w", err)
+	}
+	return nil
+}
+
+// attributionSidecarSuffix is appended to an image file name to name the
+// file that credits its author, next to the image.
+const attributionSidecarSuffix = ".json"
+
+// attributionSidecar is the content of the file written next to each image
+// downloaded through a provider.
+type attributionSidecar struct {
+	URL         string       `json:"url"`
+	File        string       `json:"file"`
+	Attribution *Attribution `json:"attribution"`
+}
+
+// writeAttributionSidecars writes the attribution of each image downloaded in
+// results to a sidecar file next to it, so the credit travels with the image
+// when it is copied out of the dataset.
+func writeAttributionSidecars(outputDir string, state *CrawlState, results map[string]downloadOutcome) error {
+	for _, record := range state.Images {
+		if record.Attribution == nil || record.Status != imageStatusDownloaded || record.File == "" {
+			continue
+		}
+		if outcome, ok := results[record.URL]; !ok || outcome.Result != downloadSuccess {
+			continue
+		}
+
+		data, err := json.MarshalIndent(attributionSidecar{URL: record.URL, File: record.File, Attribution: record.Attribution}, "", "  ")
+		if err != nil {
+			return err
+		}
+		path := filepath.Join(outputDir, record.File+attributionSidecarSuffix)
+		if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("failed to write attribution for %s: %w", record.File, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+)
+
+// proxySchemes are the proxy URL schemes net/http and curl both support.
+var proxySchemes = []string{"http", "https", "socks5", "socks5h"}
+
+// proxyPool hands out the configured proxies, either always the first one
+// or round-robin per request when rotation is enabled.
+type proxyPool struct {
+	proxies []*url.URL
+	rotate  bool
+	next    atomic.Uint64
+}
+
+// loadProxies builds the proxy pool from -proxy and -proxy-file. It returns
+// nil when no proxy is configured.
+func loadProxies(cfg *Config) (*proxyPool, error) {
+	var raw []string
+	raw = append(raw, splitCSV(cfg.Proxy)...)
+
+	if cfg.ProxyFile != "" {
+		file, err := os.Open(cfg.ProxyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read proxy file: %w", err)
+		}
+		defer file.Close()
+
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				raw = append(raw, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read proxy file: %w", err)
+		}
+	}
+
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	pool := &proxyPool{rotate: cfg.RotateProxies}
+	for _, value := range raw {
+		proxyURL, err := parseProxyURL(value)
+		if err != nil {
+			return nil, err
+		}
+		pool.proxies = append(pool.proxies, proxyURL)
+	}
+	return pool, nil
+}
+
+// parseProxyURL parses a proxy address, defaulting to http:// when no scheme
+// is given as curl does.
+func parseProxyURL(value string) (*url.URL, error) {
+	if !strings.Contains(value, "://") {
+		value = "http://" + value
+	}
+
+	proxyURL, err := url.Parse(value)
+	if err != nil || proxyURL.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %q", value)
+	}
+
+	if slices.Contains(proxySchemes, strings.ToLower(proxyURL.Scheme)) {
+		return proxyURL, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q in %s (use %s)", proxyURL.Scheme, proxyURL.Redacted(), strings.Join(proxySchemes, ", "))
+}
+
+// pick returns the proxy for the next request.
+func (p *proxyPool) pick() *url.URL {
+	if p == nil || len(p.proxies) == 0 {
+		return nil
+	}
+	if !p.rotate {
+		return p.proxies[0]
+	}
+	return p.proxies[(p.next.Add(1)-1)%uint64(len(p.proxies))]
+}
+
+// transportProxy is an http.Transport Proxy function. Local files never go
+// through a proxy. Without configured proxies the environment is used.
+func (p *proxyPool) transportProxy(req *http.Request) (*url.URL, error) {
+	if req.URL.Scheme == "file" {
+		return nil, nil
+	}
+	if p == nil {
+		return http.ProxyFromEnvironment(req)
+	}
+	return p.pick(), nil
+}
+
+// socks reports whether any proxy in the pool is a SOCKS proxy.
+func (p *proxyPool) socks() bool {
+	if p == nil {
+		return false
+	}
+	for _, proxyURL := range p.proxies {
+		if strings.HasPrefix(strings.ToLower(proxyURL.Scheme), "socks") {
+			return true
+		}
+	}
+	return false
+}
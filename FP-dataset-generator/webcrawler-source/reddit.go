@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// redditListingLimit is the number of posts asked for per listing page, the
+// most Reddit returns.
+const redditListingLimit = "100"
+
+type redditListing struct {
+	Data struct {
+		After    string `json:"after"`
+		Children []struct {
+			Data redditPost `json:"data"`
+		} `json:"children"`
+	} `json:"data"`
+}
+
+type redditPost struct {
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	GalleryData *struct {
+		Items []struct {
+			MediaID string `json:"media_id"`
+		} `json:"items"`
+	} `json:"gallery_data"`
+	MediaMetadata map[string]struct {
+		Status string `json:"status"`
+		Mime   string `json:"m"`
+	} `json:"media_metadata"`
+	Preview *struct {
+		Images []struct {
+			Source struct {
+				URL string `json:"url"`
+			} `json:"source"`
+		} `json:"images"`
+	} `json:"preview"`
+	CrosspostParents []redditPost `json:"crosspost_parent_list"`
+}
+
+// redditSite searches Reddit. Reddit renders its HTML with JavaScript, so
+// reddit.com pages are fetched from the JSON listing endpoint behind them
+// instead: the same path with .json appended.
+type redditSite struct{}
+
+func (redditSite) Name() string { return "reddit" }
+
+// Seeds returns the search page for the keyword, restricted to -subreddits
+// when there are any.
+func (redditSite) Seeds(cfg *Config, keywordEscaped string) []string {
+	if len(cfg.Subreddits) == 0 {
+		return []string{fmt.Sprintf("https://www.reddit.com/search/?q=%s&type=link", keywordEscaped)}
+	}
+	return []string{fmt.Sprintf("https://www.reddit.com/r/%s/search/?q=%s&restrict_sr=1&type=link", strings.Join(cfg.Subreddits, "+"), keywordEscaped)}
+}
+
+func (redditSite) Matches(pageURL string) bool { return hostMatches(pageURL, "reddit.com") }
+
+// RequestURL returns the JSON endpoint of a reddit.com page, asking for
+// unescaped URLs and as many posts as a page holds.
+func (redditSite) RequestURL(pageURL string) string {
+	u, err := url.Parse(pageURL)
+	if err != nil {
+		return pageURL
+	}
+	if !strings.HasSuffix(u.Path, ".json") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + ".json"
+	}
+	query := u.Query()
+	query.Set("raw_json", "1")
+	if query.Get("limit") == "" {
+		query.Set("limit", redditListingLimit)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (redditSite) Accept() string { return "application/json" }
+
+// ExtractImages records the images posted in a Reddit JSON listing. A
+// comment page answers with the post's listing followed by the comments;
+// only the first is used. Search results already match the keyword, so
+// their images are kept whatever their URL; other listings are matched
+// against the post titles.
+func (redditSite) ExtractImages(c *Crawler, page *sitePage) error {
+	if page.body == nil {
+		return errNotSitePage
+	}
+	data, err := io.ReadAll(page.body)
+	if err != nil {
+		return err
+	}
+
+	var listing redditListing
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var listings []redditListing
+		if err := json.Unmarshal(trimmed, &listings); err != nil {
+			return fmt.Errorf("invalid reddit listing: %w", err)
+		}
+		if len(listings) == 0 {
+			return nil
+		}
+		listing = listings[0]
+	} else if err := json.Unmarshal(trimmed, &listing); err != nil {
+		return fmt.Errorf("invalid reddit listing: %w", err)
+	}
+
+	search := classifyPage(page.task.URL) == pageTypeSearch
+	for _, child := range listing.Data.Children {
+		post := child.Data
+		for _, imageURL := range redditPostImages(post) {
+			if search {
+				c.storeImageURL(imageURL)
+			} else {
+				c.acceptImageURL(imageURL, post.Title)
+			}
+		}
+	}
+	logVerbose(c.config, "Reddit listing with %d post(s): %s", len(listing.Data.Children), page.task.URL)
+
+	page.cursor = listing.Data.After
+	return nil
+}
+
+// NextPage returns the listing after page, which Reddit pages by the name of
+// the last post seen.
+func (redditSite) NextPage(page *sitePage) string {
+	if page.cursor == "" {
+		return ""
+	}
+	next, err := url.Parse(page.task.URL)
+	if err != nil {
+		return ""
+	}
+	query := next.Query()
+	query.Set("after", page.cursor)
+	next.RawQuery = query.Encode()
+	return next.String()
+}
+
+// redditPostImages returns the full-size images of a post: every image of a
+// gallery in order, the linked file of an image post, or else the preview
+// Reddit generated for the link.
+func redditPostImages(post redditPost) []string {
+	if len(post.CrosspostParents) > 0 {
+		if images := redditPostImages(post.CrosspostParents[0]); len(images) > 0 {
+			return images
+		}
+	}
+
+	if post.GalleryData != nil {
+		var images []string
+		for _, item := range post.GalleryData.Items {
+			media, ok := post.MediaMetadata[item.MediaID]
+			if !ok || media.Status != "valid" || !strings.HasPrefix(media.Mime, "image/") {
+				continue
+			}
+			// Gallery originals are served from i.redd.it under the
+			// media ID, with the extension of their type.
+			ext := strings.TrimPrefix(media.Mime, "image/")
+			if ext == "jpeg" {
+				ext = "jpg"
+			}
+			if imageURL := "https://i.redd.it/" + item.MediaID + "." + ext; isImageURL(imageURL) {
+				images = append(images, imageURL)
+			}
+		}
+		return images
+	}
+
+	if isImageURL(post.URL) {
+		return []string{post.URL}
+	}
+
+	var images []string
+	if post.Preview != nil {
+		for _, preview := range post.Preview.Images {
+			if source := preview.Source.URL; source != "" && isImageURL(source) {
+				images = append(images, source)
+			}
+		}
+	}
+	return images
+}
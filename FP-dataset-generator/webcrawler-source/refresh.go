@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// freshnessReportFileName is the per-image report written by refresh.
+const freshnessReportFileName = "freshness.tsv"
+
+const (
+	freshnessUnchanged = "unchanged"
+	freshnessUpdated   = "updated"
+	freshnessGone      = "gone"
+	freshnessError     = "error"
+	freshnessSkipped   = "skipped"
+)
+
+// freshnessResult is what refreshing one image found.
+type freshnessResult struct {
+	URL    string
+	Result string
+	Detail string
+}
+
+// refreshImages re-validates every downloaded image in state with
+// conditional requests, replacing files whose content changed and flagging
+// URLs that are gone. Records are updated in place.
+func (d *Downloader) refreshImages(state *CrawlState) []freshnessResult {
+	var indexes []int
+	for i, record := range state.Images {
+		if record.Status == imageStatusDownloaded && record.File != "" {
+			indexes = append(indexes, i)
+		}
+	}
+
+	results := make([]freshnessResult, len(indexes))
+	semaphore := make(chan struct{}, d.config.downloadConcurrency())
+	var wg sync.WaitGroup
+
+	d.progressBar = newDownloadProgressBar(len(indexes), true, false)
+	for n, i := range indexes {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			results[n] = d.refreshImage(&state.Images[i])
+			d.progressBar.Add(1)
+		}()
+	}
+	wg.Wait()
+	d.progressBar.Finish()
+
+	return results
+}
+
+// refreshImage checks one downloaded image against its source. The body of
+// a changed image is written next to the old file and only replaces it once
+// it has been validated as an image.
+func (d *Downloader) refreshImage(record *ImageRecord) freshnessResult {
+	result := freshnessResult{URL: record.URL}
+
+	scheme := urlScheme(record.URL)
+	if scheme != "http" && scheme != "https" {
+		result.Result, result.Detail = freshnessSkipped, scheme+" URLs are not refreshed"
+		return result
+	}
+
+	req, err := http.NewRequest(http.MethodGet, record.URL, nil)
+	if err != nil {
+		result.Result, result.Detail = freshnessError, err.Error()
+		return result
+	}
+	req.Header.Set("User-Agent", d.config.UserAgent)
+	req.Header.Set("Referer", record.URL)
+	req.Header.Set("Accept", "image/webp,image/apng,image/*,*/*;q=0.8")
+	if etag := record.Headers["ETag"]; etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if modified := record.Headers["Last-Modified"]; modified != "" {
+		req.Header.Set("If-Modified-Since", modified)
+	}
+
+	resp, err := d.client.Do(req)
+	now := time.Now().UTC()
+	record.CheckedAt = &now
+	if err != nil {
+		record.SourceStatus = 0
+		record.SourceError = err.Error()
+		result.Result, result.Detail = freshnessError, err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	record.SourceStatus = resp.StatusCode
+	record.SourceError = ""
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		result.Result = freshnessUnchanged
+		return result
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		result.Result, result.Detail = freshnessGone, fmt.Sprintf("server returned %d; local copy kept", resp.StatusCode)
+		return result
+	case resp.StatusCode != http.StatusOK:
+		result.Result, result.Detail = freshnessError, fmt.Sprintf("server returned %d", resp.StatusCode)
+		return result
+	}
+
+	partPath := filepath.Join(d.config.OutputDir, record.File) + partFileSuffix
+	sum, err := writeBody(resp.Body, partPath)
+	if err != nil {
+		os.Remove(partPath)
+		result.Result, result.Detail = freshnessError, err.Error()
+		return result
+	}
+
+	headers := make(map[string]string, len(manifestHeaders))
+	for _, name := range manifestHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+
+	if sum == record.SHA256 {
+		// The server ignored the conditional request but nothing changed.
+		os.Remove(partPath)
+		record.Headers = headers
+		result.Result = freshnessUnchanged
+		return result
+	}
+
+	mime, problem := validateImageFile(partPath)
+	if problem != "" {
+		os.Remove(partPath)
+		result.Result, result.Detail = freshnessError, "new content rejected: "+problem
+		return result
+	}
+
+	if format := d.config.conversionFormat(mime); format != "" {
+		converted, err := convertImage(d.config, partPath, mime, format)
+		os.Remove(partPath)
+		if err == nil {
+			sum, err = hashFile(converted)
+		}
+		if err != nil {
+			os.Remove(converted)
+			result.Result, result.Detail = freshnessError, "new content rejected: "+err.Error()
+			return result
+		}
+		partPath = converted
+		if sum == record.SHA256 {
+			os.Remove(partPath)
+			record.Headers = headers
+			result.Result = freshnessUnchanged
+			return result
+		}
+	}
+
+	if err := d.sink.store(partPath, record.File); err != nil {
+		os.Remove(partPath)
+		result.Result, result.Detail = freshnessError, "could not replace file: "+err.Error()
+		return result
+	}
+
+	if d.hashes != nil {
+		if _, _, err := d.hashes.claim(sum, record.File); err != nil {
+			logWarning("%v", err)
+		}
+	}
+
+	record.SHA256 = sum
+	record.Headers = headers
+	result.Result, result.Detail = freshnessUpdated, record.File
+	return result
+}
+
+// writeBody saves body to path and returns the SHA-256 of what was written.
+func writeBody(body io.Reader, path string) (string, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hasher), body); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// writeFreshnessReport saves the refresh results as "<url>\t<result>\t<detail>"
+// lines, sorted by result and URL.
+func writeFreshnessReport(outputDir string, results []freshnessResult) (string, error) {
+	sorted := append([]freshnessResult(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Result != sorted[j].Result {
+			return sorted[i].Result < sorted[j].Result
+		}
+		return sorted[i].URL < sorted[j].URL
+	})
+
+	var b strings.Builder
+	b.WriteString("url\tresult\tdetail\n")
+	for _, result := range sorted {
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", result.URL, result.Result, strings.Join(strings.Fields(result.Detail), " "))
+	}
+
+	path := filepath.Join(outputDir, freshnessReportFileName)
+	if err := os.WriteFile(path, []byte(b.String()), 0644); err != nil {
+		return "", fmt.Errorf("failed to write freshness report: %w", err)
+	}
+	return path, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// resolveOverrides pins hostnames to addresses like curl's --resolve, so a
+// staging mirror can be crawled under the production hostname or broken DNS
+// bypassed. Keys are "host" for every port or "host:port" for one port.
+type resolveOverrides map[string]string
+
+// parseResolveOverrides parses "host:addr" and curl-style "host:port:addr"
+// entries. IPv6 addresses may be given in brackets.
+func parseResolveOverrides(entries []string) (resolveOverrides, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+
+	overrides := make(resolveOverrides, len(entries))
+	for _, entry := range entries {
+		host, rest, ok := strings.Cut(entry, ":")
+		if !ok || host == "" || rest == "" {
+			return nil, fmt.Errorf("invalid -resolve entry %q (use host:address or host:port:address)", entry)
+		}
+
+		key := strings.ToLower(host)
+		if port, addr, ok := strings.Cut(rest, ":"); ok && isPort(port) {
+			key = net.JoinHostPort(key, port)
+			rest = addr
+		}
+
+		addr := strings.TrimSuffix(strings.TrimPrefix(rest, "["), "]")
+		if net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid address in -resolve entry %q", entry)
+		}
+		overrides[key] = addr
+	}
+	return overrides, nil
+}
+
+func isPort(value string) bool {
+	if value == "" || len(value) > 5 {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// lookup returns the pinned address for host and port, if any.
+func (o resolveOverrides) lookup(host, port string) (string, bool) {
+	host = strings.ToLower(host)
+	if addr, ok := o[net.JoinHostPort(host, port)]; ok {
+		return addr, true
+	}
+	addr, ok := o[host]
+	return addr, ok
+}
+
+// dialContext dials through the overrides, connecting to the pinned address
+// while the request keeps its hostname for the Host header and TLS SNI.
+func (o resolveOverrides) dialContext(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			if addr, ok := o.lookup(host, port); ok {
+				address = net.JoinHostPort(addr, port)
+			}
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+}
+
+// curlArgs renders the overrides as curl --resolve options for fetching
+// rawURL. curl pins a host per port, so entries without a port are pinned for
+// the default HTTP and HTTPS ports and the port rawURL uses.
+func (o resolveOverrides) curlArgs(rawURL string) []string {
+	ports := []string{"80", "443"}
+	if u, err := url.Parse(rawURL); err == nil && u.Port() != "" && !slices.Contains(ports, u.Port()) {
+		ports = append(ports, u.Port())
+	}
+
+	var args []string
+	for key, addr := range o {
+		if strings.Contains(addr, ":") {
+			addr = "[" + addr + "]"
+		}
+		if host, port, err := net.SplitHostPort(key); err == nil {
+			args = append(args, "--resolve", host+":"+port+":"+addr)
+			continue
+		}
+		for _, port := range ports {
+			args = append(args, "--resolve", key+":"+port+":"+addr)
+		}
+	}
+	return args
+}
+
+// newOverrideDialer returns the dialer settings http.DefaultTransport uses.
+func newOverrideDialer() *net.Dialer {
+	return &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// resume -resume-downloads continues only the download phase of a run that
+// was interrupted while downloading. Files already in the output directory
+// are checked against the checksums recorded for them before they are
+// trusted, so a damaged or missing file is fetched again and a file stored
+// just before the interruption is not fetched twice.
+
+// loadDownloadState reads the crawl state of cfg's output directory. Without
+// one, it rebuilds the state from the URL list a dry run saved there.
+func loadDownloadState(cfg *Config) (*CrawlState, error) {
+	if cfg.OutputDir != "" {
+		if _, err := os.Stat(statePath(cfg.OutputDir)); os.IsNotExist(err) {
+			list := urlListPath(cfg)
+			if _, err := os.Stat(list); err == nil {
+				state := newCrawlState(cfg)
+				if err := (urlListSource{path: list}).discover(cfg, state, nil); err != nil {
+					return nil, err
+				}
+				state.CrawlDone = true
+				return state, nil
+			}
+		}
+	}
+	return loadStateForConfig(cfg)
+}
+
+// storedImageProblem checks the file at path holds a supported image whose
+// SHA-256 is expected, when that is known. It returns the file's SHA-256,
+// and a description of what is wrong with it, if anything.
+func storedImageProblem(path, expected string) (string, string) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", "file is missing"
+	}
+	if _, problem := validateImageFile(path); problem != "" {
+		return "", problem
+	}
+	sum, err := hashFile(path)
+	if err != nil {
+		return "", "could not read file: " + err.Error()
+	}
+	if expected != "" && sum != expected {
+		return sum, "checksum does not match " + expected
+	}
+	return sum, ""
+}
+
+// verifyDownloads checks the files of the images in state against their
+// recorded checksums, or those in the hash index. Downloaded images whose
+// file is missing or damaged become pending again, and pending images whose
+// file was stored intact become downloaded. Leftover .part files of
+// interrupted downloads are removed.
+func (s *CrawlState) verifyDownloads(cfg *Config) (verified, requeued, recovered int) {
+	indexed := make(map[string]string)
+	if hashes, err := loadHashIndex(cfg.OutputDir); err == nil {
+		for sum, file := range hashes.byHash {
+			indexed[file] = sum
+		}
+	}
+
+	for i := range s.Images {
+		record := &s.Images[i]
+		switch record.Status {
+		case imageStatusDownloaded:
+			file := record.File
+			if file == "" {
+				file = extractFilenameFromURL(record.URL)
+			}
+			expected := record.SHA256
+			if expected == "" {
+				expected = indexed[file]
+			}
+			path := filepath.Join(cfg.OutputDir, file)
+			sum, problem := storedImageProblem(path, expected)
+			if problem != "" {
+				logVerbose(cfg, "Downloading %s again: %s", file, problem)
+				os.Remove(path)
+				record.Status, record.File, record.SHA256, record.Error = imageStatusPending, "", "", ""
+				requeued++
+				continue
+			}
+			record.File, record.SHA256 = file, sum
+			verified++
+
+		case imageStatusPending, imageStatusFailed:
+			file := cfg.convertedFileName(extractFilenameFromURL(record.URL))
+			path := filepath.Join(cfg.OutputDir, file)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			sum, problem := storedImageProblem(path, indexed[file])
+			if problem != "" {
+				logVerbose(cfg, "Removing %s: %s", file, problem)
+				os.Remove(path)
+				continue
+			}
+			record.Status, record.File, record.SHA256, record.Error = imageStatusDownloaded, file, sum, ""
+			recovered++
+		}
+	}
+
+	parts, _ := filepath.Glob(filepath.Join(cfg.OutputDir, "*"+partFileSuffix))
+	for _, part := range parts {
+		os.Remove(part)
+	}
+	return verified, requeued, recovered
+}
+
+// resumeDownloads verifies the images an interrupted run downloaded and
+// downloads the rest, without crawling.
+func resumeDownloads(cfg *Config, state *CrawlState) error {
+	requeueRelaxedFilters(cfg, state)
+
+	if err := writeCrawlInfo(cfg); err != nil {
+		return err
+	}
+	if err := prepareDownloader(cfg); err != nil {
+		return err
+	}
+	fmt.Println()
+
+	if !state.CrawlDone {
+		logWarning("The crawl did not finish; downloading the %d image(s) it found. Run resume without -resume-downloads to crawl further.", len(state.Images))
+	}
+
+	verified, requeued, recovered := state.verifyDownloads(cfg)
+	logInfo("Verified %d downloaded image(s); %d damaged or missing will be downloaded again", verified+recovered, requeued)
+	if recovered > 0 {
+		logInfo("%d image(s) stored before the interruption were recorded as downloaded", recovered)
+	}
+	if err := saveState(cfg.OutputDir, state); err != nil {
+		return err
+	}
+
+	if err := downloadPhase(cfg, state); err != nil {
+		return err
+	}
+
+	fmt.Println("\n✓ Resume completed successfully!")
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/temoto/robotstxt"
+)
+
+// robotsOverrides replace the robots.txt of the sites a user owns or has
+// permission to crawl with their own rules, keyed by domain. A domain's
+// rules cover its subdomains too; the most specific domain wins.
+type robotsOverrides map[string]*robotstxt.Group
+
+// parseRobotsOverrides reads an overrides file: [domain] sections holding
+// robots.txt Allow and Disallow rules, as in
+//
+//	# My own gallery, crawled in full.
+//	[photos.example.com]
+//	Allow: /
+//
+//	[example.org]
+//	Disallow: /private/
+//
+// A section without rules allows everything.
+func parseRobotsOverrides(text string) (robotsOverrides, error) {
+	bodies := make(map[string]*strings.Builder)
+	var current *strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			domains := normalizeDomains([]string{strings.Trim(line, "[]")})
+			if len(domains) == 0 {
+				return nil, fmt.Errorf("line %d: no domain in %s", i+1, line)
+			}
+			current = &strings.Builder{}
+			bodies[domains[0]] = current
+			continue
+		}
+
+		field, _, _ := strings.Cut(line, ":")
+		field = strings.ToLower(strings.TrimSpace(field))
+		switch {
+		case current == nil:
+			return nil, fmt.Errorf("line %d: rule outside a [domain] section", i+1)
+		case field != "allow" && field != "disallow":
+			return nil, fmt.Errorf("line %d: expected Allow or Disallow, got %s", i+1, line)
+		}
+		current.WriteString(line + "\n")
+	}
+
+	overrides := make(robotsOverrides, len(bodies))
+	for domain, body := range bodies {
+		data, err := robotstxt.FromString("User-agent: *\n" + body.String())
+		if err != nil {
+			return nil, fmt.Errorf("[%s]: %w", domain, err)
+		}
+		overrides[domain] = data.FindGroup("*")
+	}
+	return overrides, nil
+}
+
+// lookup returns the rules for host, or nil when its own robots.txt applies.
+func (o robotsOverrides) lookup(host string) *robotstxt.Group {
+	host = strings.ToLower(host)
+	for host != "" {
+		if group, ok := o[host]; ok {
+			return group
+		}
+		_, parent, found := strings.Cut(host, ".")
+		if !found {
+			break
+		}
+		host = parent
+	}
+	return nil
+}
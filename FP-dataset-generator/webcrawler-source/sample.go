@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// The sample command picks a random subset of the downloaded images of a
+// crawl for a pilot dataset or a manual QA pass. The subset is stratified:
+// each host, label, or resolution bucket gets a share of it in proportion
+// to its share of the crawl, so a large site or class does not crowd the
+// others out.
+
+// sampleStrata are the properties -stratify-by accepts.
+var sampleStrata = []string{"host", "label", "resolution-bucket"}
+
+// sampleItem is a downloaded image that can be sampled, and the file it is
+// stored in.
+type sampleItem struct {
+	entry manifestEntry
+	file  string
+}
+
+// resolutionBucket names the size class of a width x height image.
+func resolutionBucket(width, height int) string {
+	pixels := width * height
+	switch {
+	case pixels == 0:
+		return "unknown"
+	case pixels < 500*500:
+		return "small"
+	case pixels < 1000*1000:
+		return "medium"
+	case pixels < 2000*2000:
+		return "large"
+	default:
+		return "xlarge"
+	}
+}
+
+// stratum returns the stratum of an image when sampling by the given
+// property.
+func (item sampleItem) stratum(by string) string {
+	switch by {
+	case "host":
+		if u, err := url.Parse(documentURL(item.entry.URL)); err == nil && u.Hostname() != "" {
+			return strings.ToLower(u.Hostname())
+		}
+		return "unknown"
+	case "label":
+		return item.entry.Label
+	default:
+		return resolutionBucket(item.entry.Width, item.entry.Height)
+	}
+}
+
+// stratifiedSample picks n of items at random, giving each stratum a share
+// of n proportional to its size, rounded by largest remainder. The sample
+// lists the strata in order.
+func stratifiedSample(items []sampleItem, n int, by string, rng *rand.Rand) []sampleItem {
+	strata := make(map[string][]sampleItem)
+	for _, item := range items {
+		key := item.stratum(by)
+		strata[key] = append(strata[key], item)
+	}
+	keys := make([]string, 0, len(strata))
+	for key := range strata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	n = min(n, len(items))
+	quotas := make(map[string]int, len(keys))
+	remainders := make(map[string]int, len(keys))
+	assigned := 0
+	for _, key := range keys {
+		share := n * len(strata[key])
+		quotas[key] = share / len(items)
+		remainders[key] = share % len(items)
+		assigned += quotas[key]
+	}
+	byRemainder := slices.Clone(keys)
+	sort.SliceStable(byRemainder, func(i, j int) bool { return remainders[byRemainder[i]] > remainders[byRemainder[j]] })
+	for _, key := range byRemainder[:n-assigned] {
+		quotas[key]++
+	}
+
+	var sample []sampleItem
+	for _, key := range keys {
+		stratum := strata[key]
+		rng.Shuffle(len(stratum), func(i, j int) { stratum[i], stratum[j] = stratum[j], stratum[i] })
+		sample = append(sample, stratum[:quotas[key]]...)
+	}
+	return sample
+}
+
+// sampleItems returns the downloaded images of every class of the dataset,
+// with their paths relative to the dataset directory.
+func sampleItems(cfg *Config) ([]sampleItem, error) {
+	classes, err := datasetClasses(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []sampleItem
+	for _, class := range classes {
+		state, err := loadState(class.outputDir)
+		if err != nil {
+			return nil, fmt.Errorf("class %s: %w", class.name, err)
+		}
+		entries, _ := storedEntries(class.outputDir, state)
+		for _, entry := range entries {
+			file := filepath.Join(class.outputDir, filepath.FromSlash(entry.Path))
+			entry.Path = filepath.ToSlash(filepath.Join(class.prefix, entry.Path))
+			if entry.Label == "" {
+				entry.Label = class.name
+			}
+			items = append(items, sampleItem{entry: entry, file: file})
+		}
+	}
+	return items, nil
+}
+
+// copyFile copies the file at src to dst, creating dst's directory.
+func copyFile(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// sampleCommand writes a stratified random sample of the downloaded images
+// as a manifest, and copies them into a directory with -copy-to.
+func sampleCommand(args []string) error {
+	var (
+		size       = 100
+		stratifyBy = "label"
+		seed       uint64
+		outPath    = "-"
+		copyTo     string
+	)
+	cfg := parseFlags("sample", args, func(fs *flag.FlagSet) {
+		fs.IntVar(&size, "n", size, "Number of images to sample")
+		fs.StringVar(&stratifyBy, "stratify-by", stratifyBy, "Sample each host, label, or resolution-bucket in proportion to its share")
+		fs.Uint64Var(&seed, "seed", seed, "Random seed, to draw the same sample again (default: random)")
+		fs.StringVar(&outPath, "out", outPath, "Manifest of the sample to write, as CSV if it ends in .csv (- for stdout)")
+		fs.StringVar(&copyTo, "copy-to", copyTo, "Directory to copy the sampled images into, by class")
+	})
+
+	stratifyBy = strings.ToLower(strings.TrimSpace(stratifyBy))
+	if !slices.Contains(sampleStrata, stratifyBy) {
+		return configError(fmt.Errorf("stratify-by must be one of: %s", strings.Join(sampleStrata, ", ")))
+	}
+	if size < 1 {
+		return configError(fmt.Errorf("n must be at least 1"))
+	}
+
+	items, err := sampleItems(cfg)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return fmt.Errorf("no downloaded images to sample in %s", cfg.OutputDir)
+	}
+
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+	sample := stratifiedSample(items, size, stratifyBy, rand.New(rand.NewPCG(seed, seed)))
+
+	entries := make([]manifestEntry, len(sample))
+	for i, item := range sample {
+		entries[i] = item.entry
+		if copyTo != "" {
+			if err := copyFile(item.file, filepath.Join(copyTo, filepath.FromSlash(item.entry.Path))); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", item.entry.Path, err)
+			}
+		}
+	}
+
+	format := "jsonl"
+	if strings.EqualFold(filepath.Ext(outPath), ".csv") {
+		format = "csv"
+	}
+	var buf bytes.Buffer
+	if err := encodeManifest(&buf, format, entries); err != nil {
+		return err
+	}
+	summary := fmt.Sprintf("Sampled %d of %d image(s) by %s (seed %d)", len(sample), len(items), stratifyBy, seed)
+	if outPath == "-" || outPath == "" {
+		// The manifest goes to stdout, so the summary goes to stderr.
+		if _, err := os.Stdout.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, summary)
+		return nil
+	}
+	if err := os.WriteFile(outPath, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPath, err)
+	}
+	logSuccess("%s to %s", summary, outPath)
+	if copyTo != "" {
+		logSuccess("Copied the sample to %s", copyTo)
+	}
+	return nil
+}
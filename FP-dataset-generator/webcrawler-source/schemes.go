@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// seedSchemes are the URL schemes accepted for seeds. http(s) pages are
+// crawled, file:// points at locally saved pages or directories, and ftp://
+// at images or directories on legacy archives.
+var seedSchemes = []string{"http", "https", "file", "ftp"}
+
+// toSeedURL turns a local path into a file:// URL and leaves everything else
+// untouched, so saved pages can be passed as plain paths.
+func toSeedURL(raw string) string {
+	if hasSeedScheme(raw) {
+		return raw
+	}
+
+	if _, err := os.Stat(raw); err != nil {
+		return raw
+	}
+
+	absolute, err := filepath.Abs(raw)
+	if err != nil {
+		return raw
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(absolute)}).String()
+}
+
+// hasSeedScheme reports whether raw starts with one of the seedSchemes.
+func hasSeedScheme(raw string) bool {
+	lower := strings.ToLower(raw)
+	for _, scheme := range seedSchemes {
+		if strings.HasPrefix(lower, scheme+"://") {
+			return true
+		}
+	}
+	return false
+}
+
+// urlScheme returns the lower-cased scheme of raw, or an empty string.
+func urlScheme(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
+
+// newCrawlerTransport returns an HTTP transport that also serves file://
+// URLs from the local filesystem, so saved pages go through the same fetch
+// and extraction path as remote ones. Requests use the configured proxies
+// and -resolve overrides, and carry the configured request headers.
+func newCrawlerTransport(cfg *Config) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = cfg.proxies.transportProxy
+	if cfg.resolve != nil {
+		transport.DialContext = cfg.resolve.dialContext(newOverrideDialer())
+	}
+	transport.RegisterProtocol("file", http.NewFileTransport(http.Dir("/")))
+	return headerTransport{base: transport, headers: cfg.requestHeaders()}
+}
+
+// listFTPDirectory returns the absolute URLs of the entries in an FTP
+// directory. net/http has no FTP client, so the listing is delegated to
+// curl, which is already the preferred downloader.
+func listFTPDirectory(dirURL string) ([]string, error) {
+	if !checkCommandExists("curl") {
+		return nil, fmt.Errorf("listing ftp:// directories requires curl")
+	}
+
+	if !strings.HasSuffix(dirURL, "/") {
+		dirURL += "/"
+	}
+
+	output, err := execCommandOutput("curl", "-s", "--list-only", dirURL)
+	if err != nil {
+		return nil, fmt.Errorf("ftp listing failed: %w", err)
+	}
+
+	base, err := url.Parse(dirURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []string
+	for _, line := range strings.Split(output, "\n") {
+		name := strings.TrimSpace(line)
+		if name == "" || name == "." || name == ".." {
+			continue
+		}
+		entries = append(entries, base.ResolveReference(&url.URL{Path: name}).String())
+	}
+	return entries, nil
+}
+
+// copyLocalFile copies the file behind a file:// URL to outputPath. curl can
+// read file:// URLs but wget cannot, so local images never go through the
+// external downloader.
+func copyLocalFile(fileURL, outputPath string) error {
+	u, err := url.Parse(fileURL)
+	if err != nil {
+		return err
+	}
+
+	src, err := os.Open(filepath.FromSlash(u.Path))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(outputPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math"
+	"net/url"
+	"path"
+)
+
+// Crawled images are weak labels: an image whose file is named after the
+// keyword is more likely to show it than one whose page merely mentions it
+// in the URL. Each image of the manifest gets a relevance score from 0 to 1
+// combining where the keyword matched and where the image came from, so
+// training can weight samples or drop the doubtful ones.
+
+// Where the keyword matched an image, strongest first.
+const (
+	matchFilename = "filename"
+	matchCaption  = "alt/title/caption"
+	matchPath     = "path"
+	matchURL      = "url"
+)
+
+// matchWeights rate how strongly each match location ties an image to the
+// keyword. Images found through a search API were matched by the API.
+var matchWeights = map[string]float64{
+	matchFilename: 1.0,
+	matchCaption:  0.9,
+	matchPath:     0.7,
+	matchURL:      0.5,
+}
+
+// Weights of an image's source, and the share of the score the match gets.
+const (
+	sourceWeightProvider   = 0.9
+	sourceWeightListed     = 0.8
+	sourceWeightFirstParty = 0.8
+	sourceWeightEmbedded   = 0.7
+	sourceWeightThirdParty = 0.5
+	unmatchedWeight        = 0.5
+	matchShare             = 0.6
+)
+
+// strongestMatch returns the strongest place the keyword appears for an
+// image: its filename, its alt, title, or caption text, its path, or
+// elsewhere in its URL. It returns "" when it appears in none.
+func strongestMatch(imageURL, metadata, keyword string) string {
+	u, err := url.Parse(documentURL(imageURL))
+	if err != nil {
+		return ""
+	}
+	urlPath := u.Path
+	if unescaped, err := url.PathUnescape(urlPath); err == nil {
+		urlPath = unescaped
+	}
+
+	switch {
+	case containsKeyword(path.Base(urlPath), keyword):
+		return matchFilename
+	case containsKeyword(metadata, keyword):
+		return matchCaption
+	case containsKeyword(urlPath, keyword):
+		return matchPath
+	case containsKeyword(imageURL, keyword):
+		return matchURL
+	}
+	return ""
+}
+
+// strongerMatch reports whether match ties an image to the keyword more
+// strongly than current.
+func strongerMatch(match, current string) bool {
+	return matchWeights[match] > matchWeights[current]
+}
+
+// sourceWeight rates how likely an image of record's source is to be what
+// its page or search was about.
+func sourceWeight(record ImageRecord) float64 {
+	switch {
+	case record.Attribution != nil:
+		return sourceWeightProvider
+	case urlScheme(record.URL) == pdfImageScheme || urlScheme(record.URL) == dataURIScheme:
+		return sourceWeightEmbedded
+	case record.Party == partyThird:
+		return sourceWeightThirdParty
+	case record.Page == "":
+		return sourceWeightListed
+	default:
+		return sourceWeightFirstParty
+	}
+}
+
+// relevanceScore returns the score of record, rounded to two decimals.
+func relevanceScore(record ImageRecord) float64 {
+	match := unmatchedWeight
+	if weight, ok := matchWeights[record.Match]; ok {
+		match = weight
+	} else if record.Attribution != nil {
+		match = sourceWeightProvider
+	}
+	score := matchShare*match + (1-matchShare)*sourceWeight(record)
+	return math.Round(score*100) / 100
+}
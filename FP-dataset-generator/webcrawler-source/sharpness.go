@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"image"
+
+	"golang.org/x/image/draw"
+)
+
+// sharpnessSize is the longest side images are scaled down to before their
+// sharpness is measured, so the measure does not depend on how large an
+// image is served and stays fast on large photos.
+const sharpnessSize = 1024
+
+// measureSharpness returns the variance of the Laplacian of the image's
+// luma: a few tens for blurry images and upscaled thumbnails, hundreds and
+// more for sharp ones.
+func measureSharpness(imagePath string) (float64, error) {
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return 0, err
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if longest := max(width, height); longest > sharpnessSize {
+		width, height = max(width*sharpnessSize/longest, 1), max(height*sharpnessSize/longest, 1)
+	}
+	if width < 3 || height < 3 {
+		return 0, fmt.Errorf("image too small to measure: %dx%d", width, height)
+	}
+	gray := image.NewGray(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(gray, gray.Bounds(), img, bounds, draw.Src, nil)
+
+	var sum, sumSquares float64
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			i := gray.PixOffset(x, y)
+			laplacian := float64(int(gray.Pix[i-1]) + int(gray.Pix[i+1]) + int(gray.Pix[i-gray.Stride]) +
+				int(gray.Pix[i+gray.Stride]) - 4*int(gray.Pix[i]))
+			sum += laplacian
+			sumSquares += laplacian * laplacian
+		}
+	}
+	n := float64((width - 2) * (height - 2))
+	mean := sum / n
+	return sumSquares/n - mean*mean, nil
+}
+
+// sharpnessFilter rejects images less sharp than -min-sharpness. Images
+// that cannot be measured are kept.
+type sharpnessFilter struct {
+	cfg *Config
+}
+
+func (sharpnessFilter) name() string { return filterSharpness }
+
+func (f sharpnessFilter) check(img *fetchedImage, outcome *downloadOutcome) (downloadResult, string) {
+	if img.mime == "image/svg+xml" {
+		return downloadSuccess, ""
+	}
+	sharpness, err := measureSharpness(img.path)
+	if err != nil {
+		logVerbose(f.cfg, "Could not measure the sharpness of %s, keeping it: %v", img.file, err)
+		return downloadSuccess, ""
+	}
+	outcome.Sharpness = sharpness
+	if sharpness < f.cfg.MinSharpness {
+		return downloadFiltered, fmt.Sprintf("sharpness %.1f below -min-sharpness", sharpness)
+	}
+	return downloadSuccess, ""
+}
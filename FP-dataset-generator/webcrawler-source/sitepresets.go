@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	_ "embed"
+	"fmt"
+	"sort"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+	"gopkg.in/yaml.v3"
+)
+
+// builtinSitePresets holds the presets tuned for the builtin sites.
+//
+//go:embed sitepresets.yaml
+var builtinSitePresets []byte
+
+// SitePreset is how politely a builtin site is crawled and where its images
+// and links are found, so searches of the site work without tuning flags.
+type SitePreset struct {
+	// RateLimitMs is the least pause after each of the site's pages; a
+	// larger -rate-limit still applies.
+	RateLimitMs int `yaml:"rate-limit" toml:"rate-limit"`
+
+	// MaxDepth caps the depth of the site's pages below -max-depth.
+	MaxDepth int `yaml:"max-depth" toml:"max-depth"`
+
+	// UserAgent is sent to sites that turn the default one away. A
+	// -user-agent given by the user is always kept.
+	UserAgent string `yaml:"user-agent" toml:"user-agent"`
+
+	ImageSelector string `yaml:"image-selector" toml:"image-selector"`
+	LinkSelector  string `yaml:"link-selector" toml:"link-selector"`
+
+	// JSONPaths select image URLs in the JSON state the site's pages embed,
+	// as -json-paths does.
+	JSONPaths []string `yaml:"json-paths" toml:"json-paths"`
+
+	// Mirrors lists, by host, the hosts tried in order when that host
+	// rate-limits or fails, as -mirrors does.
+	Mirrors map[string][]string `yaml:"mirrors" toml:"mirrors"`
+}
+
+// loadSitePresets returns the builtin presets with those of the -site-config
+// file, if any, in place of the builtin ones for the sites it lists.
+func loadSitePresets(overridePath string) (map[string]SitePreset, error) {
+	presets := make(map[string]SitePreset)
+	decoder := yaml.NewDecoder(bytes.NewReader(builtinSitePresets))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&presets); err != nil {
+		return nil, fmt.Errorf("invalid builtin site presets: %w", err)
+	}
+
+	if overridePath != "" {
+		overrides := make(map[string]SitePreset)
+		if err := decodeFile(overridePath, "site config", &overrides); err != nil {
+			return nil, err
+		}
+		for name, preset := range overrides {
+			presets[name] = preset
+		}
+	}
+	return presets, nil
+}
+
+// validateSitePresets returns the problems with the presets, in the order
+// of their sites' names.
+func validateSitePresets(presets map[string]SitePreset) []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		preset := presets[name]
+		label := fmt.Sprintf("site config for %q", name)
+		if _, builtin := builtinSiteSet[name]; !builtin {
+			problems = append(problems, label+" does not name a builtin site")
+			continue
+		}
+		if preset.RateLimitMs < 0 {
+			problems = append(problems, label+" has a negative rate-limit")
+		}
+		if preset.MaxDepth < 0 {
+			problems = append(problems, label+" has a negative max-depth")
+		}
+		if preset.ImageSelector != "" {
+			if _, err := cascadia.ParseGroup(preset.ImageSelector); err != nil {
+				problems = append(problems, fmt.Sprintf("%s has an invalid image-selector: %v", label, err))
+			}
+		}
+		if preset.LinkSelector != "" {
+			if _, err := cascadia.ParseGroup(preset.LinkSelector); err != nil {
+				problems = append(problems, fmt.Sprintf("%s has an invalid link-selector: %v", label, err))
+			}
+		}
+		_, pathProblems := parseJSONPaths(preset.JSONPaths)
+		for _, problem := range pathProblems {
+			problems = append(problems, fmt.Sprintf("%s has an invalid json-paths entry: %s", label, problem))
+		}
+	}
+	return problems
+}
+
+// sitePreset returns the preset of the builtin site pageURL belongs to.
+func (c *Crawler) sitePreset(pageURL string) SitePreset {
+	site := c.siteFor(pageURL)
+	if site == nil {
+		return SitePreset{}
+	}
+	return c.config.sitePresets[site.Name()]
+}
+
+// userAgentFor returns the User-Agent sent for pageURL. An identified crawl
+// never hides behind a preset's.
+func (c *Crawler) userAgentFor(pageURL string) string {
+	if c.config.UserAgent == defaultUserAgent && !c.config.Identify {
+		if preset := c.sitePreset(pageURL); preset.UserAgent != "" {
+			return preset.UserAgent
+		}
+	}
+	return c.config.UserAgent
+}
+
+// siteDepthLimit lowers limit, the deepest level a page may be crawled at,
+// to the max-depth preset for the site of pageURL.
+func (c *Crawler) siteDepthLimit(pageURL string, limit int) int {
+	if preset := c.sitePreset(pageURL); preset.MaxDepth > 0 {
+		return min(limit, preset.MaxDepth)
+	}
+	return limit
+}
+
+// selectLinks returns the links matched by selector or inside the elements
+// it matches.
+func selectLinks(doc *goquery.Document, selector string) *goquery.Selection {
+	selected := doc.Find(selector)
+	return selected.Filter("a[href]").AddSelection(selected.Find("a[href]"))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// SiteProvider is a site -sites can name: where a search for the keyword
+// starts and how the site's pages yield images. Builtin sites register
+// themselves with RegisterSite, so a new one only needs its own file; custom
+// sites from the config file are wrapped in customSiteProvider.
+type SiteProvider interface {
+	// Name is how -sites refers to the site.
+	Name() string
+
+	// Seeds returns the pages a search for the escaped keyword starts from.
+	Seeds(cfg *Config, keywordEscaped string) []string
+
+	// Matches reports whether pageURL is one of the site's pages.
+	Matches(pageURL string) bool
+
+	// ExtractImages records the images on a fetched page of the site. It
+	// returns errNotSitePage for content it does not handle, which the
+	// crawler then treats as it would on any other site.
+	ExtractImages(c *Crawler, page *sitePage) error
+
+	// NextPage returns the results page following page, or "" when there is
+	// none or the site's pagination is followed as ordinary links.
+	NextPage(page *sitePage) string
+}
+
+// A SiteProvider may also implement these to change how the crawler treats
+// its pages.
+type (
+	// pageRequester fetches pages from a different URL, such as an API
+	// endpoint behind the page, asking for the content types Accept returns.
+	pageRequester interface {
+		RequestURL(pageURL string) string
+		Accept() string
+	}
+
+	// linkSelector narrows the links followed from the site's pages.
+	linkSelector interface {
+		Links(doc *goquery.Document) *goquery.Selection
+	}
+
+	// siteRateLimiter replaces -rate-limit for the site's pages when it
+	// returns more than zero.
+	siteRateLimiter interface {
+		RateLimitMs() int
+	}
+)
+
+// errNotSitePage is returned by ExtractImages for pages its site does not
+// handle.
+var errNotSitePage = errors.New("not a page of the site")
+
+// sitePage is a fetched page handed to the site it belongs to. doc is set
+// for HTML pages; other content is left unread in body.
+type sitePage struct {
+	task CrawlTask
+	url  string // after redirects
+	doc  *goquery.Document
+	body io.Reader
+
+	// cursor is where ExtractImages keeps what NextPage needs to build the
+	// next page's URL.
+	cursor string
+}
+
+// siteRegistry holds the builtin sites in the order they were registered.
+var siteRegistry []SiteProvider
+
+// RegisterSite adds a builtin site. Registering two sites under one name
+// panics, as it is a programming error.
+func RegisterSite(site SiteProvider) {
+	name := site.Name()
+	if _, exists := builtinSiteSet[name]; exists {
+		panic("site registered twice: " + name)
+	}
+	siteRegistry = append(siteRegistry, site)
+	builtinSites = append(builtinSites, name)
+	builtinSiteSet[name] = struct{}{}
+}
+
+func init() {
+	for _, site := range []SiteProvider{
+		scrapeSite{"wikimedia", "wikimedia.org", "https://commons.wikimedia.org/w/index.php?search=%s&title=Special:MediaSearch&go=Go&type=image"},
+		scrapeSite{"pexels", "pexels.com", "https://www.pexels.com/search/%s/"},
+		scrapeSite{"pixabay", "pixabay.com", "https://pixabay.com/images/search/%s/"},
+		scrapeSite{"freeimages", "freeimages.com", "https://www.freeimages.com/search/%s"},
+		scrapeSite{"unsplash", "unsplash.com", "https://unsplash.com/s/photos/%s"},
+		scrapeSite{"flickr", "flickr.com", "https://www.flickr.com/search/?text=%s&media=photos&license=4,5,6,9,10"},
+		scrapeSite{"deviantart", "deviantart.com", "https://www.deviantart.com/search?q=%s"},
+		scrapeSite{"pinterest", "pinterest.com", "https://www.pinterest.com/search/pins/?q=%s"},
+		scrapeSite{"imgur", "imgur.com", "https://imgur.com/search?q=%s"},
+		redditSite{},
+	} {
+		RegisterSite(site)
+	}
+}
+
+// lookupSite returns the site -sites names as name: a custom site from the
+// config file, or else a builtin one.
+func lookupSite(cfg *Config, name string) SiteProvider {
+	if custom := cfg.customSite(name); custom != nil {
+		return customSiteProvider{custom}
+	}
+	for _, site := range siteRegistry {
+		if site.Name() == name {
+			return site
+		}
+	}
+	return nil
+}
+
+// crawlSites returns the sites whose pages the crawler recognizes: the
+// custom sites selected with -sites, ahead of every builtin site so a custom
+// definition can refine a builtin domain.
+func crawlSites(cfg *Config) []SiteProvider {
+	var sites []SiteProvider
+	for _, name := range cfg.DefaultSites {
+		if custom := cfg.customSite(name); custom != nil {
+			sites = append(sites, customSiteProvider{custom})
+		}
+	}
+	return append(sites, siteRegistry...)
+}
+
+// hostMatches reports whether pageURL is on domain or one of its subdomains.
+func hostMatches(pageURL, domain string) bool {
+	u, err := url.Parse(pageURL)
+	if err != nil || domain == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// scrapeSite is a builtin site crawled as HTML, starting from its search
+// results page.
+type scrapeSite struct {
+	name      string
+	domain    string
+	searchURL string // with %s for the escaped keyword
+}
+
+func (s scrapeSite) Name() string { return s.name }
+
+func (s scrapeSite) Seeds(_ *Config, keywordEscaped string) []string {
+	return []string{fmt.Sprintf(s.searchURL, keywordEscaped)}
+}
+
+func (s scrapeSite) Matches(pageURL string) bool { return hostMatches(pageURL, s.domain) }
+
+func (s scrapeSite) ExtractImages(c *Crawler, page *sitePage) error {
+	if page.doc == nil {
+		return errNotSitePage
+	}
+	if selector := c.config.sitePresets[s.name].ImageSelector; selector != "" && page.doc.Find(selector).Length() > 0 {
+		c.extractSelectedImages(page.doc, page.url, selector)
+	} else {
+		c.extractImages(page.doc, page.url)
+	}
+	return nil
+}
+
+func (s scrapeSite) NextPage(*sitePage) string { return "" }
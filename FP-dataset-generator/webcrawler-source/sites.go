@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// keywordPlaceholder marks where the escaped keyword goes in the search URL
+// of a custom site.
+const keywordPlaceholder = "{keyword}"
+
+// SiteDefinition registers a site that -sites can name besides the builtins.
+// Custom sites are only defined in the config file, under custom-sites.
+type SiteDefinition struct {
+	Name      string `yaml:"name" toml:"name"`
+	SearchURL string `yaml:"search-url" toml:"search-url"`
+
+	// ImageSelector and LinkSelector are CSS selectors that narrow where
+	// images are taken from and which links are followed on the site's
+	// pages. Without them every image and link on a page is considered.
+	ImageSelector string `yaml:"image-selector" toml:"image-selector"`
+	LinkSelector  string `yaml:"link-selector" toml:"link-selector"`
+
+	// RateLimitMs replaces -rate-limit for the site's pages when set.
+	RateLimitMs int `yaml:"rate-limit" toml:"rate-limit"`
+
+	// Mirrors lists, by host, the hosts tried in order when that host
+	// rate-limits or fails, as -mirrors does.
+	Mirrors map[string][]string `yaml:"mirrors" toml:"mirrors"`
+
+	host string
+}
+
+// validateCustomSites checks the custom site definitions, normalizing their
+// names and recording each site's host, and returns the problems found.
+func validateCustomSites(cfg *Config) []string {
+	var problems []string
+	seen := make(map[string]struct{}, len(cfg.CustomSites))
+	for i := range cfg.CustomSites {
+		site := &cfg.CustomSites[i]
+		site.Name = strings.ToLower(strings.TrimSpace(site.Name))
+
+		label := fmt.Sprintf("custom site %q", site.Name)
+		if site.Name == "" {
+			problems = append(problems, fmt.Sprintf("custom site #%d needs a name", i+1))
+			label = fmt.Sprintf("custom site #%d", i+1)
+		} else if _, builtin := builtinSiteSet[site.Name]; builtin {
+			problems = append(problems, label+" has the name of a builtin site")
+		} else if _, duplicate := seen[site.Name]; duplicate {
+			problems = append(problems, label+" is defined more than once")
+		}
+		seen[site.Name] = struct{}{}
+
+		if !strings.Contains(site.SearchURL, keywordPlaceholder) {
+			problems = append(problems, label+" needs a search-url containing "+keywordPlaceholder)
+		} else if u, err := url.Parse(strings.ReplaceAll(site.SearchURL, keywordPlaceholder, "x")); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, label+" needs an http or https search-url")
+		} else {
+			site.host = strings.ToLower(u.Hostname())
+		}
+
+		if site.ImageSelector != "" {
+			if _, err := cascadia.ParseGroup(site.ImageSelector); err != nil {
+				problems = append(problems, fmt.Sprintf("%s has an invalid image-selector: %v", label, err))
+			}
+		}
+		if site.LinkSelector != "" {
+			if _, err := cascadia.ParseGroup(site.LinkSelector); err != nil {
+				problems = append(problems, fmt.Sprintf("%s has an invalid link-selector: %v", label, err))
+			}
+		}
+
+		if site.RateLimitMs < 0 {
+			problems = append(problems, label+" has a negative rate-limit")
+		}
+	}
+	return problems
+}
+
+// customSite returns the custom site definition with the given name.
+func (cfg *Config) customSite(name string) *SiteDefinition {
+	for i := range cfg.CustomSites {
+		if cfg.CustomSites[i].Name == name {
+			return &cfg.CustomSites[i]
+		}
+	}
+	return nil
+}
+
+// customSiteProvider crawls a custom site as HTML, narrowed by its
+// selectors.
+type customSiteProvider struct {
+	*SiteDefinition
+}
+
+func (s customSiteProvider) Name() string { return s.SiteDefinition.Name }
+
+func (s customSiteProvider) Seeds(_ *Config, keywordEscaped string) []string {
+	return []string{strings.ReplaceAll(s.SearchURL, keywordPlaceholder, keywordEscaped)}
+}
+
+func (s customSiteProvider) Matches(pageURL string) bool { return hostMatches(pageURL, s.host) }
+
+func (s customSiteProvider) ExtractImages(c *Crawler, page *sitePage) error {
+	if page.doc == nil {
+		return errNotSitePage
+	}
+	if s.ImageSelector != "" {
+		c.extractSelectedImages(page.doc, page.url, s.ImageSelector)
+	} else {
+		c.extractImages(page.doc, page.url)
+	}
+	return nil
+}
+
+func (s customSiteProvider) NextPage(*sitePage) string { return "" }
+
+// Links returns the links matched by the link selector or inside the
+// elements it matches.
+func (s customSiteProvider) Links(doc *goquery.Document) *goquery.Selection {
+	if s.LinkSelector == "" {
+		return doc.Find("a[href]")
+	}
+	return selectLinks(doc, s.LinkSelector)
+}
+
+func (s customSiteProvider) RateLimitMs() int { return s.SiteDefinition.RateLimitMs }
+
+// extractSelectedImages records the images in the elements matched by a
+// site's image selector: the image elements, links to images, picture
+// sources and CSS backgrounds among them or inside them.
+func (c *Crawler) extractSelectedImages(doc *goquery.Document, baseURL, selector string) {
+	images := c.newPageImages(baseURL)
+	defer images.flush()
+	selected := doc.Find(selector)
+
+	selected.Filter("img").AddSelection(selected.Find("img")).Each(func(_ int, sel *goquery.Selection) {
+		metadata := imageMetadata(sel)
+		for _, candidate := range c.collectImageCandidates(sel) {
+			images.add(candidate, metadata, sel)
+		}
+		c.recordSrcsetVariants(baseURL, sel)
+	})
+
+	selected.Filter("a[href]").AddSelection(selected.Find("a[href]")).Each(func(_ int, sel *goquery.Selection) {
+		if href, exists := sel.Attr("href"); exists {
+			images.add(href, imageMetadata(sel), sel)
+		}
+	})
+
+	selected.Filter("source[srcset]").AddSelection(selected.Find("source[srcset]")).Each(func(_ int, sel *goquery.Selection) {
+		srcset, _ := sel.Attr("srcset")
+		if largest := c.extractLargestFromSrcset(srcset); largest != "" {
+			images.add(largest, imageMetadata(sel.SiblingsFiltered("img")), sel.SiblingsFiltered("img"))
+			c.recordSrcsetVariants(baseURL, sel)
+		}
+	})
+
+	selected.Filter("[style]").AddSelection(selected.Find("[style]")).Each(func(_ int, sel *goquery.Selection) {
+		for _, candidate := range cssImageURLs(sel.AttrOr("style", "")) {
+			images.add(candidate, imageMetadata(sel), sel)
+		}
+	})
+
+	if c.config.VideoPosters {
+		selected.Filter("video[poster]").Each(func(_ int, sel *goquery.Selection) {
+			poster, _ := sel.Attr("poster")
+			images.add(poster, imageMetadata(sel), sel)
+		})
+		c.extractVideoPosters(selected, images, "")
+	}
+
+	c.extractLazyAttributes(selected, images)
+	c.extractJSONState(doc, baseURL, images)
+}
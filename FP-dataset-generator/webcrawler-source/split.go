@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+)
+
+// -split assigns every downloaded image to the train, val, or test split of
+// the dataset, recorded in the crawl state and the manifest. The split of an
+// image is drawn from a hash of its content and -split-seed rather than at
+// random, so it never changes as the dataset grows, and the same image
+// served from several URLs cannot leak from train into test.
+
+// splitNames are the splits, in the order -split gives their shares.
+var splitNames = []string{"train", "val", "test"}
+
+// parseSplit reads train/val or train/val/test percentages such as 80/10/10.
+func parseSplit(spec string) ([]int, error) {
+	parts := strings.Split(spec, "/")
+	if len(parts) < 2 || len(parts) > len(splitNames) {
+		return nil, fmt.Errorf("split must be train/val or train/val/test percentages, e.g. 80/10/10, got %q", spec)
+	}
+	shares := make([]int, len(parts))
+	total := 0
+	for i, part := range parts {
+		share, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || share < 0 {
+			return nil, fmt.Errorf("split shares must be whole percentages, got %q", part)
+		}
+		shares[i] = share
+		total += share
+	}
+	if total != 100 {
+		return nil, fmt.Errorf("split shares must add up to 100, got %d", total)
+	}
+	return shares, nil
+}
+
+// splitFor returns the split of the image with the given content hash.
+func splitFor(shares []int, seed uint64, sum string) string {
+	hasher := fnv.New64a()
+	binary.Write(hasher, binary.LittleEndian, seed)
+	hasher.Write([]byte(sum))
+	bucket := int(hasher.Sum64() % 100)
+	for i, share := range shares {
+		if bucket < share {
+			return splitNames[i]
+		}
+		bucket -= share
+	}
+	return splitNames[len(shares)-1]
+}
+
+// assignSplits records the split of each downloaded image in state, judged
+// by its content, or its URL when its hash is not known.
+func (s *CrawlState) assignSplits(cfg *Config) {
+	if cfg.splitShares == nil {
+		return
+	}
+	for i := range s.Images {
+		record := &s.Images[i]
+		if record.Status != imageStatusDownloaded {
+			record.Split = ""
+			continue
+		}
+		key := record.SHA256
+		if key == "" {
+			key = record.URL
+		}
+		record.Split = splitFor(cfg.splitShares, cfg.SplitSeed, key)
+	}
+}
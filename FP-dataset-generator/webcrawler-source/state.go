@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateFileName is the file inside the output directory that records crawl
+// progress so the crawl and download phases can run separately or resume.
+const stateFileName = ".crawlstate.json"
+
+const (
+	imageStatusPending    = "pending"
+	imageStatusDownloaded = "downloaded"
+	imageStatusFailed     = "failed"
+	imageStatusFiltered   = "filtered"
+	imageStatusDuplicate  = "duplicate"
+)
+
+// CrawlState is the persisted progress of a crawl and its downloads.
+type CrawlState struct {
+	Version      string        `json:"version"`
+	Keyword      string        `json:"keyword"`
+	StartedAt    time.Time     `json:"started_at"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+	CrawlDone    bool          `json:"crawl_done"`
+	PagesCrawled int           `json:"pages_crawled"`
+	SeenPages    []string      `json:"seen_pages,omitempty"`
+	Frontier     []CrawlTask   `json:"frontier,omitempty"`
+	Images       []ImageRecord `json:"images"`
+
+	variants *variantIndex
+}
+
+// ImageRecord tracks one discovered image URL through the download phase.
+type ImageRecord struct {
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	File   string `json:"file,omitempty"`
+	SHA256 string `json:"sha256,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	// Variants are alternate URLs of the same image, tried in order when
+	// this one fails.
+	Variants []string `json:"variants,omitempty"`
+
+	// Headers holds selected response headers of the downloaded image.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// SourceStatus is the HTTP status the source URL returned when it was
+	// last checked, at CheckedAt. SourceError is set instead when the
+	// request failed without a response.
+	SourceStatus int        `json:"source_status,omitempty"`
+	SourceError  string     `json:"source_error,omitempty"`
+	CheckedAt    *time.Time `json:"checked_at,omitempty"`
+
+	// Attribution credits the author of images found through a provider API.
+	Attribution *Attribution `json:"attribution,omitempty"`
+
+	// Party is first-party or third-party for images found on a page,
+	// depending on whether they share the page's registrable domain.
+	Party string `json:"party,omitempty"`
+
+	// Page is the first page the image was found on, and Caption its alt,
+	// title, or caption text there.
+	Page    string `json:"page,omitempty"`
+	Caption string `json:"caption,omitempty"`
+
+	// Alt, Title, and Figcaption are the image's alt text, its title or that
+	// of the link around it, and the caption of the figure it sits in, each
+	// from the first page that gave one.
+	Alt        string `json:"alt,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Figcaption string `json:"figcaption,omitempty"`
+
+	// License is the license the image was found under, as -license names
+	// it, such as cc-by-sa.
+	License string `json:"license,omitempty"`
+
+	// Match is the strongest place the keyword appeared for the image.
+	Match string `json:"match,omitempty"`
+
+	// Split is the dataset split -split assigned the downloaded image to.
+	Split string `json:"split,omitempty"`
+
+	// Tags are the categories and tags of the pages the image was found on,
+	// or those a provider API gave it.
+	Tags []string `json:"tags,omitempty"`
+
+	// FilteredBy names the filter that rejected a filtered image, and MIME,
+	// Size, Width, Height, and Sharpness what was measured of it, so a run
+	// with relaxed limits can download it again without crawling.
+	FilteredBy string  `json:"filtered_by,omitempty"`
+	MIME       string  `json:"mime,omitempty"`
+	Size       int64   `json:"size,omitempty"`
+	Width      int     `json:"width,omitempty"`
+	Height     int     `json:"height,omitempty"`
+	Sharpness  float64 `json:"sharpness,omitempty"`
+}
+
+func newCrawlState(cfg *Config) *CrawlState {
+	now := time.Now().UTC()
+	return &CrawlState{
+		Version:   version,
+		Keyword:   cfg.Keyword,
+		StartedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func statePath(outputDir string) string {
+	return filepath.Join(outputDir, stateFileName)
+}
+
+// loadState reads the state file from outputDir.
+func loadState(outputDir string) (*CrawlState, error) {
+	data, err := os.ReadFile(statePath(outputDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("no crawl state found in %s (run the crawl command first)", outputDir)
+		}
+		return nil, fmt.Errorf("failed to read crawl state: %w", err)
+	}
+
+	var state CrawlState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse crawl state %s: %w", statePath(outputDir), err)
+	}
+	return &state, nil
+}
+
+// saveState writes the state file atomically so an interrupted save never
+// leaves a truncated file behind.
+func saveState(outputDir string, state *CrawlState) error {
+	state.UpdatedAt = time.Now().UTC()
+	state.syncVariants()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode crawl state: %w", err)
+	}
+
+	target := statePath(outputDir)
+	tmp := target + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write crawl state: %w", err)
+	}
+	return nil
+}
+
+// variantIndex returns the image variants recorded in state as an index the
+// crawler and downloader can share while they run.
+func (s *CrawlState) variantIndex() *variantIndex {
+	if s.variants == nil {
+		s.variants = newVariantIndex()
+		for _, record := range s.Images {
+			if len(record.Variants) > 0 {
+				s.variants.add(record.URL, record.Variants)
+			}
+		}
+	}
+	return s.variants
+}
+
+// syncVariants copies the shared variant index back into the image records.
+func (s *CrawlState) syncVariants() {
+	if s.variants == nil {
+		return
+	}
+	for i := range s.Images {
+		if variants := s.variants.lookup(s.Images[i].URL); len(variants) > 0 {
+			s.Images[i].Variants = variants
+		}
+	}
+}
+
+// addImages appends newly discovered URLs as pending records, ignoring URLs
+// that are already tracked.
+func (s *CrawlState) addImages(urls []string) int {
+	known := make(map[string]struct{}, len(s.Images))
+	for _, record := range s.Images {
+		known[record.URL] = struct{}{}
+	}
+
+	added := 0
+	for _, imageURL := range urls {
+		if _, exists := known[imageURL]; exists {
+			continue
+		}
+		known[imageURL] = struct{}{}
+		s.Images = append(s.Images, ImageRecord{URL: imageURL, Status: imageStatusPending})
+		added++
+	}
+	return added
+}
+
+// addProviderImages appends provider search results as pending records with
+// their attribution and returns the URLs that were not already tracked.
+func (s *CrawlState) addProviderImages(images []providerImage) []string {
+	known := make(map[string]struct{}, len(s.Images))
+	for _, record := range s.Images {
+		known[record.URL] = struct{}{}
+	}
+
+	var added []string
+	for _, image := range images {
+		if _, exists := known[image.URL]; exists {
+			continue
+		}
+		known[image.URL] = struct{}{}
+		attribution := image.Attribution
+		s.Images = append(s.Images, ImageRecord{URL: image.URL, Status: imageStatusPending, Attribution: &attribution, License: attributionLicense(&attribution), Tags: image.Tags})
+		added = append(added, image.URL)
+	}
+	return added
+}
+
+// imageURLs returns every tracked URL in discovery order.
+func (s *CrawlState) imageURLs() []string {
+	urls := make([]string, len(s.Images))
+	for i, record := range s.Images {
+		urls[i] = record.URL
+	}
+	return urls
+}
+
+// pendingURLs returns the URLs that still need downloading: those never
+// attempted and those that previously failed.
+func (s *CrawlState) pendingURLs() []string {
+	var urls []string
+	for _, record := range s.Images {
+		if record.Status == imageStatusPending || record.Status == imageStatusFailed {
+			urls = append(urls, record.URL)
+		}
+	}
+	return urls
+}
+
+// applyResults updates image records from a finished download batch.
+func (s *CrawlState) applyResults(results map[string]downloadOutcome) {
+	for i := range s.Images {
+		outcome, ok := results[s.Images[i].URL]
+		if !ok {
+			continue
+		}
+		s.Images[i].Status = outcome.Result.status()
+		s.Images[i].File = outcome.File
+		s.Images[i].SHA256 = outcome.SHA256
+		s.Images[i].Error = ""
+		if outcome.Result == downloadFailed {
+			s.Images[i].Error = outcome.Reason
+		}
+		if outcome.Result == downloadSuccess && outcome.Headers != nil {
+			s.Images[i].Headers = outcome.Headers
+		}
+		s.Images[i].FilteredBy, s.Images[i].MIME, s.Images[i].Size = "", "", 0
+		s.Images[i].Width, s.Images[i].Height, s.Images[i].Sharpness = 0, 0, 0
+		if outcome.Result == downloadFiltered {
+			s.Images[i].FilteredBy, s.Images[i].MIME, s.Images[i].Size = outcome.Filter, outcome.MIME, outcome.Size
+			s.Images[i].Width, s.Images[i].Height = outcome.Width, outcome.Height
+			s.Images[i].Sharpness = outcome.Sharpness
+		}
+	}
+}
+
+// requeueFiltered makes pending again the filtered images that would pass
+// the filter that rejected them with cfg, and returns how many there were.
+func (s *CrawlState) requeueFiltered(cfg *Config) int {
+	requeued := 0
+	for i := range s.Images {
+		if s.Images[i].Status == imageStatusFiltered && passesRelaxedFilter(cfg, s.Images[i]) {
+			s.Images[i].Status = imageStatusPending
+			requeued++
+		}
+	}
+	return requeued
+}
+
+// failedRecords returns the records whose last download attempt failed.
+func (s *CrawlState) failedRecords() []ImageRecord {
+	var records []ImageRecord
+	for _, record := range s.Images {
+		if record.Status == imageStatusFailed {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// statusCounts tallies image records by status.
+func (s *CrawlState) statusCounts() map[string]int {
+	counts := make(map[string]int, 4)
+	for _, record := range s.Images {
+		counts[record.Status]++
+	}
+	return counts
+}
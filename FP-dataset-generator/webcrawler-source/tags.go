@@ -0,0 +1,89 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pageTagSelectors find the categories and tags a page files its images
+// under: MediaWiki category links such as those on Wikimedia Commons, Flickr
+// photo tags, rel=tag links as WordPress and DeviantArt write them, and
+// article:tag meta tags.
+var pageTagSelectors = []string{
+	"#mw-normal-catlinks li a",
+	`a[href*="/photos/tags/"]`,
+	`a[rel~="tag"]`,
+	`meta[property="article:tag"]`,
+}
+
+// maxPageTags caps the tags recorded from one page, so tag clouds do not
+// swamp the labels that describe the images.
+const maxPageTags = 50
+
+// pageTags returns the categories and tags of a page in the order they
+// appear, without duplicates.
+func pageTags(doc *goquery.Document) []string {
+	var tags []string
+	seen := make(map[string]struct{})
+	doc.Find(strings.Join(pageTagSelectors, ", ")).EachWithBreak(func(_ int, sel *goquery.Selection) bool {
+		text := sel.Text()
+		if goquery.NodeName(sel) == "meta" {
+			text = sel.AttrOr("content", "")
+		}
+		tag := strings.TrimPrefix(strings.Join(strings.Fields(text), " "), "#")
+		key := strings.ToLower(tag)
+		if _, exists := seen[key]; tag == "" || exists {
+			return true
+		}
+		seen[key] = struct{}{}
+		tags = append(tags, tag)
+		return len(tags) < maxPageTags
+	})
+	return tags
+}
+
+// mergeTags adds the tags in more that tags does not have yet, comparing
+// them case-insensitively.
+func mergeTags(tags, more []string) []string {
+	for _, tag := range more {
+		if !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// setPageTags remembers the tags of a page while its images are extracted;
+// clearPageTags forgets them again.
+func (c *Crawler) setPageTags(pageURL string, tags []string) {
+	c.imagesMutex.Lock()
+	c.pageTags[pageURL] = tags
+	c.imagesMutex.Unlock()
+}
+
+func (c *Crawler) clearPageTags(pageURL string) {
+	c.imagesMutex.Lock()
+	delete(c.pageTags, pageURL)
+	c.imagesMutex.Unlock()
+}
+
+// noteImageTags gives an image found on pageURL the tags of that page. An
+// image found on several pages gets the tags of all of them.
+func (c *Crawler) noteImageTags(imageURL, pageURL string) {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	if tags := c.pageTags[pageURL]; len(tags) > 0 {
+		c.imageTags[imageURL] = mergeTags(c.imageTags[imageURL], tags)
+	}
+}
+
+// setTags adds to each image the tags of the pages it was found on.
+func (s *CrawlState) setTags(tags map[string][]string) {
+	for i := range s.Images {
+		if more := tags[s.Images[i].URL]; len(more) > 0 {
+			s.Images[i].Tags = mergeTags(s.Images[i].Tags, more)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	unsplashSearchURL = "https://api.unsplash.com/search/photos"
+	unsplashPerPage   = 30
+	unsplashLicense   = "Unsplash License (https://unsplash.com/license)"
+)
+
+// unsplashProvider searches photos through the official Unsplash API, which
+// needs an application access key.
+type unsplashProvider struct {
+	client    *http.Client
+	key       string
+	userAgent string
+}
+
+type unsplashSearchResponse struct {
+	TotalPages int `json:"total_pages"`
+	Results    []struct {
+		URLs struct {
+			Full string `json:"full"`
+			Raw  string `json:"raw"`
+		} `json:"urls"`
+		Links struct {
+			HTML string `json:"html"`
+		} `json:"links"`
+		User struct {
+			Name  string `json:"name"`
+			Links struct {
+				HTML string `json:"html"`
+			} `json:"links"`
+		} `json:"user"`
+	} `json:"results"`
+}
+
+func (p *unsplashProvider) searchPage(keyword string, page int) ([]providerImage, bool, error) {
+	query := url.Values{}
+	query.Set("query", keyword)
+	query.Set("page", strconv.Itoa(page))
+	query.Set("per_page", strconv.Itoa(unsplashPerPage))
+
+	req, err := http.NewRequest(http.MethodGet, unsplashSearchURL+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Authorization", "Client-ID "+p.key)
+	req.Header.Set("Accept-Version", "v1")
+	req.Header.Set("User-Agent", p.userAgent)
+
+	var response unsplashSearchResponse
+	if err := getProviderJSON(p.client, req, &response, unsplashError); err != nil {
+		return nil, false, err
+	}
+
+	images := make([]providerImage, 0, len(response.Results))
+	for _, result := range response.Results {
+		imageURL := result.URLs.Full
+		if imageURL == "" {
+			imageURL = result.URLs.Raw
+		}
+		if imageURL == "" {
+			continue
+		}
+		images = append(images, providerImage{
+			URL: imageURL,
+			Attribution: Attribution{
+				Author:    result.User.Name,
+				AuthorURL: result.User.Links.HTML,
+				Page:      result.Links.HTML,
+				License:   unsplashLicense,
+			},
+		})
+	}
+	return images, page < response.TotalPages, nil
+}
+
+// unsplashError extracts the messages from an Unsplash error response, which
+// looks like {"errors": ["OAuth error: The access token is invalid"]}.
+func unsplashError(body []byte) string {
+	var response struct {
+		Errors []string `json:"errors"`
+	}
+	if json.Unmarshal(body, &response) == nil && len(response.Errors) > 0 {
+		return strings.Join(response.Errors, "; ")
+	}
+	return string(body)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Image URL lists move discovered images between runs, machines, and tools.
+// A .json list keeps what was learned about each image while crawling; any
+// other list holds one URL per line, the format curl, wget -i, and
+// aria2c -i read.
+
+// urlListEntry is one image of a JSON URL list. Its fields are named as in
+// the crawl state, so the JSON the export command writes reads back too.
+type urlListEntry struct {
+	URL         string       `json:"url"`
+	Variants    []string     `json:"variants,omitempty"`
+	Tags        []string     `json:"tags,omitempty"`
+	Attribution *Attribution `json:"attribution,omitempty"`
+}
+
+// readURLList reads the image URLs in the file at path: a JSON array of
+// URLs or of objects with a url field, or one URL per line, skipping blank
+// lines, lines starting with #, and the indented option lines of aria2c
+// input files. Entries that are not URLs are skipped with a warning.
+func readURLList(path string) ([]urlListEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read URL list: %w", err)
+	}
+
+	var entries []urlListEntry
+	if trimmed := bytes.TrimSpace(data); bytes.HasPrefix(trimmed, []byte("[")) {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("failed to parse URL list %s: %w", path, err)
+		}
+		for _, item := range items {
+			var entry urlListEntry
+			if json.Unmarshal(item, &entry.URL) != nil && json.Unmarshal(item, &entry) != nil {
+				return nil, fmt.Errorf("failed to parse URL list %s: entries must be URLs or objects with a url", path)
+			}
+			entries = append(entries, entry)
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		for scanner.Scan() {
+			line := scanner.Text()
+			if strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t") {
+				continue
+			}
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			entries = append(entries, urlListEntry{URL: line})
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("failed to read URL list: %w", err)
+		}
+	}
+
+	valid := entries[:0]
+	for _, entry := range entries {
+		entry.URL = strings.TrimSpace(entry.URL)
+		if !hasSeedScheme(entry.URL) {
+			logWarning("Skipping invalid URL in %s: %s", path, entry.URL)
+			continue
+		}
+		valid = append(valid, entry)
+	}
+	return valid, nil
+}
+
+// writeImageURLList writes the images in state to path, as JSON when it
+// ends in .json and one URL per line otherwise.
+func writeImageURLList(path string, state *CrawlState) error {
+	state.syncVariants()
+
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		entries := make([]urlListEntry, len(state.Images))
+		for i, record := range state.Images {
+			entries[i] = urlListEntry{URL: record.URL, Variants: record.Variants, Tags: record.Tags, Attribution: record.Attribution}
+		}
+		encoded, err := json.MarshalIndent(entries, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode URL list: %w", err)
+		}
+		data = append(encoded, '\n')
+	} else {
+		for _, imageURL := range state.imageURLs() {
+			data = append(data, imageURL+"\n"...)
+		}
+	}
+
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write URL list %s: %w", path, err)
+	}
+	return nil
+}
+
+// addListedImages appends the entries of a URL list as pending records with
+// what the list says about them, and returns the URLs that were not already
+// tracked.
+func (s *CrawlState) addListedImages(entries []urlListEntry) []string {
+	known := make(map[string]struct{}, len(s.Images))
+	for _, record := range s.Images {
+		known[record.URL] = struct{}{}
+	}
+
+	var added []string
+	for _, entry := range entries {
+		if _, exists := known[entry.URL]; exists {
+			continue
+		}
+		known[entry.URL] = struct{}{}
+		s.Images = append(s.Images, ImageRecord{
+			URL:         entry.URL,
+			Status:      imageStatusPending,
+			Variants:    entry.Variants,
+			Tags:        entry.Tags,
+			Attribution: entry.Attribution,
+			License:     attributionLicense(entry.Attribution),
+		})
+		if s.variants != nil && len(entry.Variants) > 0 {
+			s.variants.add(entry.URL, entry.Variants)
+		}
+		added = append(added, entry.URL)
+	}
+	return added
+}
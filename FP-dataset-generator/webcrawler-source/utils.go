@@ -3,15 +3,25 @@ package main
 import (
 	"fmt"
 	"net/url"
+	"os"
 	"os/exec"
 	"path"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 var (
 	skipThumbnailFiltering bool
+	allowWebP              bool
 
-	imageExtensions = []string{
+	// imageMIMETypes holds the types -image-types keeps; nil keeps every
+	// supported image type.
+	imageMIMETypes map[string]struct{}
+
+	imageExtensions = defaultImageExtensions
+
+	defaultImageExtensions = []string{
 		".jpg",
 		".jpeg",
 		".png",
@@ -21,6 +31,9 @@ var (
 		".ico",
 		".tiff",
 		".tif",
+		".avif",
+		".heic",
+		".heif",
 	}
 )
 
@@ -29,8 +42,56 @@ func SetSkipThumbnails(enabled bool) {
 	skipThumbnailFiltering = enabled
 }
 
+// SetAllowWebP enables or disables keeping WebP images globally.
+func SetAllowWebP(enabled bool) {
+	allowWebP = enabled
+}
+
+// imageTypePattern matches the image types -image-types accepts.
+var imageTypePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+.-]*$`)
+
+// imageExtensionAliases are the other spellings of an image extension.
+var imageExtensionAliases = map[string]string{
+	".jpg":  ".jpeg",
+	".jpeg": ".jpg",
+	".tif":  ".tiff",
+	".tiff": ".tif",
+}
+
+// SetImageTypes sets the image types recognized in URLs and kept when
+// downloaded, by extension, such as jpg or webp. Extensions without a known
+// MIME type are matched as image/<extension>. An empty list restores the
+// defaults.
+func SetImageTypes(types []string) {
+	if len(types) == 0 {
+		imageExtensions, imageMIMETypes = defaultImageExtensions, nil
+		return
+	}
+
+	imageExtensions, imageMIMETypes = nil, make(map[string]struct{})
+	for _, imageType := range types {
+		ext := "." + strings.TrimPrefix(strings.ToLower(imageType), ".")
+		for _, ext := range []string{ext, imageExtensionAliases[ext]} {
+			if ext == "" {
+				continue
+			}
+			imageExtensions = append(imageExtensions, ext)
+			imageMIMETypes[imageTypeMIME(ext)] = struct{}{}
+		}
+	}
+}
+
+// imageTypeMIME returns the MIME type of an image extension.
+func imageTypeMIME(ext string) string {
+	if mime, ok := extensionMIMETypes[ext]; ok {
+		return mime
+	}
+	return "image/" + strings.TrimPrefix(ext, ".")
+}
+
 // isImageURL returns true when the provided URL appears to reference an image
-// asset that we support downloading. WebP assets are always excluded.
+// asset that we support downloading. WebP assets are excluded unless
+// -allow-webp is set.
 func isImageURL(raw string) bool {
 	if raw == "" {
 		return false
@@ -45,7 +106,8 @@ func isImageURL(raw string) bool {
 		return false
 	}
 
-	if isWebPImage(normalized) {
+	webp := isWebPImage(normalized)
+	if webp && !allowWebP {
 		return false
 	}
 
@@ -57,6 +119,10 @@ func isImageURL(raw string) bool {
 		return false
 	}
 
+	if webp {
+		return true
+	}
+
 	u, err := url.Parse(normalized)
 	if err == nil && u.Scheme != "" && u.Host != "" {
 		if hasImageExtension(u.Path) {
@@ -70,6 +136,21 @@ func isImageURL(raw string) bool {
 	return hasImageExtension(normalized)
 }
 
+// isSupportedImageMIME reports whether a MIME type names an image format we
+// keep: one of -image-types when it is set, otherwise any image but WebP,
+// as in isImageURL, unless -allow-webp is set.
+func isSupportedImageMIME(mime string) bool {
+	mime = strings.ToLower(strings.TrimSpace(mime))
+	if idx := strings.Index(mime, ";"); idx != -1 {
+		mime = strings.TrimSpace(mime[:idx])
+	}
+	if imageMIMETypes != nil {
+		_, ok := imageMIMETypes[mime]
+		return ok
+	}
+	return strings.HasPrefix(mime, "image/") && (mime != "image/webp" || allowWebP)
+}
+
 // isWebPImage checks if the URL or filename indicates a WebP image.
 func isWebPImage(raw string) bool {
 	lower := strings.ToLower(raw)
@@ -134,6 +215,109 @@ func containsKeyword(raw, keyword string) bool {
 	return strings.Contains(strings.ToLower(raw), strings.ToLower(keyword))
 }
 
+// Keyword scopes select which part of an image reference must contain the
+// keyword.
+const (
+	keywordScopeFilename = "filename"
+	keywordScopePath     = "path"
+	keywordScopeURL      = "url"
+	keywordScopeMetadata = "metadata"
+	keywordScopeText     = "text"
+	keywordScopeAny      = "any"
+)
+
+var keywordScopes = []string{keywordScopeFilename, keywordScopePath, keywordScopeURL, keywordScopeMetadata, keywordScopeText, keywordScopeAny}
+
+// matchesKeyword reports whether an image matches keyword within scope. The
+// filename and path scopes ignore the hostname and query string, so tracking
+// parameters and domain names cannot cause false matches. The metadata scope
+// matches the filename or the image's descriptive text, the text scope only
+// the descriptive text, and the any scope the URL or the descriptive text.
+func matchesKeyword(scope, imageURL, metadata, keyword string) bool {
+	_, _, ok := keywordMatch(scope, imageURL, metadata, keyword)
+	return ok
+}
+
+// keywordMatch is matchesKeyword that also returns which part of the image
+// reference matched and its text, for -explain.
+func keywordMatch(scope, imageURL, metadata, keyword string) (string, string, bool) {
+	switch scope {
+	case "", keywordScopeURL:
+		return "url", imageURL, containsKeyword(imageURL, keyword)
+	case keywordScopeText:
+		return "alt/title/caption", metadata, containsKeyword(metadata, keyword)
+	case keywordScopeAny:
+		if containsKeyword(imageURL, keyword) {
+			return "url", imageURL, true
+		}
+		return "alt/title/caption", metadata, containsKeyword(metadata, keyword)
+	}
+
+	u, err := url.Parse(imageURL)
+	if err != nil {
+		return "", "", false
+	}
+
+	urlPath := u.Path
+	if unescaped, err := url.PathUnescape(urlPath); err == nil {
+		urlPath = unescaped
+	}
+	filename := path.Base(urlPath)
+
+	switch scope {
+	case keywordScopeFilename:
+		return "filename", filename, containsKeyword(filename, keyword)
+	case keywordScopePath:
+		return "path", urlPath, containsKeyword(urlPath, keyword)
+	case keywordScopeMetadata:
+		if containsKeyword(filename, keyword) {
+			return "filename", filename, true
+		}
+		return "alt/title/caption", metadata, containsKeyword(metadata, keyword)
+	default:
+		return "", "", false
+	}
+}
+
+// highlightKeyword marks every case-insensitive occurrence of keyword in
+// text: in reverse video on a terminal, or in brackets otherwise.
+func highlightKeyword(text, keyword string) string {
+	if keyword == "" {
+		return text
+	}
+
+	open, close := "[", "]"
+	if isTerminal(os.Stdout) {
+		open, close = "\033[7m", "\033[0m"
+	}
+
+	lowerText, lowerKeyword := strings.ToLower(text), strings.ToLower(keyword)
+	if len(lowerText) != len(text) {
+		// Case folding changed byte offsets; mark nothing rather than
+		// splitting a character.
+		return text
+	}
+
+	var b strings.Builder
+	for {
+		idx := strings.Index(lowerText, lowerKeyword)
+		if idx == -1 {
+			b.WriteString(text)
+			return b.String()
+		}
+		end := idx + len(lowerKeyword)
+		b.WriteString(text[:idx])
+		b.WriteString(open + text[idx:end] + close)
+		text, lowerText = text[end:], lowerText[end:]
+	}
+}
+
+// isTerminal reports whether file is an interactive terminal.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // normalizeURL removes fragments and trims whitespace.
 func normalizeURL(raw string) string {
 	if idx := strings.Index(raw, "#"); idx != -1 {
@@ -199,6 +383,13 @@ func sanitizeFilename(filename string) string {
 
 // extractFilenameFromURL extracts a sanitized filename from a URL.
 func extractFilenameFromURL(raw string) string {
+	if pdfURL, entry, ok := parsePDFImageURL(raw); ok {
+		return pdfImageFilename(pdfURL, entry)
+	}
+	if pageURL, entry, ok := parseDataURIImageURL(raw); ok {
+		return dataURIImageFilename(pageURL, entry)
+	}
+
 	if idx := strings.Index(raw, "?"); idx != -1 {
 		raw = raw[:idx]
 	}
@@ -243,6 +434,40 @@ func isSubdomain(parentURL, childURL string) bool {
 	return strings.HasSuffix(child, parent)
 }
 
+// parseByteSize parses sizes such as "512MB", "2GB", "1.5G", or "4096".
+// Units are binary multiples (1KB = 1024 bytes) and are case-insensitive.
+func parseByteSize(raw string) (uint64, error) {
+	value := strings.ToUpper(strings.TrimSpace(raw))
+	if value == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multipliers := []struct {
+		suffix string
+		factor float64
+	}{
+		{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+		{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+		{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+		{"B", 1},
+	}
+
+	factor := 1.0
+	for _, m := range multipliers {
+		if strings.HasSuffix(value, m.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, m.suffix))
+			factor = m.factor
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return uint64(number * factor), nil
+}
+
 // log helpers ---------------------------------------------------------------
 
 func logVerbose(cfg *Config, format string, args ...interface{}) {
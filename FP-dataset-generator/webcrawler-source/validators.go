@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// validatorIndexFileName is the index of the cache validators of stored
+// images, kept in the output directory.
+const validatorIndexFileName = ".validators"
+
+// validatorIndex maps the cache validators of stored images, their ETag or
+// Last-Modified, to the file holding the image. The same image served from
+// another URL, such as another CDN edge host, usually carries the same
+// validators, so it is recognized from the pre-download check alone,
+// before any of it is downloaded. Hash deduplication still catches the
+// duplicates it misses. A nil index finds and records nothing.
+type validatorIndex struct {
+	outputDir string
+	mu        sync.Mutex
+	byKey     map[string]string
+}
+
+// loadValidatorIndex reads the validator index from outputDir. A missing
+// index is not an error; it is created on the first record.
+func loadValidatorIndex(outputDir string) (*validatorIndex, error) {
+	index := &validatorIndex{
+		outputDir: outputDir,
+		byKey:     make(map[string]string),
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, validatorIndexFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read validator index: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		key, name, ok := strings.Cut(scanner.Text(), "\t\t")
+		if !ok || key == "" || name == "" {
+			continue
+		}
+		index.byKey[key] = name
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read validator index: %w", err)
+	}
+
+	return index, nil
+}
+
+// validatorKey identifies an image by the validators in its response
+// headers, or returns "" when they are too weak to. An ETag is taken with
+// the image's size. Last-Modified is only taken with the size and the name
+// the URL gives the image, as unrelated images are often modified at the
+// same second.
+func validatorKey(imageURL string, headers map[string]string) string {
+	size := headers["Content-Length"]
+	if size == "" {
+		return ""
+	}
+	if etag := headers["ETag"]; etag != "" {
+		return "etag\t" + etag + "\t" + size
+	}
+	modified := headers["Last-Modified"]
+	if modified == "" {
+		return ""
+	}
+	u, err := url.Parse(imageURL)
+	if err != nil || path.Base(u.Path) == "/" || path.Base(u.Path) == "." {
+		return ""
+	}
+	return "modified\t" + modified + "\t" + size + "\t" + path.Base(u.Path)
+}
+
+// lookup returns the stored file of the image with the validators in
+// headers, if it still exists under a name other than file.
+func (v *validatorIndex) lookup(imageURL string, headers map[string]string, file string) (string, bool) {
+	key := validatorKey(imageURL, headers)
+	if v == nil || key == "" {
+		return "", false
+	}
+
+	v.mu.Lock()
+	existing, ok := v.byKey[key]
+	v.mu.Unlock()
+	if !ok || existing == file {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(v.outputDir, existing)); err != nil {
+		return "", false
+	}
+	return existing, true
+}
+
+// record registers file as holding the image with the validators in
+// headers.
+func (v *validatorIndex) record(imageURL string, headers map[string]string, file string) error {
+	key := validatorKey(imageURL, headers)
+	if v == nil || key == "" {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.byKey[key] == file {
+		return nil
+	}
+	v.byKey[key] = file
+
+	out, err := os.OpenFile(filepath.Join(v.outputDir, validatorIndexFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to update validator index: %w", err)
+	}
+	defer out.Close()
+
+	if _, err := fmt.Fprintf(out, "%s\t\t%s\n", key, file); err != nil {
+		return fmt.Errorf("failed to update validator index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// variantIndex maps a recorded image URL to alternate URLs of the same
+// image, such as the other entries of its srcset, largest first. The
+// downloader falls back to them when the recorded variant cannot be used.
+// URLs are keyed by their canonical form, like the crawler's image set.
+type variantIndex struct {
+	mu    sync.Mutex
+	byURL map[string][]string
+}
+
+func newVariantIndex() *variantIndex {
+	return &variantIndex{byURL: make(map[string][]string)}
+}
+
+// add appends alternates for imageURL, skipping ones already known.
+func (v *variantIndex) add(imageURL string, alternates []string) {
+	key := variantKey(imageURL)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	known := v.byURL[key]
+	for _, alternate := range alternates {
+		if alternate != imageURL && !slices.Contains(known, alternate) {
+			known = append(known, alternate)
+		}
+	}
+	if len(known) > 0 {
+		v.byURL[key] = known
+	}
+}
+
+func (v *variantIndex) lookup(imageURL string) []string {
+	if v == nil {
+		return nil
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return append([]string(nil), v.byURL[variantKey(imageURL)]...)
+}
+
+func variantKey(imageURL string) string {
+	if canonical := canonicalizeImageURL(imageURL); canonical != "" {
+		return canonical
+	}
+	return imageURL
+}
+
+// srcsetCandidates returns the URLs of a srcset ordered by their width or
+// density descriptor, largest first. Entries without a descriptor keep
+// their order after the described ones.
+func srcsetCandidates(srcset string) []string {
+	type entry struct {
+		url  string
+		size float64
+	}
+
+	var entries []entry
+	for _, part := range strings.Split(srcset, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+
+		e := entry{url: fields[0]}
+		if len(fields) > 1 {
+			descriptor := strings.TrimRight(fields[1], "wx")
+			fmt.Sscanf(descriptor, "%g", &e.size)
+		}
+		entries = append(entries, e)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].size > entries[j].size
+	})
+
+	urls := make([]string, len(entries))
+	for i, e := range entries {
+		urls[i] = e.url
+	}
+	return urls
+}
+
+// recordSrcsetVariants registers the smaller srcset entries of an image
+// element as alternates of its largest entry, once that entry has been
+// recorded as an image.
+func (c *Crawler) recordSrcsetVariants(baseURL string, sel *goquery.Selection) {
+	for _, attr := range []string{"srcset", "data-srcset", "imagesrcset"} {
+		srcset, exists := sel.Attr(attr)
+		if !exists {
+			continue
+		}
+
+		var absolute []string
+		for _, candidate := range srcsetCandidates(srcset) {
+			if resolved := c.resolveURL(baseURL, candidate); resolved != "" && isImageURL(resolved) {
+				absolute = append(absolute, resolved)
+			}
+		}
+		if len(absolute) < 2 || !c.hasImage(absolute[0]) {
+			continue
+		}
+		c.variants.add(absolute[0], absolute[1:])
+	}
+}
+
+// hasImage reports whether imageURL, or a URL with the same canonical form,
+// has been recorded.
+func (c *Crawler) hasImage(imageURL string) bool {
+	c.imagesMutex.Lock()
+	defer c.imagesMutex.Unlock()
+	_, exists := c.visitedImages[variantKey(imageURL)]
+	return exists
+}
+
+// TrackVariants makes the crawler record alternate image variants in index,
+// which the downloader shares. It must be called before Start.
+func (c *Crawler) TrackVariants(index *variantIndex) {
+	c.variants = index
+}
+
+// UseVariants lets the downloader fall back to the alternates in index when
+// an image cannot be downloaded or fails validation.
+func (d *Downloader) UseVariants(index *variantIndex) {
+	d.variants = index
+}
+
+// downloadWithVariants downloads imageURL and, if that fails, each of its
+// known variants in turn. The first variant that works is recorded as the
+// outcome for imageURL.
+func (d *Downloader) downloadWithVariants(imageURL string) downloadOutcome {
+	outcome := downloadOutcome{File: extractFilenameFromURL(imageURL)}
+	outcome.Result = d.downloadImage(imageURL, &outcome)
+	if outcome.Result != downloadFailed {
+		return outcome
+	}
+
+	for _, variant := range d.variants.lookup(imageURL) {
+		logVerbose(d.config, "Trying variant %s for %s (%s)", variant, imageURL, outcome.Reason)
+		alternate := downloadOutcome{File: extractFilenameFromURL(variant)}
+		alternate.Result = d.downloadImage(variant, &alternate)
+		if alternate.Result != downloadFailed {
+			return alternate
+		}
+	}
+	return outcome
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// watchPollInterval is how often -watch-dir looks for new pages. A page is
+// crawled once its size and modification time held still for one interval,
+// so a browser still saving it is not read half-written.
+const watchPollInterval = 2 * time.Second
+
+// watchDirSource crawls the HTML files dropped into a directory, each as a
+// seed of its own, until interrupted. It is meant for pages the crawler
+// cannot reach, such as ones behind a login, that are saved from a browser.
+// A file changed after it was crawled is crawled again.
+type watchDirSource struct {
+	dir string
+}
+
+func (watchDirSource) name() string { return "watch dir" }
+
+// watchedFile is what a poll saw of a file.
+type watchedFile struct {
+	size    int64
+	modTime time.Time
+}
+
+func (s watchDirSource) discover(cfg *Config, state *CrawlState, stream chan<- string) error {
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+
+	logInfo("Watching %s for saved pages (press Ctrl+C to stop)", s.dir)
+
+	crawled := make(map[string]watchedFile)
+	pending := make(map[string]watchedFile)
+	ticker := time.NewTicker(watchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		pages, err := watchedPages(s.dir)
+		if err != nil {
+			return err
+		}
+		for _, page := range pages {
+			seen := pending[page.path]
+			pending[page.path] = page.watchedFile
+			if page.watchedFile != seen || crawled[page.path] == page.watchedFile {
+				continue
+			}
+
+			delete(pending, page.path)
+			crawled[page.path] = page.watchedFile
+			if err := s.crawlPage(cfg, state, stream, page.path); err != nil {
+				logError("Could not crawl %s: %v", page.path, err)
+			}
+			if err := saveState(cfg.OutputDir, state); err != nil {
+				return err
+			}
+
+			select {
+			case <-interrupts:
+				return nil
+			default:
+			}
+		}
+
+		if cfg.pastDeadline() {
+			logInfo("Time budget of %s used, stopped watching %s", cfg.MaxDuration, s.dir)
+			return nil
+		}
+		select {
+		case <-interrupts:
+			fmt.Println()
+			logInfo("Stopped watching %s", s.dir)
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// crawlPage runs the crawler on one saved page, with the rest of the
+// configuration as given.
+func (watchDirSource) crawlPage(cfg *Config, state *CrawlState, stream chan<- string, path string) error {
+	logInfo("Crawling saved page %s", path)
+
+	pageCfg := *cfg
+	pageCfg.SeedURLs = []string{toSeedURL(path)}
+	pageCfg.SkipProbe = true
+	before := len(state.Images)
+	if err := (crawlerSource{}).discover(&pageCfg, state, stream); err != nil {
+		return err
+	}
+	fmt.Println()
+	logSuccess("Found %d new image(s) in %s", len(state.Images)-before, filepath.Base(path))
+	return nil
+}
+
+type watchedPage struct {
+	path string
+	watchedFile
+}
+
+// watchedPages lists the HTML files directly inside dir, oldest first.
+func watchedPages(dir string) ([]watchedPage, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watch directory: %w", err)
+	}
+
+	var pages []watchedPage
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".html" && ext != ".htm") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() == 0 {
+			continue
+		}
+		pages = append(pages, watchedPage{
+			path:        filepath.Join(dir, entry.Name()),
+			watchedFile: watchedFile{size: info.Size(), modTime: info.ModTime()},
+		})
+	}
+	sort.Slice(pages, func(i, j int) bool { return pages[i].modTime.Before(pages[j].modTime) })
+	return pages, nil
+}
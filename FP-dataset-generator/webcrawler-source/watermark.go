@@ -0,0 +1,289 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"net/url"
+	"strings"
+)
+
+const (
+	// watermarkSampleGrid bounds the size of the luma grid analysed per image.
+	watermarkSampleGrid = 256
+	// watermarkEdgeThreshold is the luma difference (0-255) between adjacent
+	// samples that counts as an edge.
+	watermarkEdgeThreshold = 48
+)
+
+// watermarkedHosts lists stock-photo sites whose publicly reachable preview
+// images are always watermarked.
+var watermarkedHosts = []string{
+	"shutterstock.com",
+	"istockphoto.com",
+	"gettyimages.com",
+	"dreamstime.com",
+	"123rf.com",
+	"depositphotos.com",
+	"alamy.com",
+	"stock.adobe.com",
+	"ftcdn.net",
+	"bigstockphoto.com",
+	"canstockphoto.com",
+	"vectorstock.com",
+}
+
+// watermarkedPathHints are path fragments commonly used for watermarked
+// "comp" renditions served by stock-photo CDNs.
+var watermarkedPathHints = []string{
+	"watermark",
+	"/comp/",
+	"/comps/",
+	"_wm.",
+	"-wm.",
+}
+
+// isLikelyWatermarkedURL reports whether the URL points at a known source of
+// watermarked previews. It runs before download so no bandwidth is spent on
+// images that would be rejected anyway.
+func isLikelyWatermarkedURL(raw string) bool {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, stock := range watermarkedHosts {
+		if host == stock || strings.HasSuffix(host, "."+stock) {
+			return true
+		}
+	}
+
+	lowerPath := strings.ToLower(u.Path)
+	for _, hint := range watermarkedPathHints {
+		if strings.Contains(lowerPath, hint) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectWatermark inspects a downloaded image for the two watermark styles
+// seen most often on stock previews: a logo stamped into a corner, and
+// semi-transparent text repeated in a grid across the whole frame. It
+// returns a short description of the detected pattern, or an empty string.
+func detectWatermark(imagePath string) (string, error) {
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	grid := newLumaGrid(img)
+	if grid.width < 16 || grid.height < 16 {
+		return "", fmt.Errorf("image too small to analyse: %dx%d", grid.width, grid.height)
+	}
+
+	edges, light := grid.edgeMaps()
+
+	if corner := cornerLogo(edges, light, grid.width, grid.height); corner != "" {
+		return "logo in " + corner + " corner", nil
+	}
+
+	if repeatingOverlay(edges, light, grid.width, grid.height) {
+		return "repeating overlay text", nil
+	}
+
+	return "", nil
+}
+
+type lumaGrid struct {
+	width, height int
+	luma          []uint8
+	gray          []bool
+}
+
+// newLumaGrid samples img into a grid of at most watermarkSampleGrid cells
+// per axis, recording luma and whether each sample is close to neutral gray.
+func newLumaGrid(img image.Image) lumaGrid {
+	bounds := img.Bounds()
+	stepX := max(bounds.Dx()/watermarkSampleGrid, 1)
+	stepY := max(bounds.Dy()/watermarkSampleGrid, 1)
+
+	grid := lumaGrid{
+		width:  (bounds.Dx() + stepX - 1) / stepX,
+		height: (bounds.Dy() + stepY - 1) / stepY,
+	}
+	grid.luma = make([]uint8, 0, grid.width*grid.height)
+	grid.gray = make([]bool, 0, grid.width*grid.height)
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += stepY {
+		for x := bounds.Min.X; x < bounds.Max.X; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r8, g8, b8 := r>>8, g>>8, b>>8
+			grid.luma = append(grid.luma, uint8((299*r8+587*g8+114*b8)/1000))
+
+			hi := max(r8, g8, b8)
+			lo := min(r8, g8, b8)
+			grid.gray = append(grid.gray, hi-lo < 40)
+		}
+	}
+
+	return grid
+}
+
+// edgeMaps returns, for every cell, whether it sits on a strong edge and
+// whether that edge is a light neutral stroke (the typical look of white or
+// gray watermark text blended over a photo).
+func (g lumaGrid) edgeMaps() (edges, light []bool) {
+	edges = make([]bool, len(g.luma))
+	light = make([]bool, len(g.luma))
+
+	for y := 0; y < g.height-1; y++ {
+		for x := 0; x < g.width-1; x++ {
+			i := y*g.width + x
+			here := int(g.luma[i])
+			right := int(g.luma[i+1])
+			below := int(g.luma[i+g.width])
+
+			diff := max(abs(here-right), abs(here-below))
+			if diff < watermarkEdgeThreshold {
+				continue
+			}
+
+			edges[i] = true
+			brightest, brightIdx := here, i
+			if right > brightest {
+				brightest, brightIdx = right, i+1
+			}
+			if below > brightest {
+				brightest, brightIdx = below, i+g.width
+			}
+			light[i] = brightest >= 170 && g.gray[brightIdx]
+		}
+	}
+
+	return edges, light
+}
+
+// cornerLogo looks for a corner whose edge density is far above the rest of
+// the frame while being dominated by light neutral strokes.
+func cornerLogo(edges, light []bool, width, height int) string {
+	totalEdges, _ := countEdges(edges, light, width, 0, 0, width, height)
+	overall := float64(totalEdges) / float64(width*height)
+
+	cw, ch := width/5, height/8
+	corners := []struct {
+		name   string
+		x0, y0 int
+	}{
+		{"top-left", 0, 0},
+		{"top-right", width - cw, 0},
+		{"bottom-left", 0, height - ch},
+		{"bottom-right", width - cw, height - ch},
+	}
+
+	for _, corner := range corners {
+		count, lightCount := countEdges(edges, light, width, corner.x0, corner.y0, corner.x0+cw, corner.y0+ch)
+		if count == 0 {
+			continue
+		}
+		density := float64(count) / float64(cw*ch)
+		lightRatio := float64(lightCount) / float64(count)
+		if density >= 0.08 && density >= overall*3 && lightRatio >= 0.4 {
+			return corner.name
+		}
+	}
+
+	return ""
+}
+
+// repeatingOverlay detects tiled overlay text by looking for a strong
+// periodic signal in the light-stroke projections along both axes.
+func repeatingOverlay(edges, light []bool, width, height int) bool {
+	rows := make([]float64, height)
+	cols := make([]float64, width)
+	lightTotal := 0
+	edgeTotal := 0
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := y*width + x
+			if edges[i] {
+				edgeTotal++
+			}
+			if light[i] {
+				lightTotal++
+				rows[y]++
+				cols[x]++
+			}
+		}
+	}
+
+	if edgeTotal == 0 || float64(lightTotal)/float64(edgeTotal) < 0.3 {
+		return false
+	}
+
+	return periodicity(rows) >= 0.6 && periodicity(cols) >= 0.6
+}
+
+// periodicity returns the highest normalised autocorrelation of signal for
+// lags between 1/12 and 1/2 of its length.
+func periodicity(signal []float64) float64 {
+	n := len(signal)
+	if n < 24 {
+		return 0
+	}
+
+	mean := 0.0
+	for _, v := range signal {
+		mean += v
+	}
+	mean /= float64(n)
+
+	variance := 0.0
+	centered := make([]float64, n)
+	for i, v := range signal {
+		centered[i] = v - mean
+		variance += centered[i] * centered[i]
+	}
+	if variance == 0 {
+		return 0
+	}
+
+	best := 0.0
+	for lag := n / 12; lag <= n/2; lag++ {
+		sum := 0.0
+		for i := 0; i+lag < n; i++ {
+			sum += centered[i] * centered[i+lag]
+		}
+		// Normalise by the overlap so longer lags are not penalised.
+		score := sum / variance * float64(n) / float64(n-lag)
+		if score > best {
+			best = score
+		}
+	}
+
+	return best
+}
+
+func countEdges(edges, light []bool, width, x0, y0, x1, y1 int) (count, lightCount int) {
+	for y := y0; y < y1; y++ {
+		for x := x0; x < x1; x++ {
+			i := y*width + x
+			if edges[i] {
+				count++
+			}
+			if light[i] {
+				lightCount++
+			}
+		}
+	}
+	return count, lightCount
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
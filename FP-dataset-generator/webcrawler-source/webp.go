@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/image/webp"
+)
+
+// convertWebP decodes the WebP image at in and writes it to out in format.
+// Animated WebP images cannot be decoded and are reported as errors.
+func convertWebP(in, out, format string) error {
+	file, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	img, err := webp.Decode(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("could not decode WebP: %w", err)
+	}
+
+	converted, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := conversionTargets[format].encode(converted, img); err != nil {
+		converted.Close()
+		return fmt.Errorf("could not encode %s: %w", format, err)
+	}
+	return converted.Close()
+}
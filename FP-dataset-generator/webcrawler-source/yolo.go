@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// export -format yolo lays the downloaded images out as a YOLO dataset in
+// the -out directory, the structure Ultralytics and most annotation tools
+// expect:
+//
+//	data.yaml
+//	images/train/  images/val/
+//	labels/train/  labels/val/
+//
+// Each class is split into train and val at random, by -val-split; the same
+// -seed draws the same split. Images a crawl with -split assigned keep their
+// split instead, and a test split adds images/test/ and labels/test/. Every image gets an empty label file, a stub
+// for the boxes to be drawn, and data.yaml names one class per keyword.
+
+// yoloData is the data.yaml of a YOLO dataset.
+type yoloData struct {
+	Path  string         `yaml:"path"`
+	Train string         `yaml:"train"`
+	Val   string         `yaml:"val"`
+	Test  string         `yaml:"test,omitempty"`
+	Names map[int]string `yaml:"names"`
+}
+
+// exportYOLO writes the YOLO dataset of cfg's downloaded images to dir,
+// holding out valSplit of each class for validation. It returns the number
+// of images exported.
+func exportYOLO(cfg *Config, dir string, valSplit float64, seed uint64) (int, error) {
+	if dir == "" || dir == "-" {
+		return 0, configError(fmt.Errorf("-format yolo needs an -out directory"))
+	}
+	if valSplit < 0 || valSplit >= 1 {
+		return 0, configError(fmt.Errorf("val-split must be at least 0 and less than 1"))
+	}
+	classes, err := datasetClasses(cfg)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, sub := range []string{"images/train", "images/val", "labels/train", "labels/val"} {
+		if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(sub)), 0755); err != nil {
+			return 0, fmt.Errorf("failed to create %s: %w", sub, err)
+		}
+	}
+
+	rng := rand.New(rand.NewPCG(seed, seed))
+	data := yoloData{Train: "images/train", Val: "images/val", Names: make(map[int]string, len(classes))}
+	if abs, err := filepath.Abs(dir); err == nil {
+		data.Path = abs
+	}
+
+	exported := 0
+	for id, class := range classes {
+		data.Names[id] = class.name
+		state, err := loadState(class.outputDir)
+		if err != nil {
+			return 0, fmt.Errorf("class %s: %w", class.name, err)
+		}
+		entries, _ := storedEntries(class.outputDir, state)
+		rng.Shuffle(len(entries), func(i, j int) { entries[i], entries[j] = entries[j], entries[i] })
+		val := int(math.Round(float64(len(entries)) * valSplit))
+
+		for i, entry := range entries {
+			split := "train"
+			switch {
+			case entry.Split != "":
+				split = entry.Split
+			case i < val:
+				split = "val"
+			}
+			if split == "test" && data.Test == "" {
+				data.Test = "images/test"
+				for _, sub := range []string{"images/test", "labels/test"} {
+					if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(sub)), 0755); err != nil {
+						return 0, fmt.Errorf("failed to create %s: %w", sub, err)
+					}
+				}
+			}
+			// Images of different classes may share a name, so with several
+			// classes each is prefixed with its class.
+			name := filepath.Base(entry.Path)
+			if class.prefix != "" {
+				name = class.prefix + "_" + name
+			}
+			src := filepath.Join(class.outputDir, filepath.FromSlash(entry.Path))
+			if err := copyFile(src, filepath.Join(dir, "images", split, name)); err != nil {
+				return 0, fmt.Errorf("failed to copy %s: %w", entry.Path, err)
+			}
+			// A label file left by an earlier export may hold annotations
+			// already, so only missing ones are created.
+			label := filepath.Join(dir, "labels", split, strings.TrimSuffix(name, filepath.Ext(name))+".txt")
+			stub, err := os.OpenFile(label, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+			switch {
+			case err == nil:
+				stub.Close()
+			case !os.IsExist(err):
+				return 0, fmt.Errorf("failed to write %s: %w", label, err)
+			}
+			exported++
+		}
+	}
+
+	encoded, err := yaml.Marshal(data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode data.yaml: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "data.yaml"), encoded, 0644); err != nil {
+		return 0, fmt.Errorf("failed to write data.yaml: %w", err)
+	}
+	return exported, nil
+}